@@ -2,23 +2,25 @@ module github.com/aaronlippold/go-split
 
 go 1.23.0
 
-require github.com/anthropics/anthropic-sdk-go v1.19.0
+require (
+	github.com/anthropics/anthropic-sdk-go v1.19.0
+	github.com/briandowns/spinner v1.23.2
+	github.com/drewstinnett/gout/v2 v2.3.0
+	github.com/fatih/color v1.7.0
+	github.com/spf13/cobra v1.10.2
+	golang.org/x/term v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/briandowns/spinner v1.23.2 // indirect
 	github.com/drewstinnett/gout-cobra v0.2.0 // indirect
-	github.com/drewstinnett/gout/v2 v2.3.0 // indirect
-	github.com/fatih/color v1.7.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.2 // indirect
 	github.com/mattn/go-isatty v0.0.8 // indirect
-	github.com/spf13/cobra v1.10.2 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	github.com/tidwall/gjson v1.18.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
 	golang.org/x/sys v0.34.0 // indirect
-	golang.org/x/term v0.1.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -2,11 +2,18 @@
 package analyzer
 
 import (
+	"bytes"
 	"go/ast"
+	"go/build/constraint"
+	"go/doc"
 	"go/parser"
 	"go/token"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // FileInfo contains parsed information about a Go source file.
@@ -18,14 +25,49 @@ type FileInfo struct {
 	Types     []TypeInfo
 	Vars      []VarInfo
 	Lines     int
+	CodeLines int  // Lines without blank and comment-only ones
+	InitFuncs int  // init functions; a file may declare several
+	CgoUsed   bool // imports "C": the cgo preamble is tied to this file
+	// BuildTags holds the build constraint lines above the package clause
+	// as written: "//go:build linux" and any legacy "// +build" lines.
+	BuildTags []string
+	// Calls maps each function and method ("Type.Method") that calls
+	// others declared in the file to those it calls; see CallGraph.
+	Calls map[string][]string
+	// ImportUses maps each function and method ("Type.Method") that uses
+	// imports to their paths; see ImportsUsedBy.
+	ImportUses map[string][]string
 }
 
 // FuncInfo describes a function or method.
 type FuncInfo struct {
-	Name     string
-	Receiver string // empty for functions, type name for methods
-	Line     int
-	EndLine  int
+	Name         string
+	Receiver     string // receiver type as written ("*Cache[K, V]"), empty for functions
+	ReceiverName string // receiver identifier ("s" in "func (s *T)"), empty if unnamed
+	Line         int
+	DocLine      int // first line of the doc comment, Line if undocumented
+	EndLine      int
+	Doc          string // full doc comment text, empty if undocumented
+	Complexity   int    // cyclomatic complexity: 1 + branch points in the body, 0 without one
+	Exported     bool   // the name is exported, whatever the receiver type
+	IsInit       bool   // a package init function
+	// Directives holds the directive comments above the function
+	// ("//nolint:dupl // reason", "//go:noinline"), which Doc omits.
+	Directives []string
+}
+
+// ReceiverType returns the name of the type fn is a method of, without the
+// pointer or type arguments of its receiver ("Cache" for "*Cache[K, V]"),
+// or "" for functions.
+func (fn FuncInfo) ReceiverType() string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(fn.Receiver, "*"), "[")
+	return name
+}
+
+// DocSummary returns the first sentence of a doc comment, joined onto one
+// line as go doc lists it, or "" for none.
+func DocSummary(text string) string {
+	return new(doc.Package).Synopsis(text)
 }
 
 // TypeInfo describes a type declaration.
@@ -33,7 +75,20 @@ type TypeInfo struct {
 	Name    string
 	Kind    string // struct, interface, alias
 	Line    int
+	DocLine int // first line of the doc comment, Line if undocumented
 	EndLine int
+	Doc     string // full doc comment text, empty if undocumented
+	// TotalLines is the type's footprint: its declaration plus every
+	// method declared on it in the file.
+	TotalLines int
+	// Directives holds the directive comments above the type, like
+	// FuncInfo.Directives.
+	Directives []string
+	// TypeParams holds the type parameter names of a generic type ("K",
+	// "V" for Cache[K comparable, V any]), nil otherwise.
+	TypeParams []string
+	// Exported reports whether the type's name is exported.
+	Exported bool
 }
 
 // VarInfo describes a variable or constant declaration.
@@ -41,6 +96,11 @@ type VarInfo struct {
 	Name  string
 	IsVar bool // true for var, false for const
 	Line  int
+	// DependsOn lists the file's other top-level vars, consts and funcs
+	// referenced by the initializer, in order of first use.
+	DependsOn []string
+	// Exported reports whether the name is exported.
+	Exported bool
 }
 
 // CountLines returns the number of lines in the content.
@@ -53,13 +113,71 @@ func CountLines(content string) int {
 	return strings.Count(content, "\n") + 1
 }
 
+// utf8BOM is the UTF-8 encoding of U+FEFF, which some editors write at the
+// start of a file.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// NormalizeSource strips a leading UTF-8 byte order mark and converts CRLF
+// line endings to LF. It returns the normalized content and a description
+// of each change made, nil if content was already normalized.
+func NormalizeSource(content []byte) ([]byte, []string) {
+	var changes []string
+	if bytes.HasPrefix(content, utf8BOM) {
+		content = content[len(utf8BOM):]
+		changes = append(changes, "stripped byte order mark")
+	}
+	if bytes.Contains(content, []byte("\r\n")) {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		changes = append(changes, "converted CRLF line endings")
+	}
+	return content, changes
+}
+
+// AssumePackage puts a "package name;" clause in front of content if it has
+// none, so that a fragment such as a partial editor buffer can be parsed.
+// The clause shares the first line with the fragment, keeping line numbers
+// as they were. It reports whether the clause was added.
+func AssumePackage(content []byte, name string) ([]byte, bool) {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", content, parser.PackageClauseOnly); err == nil {
+		return content, false
+	}
+	return append([]byte("package "+name+"; "), content...), true
+}
+
 // ParseGoFile parses a Go source file and returns information about its contents.
 func ParseGoFile(path string) (*FileInfo, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	return ParseGoSource(path, content)
+}
 
+// ParsePackage parses every non-test Go file in dir, in name order.
+func ParsePackage(dir string) ([]*FileInfo, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	var infos []*FileInfo
+	for _, m := range matches {
+		if strings.HasSuffix(m, "_test.go") {
+			continue
+		}
+		info, err := ParseGoFile(m)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ParseGoSource parses Go source already in memory. path is used for
+// positions and FileInfo.Path only; nothing is read from disk.
+func ParseGoSource(path string, content []byte) (*FileInfo, error) {
 	fset := token.NewFileSet()
 	file, err := parser.ParseFile(fset, path, content, parser.ParseComments)
 	if err != nil {
@@ -67,28 +185,48 @@ func ParseGoFile(path string) (*FileInfo, error) {
 	}
 
 	info := &FileInfo{
-		Path:    path,
-		Package: file.Name.Name,
-		Lines:   CountLines(string(content)),
+		Path:      path,
+		Package:   file.Name.Name,
+		Lines:     CountLines(string(content)),
+		CodeLines: CountCodeLines(string(content)),
 	}
 
 	// Extract imports
 	for _, imp := range file.Imports {
 		path := strings.Trim(imp.Path.Value, `"`)
 		info.Imports = append(info.Imports, path)
+		if path == "C" {
+			info.CgoUsed = true
+		}
 	}
 
-	// Walk the AST to extract declarations
-	ast.Inspect(file, func(n ast.Node) bool {
-		switch decl := n.(type) {
+	// Walk top-level declarations only; locals inside function bodies are not
+	// part of the file's surface.
+	for _, d := range file.Decls {
+		switch decl := d.(type) {
 		case *ast.FuncDecl:
 			fn := FuncInfo{
-				Name:    decl.Name.Name,
-				Line:    fset.Position(decl.Pos()).Line,
-				EndLine: fset.Position(decl.End()).Line,
+				Name:     decl.Name.Name,
+				Line:     fset.Position(decl.Pos()).Line,
+				EndLine:  fset.Position(decl.End()).Line,
+				Doc:      decl.Doc.Text(),
+				Exported: decl.Name.IsExported(),
+			}
+			fn.DocLine = fn.Line
+			if decl.Doc != nil {
+				fn.DocLine = fset.Position(decl.Doc.Pos()).Line
+			}
+			fn.Directives = directives(decl.Doc)
+			fn.Complexity = complexity(decl)
+			if decl.Recv == nil && decl.Name.Name == "init" {
+				fn.IsInit = true
+				info.InitFuncs++
 			}
 			if decl.Recv != nil && len(decl.Recv.List) > 0 {
 				fn.Receiver = exprToString(decl.Recv.List[0].Type)
+				if names := decl.Recv.List[0].Names; len(names) > 0 {
+					fn.ReceiverName = names[0].Name
+				}
 			}
 			info.Functions = append(info.Functions, fn)
 
@@ -97,9 +235,31 @@ func ParseGoFile(path string) (*FileInfo, error) {
 				switch s := spec.(type) {
 				case *ast.TypeSpec:
 					ti := TypeInfo{
-						Name:    s.Name.Name,
-						Line:    fset.Position(s.Pos()).Line,
-						EndLine: fset.Position(s.End()).Line,
+						Name:     s.Name.Name,
+						Line:     fset.Position(s.Pos()).Line,
+						EndLine:  fset.Position(s.End()).Line,
+						Doc:      s.Doc.Text(),
+						Exported: s.Name.IsExported(),
+					}
+					ti.DocLine = ti.Line
+					if s.Doc != nil {
+						ti.DocLine = fset.Position(s.Doc.Pos()).Line
+					}
+					ti.Directives = directives(s.Doc)
+					if s.TypeParams != nil {
+						for _, field := range s.TypeParams.List {
+							for _, n := range field.Names {
+								ti.TypeParams = append(ti.TypeParams, n.Name)
+							}
+						}
+					}
+					// An unparenthesized "type X ..." carries its doc on the GenDecl
+					if s.Doc == nil && !decl.Lparen.IsValid() {
+						ti.Doc = decl.Doc.Text()
+						if decl.Doc != nil {
+							ti.DocLine = fset.Position(decl.Doc.Pos()).Line
+						}
+						ti.Directives = directives(decl.Doc)
 					}
 					switch s.Type.(type) {
 					case *ast.StructType:
@@ -112,20 +272,249 @@ func ParseGoFile(path string) (*FileInfo, error) {
 					info.Types = append(info.Types, ti)
 
 				case *ast.ValueSpec:
+					deps := initDependencies(s, file)
 					for _, name := range s.Names {
 						info.Vars = append(info.Vars, VarInfo{
-							Name:  name.Name,
-							IsVar: decl.Tok == token.VAR,
-							Line:  fset.Position(s.Pos()).Line,
+							Name:      name.Name,
+							IsVar:     decl.Tok == token.VAR,
+							Line:      fset.Position(s.Pos()).Line,
+							DependsOn: deps,
+							Exported:  name.IsExported(),
 						})
 					}
 				}
 			}
 		}
+	}
+
+	for i := range info.Types {
+		t := &info.Types[i]
+		t.TotalLines = t.EndLine - t.Line + 1
+		for _, fn := range info.Functions {
+			if fn.ReceiverType() == t.Name {
+				t.TotalLines += fn.EndLine - fn.Line + 1
+			}
+		}
+	}
+
+	info.BuildTags = buildConstraints(file)
+	info.Calls = fileCalls(file)
+	info.ImportUses = fileImportUses(file)
+	return info, nil
+}
+
+// BuildConstraints returns the build constraint lines of the Go source src
+// as FileInfo.BuildTags holds them, without parsing past the package clause.
+func BuildConstraints(src []byte) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return buildConstraints(file), nil
+}
+
+// buildConstraints returns the //go:build and // +build lines that precede
+// the package clause of file.
+func buildConstraints(file *ast.File) []string {
+	var lines []string
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if constraint.IsGoBuild(c.Text) || constraint.IsPlusBuild(c.Text) {
+				lines = append(lines, c.Text)
+			}
+		}
+	}
+	return lines
+}
+
+// IsDirective reports whether comment (as written, with its slashes) is a
+// directive for a tool rather than documentation: "//nolint", cgo's
+// "//export Name", or the "//tool:arg" form of //go:generate, //lint:ignore
+// and the like.
+func IsDirective(comment string) bool {
+	text, ok := strings.CutPrefix(comment, "//")
+	if !ok {
+		return false
+	}
+	if text == "nolint" || strings.HasPrefix(text, "nolint:") || strings.HasPrefix(text, "nolint ") {
+		return true
+	}
+	if strings.HasPrefix(text, "export ") {
+		return true
+	}
+	tool, arg, ok := strings.Cut(text, ":")
+	return ok && tool != "" && arg != "" && isDirectiveWord(tool) && isDirectiveWord(arg[:1])
+}
+
+// isDirectiveWord reports whether s is made of lowercase letters and digits.
+func isDirectiveWord(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// directives returns the directive comments in doc, as written.
+func directives(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var out []string
+	for _, c := range doc.List {
+		if IsDirective(c.Text) {
+			out = append(out, c.Text)
+		}
+	}
+	return out
+}
+
+// initDependencies returns the top-level declarations of file that spec's
+// initializer refers to.
+func initDependencies(spec *ast.ValueSpec, file *ast.File) []string {
+	var deps []string
+	seen := make(map[string]bool)
+	for _, v := range spec.Values {
+		ast.Inspect(v, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok || id.Obj == nil || seen[id.Name] || file.Scope.Lookup(id.Name) != id.Obj {
+				return true
+			}
+			if k := id.Obj.Kind; k == ast.Var || k == ast.Con || k == ast.Fun {
+				seen[id.Name] = true
+				deps = append(deps, id.Name)
+			}
+			return true
+		})
+	}
+	return deps
+}
+
+// complexity returns the cyclomatic complexity of fn: one plus the number
+// of if, for and range statements, non-default case and select clauses, and
+// && and || operators in its body. Function literals count toward the
+// enclosing function. Functions without a body (assembly) have 0.
+func complexity(fn *ast.FuncDecl) int {
+	if fn.Body == nil {
+		return 0
+	}
+	n := 1
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch x := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			n++
+		case *ast.CaseClause:
+			if x.List != nil {
+				n++
+			}
+		case *ast.CommClause:
+			if x.Comm != nil {
+				n++
+			}
+		case *ast.BinaryExpr:
+			if x.Op == token.LAND || x.Op == token.LOR {
+				n++
+			}
+		}
 		return true
 	})
+	return n
+}
 
-	return info, nil
+// Test function kinds returned by ClassifyTestFunc.
+const (
+	KindTest      = "test"
+	KindBenchmark = "benchmark"
+	KindExample   = "example"
+	KindFuzz      = "fuzz"
+	KindTestMain  = "testmain"
+)
+
+// ClassifyTestFunc reports which kind of go test function fn is, or ""
+// for ordinary functions and methods. As with go test, a prefix only counts
+// when followed by the end of the name or a non-lowercase character.
+func ClassifyTestFunc(fn FuncInfo) string {
+	if fn.Receiver != "" {
+		return ""
+	}
+	if fn.Name == "TestMain" {
+		return KindTestMain
+	}
+	for _, p := range []struct{ prefix, kind string }{
+		{"Test", KindTest},
+		{"Benchmark", KindBenchmark},
+		{"Example", KindExample},
+		{"Fuzz", KindFuzz},
+	} {
+		if hasTestPrefix(fn.Name, p.prefix) {
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// TestSubject returns the symbol a test function exercises by convention:
+// "BenchmarkParse" → "Parse", "TestClient_Call" → "Client.Call". It returns
+// "" for names that are not test functions or have no subject.
+func TestSubject(name string) string {
+	for _, prefix := range []string{"Test", "Benchmark", "Example", "Fuzz"} {
+		if hasTestPrefix(name, prefix) {
+			subject := strings.TrimPrefix(strings.TrimPrefix(name, prefix), "_")
+			return strings.Replace(subject, "_", ".", 1)
+		}
+	}
+	return ""
+}
+
+func hasTestPrefix(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// Symbol identifies a top-level declaration.
+type Symbol struct {
+	Name    string // "Type.Method" for methods
+	Kind    string // func, method, type, var, const
+	Line    int
+	EndLine int
+}
+
+// Symbols returns every named top-level declaration in the file, in
+// functions, types, vars order. Blank identifiers are skipped.
+func (f *FileInfo) Symbols() []Symbol {
+	var syms []Symbol
+	for _, fn := range f.Functions {
+		sym := Symbol{Name: fn.Name, Kind: "func", Line: fn.Line, EndLine: fn.EndLine}
+		if fn.Receiver != "" {
+			sym.Name = fn.ReceiverType() + "." + fn.Name
+			sym.Kind = "method"
+		}
+		syms = append(syms, sym)
+	}
+	for _, t := range f.Types {
+		syms = append(syms, Symbol{Name: t.Name, Kind: "type", Line: t.Line, EndLine: t.EndLine})
+	}
+	for _, v := range f.Vars {
+		if v.Name == "_" {
+			continue
+		}
+		kind := "const"
+		if v.IsVar {
+			kind = "var"
+		}
+		syms = append(syms, Symbol{Name: v.Name, Kind: kind, Line: v.Line, EndLine: v.Line})
+	}
+	return syms
 }
 
 // exprToString converts a type expression to a string representation.
@@ -135,6 +524,32 @@ func exprToString(expr ast.Expr) string {
 		return t.Name
 	case *ast.StarExpr:
 		return "*" + exprToString(t.X)
+	case *ast.ParenExpr:
+		return exprToString(t.X)
+	case *ast.IndexExpr:
+		return exprToString(t.X) + "[" + exprToString(t.Index) + "]"
+	case *ast.IndexListExpr:
+		args := make([]string, len(t.Indices))
+		for i, index := range t.Indices {
+			args[i] = exprToString(index)
+		}
+		return exprToString(t.X) + "[" + strings.Join(args, ", ") + "]"
+	case *ast.SelectorExpr:
+		return exprToString(t.X) + "." + t.Sel.Name
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "[]" + exprToString(t.Elt)
+		}
+		return "[" + exprToString(t.Len) + "]" + exprToString(t.Elt)
+	case *ast.BasicLit: // Array length
+		return t.Value
+	case *ast.MapType:
+		return "map[" + exprToString(t.Key) + "]" + exprToString(t.Value)
+	case *ast.InterfaceType:
+		if t.Methods == nil || len(t.Methods.List) == 0 {
+			return "interface{}"
+		}
+		return "interface{...}"
 	default:
 		return ""
 	}
@@ -1,8 +1,13 @@
 package analyzer_test
 
 import (
+	"go/parser"
+	"go/token"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/aaronlippold/go-split/internal/analyzer"
@@ -30,6 +35,47 @@ func TestCountLines(t *testing.T) {
 	}
 }
 
+func TestNormalizeSource(t *testing.T) {
+	src := "\xEF\xBB\xBFpackage main\r\n\r\nfunc main() {}\r\n"
+	got, changes := analyzer.NormalizeSource([]byte(src))
+	if string(got) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("NormalizeSource() = %q", got)
+	}
+	if len(changes) != 2 {
+		t.Errorf("changes = %v, want BOM and CRLF", changes)
+	}
+
+	if _, changes := analyzer.NormalizeSource([]byte("package main\n")); changes != nil {
+		t.Errorf("changes = %v for normalized source, want none", changes)
+	}
+}
+
+func TestAssumePackage(t *testing.T) {
+	snippet := "import \"strings\"\n\nfunc Shout(s string) string {\n\treturn strings.ToUpper(undeclared(s))\n}\n"
+	src, added := analyzer.AssumePackage([]byte(snippet), "scratch")
+	if !added {
+		t.Fatal("AssumePackage() did not add a package clause to a snippet")
+	}
+	info, err := analyzer.ParseGoSource("snippet.go", src)
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	if info.Package != "scratch" || len(info.Functions) != 1 {
+		t.Fatalf("package = %q, functions = %d; want scratch and 1", info.Package, len(info.Functions))
+	}
+	if fn := info.Functions[0]; fn.Line != 3 || fn.EndLine != 5 {
+		t.Errorf("Shout at lines %d-%d, want 3-5 as in the snippet", fn.Line, fn.EndLine)
+	}
+	if info.Lines != analyzer.CountLines(snippet) {
+		t.Errorf("lines = %d, want %d", info.Lines, analyzer.CountLines(snippet))
+	}
+
+	full := []byte("package real\n\nfunc F() {}\n")
+	if got, added := analyzer.AssumePackage(full, "scratch"); added || string(got) != string(full) {
+		t.Errorf("AssumePackage() changed a file with a package clause: %q", got)
+	}
+}
+
 func TestParseGoFile(t *testing.T) {
 	// Create a temp file with valid Go code
 	content := `package main
@@ -99,3 +145,900 @@ func TestParseGoFile_NotFound(t *testing.T) {
 		t.Error("ParseGoFile() expected error for nonexistent file")
 	}
 }
+
+func TestParseGoFile_Docs(t *testing.T) {
+	content := `package main
+
+// Documented does things.
+func Documented() {}
+
+func Bare() {}
+
+// Single is a standalone type.
+type Single struct{}
+
+type (
+	// Grouped is declared in a group.
+	Grouped int
+	Plain   int
+)
+
+// Multi spans
+// two lines. It says more.
+func Multi() {}
+`
+	tmpFile := filepath.Join(t.TempDir(), "docs.go")
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+
+	info, err := analyzer.ParseGoFile(tmpFile)
+	if err != nil {
+		t.Fatalf("ParseGoFile() error = %v", err)
+	}
+
+	funcDocs := map[string]string{}
+	for _, fn := range info.Functions {
+		funcDocs[fn.Name] = fn.Doc
+	}
+	if funcDocs["Documented"] != "Documented does things.\n" {
+		t.Errorf("Documented doc = %q", funcDocs["Documented"])
+	}
+	if funcDocs["Bare"] != "" {
+		t.Errorf("Bare doc = %q, want empty", funcDocs["Bare"])
+	}
+	if got := analyzer.DocSummary(funcDocs["Multi"]); got != "Multi spans two lines." {
+		t.Errorf("DocSummary(Multi doc) = %q, want the first sentence", got)
+	}
+	if got := analyzer.DocSummary(funcDocs["Bare"]); got != "" {
+		t.Errorf("DocSummary(\"\") = %q, want empty", got)
+	}
+
+	typeDocs := map[string]string{}
+	for _, ti := range info.Types {
+		typeDocs[ti.Name] = ti.Doc
+	}
+	if typeDocs["Single"] != "Single is a standalone type.\n" {
+		t.Errorf("Single doc = %q", typeDocs["Single"])
+	}
+	if typeDocs["Grouped"] != "Grouped is declared in a group.\n" {
+		t.Errorf("Grouped doc = %q", typeDocs["Grouped"])
+	}
+	if typeDocs["Plain"] != "" {
+		t.Errorf("Plain doc = %q, want empty", typeDocs["Plain"])
+	}
+
+	// Line ranges start at the doc comment
+	docLines := map[string]int{}
+	for _, fn := range info.Functions {
+		docLines[fn.Name] = fn.DocLine
+	}
+	for _, ti := range info.Types {
+		docLines[ti.Name] = ti.DocLine
+	}
+	for name, want := range map[string]int{"Documented": 3, "Bare": 6, "Single": 8, "Grouped": 12, "Plain": 14} {
+		if docLines[name] != want {
+			t.Errorf("%s DocLine = %d, want %d", name, docLines[name], want)
+		}
+	}
+}
+
+func TestClassifyTestFunc(t *testing.T) {
+	tests := []struct {
+		fn   analyzer.FuncInfo
+		want string
+	}{
+		{analyzer.FuncInfo{Name: "TestParse"}, analyzer.KindTest},
+		{analyzer.FuncInfo{Name: "Test"}, analyzer.KindTest},
+		{analyzer.FuncInfo{Name: "Test_parse"}, analyzer.KindTest},
+		{analyzer.FuncInfo{Name: "Testify"}, ""},
+		{analyzer.FuncInfo{Name: "BenchmarkParse"}, analyzer.KindBenchmark},
+		{analyzer.FuncInfo{Name: "ExampleClient_Call"}, analyzer.KindExample},
+		{analyzer.FuncInfo{Name: "FuzzParse"}, analyzer.KindFuzz},
+		{analyzer.FuncInfo{Name: "TestMain"}, analyzer.KindTestMain},
+		{analyzer.FuncInfo{Name: "TestParse", Receiver: "*suite"}, ""},
+		{analyzer.FuncInfo{Name: "helper"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fn.Name, func(t *testing.T) {
+			if got := analyzer.ClassifyTestFunc(tt.fn); got != tt.want {
+				t.Errorf("ClassifyTestFunc(%+v) = %q, want %q", tt.fn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestSubject(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"BenchmarkParse", "Parse"},
+		{"TestClient_Call", "Client.Call"},
+		{"Test_helper", "helper"},
+		{"Testify", ""},
+		{"Parse", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := analyzer.TestSubject(tt.name); got != tt.want {
+				t.Errorf("TestSubject(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePackage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.go":      "package foo\n\nfunc B() {}\n",
+		"a.go":      "package foo\n\ntype A struct{}\n",
+		"a_test.go": "package foo\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {}\n",
+		"notes.txt": "not go",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := analyzer.ParsePackage(dir)
+	if err != nil {
+		t.Fatalf("ParsePackage() error = %v", err)
+	}
+	if len(infos) != 2 || filepath.Base(infos[0].Path) != "a.go" || filepath.Base(infos[1].Path) != "b.go" {
+		t.Fatalf("ParsePackage() = %d files, want a.go and b.go in order", len(infos))
+	}
+	if len(infos[0].Types) != 1 || len(infos[1].Functions) != 1 {
+		t.Errorf("ParsePackage() did not parse declarations: %+v, %+v", infos[0], infos[1])
+	}
+}
+
+func TestParseGoSource_TotalLines(t *testing.T) {
+	src := `package shapes
+
+type Rect struct {
+	W, H int
+}
+
+func (r Rect) Area() int { return r.W * r.H }
+
+func (r *Rect) Scale(f int) {
+	r.W *= f
+	r.H *= f
+}
+
+func (r Rect) String() string {
+	return "rect"
+}
+
+type Empty struct{}
+
+func NewRect() Rect { return Rect{} }
+`
+	info, err := analyzer.ParseGoSource("shapes.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+
+	want := map[string]int{"Rect": 3 + 1 + 4 + 3, "Empty": 1}
+	for _, ti := range info.Types {
+		if ti.TotalLines != want[ti.Name] {
+			t.Errorf("%s TotalLines = %d, want %d", ti.Name, ti.TotalLines, want[ti.Name])
+		}
+	}
+}
+
+func TestParseGoSource_Generics(t *testing.T) {
+	src := `package cache
+
+type Cache[K comparable, V any] struct {
+	items map[K]V
+}
+
+func (c *Cache[K, V]) Get(k K) V { return c.items[k] }
+
+func (c Cache[_, V]) Len() int { return len(c.items) }
+
+type Set[T comparable] map[T]struct{}
+
+func (s Set[T]) Add(v T) { s[v] = struct{}{} }
+
+type Plain struct{}
+`
+	info, err := analyzer.ParseGoSource("cache.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+
+	types := make(map[string]analyzer.TypeInfo)
+	for _, ti := range info.Types {
+		types[ti.Name] = ti
+	}
+	if c := types["Cache"]; c.Kind != "struct" || !slices.Equal(c.TypeParams, []string{"K", "V"}) || c.TotalLines != 3+1+1 {
+		t.Errorf("Cache = %+v, want a struct with type params [K V] and both methods in TotalLines", c)
+	}
+	if s := types["Set"]; !slices.Equal(s.TypeParams, []string{"T"}) || s.TotalLines != 2 {
+		t.Errorf("Set = %+v, want type params [T] and its method in TotalLines", s)
+	}
+	if p := types["Plain"]; p.TypeParams != nil {
+		t.Errorf("Plain.TypeParams = %v, want nil", p.TypeParams)
+	}
+
+	want := map[string]string{"Get": "*Cache[K, V]", "Len": "Cache[_, V]", "Add": "Set[T]"}
+	for _, fn := range info.Functions {
+		if fn.Receiver != want[fn.Name] {
+			t.Errorf("%s receiver = %q, want %q", fn.Name, fn.Receiver, want[fn.Name])
+		}
+	}
+	var methods []string
+	for _, sym := range info.Symbols() {
+		if sym.Kind == "method" {
+			methods = append(methods, sym.Name)
+		}
+	}
+	if got := strings.Join(methods, ","); got != "Cache.Get,Cache.Len,Set.Add" {
+		t.Errorf("methods = %s, want Cache.Get,Cache.Len,Set.Add", got)
+	}
+}
+
+func TestParseGoSource_Complexity(t *testing.T) {
+	src := `package p
+
+func straight() int { return 1 }
+
+func asm(x int) int
+
+func branchy(xs []int, ok bool) int {
+	n := 0
+	for _, x := range xs {
+		if x > 0 && ok {
+			n++
+		}
+	}
+	switch n {
+	case 0:
+		return -1
+	case 1, 2:
+		return 1
+	default:
+		return n
+	}
+}
+`
+	info, err := analyzer.ParseGoSource("p.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+
+	want := map[string]int{"straight": 1, "asm": 0, "branchy": 6}
+	for _, fn := range info.Functions {
+		if fn.Complexity != want[fn.Name] {
+			t.Errorf("%s Complexity = %d, want %d", fn.Name, fn.Complexity, want[fn.Name])
+		}
+	}
+}
+
+func TestParseGoSource_ReceiverExpressions(t *testing.T) {
+	// Only syntax is checked, so receivers Go would reject still parse
+	tests := []struct {
+		recv string
+		want string
+	}{
+		{"Server", "Server"},
+		{"*Server", "*Server"},
+		{"(*Server)", "*Server"},
+		{"*Cache[K]", "*Cache[K]"},
+		{"*Cache[K, V]", "*Cache[K, V]"},
+		{"pkg.Foo", "pkg.Foo"},
+		{"*pkg.Foo", "*pkg.Foo"},
+		{"List[pkg.Item]", "List[pkg.Item]"},
+		{"[]Item", "[]Item"},
+		{"[4]byte", "[4]byte"},
+		{"map[string][]*pkg.Item", "map[string][]*pkg.Item"},
+		{"Set[interface{}]", "Set[interface{}]"},
+		{"Set[interface{ String() string }]", "Set[interface{...}]"},
+	}
+	for _, tt := range tests {
+		src := "package p\n\nfunc (r " + tt.recv + ") M() {}\n"
+		info, err := analyzer.ParseGoSource("p.go", []byte(src))
+		if err != nil {
+			t.Errorf("ParseGoSource(%s) error = %v", tt.recv, err)
+			continue
+		}
+		if got := info.Functions[0].Receiver; got != tt.want {
+			t.Errorf("Receiver of (r %s) = %q, want %q", tt.recv, got, tt.want)
+		}
+	}
+}
+
+func TestParseGoSource_InitFuncs(t *testing.T) {
+	src := `package p
+
+func init() {}
+
+type T struct{}
+
+func (T) init() {}
+
+func init() {}
+
+func helper() {}
+
+func init() {}
+`
+	info, err := analyzer.ParseGoSource("p.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	if info.InitFuncs != 3 {
+		t.Errorf("InitFuncs = %d, want 3", info.InitFuncs)
+	}
+	var marked []int
+	for _, fn := range info.Functions {
+		if fn.IsInit {
+			marked = append(marked, fn.Line)
+		}
+	}
+	// Every init counts, and a method named init is not one
+	if want := []int{3, 9, 13}; !slices.Equal(marked, want) {
+		t.Errorf("IsInit set on lines %v, want %v", marked, want)
+	}
+}
+
+func TestParseGoSource_BuildTags(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"none", "package p\n", nil},
+		{"go:build", "//go:build linux && amd64\n\npackage p\n", []string{"//go:build linux && amd64"}},
+		{"legacy too", "// Copyright 2024.\n\n//go:build linux\n// +build linux\n\n// Package p does things.\npackage p\n", []string{"//go:build linux", "// +build linux"}},
+		{"after package clause", "package p\n\n//go:build linux\nvar x int\n", nil},
+	}
+	for _, tt := range tests {
+		info, err := analyzer.ParseGoSource("p.go", []byte(tt.src))
+		if err != nil {
+			t.Fatalf("%s: ParseGoSource() error = %v", tt.name, err)
+		}
+		if !slices.Equal(info.BuildTags, tt.want) {
+			t.Errorf("%s: BuildTags = %q, want %q", tt.name, info.BuildTags, tt.want)
+		}
+		if lines, err := analyzer.BuildConstraints([]byte(tt.src)); err != nil || !slices.Equal(lines, tt.want) {
+			t.Errorf("%s: BuildConstraints() = %q, %v, want %q", tt.name, lines, err, tt.want)
+		}
+	}
+}
+
+func TestParseGoSource_Exported(t *testing.T) {
+	src := `package p
+
+type cache struct{}
+
+func (c *cache) Get() {}
+
+func (c *cache) evict() {}
+
+type Server struct{}
+
+func (s Server) close() {}
+
+func New() *Server { return nil }
+
+var (
+	Version = "1"
+	debug   = false
+)
+`
+	info, err := analyzer.ParseGoSource("p.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+
+	var exported []string
+	for _, fn := range info.Functions {
+		if fn.Exported {
+			exported = append(exported, fn.Name)
+		}
+	}
+	for _, ti := range info.Types {
+		if ti.Exported {
+			exported = append(exported, ti.Name)
+		}
+	}
+	for _, v := range info.Vars {
+		if v.Exported {
+			exported = append(exported, v.Name)
+		}
+	}
+	// Methods go by their own name, not their receiver's
+	if want := []string{"Get", "New", "Server", "Version"}; !slices.Equal(exported, want) {
+		t.Errorf("exported = %v, want %v", exported, want)
+	}
+}
+
+func TestParseGoSource_Directives(t *testing.T) {
+	src := `package p
+
+// run does things.
+//
+//nolint:gocyclo,funlen // big on purpose
+//go:noinline
+func run() {}
+
+// Plain has a doc comment only.
+// nolint is not a directive with a space.
+type Plain struct{}
+
+//go:generate stringer -type=Kind
+type Kind int
+`
+	info, err := analyzer.ParseGoSource("p.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+
+	if want := []string{"//nolint:gocyclo,funlen // big on purpose", "//go:noinline"}; !slices.Equal(info.Functions[0].Directives, want) {
+		t.Errorf("run Directives = %q, want %q", info.Functions[0].Directives, want)
+	}
+	want := map[string][]string{"Plain": nil, "Kind": {"//go:generate stringer -type=Kind"}}
+	for _, ti := range info.Types {
+		if !slices.Equal(ti.Directives, want[ti.Name]) {
+			t.Errorf("%s Directives = %q, want %q", ti.Name, ti.Directives, want[ti.Name])
+		}
+	}
+
+	for c, want := range map[string]bool{
+		"//nolint": true, "//nolint:dupl": true, "//go:build linux": true, "//lint:ignore SA1019 old": true, "//export Add": true,
+		"// nolint": false, "// TODO: fix": false, "//http://example.com": false, "/* nolint */": false,
+	} {
+		if got := analyzer.IsDirective(c); got != want {
+			t.Errorf("IsDirective(%q) = %v, want %v", c, got, want)
+		}
+	}
+}
+
+func TestParseGoSource_VarDependencies(t *testing.T) {
+	src := `package main
+
+var base = "x"
+
+var derived = join(base, suffix)
+
+const suffix = "!"
+
+var local = func() int { base := 1; return base }()
+
+func join(a, b string) string { return a + b }
+`
+	info, err := analyzer.ParseGoSource("main.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+
+	want := map[string]string{"base": "", "derived": "join,base,suffix", "suffix": "", "local": ""}
+	for _, v := range info.Vars {
+		if got := strings.Join(v.DependsOn, ","); got != want[v.Name] {
+			t.Errorf("%s DependsOn = %q, want %q", v.Name, got, want[v.Name])
+		}
+	}
+}
+
+func TestUnreferenced(t *testing.T) {
+	dir := t.TempDir()
+	src := `package store
+
+const (
+	limit = 10
+	twice = limit * 2
+)
+
+var cache = map[string]int{}
+
+type entry struct{ key string }
+
+func (e entry) unusedMethod() {}
+
+func Get(k string) int { return cache[k] + twice }
+
+func fact(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n * fact(n-1)
+}
+
+func usedByTest() {}
+
+func usedBySibling() entry { return entry{} }
+`
+	files := map[string]string{
+		"store_test.go": "package store\n\nimport \"testing\"\n\nfunc TestX(t *testing.T) { usedByTest() }\n",
+		"other.go":      "package store\n\nvar _ = usedBySibling\n",
+		"ext_test.go":   "package store_test\n\nfunc fact() {}\n\nvar _ = fact\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unused, err := analyzer.Unreferenced(filepath.Join(dir, "store.go"), []byte(src), dir)
+	if err != nil {
+		t.Fatalf("Unreferenced() error = %v", err)
+	}
+	var got []string
+	for _, sym := range unused {
+		got = append(got, sym.Kind+" "+sym.Name)
+	}
+	if want := "func fact"; strings.Join(got, ",") != want {
+		t.Errorf("Unreferenced() = %v, want [%s]", got, want)
+	}
+
+	// Without the package, references from other files are not seen
+	unused, _ = analyzer.Unreferenced("store.go", []byte(src), "")
+	if len(unused) != 3 {
+		t.Errorf("Unreferenced() alone = %+v, want fact, usedByTest and usedBySibling", unused)
+	}
+}
+
+func TestCallGraph(t *testing.T) {
+	src := `package shop
+
+import "strings"
+
+type Cart struct{ items []string }
+
+func NewCart() *Cart { return &Cart{} }
+
+func (c *Cart) Add(item string) {
+	c.items = append(c.items, normalize(item))
+	c.Add("again")
+}
+
+func (c *Cart) Total() int {
+	n := len(c.items)
+	c.Add("x")
+	c.Add("y")
+	return n
+}
+
+type Store struct{ carts []*Cart }
+
+func (s *Store) Checkout() {
+	for _, c := range s.carts {
+		c.Total()
+	}
+	s.Empty()
+}
+
+func (s *Store) Empty() {}
+
+func normalize(s string) string { return strings.TrimSpace(s) }
+
+func main() {
+	cart := NewCart()
+	cart.Add("x")
+	go func() { (normalize)("y") }()
+	strings.ToUpper("z")
+}
+`
+	info, err := analyzer.ParseGoSource("shop.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	want := map[string][]string{
+		"NewCart":        nil,
+		"Cart.Add":       {"normalize"},
+		"Cart.Total":     {"Cart.Add"},
+		"Store.Checkout": {"Cart.Total", "Store.Empty"},
+		"Store.Empty":    nil,
+		"normalize":      nil,
+		"main":           {"NewCart", "Cart.Add", "normalize"},
+	}
+	if graph := analyzer.CallGraph(info); !reflect.DeepEqual(graph, want) {
+		t.Errorf("CallGraph() =\n%v\nwant\n%v", graph, want)
+	}
+	// Calls leaves out the functions that call nothing in the file
+	if len(info.Calls) != 4 || info.Calls["NewCart"] != nil {
+		t.Errorf("Calls = %v, want the 4 callers", info.Calls)
+	}
+}
+
+func TestParseGoSource_EmptyReceiver(t *testing.T) {
+	// The parser accepts an empty receiver list; analysis must not panic on it
+	src := "package p\n\nimport \"fmt\"\n\nfunc () M() { fmt.Println() }\n\nfunc F() { M() }\n"
+	info, err := analyzer.ParseGoSource("r.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	if len(info.Functions) != 2 || info.Functions[0].Receiver != "" {
+		t.Errorf("functions = %+v, want M without a receiver and F", info.Functions)
+	}
+	if len(info.ImportUses) != 0 {
+		t.Errorf("import uses = %v, want none recorded for M", info.ImportUses)
+	}
+}
+
+func TestImportsUsedBy(t *testing.T) {
+	src := `package shop
+
+import (
+	"fmt"
+	"io"
+	str "strings"
+	_ "embed"
+	. "math"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Cart struct{ w io.Writer }
+
+func (c *Cart) Print(items []string) {
+	fmt.Fprintln(c.w, str.Join(items, ", "))
+}
+
+func Load(data []byte) (v map[string]any, err error) {
+	err = yaml.Unmarshal(data, &v)
+	return v, err
+}
+
+func Area(r float64) float64 { return Pi * r * r }
+
+func Local() string {
+	fmt := Cart{}
+	_ = fmt.w
+	return str.ToUpper("x")
+}
+
+func pure(n int) int { return n + len([]int{}) }
+`
+	info, err := analyzer.ParseGoSource("shop.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	for name, want := range map[string][]string{
+		"Cart.Print": {"fmt", "strings"}, // io is in the type, not the method
+		"Load":       {"gopkg.in/yaml.v3"},
+		"Area":       {"math"},
+		"Local":      {"strings"}, // fmt is shadowed
+		"pure":       nil,
+		"Missing":    nil,
+	} {
+		if got := analyzer.ImportsUsedBy(info, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("ImportsUsedBy(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDeclImports(t *testing.T) {
+	src := `package shop
+
+import (
+	"io"
+	"time"
+)
+
+type Cart struct {
+	w       io.Writer
+	created time.Time
+}
+
+var timeout = 5 * time.Second
+
+const name = "cart"
+`
+	file, err := parser.ParseFile(token.NewFileSet(), "shop.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{nil, {"io", "time"}, {"time"}, nil} // the import block first
+	for i, d := range file.Decls {
+		if got := analyzer.DeclImports(file, d); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("DeclImports(decl %d) = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestImportName(t *testing.T) {
+	for path, want := range map[string]string{
+		"fmt":                        "fmt",
+		"net/http":                   "http",
+		"github.com/x/y/v2":          "y",
+		"gopkg.in/yaml.v3":           "yaml",
+		"github.com/mattn/go-isatty": "isatty",
+	} {
+		if got := analyzer.ImportName(path); got != want {
+			t.Errorf("ImportName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	src := `// Package shop sells things.
+package shop
+
+/*
+Block comment
+*/
+
+const url = "http://example.com" // Not a comment inside the string
+
+func Total( /* inline */ n int) int {
+
+	// Doubled
+	return n * 2
+}
+`
+	stripped, stats := analyzer.StripComments([]byte(src))
+	want := `package shop
+const url = "http://example.com"
+func Total(   n int) int {
+	return n * 2
+}
+`
+	if string(stripped) != want {
+		t.Errorf("StripComments() =\n%s\nwant\n%s", stripped, want)
+	}
+	if wantStats := (analyzer.LineStats{Code: 5, Comment: 5, Blank: 4}); stats != wantStats {
+		t.Errorf("StripComments() stats = %+v, want %+v", stats, wantStats)
+	}
+
+	if got := analyzer.CountCodeLines(src); got != 5 {
+		t.Errorf("CountCodeLines() = %d, want 5", got)
+	}
+	info, err := analyzer.ParseGoSource("shop.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	if info.Lines != 15 || info.CodeLines != 5 {
+		t.Errorf("Lines = %d, CodeLines = %d, want 15 and 5", info.Lines, info.CodeLines)
+	}
+}
+
+func TestCrossFileReferences(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go": "package p\n\ntype Store struct{}\n\nfunc helper() int { return limit }\n",
+		"b.go": "package p\n\nconst limit = 3\n\nfunc (s Store) Get() int { return helper() + limit }\n",
+		"c.go": "package p\n\nfunc self() int { return local }\n\nvar local = 1\n",
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// a.go uses limit; b.go uses Store and helper; c.go only itself
+	got, err := analyzer.CrossFileReferences(paths)
+	if err != nil {
+		t.Fatalf("CrossFileReferences() error = %v", err)
+	}
+	if got != 3 {
+		t.Errorf("CrossFileReferences() = %d, want 3", got)
+	}
+}
+
+func TestCallGraph_VersionedImport(t *testing.T) {
+	src := `package conf
+
+import "gopkg.in/yaml.v3"
+
+type Doc struct{}
+
+func (d Doc) Marshal() ([]byte, error) { return nil, nil }
+
+func Save(v any) ([]byte, error) { return yaml.Marshal(v) }
+`
+	info, err := analyzer.ParseGoSource("conf.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := analyzer.CallGraph(info)["Save"]; calls != nil {
+		t.Errorf("Save calls %v, want none: yaml.Marshal is in another package", calls)
+	}
+
+	// The package qualifier is dropped from bodies whatever the import path
+	bodies, err := analyzer.FuncBodies("conf.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(bodies["Save"], "yaml") {
+		t.Errorf("Save body = %q, want the yaml qualifier dropped", bodies["Save"])
+	}
+}
+
+func TestFuncBodies(t *testing.T) {
+	orig := `package store
+
+import "strings"
+
+func init() {}
+
+func (s *Store) Keys() []string {
+	keys := []string{
+		"a",
+		"b", // second
+	}
+	return keys
+}
+
+func Clean(s string) string { return strings.TrimSpace(s) }
+
+func Count() int { return 1 }
+`
+	moved := `package api
+
+import (
+	str "strings"
+
+	"example.com/store"
+)
+
+// Keys lists the keys.
+func (s *Store) Keys() []string {
+	keys := []string{"a", "b"}
+
+	return keys
+}
+
+func Clean(s string) string {
+	return str.TrimSpace(s)
+}
+
+func Count() int { return store.Limit }
+`
+	want, err := analyzer.FuncBodies("store.go", []byte(orig))
+	if err != nil {
+		t.Fatalf("FuncBodies() error = %v", err)
+	}
+	got, err := analyzer.FuncBodies("api.go", []byte(moved))
+	if err != nil {
+		t.Fatalf("FuncBodies() error = %v", err)
+	}
+
+	if _, ok := want["init"]; ok {
+		t.Error("FuncBodies() included init")
+	}
+	for name, same := range map[string]bool{"Store.Keys": true, "Clean": true, "Count": false} {
+		if (got[name] == want[name]) != same {
+			t.Errorf("%s: bodies %q and %q, want equal = %v", name, want[name], got[name], same)
+		}
+	}
+}
+
+func TestParseGoSource_Cgo(t *testing.T) {
+	src := `package native
+
+// #include <stdlib.h>
+import "C"
+
+//export Add
+func Add(a, b C.int) C.int { return a + b }
+`
+	info, err := analyzer.ParseGoSource("native.go", []byte(src))
+	if err != nil {
+		t.Fatalf("ParseGoSource() error = %v", err)
+	}
+	if !info.CgoUsed {
+		t.Error("CgoUsed = false for a file importing \"C\"")
+	}
+	if want := []string{"//export Add"}; !slices.Equal(info.Functions[0].Directives, want) {
+		t.Errorf("Add Directives = %q, want %q", info.Functions[0].Directives, want)
+	}
+
+	plain, err := analyzer.ParseGoSource("p.go", []byte("package p\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.CgoUsed {
+		t.Error("CgoUsed = true for a file without import \"C\"")
+	}
+}
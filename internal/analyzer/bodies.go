@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// FuncBodies returns the body of each function and method declared in src,
+// keyed by symbol name as in Symbols ("Type.Method" for methods). A body is
+// reduced to its tokens, without comments, layout or the qualifiers of
+// imported packages ("strings.TrimSpace" becomes "TrimSpace"), so that two
+// bodies compare equal when a split only reformatted them or changed the
+// package a name is reached through. init functions are left out since a
+// file may declare several.
+func FuncBodies(filename string, src []byte) (map[string]string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make(map[string]bool)
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := ImportName(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imported[name] = true
+	}
+
+	bodies := make(map[string]string)
+	for _, d := range file.Decls {
+		decl, ok := d.(*ast.FuncDecl)
+		if !ok || decl.Body == nil || (decl.Recv == nil && decl.Name.Name == "init") {
+			continue
+		}
+		name := decl.Name.Name
+		if decl.Recv != nil && len(decl.Recv.List) > 0 {
+			name = strings.TrimPrefix(exprToString(decl.Recv.List[0].Type), "*") + "." + name
+		}
+		start := fset.Position(decl.Body.Pos()).Offset
+		end := fset.Position(decl.Body.End()).Offset
+		bodies[name] = bodyTokens(src[start:end], imported)
+	}
+	return bodies, nil
+}
+
+// bodyTokens joins the tokens of body with spaces, dropping semicolons,
+// trailing commas and the qualifiers of the packages in imported.
+func bodyTokens(body []byte, imported map[string]bool) string {
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", -1, len(body)), body, nil, 0)
+
+	var toks []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		switch {
+		case tok == token.SEMICOLON:
+			continue
+		case tok == token.RBRACE || tok == token.RPAREN || tok == token.RBRACK:
+			if n := len(toks); n > 0 && toks[n-1] == "," {
+				toks = toks[:n-1]
+			}
+		case tok == token.PERIOD:
+			if n := len(toks); n > 0 && imported[toks[n-1]] {
+				toks = toks[:n-1]
+				continue
+			}
+		}
+		toks = append(toks, lit)
+	}
+	return strings.Join(toks, " ")
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"go/ast"
+	"slices"
+	"strconv"
+)
+
+// CallGraph returns the call graph of the file: every function and method
+// of info, named as in Symbols ("Type.Method" for methods), mapped to the
+// ones it calls as recorded in info.Calls, nil if it calls none.
+func CallGraph(info *FileInfo) map[string][]string {
+	graph := make(map[string][]string, len(info.Functions))
+	for _, fn := range info.Functions {
+		name := fn.Name
+		if fn.Receiver != "" {
+			name = fn.ReceiverType() + "." + fn.Name
+		}
+		graph[name] = slices.Clone(info.Calls[name])
+	}
+	return graph
+}
+
+// fileCalls returns the calls the functions and methods declared in file
+// make to each other, keyed by caller, each callee once in the order they
+// are found. Calls are resolved by name: f() is a call to the function f,
+// recv.M() inside a method to the receiver type's method M, and x.M() to M
+// when a single type in the file declares it. Recursive calls are left out,
+// as are calls to anything declared elsewhere.
+func fileCalls(file *ast.File) map[string][]string {
+	imported := make(map[string]bool)
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := ImportName(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imported[name] = true
+	}
+
+	funcs := make(map[string]bool)
+	methods := make(map[string][]string) // method name -> receiver types
+	for _, d := range file.Decls {
+		decl, ok := d.(*ast.FuncDecl)
+		if !ok || emptyReceiver(decl) {
+			continue
+		}
+		if decl.Recv == nil {
+			funcs[decl.Name.Name] = true
+			continue
+		}
+		methods[decl.Name.Name] = append(methods[decl.Name.Name], receiverType(decl))
+	}
+
+	calls := make(map[string][]string)
+	for _, d := range file.Decls {
+		decl, ok := d.(*ast.FuncDecl)
+		if !ok || decl.Body == nil || emptyReceiver(decl) {
+			continue
+		}
+		caller, recvName, recvType := decl.Name.Name, "", ""
+		if decl.Recv != nil {
+			recvType = receiverType(decl)
+			caller = recvType + "." + caller
+			if names := decl.Recv.List[0].Names; len(names) > 0 {
+				recvName = names[0].Name
+			}
+		}
+
+		ast.Inspect(decl.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			var callee string
+			switch fn := ast.Unparen(call.Fun).(type) {
+			case *ast.Ident:
+				if funcs[fn.Name] {
+					callee = fn.Name
+				}
+			case *ast.IndexExpr: // Explicit instantiation: f[int]()
+				if id, ok := fn.X.(*ast.Ident); ok && funcs[id.Name] {
+					callee = id.Name
+				}
+			case *ast.SelectorExpr:
+				x, ok := fn.X.(*ast.Ident)
+				switch {
+				case ok && recvName != "" && x.Name == recvName:
+					for _, t := range methods[fn.Sel.Name] {
+						if t == recvType {
+							callee = t + "." + fn.Sel.Name
+						}
+					}
+				case ok && imported[x.Name]:
+					// A function of another package
+				case len(methods[fn.Sel.Name]) == 1:
+					callee = methods[fn.Sel.Name][0] + "." + fn.Sel.Name
+				}
+			}
+			if callee != "" && callee != caller && !slices.Contains(calls[caller], callee) {
+				calls[caller] = append(calls[caller], callee)
+			}
+			return true
+		})
+	}
+	return calls
+}
+
+// receiverType returns the base type name of a method's receiver: "Cache"
+// for "*Cache[K, V]", or "" for an empty receiver list.
+func receiverType(decl *ast.FuncDecl) string {
+	if emptyReceiver(decl) {
+		return ""
+	}
+	return FuncInfo{Receiver: exprToString(decl.Recv.List[0].Type)}.ReceiverType()
+}
+
+// emptyReceiver reports whether decl has receiver parentheses with nothing
+// in them, "func () M()", which the parser accepts and the type checker
+// does not. Calls to and from such a declaration are not resolved.
+func emptyReceiver(decl *ast.FuncDecl) bool {
+	return decl.Recv != nil && len(decl.Recv.List) == 0
+}
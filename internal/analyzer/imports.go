@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/types"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ImportsUsedBy returns the paths of the imports the function or method
+// funcName (named as in Symbols, "Type.Method" for methods) refers to, in
+// the order the file imports them, as recorded in info.ImportUses. It is
+// nil for a function that uses no import or that the file doesn't declare.
+func ImportsUsedBy(info *FileInfo, funcName string) []string {
+	return slices.Clone(info.ImportUses[funcName])
+}
+
+// fileImportUses returns the imports each function and method declared in
+// file refers to, as reported by DeclImports, keyed as in Symbols.
+func fileImportUses(file *ast.File) map[string][]string {
+	if len(file.Imports) == 0 {
+		return nil
+	}
+	uses := make(map[string][]string)
+	for _, d := range file.Decls {
+		decl, ok := d.(*ast.FuncDecl)
+		if !ok || emptyReceiver(decl) {
+			continue
+		}
+		name := decl.Name.Name
+		if decl.Recv != nil {
+			name = receiverType(decl) + "." + name
+		}
+		for _, p := range DeclImports(file, decl) {
+			if !slices.Contains(uses[name], p) {
+				uses[name] = append(uses[name], p)
+			}
+		}
+	}
+	return uses
+}
+
+// DeclImports returns the paths of the imports decl, a top-level
+// declaration of file, refers to, in the order the file imports them; for
+// a function that includes its signature. An import is used where its
+// local name (the alias, or ImportName of the path) qualifies a selector
+// that doesn't resolve to a local object. Without type information a dot
+// import can't be told apart from the rest of the package, so it counts as
+// used by a declaration that names something neither declared in the file
+// nor predeclared. Blank imports are used by the package, not by a
+// declaration, and never appear.
+func DeclImports(file *ast.File, decl ast.Decl) []string {
+	var paths []string
+	local := make(map[string]string) // local name -> path
+	var dot []string
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := ImportName(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		switch name {
+		case "_":
+			continue
+		case ".":
+			dot = append(dot, p)
+		default:
+			local[name] = p
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	skip := make(map[*ast.Ident]bool) // Names that are not references
+	if fn, ok := decl.(*ast.FuncDecl); ok {
+		skip[fn.Name] = true
+	}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			skip[x.Sel] = true
+			if id, ok := x.X.(*ast.Ident); ok && id.Obj == nil && local[id.Name] != "" {
+				used[local[id.Name]] = true
+				skip[id] = true
+			}
+		case *ast.KeyValueExpr:
+			// A struct literal's field name is unresolved too
+			if id, ok := x.Key.(*ast.Ident); ok {
+				skip[id] = true
+			}
+		case *ast.Ident:
+			if len(dot) > 0 && !skip[x] && x.Obj == nil && x.Name != "_" && types.Universe.Lookup(x.Name) == nil {
+				for _, p := range dot {
+					used[p] = true
+				}
+			}
+		}
+		return true
+	})
+
+	var uses []string
+	for _, p := range paths {
+		if used[p] && !slices.Contains(uses, p) {
+			uses = append(uses, p)
+		}
+	}
+	return uses
+}
+
+// ImportName guesses the package name of an unaliased import from its
+// path, skipping major-version suffixes ("github.com/x/y/v2" → "y") and
+// gopkg.in-style versions ("gopkg.in/yaml.v3" → "yaml").
+func ImportName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && isDigits(name[1:]) {
+		name = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(name, ".v"); i > 0 && isDigits(name[i+2:]) {
+		name = name[:i]
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(name, "go-"), "-", "")
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
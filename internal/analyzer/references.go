@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+)
+
+// Unreferenced returns the unexported top-level functions, types, variables
+// and constants declared in path (with content src) that nothing refers
+// to. References are looked for in src and, when dir is not empty, in every
+// other .go file of the same package in dir, tests included. Methods are
+// not reported since they may satisfy interfaces, nor are init, main and
+// blank declarations. The check is by name, so a local that shadows a
+// package-level name counts as a use of it.
+func Unreferenced(path string, src []byte, dir string) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	collectUses(file, used)
+
+	if dir != "" {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		self, _ := filepath.Abs(path)
+		for _, m := range matches {
+			if abs, _ := filepath.Abs(m); abs == self {
+				continue
+			}
+			content, err := os.ReadFile(m)
+			if err != nil {
+				return nil, err
+			}
+			other, err := parser.ParseFile(fset, m, content, 0)
+			if err != nil || other.Name.Name != file.Name.Name {
+				// External test packages cannot see unexported names
+				continue
+			}
+			collectUses(other, used)
+		}
+	}
+
+	var unused []Symbol
+	add := func(name, kind string, node ast.Node) {
+		if name == "_" || ast.IsExported(name) || used[name] {
+			return
+		}
+		unused = append(unused, Symbol{
+			Name:    name,
+			Kind:    kind,
+			Line:    fset.Position(node.Pos()).Line,
+			EndLine: fset.Position(node.End()).Line,
+		})
+	}
+	for _, d := range file.Decls {
+		switch decl := d.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name != "init" && decl.Name.Name != "main" {
+				add(decl.Name.Name, "func", decl)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name.Name, "type", s)
+				case *ast.ValueSpec:
+					kind := "const"
+					if decl.Tok == token.VAR {
+						kind = "var"
+					}
+					for _, n := range s.Names {
+						add(n.Name, kind, s)
+					}
+				}
+			}
+		}
+	}
+	return unused, nil
+}
+
+// collectUses records the names file refers to outside their own
+// declaration, so recursion and self-reference don't count as use.
+func collectUses(file *ast.File, used map[string]bool) {
+	for _, d := range file.Decls {
+		switch decl := d.(type) {
+		case *ast.FuncDecl:
+			self := map[string]bool{}
+			if decl.Recv == nil {
+				self[decl.Name.Name] = true
+			}
+			collectIdents(decl, decl.Name, self, used)
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				self := map[string]bool{}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					self[s.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						self[n.Name] = true
+					}
+				}
+				collectIdents(spec, nil, self, used)
+			}
+		}
+	}
+}
+
+// collectIdents adds the identifiers under node to used, except the names
+// in self and the declared name itself. Only the left side of a selector
+// can name a package-level declaration.
+func collectIdents(node ast.Node, name *ast.Ident, self, used map[string]bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.Ident:
+			if x != name && !self[x.Name] {
+				used[x.Name] = true
+			}
+		case *ast.SelectorExpr:
+			collectIdents(x.X, name, self, used)
+			return false
+		}
+		return true
+	})
+}
+
+// CrossFileReferences counts, over the Go files at paths (taken to be one
+// package), the distinct package-level names each file uses that another of
+// the files declares. Fewer means the files are more self-contained.
+func CrossFileReferences(paths []string) (int, error) {
+	fset := token.NewFileSet()
+	declaredIn := make(map[string][]string)
+	uses := make(map[string]map[string]bool)
+	for _, path := range paths {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		for _, name := range declaredNames(file) {
+			declaredIn[name] = append(declaredIn[name], path)
+		}
+		uses[path] = make(map[string]bool)
+		collectUses(file, uses[path])
+	}
+
+	count := 0
+	for _, path := range paths {
+		for name := range uses[path] {
+			for _, decl := range declaredIn[name] {
+				if decl != path {
+					count++
+					break
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+// declaredNames returns the package-level names file declares; methods are
+// not included since they are reached through their receiver.
+func declaredNames(file *ast.File) []string {
+	var names []string
+	for _, d := range file.Decls {
+		switch decl := d.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil && decl.Name.Name != "init" {
+				names = append(names, decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						names = append(names, n.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,77 @@
+package analyzer
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+)
+
+// LineStats counts the lines of a Go file by what they hold.
+type LineStats struct {
+	Code    int // Lines with code once comments are removed
+	Comment int // Lines holding only comments
+	Blank   int // Empty or whitespace-only lines
+}
+
+// CountCodeLines returns the number of lines of content holding code, not
+// counting blank lines or lines holding only comments.
+func CountCodeLines(content string) int {
+	_, stats := StripComments([]byte(content))
+	return stats.Code
+}
+
+// StripComments returns src without its comments and without the lines
+// that are then blank, and counts the lines of src by kind. Comments are
+// found with the token scanner, so "//" inside a string literal is kept.
+// A comment between tokens on one line is replaced by a space.
+func StripComments(src []byte) ([]byte, LineStats) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+
+	var code []byte
+	last := 0
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT {
+			continue
+		}
+		start := file.Offset(pos)
+		end := len(src)
+		if bytes.HasPrefix(src[start:], []byte("//")) {
+			if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+				end = start + i
+			}
+		} else if i := bytes.Index(src[start+2:], []byte("*/")); i >= 0 {
+			end = start + 2 + i + 2
+		}
+		code = append(code, src[last:start]...)
+		code = append(code, ' ')
+		// Keep the line breaks of a block comment so lines stay aligned
+		code = append(code, bytes.Repeat([]byte("\n"), bytes.Count(src[start:end], []byte("\n")))...)
+		last = end
+	}
+	code = append(code, src[last:]...)
+
+	var stats LineStats
+	var stripped []byte
+	rawLines := bytes.Split(bytes.TrimSuffix(src, []byte("\n")), []byte("\n"))
+	codeLines := bytes.Split(bytes.TrimSuffix(code, []byte("\n")), []byte("\n"))
+	for i, line := range codeLines {
+		switch {
+		case len(bytes.TrimSpace(line)) > 0:
+			stats.Code++
+			stripped = append(stripped, bytes.TrimRight(line, " \t")...)
+			stripped = append(stripped, '\n')
+		case len(bytes.TrimSpace(rawLines[i])) == 0:
+			stats.Blank++
+		default:
+			stats.Comment++
+		}
+	}
+	return stripped, stats
+}
@@ -4,6 +4,8 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +15,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -24,6 +28,7 @@ type Request struct {
 	Model     string    `json:"model"`
 	MaxTokens int       `json:"max_tokens"`
 	Messages  []Message `json:"messages"`
+	Stream    bool      `json:"stream,omitempty"`
 }
 
 // Message represents a single message in the conversation.
@@ -49,18 +54,54 @@ type APIError struct {
 	Message string `json:"message"`
 }
 
+// UnreachableError reports that the wrapper endpoint could not be contacted
+// at all (connection refused, unknown host), as opposed to an API failure.
+type UnreachableError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("could not reach API endpoint %s; is the wrapper running? (see --endpoint / GO_SPLIT_ENDPOINT)", e.Endpoint)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
 const (
 	maxRetries     = 3
 	initialBackoff = 1 * time.Second
 )
 
+// statusError is a non-200 response from the wrapper.
+type statusError struct {
+	Code int
+	Body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("API returned %d: %s", e.Code, e.Body)
+}
+
 // Client is an API client for the Anthropic Messages API.
 type Client struct {
 	endpoint   string
+	fallbacks  []string     // Tried in order when endpoint is down
+	onServed   func(string) // Called with the endpoint that answered
+	onRetry    func(attempt, attempts int, err error)
 	model      string
 	timeout    time.Duration
 	http       *http.Client
-	captureDir string // If set, captures request/response to files
+	captureDir string            // If set, captures request/response to files
+	cacheDir   string            // If set, reuses responses by prompt hash
+	stream     bool              // Ask wrapper endpoints for server-sent events
+	onDelta    func(text string) // Called with each streamed chunk
+	inFlight   chan struct{}     // Semaphore bounding concurrent calls, nil for no limit
+	// Permissions of capture files, 0644 if zero
+	captureMode os.FileMode
+	// Model tried once when the model stays rate limited or overloaded
+	fallbackModel string
 	// Direct API mode
 	apiKey     string
 	directMode bool
@@ -84,6 +125,62 @@ func (c *Client) WithCapture(dir string) *Client {
 	return c
 }
 
+// WithCache makes the client keep each response in dir, keyed by a hash of
+// the model, max tokens and prompt, and answer a call whose response is
+// already there from the file instead of the API.
+func (c *Client) WithCache(dir string) *Client {
+	c.cacheDir = dir
+	return c
+}
+
+// WithCaptureMode sets the permissions of capture files (default 0644).
+func (c *Client) WithCaptureMode(mode os.FileMode) *Client {
+	c.captureMode = mode
+	return c
+}
+
+// WithMaxConcurrency limits the client to n calls in flight at once, however
+// many goroutines call it; further calls wait for a slot. n <= 0 removes the
+// limit.
+func (c *Client) WithMaxConcurrency(n int) *Client {
+	c.inFlight = nil
+	if n > 0 {
+		c.inFlight = make(chan struct{}, n)
+	}
+	return c
+}
+
+// WithFallbackEndpoints adds wrapper endpoints to try, in order, when the
+// primary endpoint is unreachable or returns a 5xx error.
+func (c *Client) WithFallbackEndpoints(endpoints ...string) *Client {
+	c.fallbacks = append(c.fallbacks, endpoints...)
+	return c
+}
+
+// WithFallbackModel makes a call that still fails with a rate limit or
+// overload error once retries and endpoint failover are exhausted try once
+// more with model. An empty model, or the client's own, disables fallback.
+func (c *Client) WithFallbackModel(model string) *Client {
+	c.fallbackModel = model
+	return c
+}
+
+// WithServedHook registers fn to be called with the wrapper endpoint that
+// served each request.
+func (c *Client) WithServedHook(fn func(endpoint string)) *Client {
+	c.onServed = fn
+	return c
+}
+
+// WithRetryHook registers fn to be called before each attempt of a call
+// after the first: a retry in direct mode, the next fallback endpoint in
+// wrapper mode. It gets the attempt number, the most attempts the call can
+// make and the error that failed the previous attempt.
+func (c *Client) WithRetryHook(fn func(attempt, attempts int, err error)) *Client {
+	c.onRetry = fn
+	return c
+}
+
 // WithAPIKey enables direct Anthropic API mode.
 // If key is empty, checks ANTHROPIC_API_KEY environment variable.
 func (c *Client) WithAPIKey(key string) *Client {
@@ -99,6 +196,11 @@ func (c *Client) WithAPIKey(key string) *Client {
 	return c
 }
 
+// Endpoint returns the wrapper endpoint tried first.
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
 // IsDirectMode returns true if using direct Anthropic API.
 func (c *Client) IsDirectMode() bool {
 	return c.directMode
@@ -106,17 +208,46 @@ func (c *Client) IsDirectMode() bool {
 
 // Call sends a prompt to the API and returns the response text.
 func (c *Client) Call(prompt string, maxTokens int) (string, error) {
-	var responseText string
-	var err error
+	responseText, _, err := c.call(prompt, maxTokens)
+	return responseText, err
+}
 
-	if c.directMode {
-		responseText, err = c.callDirect(prompt, maxTokens)
-	} else {
-		responseText, err = c.callWrapper(prompt, maxTokens)
+// call is Call, also returning the model that served the request.
+func (c *Client) call(prompt string, maxTokens int) (string, string, error) {
+	if c.cacheDir != "" {
+		if responseText, ok := c.cachedResponse(prompt, maxTokens); ok {
+			if c.onDelta != nil {
+				c.onDelta(responseText)
+			}
+			if c.captureDir != "" {
+				if captureErr := c.captureExchange(prompt, responseText); captureErr != nil {
+					fmt.Fprintf(os.Stderr, "Warning: capture failed: %v\n", captureErr)
+				}
+			}
+			return responseText, c.model, nil
+		}
+	}
+
+	if c.inFlight != nil {
+		c.inFlight <- struct{}{}
+		defer func() { <-c.inFlight }()
+	}
+
+	model := c.model
+	responseText, err := c.send(model, prompt, maxTokens, maxRetries)
+	if err != nil && c.fallbackModel != "" && c.fallbackModel != c.model && shouldFallback(err) {
+		model = c.fallbackModel
+		var fallbackErr error
+		responseText, fallbackErr = c.send(model, prompt, maxTokens, 0)
+		if fallbackErr != nil {
+			err = fmt.Errorf("%w (fallback model %s: %v)", err, model, fallbackErr)
+		} else {
+			err = nil
+		}
 	}
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// Capture request/response if capture mode is enabled
@@ -127,17 +258,105 @@ func (c *Client) Call(prompt string, maxTokens int) (string, error) {
 		}
 	}
 
-	return responseText, nil
+	// Only the client's own model answers for the cache key
+	if c.cacheDir != "" && model == c.model {
+		if cacheErr := c.storeResponse(prompt, maxTokens, responseText); cacheErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: caching the response failed: %v\n", cacheErr)
+		}
+	}
+
+	return responseText, model, nil
+}
+
+// send makes one call with model, by whichever mode the client uses. Direct
+// mode retries retryable errors up to retries times.
+func (c *Client) send(model, prompt string, maxTokens, retries int) (string, error) {
+	if c.directMode {
+		return c.callDirect(model, prompt, maxTokens, retries)
+	}
+	return c.callWrapper(model, prompt, maxTokens)
+}
+
+// CallWithTimeout is like Call but bounds the request by timeout instead of
+// the client's default. A timeout of zero or less uses the default.
+func (c *Client) CallWithTimeout(prompt string, maxTokens int, timeout time.Duration) (string, error) {
+	responseText, _, err := c.CallServed(prompt, maxTokens, timeout)
+	return responseText, err
+}
+
+// CallServed is like CallWithTimeout and also returns the model that served
+// the call: the client's model, or its fallback model.
+func (c *Client) CallServed(prompt string, maxTokens int, timeout time.Duration) (response, model string, err error) {
+	if timeout <= 0 || timeout == c.timeout {
+		return c.call(prompt, maxTokens)
+	}
+	bounded := *c
+	bounded.timeout = timeout
+	bounded.http = &http.Client{Timeout: timeout, Transport: c.http.Transport}
+	return bounded.call(prompt, maxTokens)
+}
+
+// callWrapper calls the API via the claude-code-openai-wrapper, failing over
+// to the fallback endpoints on connection errors and 5xx responses.
+func (c *Client) callWrapper(model, prompt string, maxTokens int) (string, error) {
+	var err error
+	endpoints := append([]string{c.endpoint}, c.fallbacks...)
+	for i, endpoint := range endpoints {
+		if i > 0 && c.onRetry != nil {
+			c.onRetry(i+1, len(endpoints), err)
+		}
+		var text string
+		text, err = c.callEndpoint(endpoint, model, prompt, maxTokens)
+		if err == nil {
+			if c.onServed != nil {
+				c.onServed(endpoint)
+			}
+			return text, nil
+		}
+		if !shouldFailover(err) {
+			return "", err
+		}
+	}
+	return "", err
+}
+
+// shouldFailover reports whether err means the endpoint, rather than the
+// request, is at fault.
+func shouldFailover(err error) bool {
+	var unreachable *UnreachableError
+	var status *statusError
+	switch {
+	case errors.As(err, &unreachable):
+		return true
+	case errors.As(err, &status):
+		return status.Code >= 500
+	}
+	return false
+}
+
+// shouldFallback reports whether err means the model is rate limited or
+// overloaded, so another model may still answer.
+func shouldFallback(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.Code == http.StatusTooManyRequests || status.Code >= 500
+	}
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return false
 }
 
-// callWrapper calls the API via the claude-code-openai-wrapper.
-func (c *Client) callWrapper(prompt string, maxTokens int) (string, error) {
+// callEndpoint sends one request for model to a single wrapper endpoint.
+func (c *Client) callEndpoint(endpoint, model, prompt string, maxTokens int) (string, error) {
 	req := Request{
-		Model:     c.model,
+		Model:     model,
 		MaxTokens: maxTokens,
 		Messages: []Message{
 			{Role: "user", Content: prompt},
 		},
+		Stream: c.stream,
 	}
 
 	body, err := json.Marshal(req)
@@ -145,25 +364,36 @@ func (c *Client) callWrapper(prompt string, maxTokens int) (string, error) {
 		return "", fmt.Errorf("marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	if c.stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
 
 	resp, err := c.http.Do(httpReq)
 	if err != nil {
+		if isUnreachable(err) {
+			return "", &UnreachableError{Endpoint: endpoint, Err: err}
+		}
 		return "", fmt.Errorf("http request: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	// Wrappers without streaming support answer with plain JSON
+	if resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return c.readStream(resp.Body)
+	}
+
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned %d: %s", resp.StatusCode, string(respBody))
+		return "", &statusError{Code: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var apiResp Response
@@ -182,8 +412,9 @@ func (c *Client) callWrapper(prompt string, maxTokens int) (string, error) {
 	return apiResp.Content[0].Text, nil
 }
 
-// callDirect calls the Anthropic API directly using the SDK.
-func (c *Client) callDirect(prompt string, maxTokens int) (string, error) {
+// callDirect calls the Anthropic API directly using the SDK, retrying
+// retryable errors up to retries times.
+func (c *Client) callDirect(model, prompt string, maxTokens, retries int) (string, error) {
 	if c.anthropic == nil {
 		return "", fmt.Errorf("direct mode not initialized: call WithAPIKey first")
 	}
@@ -191,20 +422,17 @@ func (c *Client) callDirect(prompt string, maxTokens int) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	// Map model string to anthropic.Model
-	model := c.mapModel()
-
-	return c.callDirectWithRetry(ctx, prompt, maxTokens, model)
+	return c.callDirectWithRetry(ctx, prompt, maxTokens, mapModel(model), retries)
 }
 
 // mapModel converts the model string to anthropic.Model.
 // The SDK accepts any string - Anthropic validates server-side.
-func (c *Client) mapModel() anthropic.Model {
-	return anthropic.Model(c.model)
+func mapModel(model string) anthropic.Model {
+	return anthropic.Model(model)
 }
 
 // callDirectWithRetry implements retry with exponential backoff.
-func (c *Client) callDirectWithRetry(ctx context.Context, prompt string, maxTokens int, model anthropic.Model) (string, error) {
+func (c *Client) callDirectWithRetry(ctx context.Context, prompt string, maxTokens int, model anthropic.Model, retries int) (string, error) {
 	var lastErr error
 	params := anthropic.MessageNewParams{
 		Model:     model,
@@ -214,8 +442,11 @@ func (c *Client) callDirectWithRetry(ctx context.Context, prompt string, maxToke
 		},
 	}
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
+	for attempt := 0; attempt <= retries; attempt++ {
 		if attempt > 0 {
+			if c.onRetry != nil {
+				c.onRetry(attempt+1, retries+1, lastErr)
+			}
 			backoff := initialBackoff * time.Duration(math.Pow(2, float64(attempt-1)))
 			select {
 			case <-time.After(backoff):
@@ -248,7 +479,7 @@ func (c *Client) callDirectWithRetry(ctx context.Context, prompt string, maxToke
 		}
 	}
 
-	return "", fmt.Errorf("failed after %d retries: %w", maxRetries+1, lastErr)
+	return "", fmt.Errorf("failed after %d retries: %w", retries+1, lastErr)
 }
 
 // isRetryable determines if an error should trigger a retry.
@@ -279,6 +510,16 @@ func isRetryable(err error) bool {
 	return false
 }
 
+// isUnreachable reports whether err means nothing is listening at the
+// endpoint or its host does not resolve.
+func isUnreachable(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
 // captureExchange saves the prompt and response to files in the capture directory.
 func (c *Client) captureExchange(prompt, response string) error {
 	if err := os.MkdirAll(c.captureDir, 0755); err != nil {
@@ -286,19 +527,179 @@ func (c *Client) captureExchange(prompt, response string) error {
 	}
 
 	timestamp := time.Now().Format("20060102_150405")
+	mode := c.captureMode
+	if mode == 0 {
+		mode = 0644
+	}
+	write := func(path, data string) error {
+		if err := os.WriteFile(path, []byte(data), mode); err != nil {
+			return err
+		}
+		// WriteFile's permissions are subject to the umask
+		return os.Chmod(path, mode)
+	}
 
 	// Write request (prompt)
 	reqPath := filepath.Join(c.captureDir, fmt.Sprintf("%s_request.txt", timestamp))
-	if err := os.WriteFile(reqPath, []byte(prompt), 0644); err != nil {
+	if err := write(reqPath, prompt); err != nil {
 		return fmt.Errorf("write request: %w", err)
 	}
 
 	// Write response
 	respPath := filepath.Join(c.captureDir, fmt.Sprintf("%s_response.txt", timestamp))
-	if err := os.WriteFile(respPath, []byte(response), 0644); err != nil {
+	if err := write(respPath, response); err != nil {
 		return fmt.Errorf("write response: %w", err)
 	}
 
 	fmt.Fprintf(os.Stderr, "📝 Captured: %s\n", timestamp)
 	return nil
 }
+
+// cachePath returns the file in the cache directory holding the response
+// of the client's model to prompt with maxTokens.
+func (c *Client) cachePath(prompt string, maxTokens int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", c.model, maxTokens, prompt)))
+	return filepath.Join(c.cacheDir, hex.EncodeToString(sum[:])+".txt")
+}
+
+// cachedResponse returns the cached response to prompt, if there is one.
+func (c *Client) cachedResponse(prompt string, maxTokens int) (string, bool) {
+	data, err := os.ReadFile(c.cachePath(prompt, maxTokens))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// storeResponse saves response in the cache directory. It is written to a
+// temporary file and renamed into place, so a concurrent call never reads
+// a partial response.
+func (c *Client) storeResponse(prompt string, maxTokens int, response string) error {
+	if err := os.MkdirAll(c.cacheDir, 0755); err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.cacheDir, ".response-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(response); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.cachePath(prompt, maxTokens))
+}
+
+// KnownModels lists the Claude models available through the direct API, as
+// known to this build's SDK. Newest first.
+var KnownModels = []string{
+	string(anthropic.ModelClaudeOpus4_5_20251101),
+	string(anthropic.ModelClaudeSonnet4_5_20250929),
+	string(anthropic.ModelClaudeHaiku4_5_20251001),
+	string(anthropic.ModelClaudeOpus4_1_20250805),
+	string(anthropic.ModelClaudeOpus4_20250514),
+	string(anthropic.ModelClaudeSonnet4_20250514),
+	string(anthropic.ModelClaude3_7Sonnet20250219),
+	string(anthropic.ModelClaude3_5Haiku20241022),
+	string(anthropic.ModelClaude_3_Haiku_20240307),
+}
+
+// modelList is the models endpoint response; OpenAI- and Anthropic-style
+// backends both return {"data": [{"id": ...}]}.
+type modelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the model IDs the backend accepts. Wrapper endpoints
+// are asked at their models route (".../v1/messages" becomes
+// ".../v1/models"), failing over like Call; direct mode returns
+// KnownModels.
+func (c *Client) ListModels() ([]string, error) {
+	if c.directMode {
+		return KnownModels, nil
+	}
+
+	var err error
+	for _, endpoint := range append([]string{c.endpoint}, c.fallbacks...) {
+		var models []string
+		models, err = c.listEndpointModels(endpoint)
+		if err == nil {
+			return models, nil
+		}
+		if !shouldFailover(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Ping checks that the backend answers, without spending tokens. Direct mode
+// lists a model, which fails if the API key is rejected. Wrapper mode asks
+// each endpoint's models route in turn; any answer short of a 5xx means the
+// wrapper is up, since not every wrapper serves that route.
+func (c *Client) Ping() error {
+	if c.directMode {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+		_, err := c.anthropic.Models.List(ctx, anthropic.ModelListParams{Limit: anthropic.Int(1)})
+		return err
+	}
+
+	var err error
+	for _, endpoint := range append([]string{c.endpoint}, c.fallbacks...) {
+		_, err = c.listEndpointModels(endpoint)
+		var status *statusError
+		if err == nil || (errors.As(err, &status) && status.Code < 500) {
+			return nil
+		}
+	}
+	return err
+}
+
+// listEndpointModels queries the models route of one wrapper endpoint.
+func (c *Client) listEndpointModels(endpoint string) ([]string, error) {
+	url := modelsURL(endpoint)
+	resp, err := c.http.Get(url)
+	if err != nil {
+		if isUnreachable(err) {
+			return nil, &UnreachableError{Endpoint: endpoint, Err: err}
+		}
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{Code: resp.StatusCode, Body: string(body)}
+	}
+
+	var list modelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("parse models from %s: %w", url, err)
+	}
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// modelsURL derives the models route from a messages or chat completions
+// endpoint.
+func modelsURL(endpoint string) string {
+	base := strings.TrimRight(endpoint, "/")
+	for _, route := range []string{"/messages", "/chat/completions"} {
+		if trimmed, ok := strings.CutSuffix(base, route); ok {
+			return trimmed + "/models"
+		}
+	}
+	return base + "/models"
+}
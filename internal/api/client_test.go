@@ -2,8 +2,13 @@ package api_test
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -94,3 +99,378 @@ func TestClient_Call_Timeout(t *testing.T) {
 		t.Error("Call() expected timeout error")
 	}
 }
+
+func TestClient_CallWithTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		resp := api.Response{Content: []api.ContentBlock{{Type: "text", Text: "slow"}}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL, "test-model", 10*time.Millisecond)
+	if _, err := client.CallWithTimeout("Test prompt", 100, 5*time.Second); err != nil {
+		t.Errorf("CallWithTimeout() with a longer timeout error = %v", err)
+	}
+	if _, err := client.CallWithTimeout("Test prompt", 100, 0); err == nil {
+		t.Error("CallWithTimeout() with no override expected the client timeout")
+	}
+}
+
+func TestClient_WithMaxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(20 * time.Millisecond)
+		resp := api.Response{Content: []api.ContentBlock{{Type: "text", Text: "ok"}}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	const limit = 2
+	client := api.NewClient(server.URL, "test-model", 5*time.Second).WithMaxConcurrency(limit)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Calls with their own timeout share the limit
+			if _, err := client.CallWithTimeout("Test prompt", 100, 4*time.Second); err != nil {
+				t.Errorf("CallWithTimeout() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak > limit {
+		t.Errorf("peak concurrent requests = %d, want at most %d", peak, limit)
+	}
+}
+
+func TestClient_WithCache(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var req api.Request
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp := api.Response{Content: []api.ContentBlock{{Type: "text", Text: fmt.Sprintf("%s #%d", req.Messages[0].Content, calls)}}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := api.NewClient(server.URL, "test-model", 5*time.Second).WithCache(dir)
+	for _, tc := range []struct {
+		prompt    string
+		maxTokens int
+		want      string
+	}{
+		{"a", 100, "a #1"},
+		{"a", 100, "a #1"}, // From the cache
+		{"a", 200, "a #2"}, // Max tokens is part of the key
+		{"b", 100, "b #3"},
+	} {
+		got, err := client.Call(tc.prompt, tc.maxTokens)
+		if err != nil || got != tc.want {
+			t.Errorf("Call(%q, %d) = %q, %v, want %q", tc.prompt, tc.maxTokens, got, err, tc.want)
+		}
+	}
+
+	// Another model misses, and a client without the cache always calls
+	if got, _ := api.NewClient(server.URL, "other-model", 5*time.Second).WithCache(dir).Call("a", 100); got != "a #4" {
+		t.Errorf("Call() with another model = %q, want a fresh response", got)
+	}
+	if got, _ := api.NewClient(server.URL, "test-model", 5*time.Second).Call("a", 100); got != "a #5" {
+		t.Errorf("Call() without the cache = %q, want a fresh response", got)
+	}
+	if calls != 5 {
+		t.Errorf("server called %d times, want 5", calls)
+	}
+}
+
+func TestClient_Call_Unreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	endpoint := server.URL
+	server.Close()
+
+	client := api.NewClient(endpoint, "test-model", 10*time.Second)
+	_, err := client.Call("Test prompt", 100)
+
+	var unreachable *api.UnreachableError
+	if !errors.As(err, &unreachable) {
+		t.Fatalf("Call() error = %v, want *api.UnreachableError", err)
+	}
+	if !strings.Contains(err.Error(), endpoint) || !strings.Contains(err.Error(), "is the wrapper running") {
+		t.Errorf("Call() error = %q, want friendly message naming %s", err, endpoint)
+	}
+	if unreachable.Err == nil {
+		t.Error("UnreachableError should wrap the underlying error")
+	}
+}
+
+func TestClient_Call_Failover(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := dead.URL
+	dead.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(api.Response{Content: []api.ContentBlock{{Type: "text", Text: "from live"}}})
+	}))
+	defer live.Close()
+
+	var served string
+	client := api.NewClient(deadURL, "test-model", 10*time.Second).
+		WithFallbackEndpoints(failing.URL, live.URL).
+		WithServedHook(func(endpoint string) { served = endpoint })
+
+	result, err := client.Call("Test prompt", 100)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if result != "from live" {
+		t.Errorf("Call() = %q, want %q", result, "from live")
+	}
+	if served != live.URL {
+		t.Errorf("served by %q, want %q", served, live.URL)
+	}
+}
+
+func TestClient_WithRetryHook(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(api.Response{Content: []api.ContentBlock{{Type: "text", Text: "ok"}}})
+	}))
+	defer live.Close()
+
+	type retry struct{ attempt, attempts int }
+	var retries []retry
+	var lastErr error
+	client := api.NewClient(failing.URL, "test-model", 10*time.Second).
+		WithFallbackEndpoints(failing.URL, live.URL).
+		WithRetryHook(func(attempt, attempts int, err error) {
+			retries = append(retries, retry{attempt, attempts})
+			lastErr = err
+		})
+
+	if _, err := client.Call("Test prompt", 100); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if want := []retry{{2, 3}, {3, 3}}; !slices.Equal(retries, want) {
+		t.Errorf("retries = %v, want %v", retries, want)
+	}
+	if lastErr == nil || !strings.Contains(lastErr.Error(), "503") {
+		t.Errorf("retry error = %v, want the 503 that caused it", lastErr)
+	}
+
+	retries = nil
+	if _, err := api.NewClient(live.URL, "test-model", 10*time.Second).WithFallbackEndpoints(failing.URL).
+		WithRetryHook(func(attempt, attempts int, err error) { retries = append(retries, retry{attempt, attempts}) }).
+		Call("Test prompt", 100); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if len(retries) != 0 {
+		t.Errorf("retry hook called %d times for a call that succeeded first time", len(retries))
+	}
+}
+
+func TestClient_Call_NoFailoverOnClientError(t *testing.T) {
+	calls := 0
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer other.Close()
+
+	client := api.NewClient(rejecting.URL, "test-model", 10*time.Second).WithFallbackEndpoints(other.URL)
+	if _, err := client.Call("Test prompt", 100); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Call() error = %v, want the 400 from the first endpoint", err)
+	}
+	if calls != 0 {
+		t.Errorf("fallback endpoint called %d times, want 0", calls)
+	}
+}
+
+func TestClient_WithFallbackModel(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		models = append(models, req.Model)
+		switch req.Model {
+		case "primary-model":
+			http.Error(w, "overloaded", 529)
+		case "rejected-model":
+			http.Error(w, "bad request", http.StatusBadRequest)
+		default:
+			_ = json.NewEncoder(w).Encode(api.Response{Content: []api.ContentBlock{{Type: "text", Text: "from " + req.Model}}})
+		}
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL, "primary-model", 10*time.Second).WithFallbackModel("fallback-model")
+	result, model, err := client.CallServed("Test prompt", 100, 0)
+	if err != nil {
+		t.Fatalf("CallServed() error = %v", err)
+	}
+	if result != "from fallback-model" || model != "fallback-model" {
+		t.Errorf("CallServed() = %q, %q, want the answer from fallback-model", result, model)
+	}
+	if want := []string{"primary-model", "fallback-model"}; !slices.Equal(models, want) {
+		t.Errorf("models requested = %v, want %v", models, want)
+	}
+
+	// The primary model answering needs no fallback
+	models = nil
+	if _, model, err := api.NewClient(server.URL, "other-model", 10*time.Second).WithFallbackModel("fallback-model").CallServed("Test prompt", 100, 0); err != nil || model != "other-model" {
+		t.Errorf("CallServed() model = %q, error = %v, want other-model", model, err)
+	}
+
+	// Neither does a request the API rejects
+	models = nil
+	_, err = api.NewClient(server.URL, "rejected-model", 10*time.Second).WithFallbackModel("fallback-model").Call("Test prompt", 100)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Call() error = %v, want the 400", err)
+	}
+	if want := []string{"rejected-model"}; !slices.Equal(models, want) {
+		t.Errorf("models requested = %v, want %v", models, want)
+	}
+
+	// A failing fallback reports both errors
+	models = nil
+	_, err = api.NewClient(server.URL, "primary-model", 10*time.Second).WithFallbackModel("rejected-model").Call("Test prompt", 100)
+	if err == nil || !strings.Contains(err.Error(), "529") || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Call() error = %v, want the 529 and the fallback's 400", err)
+	}
+}
+
+func TestClient_Call_Stream(t *testing.T) {
+	tests := []struct {
+		name   string
+		events string
+	}{
+		{"anthropic", "event: message_start\ndata: {\"type\":\"message_start\"}\n\n" +
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello \"}}\n\n" +
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"world\"}}\n\n" +
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"},
+		{"openai", "data: {\"choices\":[{\"delta\":{\"content\":\"Hello \"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"world\"}}]}\n\n" +
+			"data: [DONE]\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req api.Request
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				if !req.Stream {
+					t.Error("request did not ask for a stream")
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte(tt.events))
+			}))
+			defer server.Close()
+
+			var deltas []string
+			client := api.NewClient(server.URL, "test-model", 10*time.Second).
+				WithStreaming(func(text string) { deltas = append(deltas, text) })
+			result, err := client.Call("Test prompt", 100)
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if result != "Hello world" {
+				t.Errorf("Call() = %q, want %q", result, "Hello world")
+			}
+			if len(deltas) != 2 {
+				t.Errorf("deltas = %q, want 2 chunks", deltas)
+			}
+		})
+	}
+}
+
+func TestClient_Call_StreamFallback(t *testing.T) {
+	// A wrapper without streaming support ignores "stream" and sends JSON
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.Response{Content: []api.ContentBlock{{Type: "text", Text: "plain"}}})
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL, "test-model", 10*time.Second).WithStreaming(nil)
+	result, err := client.Call("Test prompt", 100)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if result != "plain" {
+		t.Errorf("Call() = %q, want %q", result, "plain")
+	}
+}
+
+func TestClient_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models" {
+			t.Errorf("request = %s %s, want GET /v1/models", r.Method, r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"model-a"},{"id":"model-b"}]}`))
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL+"/v1/messages", "test-model", 10*time.Second)
+	models, err := client.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if strings.Join(models, ",") != "model-a,model-b" {
+		t.Errorf("ListModels() = %v, want [model-a model-b]", models)
+	}
+
+	direct := api.NewClient(server.URL, "test-model", 10*time.Second).WithAPIKey("sk-test")
+	if models, err := direct.ListModels(); err != nil || len(models) != len(api.KnownModels) {
+		t.Errorf("direct ListModels() = %v, %v; want KnownModels", models, err)
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	status := http.StatusNotFound // A wrapper without a models route is still up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", status)
+	}))
+	defer server.Close()
+
+	client := api.NewClient(server.URL+"/v1/messages", "test-model", 10*time.Second)
+	if err := client.Ping(); err != nil {
+		t.Errorf("Ping() error = %v, want nil for a 404", err)
+	}
+	status = http.StatusBadGateway
+	if err := client.Ping(); err == nil {
+		t.Error("Ping() succeeded against a 502")
+	}
+
+	down := api.NewClient("http://127.0.0.1:1/v1/messages", "test-model", time.Second)
+	var unreachable *api.UnreachableError
+	if err := down.Ping(); !errors.As(err, &unreachable) {
+		t.Errorf("Ping() error = %v, want UnreachableError", err)
+	}
+}
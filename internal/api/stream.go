@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// streamEvent is one server-sent event payload. Both the Anthropic
+// (content_block_delta) and OpenAI (choices[].delta) chunk shapes are
+// understood, since wrappers differ in which they emit.
+type streamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Text string `json:"text"`
+	} `json:"delta"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *APIError `json:"error,omitempty"`
+}
+
+// WithStreaming asks wrapper endpoints to stream responses as server-sent
+// events. onDelta, if not nil, is called with each chunk of text as it
+// arrives. Endpoints that answer with a plain JSON response are handled as
+// before, so streaming can be left on for wrappers that don't support it.
+func (c *Client) WithStreaming(onDelta func(text string)) *Client {
+	c.stream = true
+	c.onDelta = onDelta
+	return c
+}
+
+// readStream accumulates the text of a text/event-stream response body.
+func (c *Client) readStream(body io.Reader) (string, error) {
+	var text strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // event names, comments and blank separators
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+
+		var ev streamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return "", fmt.Errorf("parse stream event: %w", err)
+		}
+		if ev.Error != nil {
+			return "", fmt.Errorf("API error: %s", ev.Error.Message)
+		}
+
+		delta := ev.Delta.Text
+		if ev.Type != "" && ev.Type != "content_block_delta" {
+			delta = ""
+		}
+		for _, choice := range ev.Choices {
+			delta += choice.Delta.Content
+		}
+		if delta == "" {
+			continue
+		}
+		text.WriteString(delta)
+		if c.onDelta != nil {
+			c.onDelta(delta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read stream: %w", err)
+	}
+
+	if text.Len() == 0 {
+		return "", fmt.Errorf("empty response from API")
+	}
+	return text.String(), nil
+}
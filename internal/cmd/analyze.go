@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"go/token"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -13,55 +16,327 @@ import (
 
 // AnalyzeResult holds analysis results for JSON output.
 type AnalyzeResult struct {
-	File            string `json:"file"`
-	Package         string `json:"package"`
-	Lines           int    `json:"lines"`
-	Functions       int    `json:"functions"`
-	Types           int    `json:"types"`
-	Variables       int    `json:"variables"`
-	TestFile        string `json:"test_file,omitempty"`
-	TestLines       int    `json:"test_lines,omitempty"`
-	TestFunctions   int    `json:"test_functions,omitempty"`
-	Recommendations string `json:"recommendations,omitempty"`
+	File             string `json:"file"`
+	Package          string `json:"package"`
+	Lines            int    `json:"lines"`
+	CodeLines        int    `json:"code_lines"` // Without blank and comment-only lines
+	InitFuncs        int    `json:"init_funcs,omitempty"`
+	Functions        int    `json:"functions"`
+	Types            int    `json:"types"`
+	Variables        int    `json:"variables"`
+	TestFile         string `json:"test_file,omitempty"`
+	TestLines        int    `json:"test_lines,omitempty"`
+	TestFunctions    int    `json:"test_functions,omitempty"`
+	SplitRecommended bool   `json:"split_recommended"`
+	SplitReason      string `json:"split_reason"`
+	PackageMismatch  bool   `json:"package_mismatch,omitempty"` // Package not named after its directory
+	Empty            bool   `json:"empty,omitempty"`            // No declarations at all
+	Cgo              bool   `json:"cgo,omitempty"`              // Imports "C"; generate refuses without --force
+	Recommendations  string `json:"recommendations,omitempty"`
+	// The exported API: functions and methods with exported names, and types
+	ExportedFunctions int `json:"exported_functions"`
+	ExportedTypes     int `json:"exported_types"`
+	// BuildTags holds the file's build constraint lines; a split must keep them.
+	BuildTags []string `json:"build_tags,omitempty"`
+	// Normalized lists the fixes --normalize-eol applied to the input.
+	Normalized []string `json:"normalized,omitempty"`
+	// AssumedPackage is the --assume-package clause added to a fragment.
+	AssumedPackage string `json:"assumed_package,omitempty"`
+	// For a _test.go input: the source file it tests and its test functions by kind
+	SourceFile string     `json:"source_file,omitempty"`
+	TestStats  *TestStats `json:"test_stats,omitempty"`
+	// DeadCode lists unexported declarations nothing in the package refers to (--dead-code).
+	DeadCode []DeadSymbol `json:"dead_code,omitempty"`
+	// Calls lists the model calls made, with their latencies.
+	Calls []CallStat `json:"calls,omitempty"`
+	// StructuredRecommendations replaces Recommendations with
+	// --structured-recommendations, unless the response could not be parsed.
+	StructuredRecommendations []Recommendation `json:"structured_recommendations,omitempty"`
+	// Complexity lists each function's cyclomatic complexity, most complex first.
+	Complexity []FuncComplexity `json:"complexity,omitempty"`
+	// Stripped measures the file without comments and blank lines (--strip-comments).
+	Stripped *StrippedMetrics `json:"stripped,omitempty"`
 }
 
+// FuncComplexity is the cyclomatic complexity of a function or method.
+type FuncComplexity struct {
+	Name       string `json:"name"` // "Type.Method" for methods
+	Line       int    `json:"line"`
+	Complexity int    `json:"complexity"`
+}
+
+// StrippedMetrics compares a file's size with its comments and blank lines
+// removed against the raw Lines.
+type StrippedMetrics struct {
+	Lines        int `json:"lines"`         // Lines of code left
+	CommentLines int `json:"comment_lines"` // Lines holding only comments
+	BlankLines   int `json:"blank_lines"`
+}
+
+// Recommendation is one proposed file of a split.
+type Recommendation struct {
+	Filename            string   `json:"filename"`
+	ContentsDescription string   `json:"contents_description"`
+	Functions           []string `json:"functions,omitempty"`
+	Rationale           string   `json:"rationale,omitempty"`
+}
+
+// TestStats counts the go test functions in a test file by kind.
+type TestStats struct {
+	Tests      int  `json:"tests"`
+	Benchmarks int  `json:"benchmarks"`
+	Examples   int  `json:"examples"`
+	Fuzz       int  `json:"fuzz"`
+	TestMain   bool `json:"test_main,omitempty"`
+}
+
+// DeadSymbol is an unexported declaration with no references.
+type DeadSymbol struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // func, type, var, const
+	Line int    `json:"line"`
+}
+
+// analyzeConfig holds analyze-specific configuration.
+type analyzeConfig struct {
+	Force    bool
+	Budget   string // YAML size budget to check files against
+	DeadCode bool   // Report unreferenced unexported declarations
+	// Ask for recommendations as JSON and parse them
+	Structured bool
+	Since      string // Check only the Go files changed since this git ref
+	// Package to parse a fragment without a package clause as
+	AssumePackage string
+	// List the files above this percentile of line count (0 = off)
+	Percentile float64
+	// Also measure the file with comments and blank lines removed
+	StripComments bool
+}
+
+var anaCfg = &analyzeConfig{}
+
 // newAnalyzeCmd creates the analyze command.
 func newAnalyzeCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "analyze <file>",
+	cmd := &cobra.Command{
+		Use:   "analyze <file|dir|->...",
 		Short: "Analyze a Go file and show recommended splits",
 		Long: `Analyze a Go file to understand its structure and get AI-powered
-recommendations for how to split it into smaller, focused modules.`,
-		Args: cobra.ExactArgs(1),
+recommendations for how to split it into smaller, focused modules.
+
+Given a directory, analyze ranks its non-test Go files by line count,
+largest first, without AI (an array of results in JSON output), to find
+the file most in need of a split.
+
+Use "-" to read the source from stdin; --stdin-name sets the filename it
+is treated as (default stdin.go).
+
+To review code that isn't checked out, name a git object as
+git:<ref>:<path> (git:HEAD~1:internal/foo.go, path from the repository
+root) or a raw https:// URL. The content is read into memory and goes by
+the base name of its path. URL fetches use --timeout and are limited to
+10 MiB.
+
+A _test.go file is analyzed as tests: it is paired with the source file it
+tests, test functions are counted by kind, and the recommendations cover
+how to split the tests.
+
+--structured-recommendations asks the model for JSON and reports each
+proposed file with its contents, functions and rationale
+(structured_recommendations in JSON output). If the response cannot be
+parsed, the freeform text is reported instead.
+
+--dead-code lists the file's unexported functions, types, variables and
+constants that nothing in the package (tests included) refers to, so they
+can be dropped rather than carried into the split.
+
+Files that look fine as they are (small, or one cohesive unit) get a
+verdict without an AI call; use --force to ask for recommendations anyway.
+
+With --budget, no AI is used: each file (or every non-test file of each
+directory) is checked against the limits in the budget file, and analyze
+exits nonzero if any file exceeds them:
+
+  max_lines: 500
+  max_functions: 25
+  max_complexity: 15   # per function
+
+--since <ref> checks the non-test Go files changed since a git ref instead
+(limited to the given paths, if any), reporting each file's size and, with
+--budget, whether it is within budget. With --format markdown the report is
+a table ready to post as a pull request comment.
+
+--assume-package <name> analyzes a fragment that has no package clause,
+such as a partial editor buffer, as part of package <name>. Only syntax
+matters, so the fragment may refer to names it doesn't declare.
+
+--percentile <p> measures the non-test Go files of the given files and
+directories without AI and lists those above the p-th percentile of line
+count (interpolated), largest first, as split candidates:
+
+  go-split analyze ./internal/cmd ./internal/api --percentile 90
+
+--format dot prints the file's call graph for Graphviz instead, without
+AI: functions are nodes, calls between them edges, and methods are
+clustered by receiver type, which hints at natural split boundaries:
+
+  go-split --format dot analyze server.go | dot -Tpng -o server.png
+
+--strip-comments also measures the file with its comments and blank lines
+removed, to show how much of its size is code:
+
+  📄 Analyzing server.go (1500 lines, 600 of code)
+     Stripped:  600 lines of code, 700 of comments, 200 blank`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if anaCfg.Since != "" {
+				return nil
+			}
+			if anaCfg.Budget != "" || anaCfg.Percentile != 0 {
+				return cobra.MinimumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		RunE: runAnalyze,
 	}
+
+	cmd.Flags().BoolVar(&anaCfg.Force, "force", false, "Get AI recommendations even when the file does not need splitting")
+	cmd.Flags().BoolVar(&anaCfg.DeadCode, "dead-code", false, "Report unexported declarations nothing in the package refers to")
+	cmd.Flags().BoolVar(&anaCfg.Structured, "structured-recommendations", false, "Ask for recommendations as JSON and report them as typed fields")
+	cmd.Flags().StringVar(&anaCfg.Budget, "budget", "", "Check files or directories against a YAML size budget instead of analyzing")
+	cmd.Flags().StringVar(&anaCfg.AssumePackage, "assume-package", "", "Parse a fragment without a package clause as part of this package")
+	cmd.Flags().Float64Var(&anaCfg.Percentile, "percentile", 0, "List the files above this percentile (0-100) of line count as split candidates, without AI")
+	cmd.Flags().StringVar(&anaCfg.Since, "since", "", "Report sizes of the Go files changed since this git ref (checked against --budget if set)")
+	cmd.Flags().BoolVar(&anaCfg.StripComments, "strip-comments", false, "Also report the line count without comments and blank lines")
+
+	return cmd
+}
+
+// newAnalyzeResult fills in what an AnalyzeResult takes from the parsed
+// file alone.
+func newAnalyzeResult(info *analyzer.FileInfo) AnalyzeResult {
+	result := AnalyzeResult{
+		File:      filepath.Base(info.Path),
+		Package:   info.Package,
+		Lines:     info.Lines,
+		CodeLines: info.CodeLines,
+		InitFuncs: info.InitFuncs,
+		BuildTags: info.BuildTags,
+		Functions: len(info.Functions),
+		Types:     len(info.Types),
+		Variables: len(info.Vars),
+		Cgo:       info.CgoUsed,
+	}
+	for _, fn := range info.Functions {
+		if fn.Exported {
+			result.ExportedFunctions++
+		}
+	}
+	for _, t := range info.Types {
+		if t.Exported {
+			result.ExportedTypes++
+		}
+	}
+	return result
 }
 
 func runAnalyze(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed("percentile") {
+		return runPercentile(cmd, args)
+	}
+	if anaCfg.Budget != "" || anaCfg.Since != "" {
+		return runBudget(cmd, args)
+	}
+	if st, err := os.Stat(args[0]); err == nil && st.IsDir() && isLocalInput(args[0]) {
+		return runAnalyzePackage(cmd, args[0])
+	}
+
 	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
 
-	filename := args[0]
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return fmt.Errorf("file not found: %s", filename)
+	filename, content, normalized, err := readInput(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	var assumed string
+	if anaCfg.AssumePackage != "" {
+		if !token.IsIdentifier(anaCfg.AssumePackage) || anaCfg.AssumePackage == "_" {
+			return &usageError{err: fmt.Errorf("--assume-package must be a Go identifier, got %q", anaCfg.AssumePackage)}
+		}
+		var added bool
+		if content, added = analyzer.AssumePackage(content, anaCfg.AssumePackage); added {
+			assumed = anaCfg.AssumePackage
+		}
 	}
 
-	info, err := analyzer.ParseGoFile(filename)
+	info, err := analyzer.ParseGoSource(filename, content)
 	if err != nil {
 		return fmt.Errorf("parsing file: %w", err)
 	}
 
-	result := AnalyzeResult{
-		File:      filepath.Base(filename),
-		Package:   info.Package,
-		Lines:     info.Lines,
-		Functions: len(info.Functions),
-		Types:     len(info.Types),
-		Variables: len(info.Vars),
+	// The call graph is all a DOT rendering can show
+	if GetFormat() == "dot" {
+		return PrintOutput(cmd.OutOrStdout(), newCallGraphResult(info))
+	}
+
+	result := newAnalyzeResult(info)
+	result.Normalized = normalized
+	result.AssumedPackage = assumed
+
+	if anaCfg.StripComments {
+		stripped, stats := analyzer.StripComments(content)
+		if _, err := analyzer.ParseGoSource(filename, stripped); err != nil {
+			return fmt.Errorf("parsing file without comments: %w", err)
+		}
+		result.Stripped = &StrippedMetrics{Lines: stats.Code, CommentLines: stats.Comment, BlankLines: stats.Blank}
+	}
+
+	// Source read from stdin or fetched remotely has no directory of its own
+	local := isLocalInput(args[0])
+	if local {
+		result.PackageMismatch = packageMismatch(info.Package, filepath.Dir(filename))
 	}
 
-	// Check for associated test file
-	testFile := findTestFile(filename)
-	if testFile != "" {
+	if isEmptyFile(info) {
+		result.Empty = true
+		result.SplitReason = "nothing to split: the file has no declarations"
+		if IsStructuredOutput() {
+			return PrintOutput(cmd.OutOrStdout(), result)
+		}
+		ui.Header(fmt.Sprintf("📄 Analyzing %s (%d lines)", result.File, result.Lines))
+		ui.Success("Nothing to split: the file has no declarations")
+		return nil
+	}
+
+	result.Complexity = funcComplexities(info)
+
+	verdict := assessSplit(info)
+	result.SplitRecommended = verdict.Recommended
+	result.SplitReason = verdict.Reason
+
+	if anaCfg.DeadCode {
+		dir := filepath.Dir(filename)
+		if !local {
+			dir = "" // stdin and remote inputs have no package around them
+		}
+		unused, err := analyzer.Unreferenced(filename, content, dir)
+		if err != nil {
+			return fmt.Errorf("finding dead code: %w", err)
+		}
+		for _, sym := range unused {
+			result.DeadCode = append(result.DeadCode, DeadSymbol{Name: sym.Name, Kind: sym.Kind, Line: sym.Line})
+		}
+	}
+
+	// Pair tests with their source, or source with its tests
+	var sourceInfo *analyzer.FileInfo
+	if isTestFile(filename) {
+		stats := testStats(info)
+		result.TestStats = &stats
+		result.TestFunctions = stats.Tests
+		if sourceFile := findSourceFile(filename); local && sourceFile != "" {
+			if sourceInfo, err = analyzer.ParseGoFile(sourceFile); err == nil {
+				result.SourceFile = filepath.Base(sourceFile)
+			}
+		}
+	} else if testFile := findTestFile(filename); local && testFile != "" {
 		testInfo, err := analyzer.ParseGoFile(testFile)
 		if err == nil {
 			result.TestFile = filepath.Base(testFile)
@@ -71,68 +346,205 @@ func runAnalyze(cmd *cobra.Command, args []string) error {
 	}
 
 	if !IsStructuredOutput() {
-		ui.Header(fmt.Sprintf("📄 Analyzing %s (%d lines)", result.File, result.Lines))
+		ui.Header(fmt.Sprintf("📄 Analyzing %s (%d lines, %d of code)", result.File, result.Lines, result.CodeLines))
+		if st := result.Stripped; st != nil {
+			cmd.Printf("   Stripped:  %d lines of code, %d of comments, %d blank\n", st.Lines, st.CommentLines, st.BlankLines)
+		}
 		cmd.Printf("   Package:   %s\n", result.Package)
-		cmd.Printf("   Functions: %d\n", result.Functions)
-		cmd.Printf("   Types:     %d\n", result.Types)
+		cmd.Printf("   Functions: %d (%d exported)\n", result.Functions, result.ExportedFunctions)
+		cmd.Printf("   Types:     %d (%d exported)\n", result.Types, result.ExportedTypes)
 		cmd.Printf("   Variables: %d\n", result.Variables)
+		if len(result.Normalized) > 0 {
+			ui.Info(fmt.Sprintf("Normalized input: %s", strings.Join(result.Normalized, ", ")))
+		}
+		if result.AssumedPackage != "" {
+			ui.Info(fmt.Sprintf("No package clause; parsed as package %s", result.AssumedPackage))
+		}
+		if len(result.BuildTags) > 0 {
+			ui.Info(fmt.Sprintf("Build constraints: %s (kept in every generated file)", strings.Join(result.BuildTags, ", ")))
+		}
+		if result.InitFuncs > 0 {
+			ui.Info(fmt.Sprintf("%d init function(s): they run in file name order, so keep them in one file when splitting", result.InitFuncs))
+		}
+		if result.Cgo {
+			ui.Warning("Uses cgo: code calling C.* must stay with import \"C\"; generate refuses without --force")
+		}
+		if result.PackageMismatch {
+			dir, _ := filepath.Abs(filepath.Dir(filename))
+			ui.Warning(fmt.Sprintf("Package %s does not match directory %s", result.Package, filepath.Base(dir)))
+		}
+
+		if anaCfg.DeadCode {
+			if len(result.DeadCode) == 0 {
+				ui.Success("No unreferenced unexported declarations")
+			}
+			for _, d := range result.DeadCode {
+				ui.Warning(fmt.Sprintf("Unreferenced %s %s (line %d)", d.Kind, d.Name, d.Line))
+			}
+		}
 
-		if result.TestFile != "" {
+		switch {
+		case result.TestStats != nil:
+			st := result.TestStats
+			cmd.Printf("\n🧪 Tests: %d, benchmarks: %d, examples: %d, fuzz: %d\n", st.Tests, st.Benchmarks, st.Examples, st.Fuzz)
+			if result.SourceFile != "" {
+				cmd.Printf("   Source file: %s\n", result.SourceFile)
+			} else {
+				ui.Warning("No source file found for these tests")
+			}
+		case result.TestFile != "":
 			cmd.Printf("\n🧪 Test file: %s (%d lines, %d tests)\n", result.TestFile, result.TestLines, result.TestFunctions)
-		} else {
+		default:
 			ui.Warning("No associated test file found")
 		}
 
 		if cfg.Verbose {
+			if len(info.Types) > 0 {
+				cmd.Println("\n   Types:")
+				for _, t := range info.Types {
+					name := t.Name
+					if len(t.TypeParams) > 0 {
+						name += "[" + strings.Join(t.TypeParams, ", ") + "]"
+					}
+					cmd.Printf("     • %s %s (lines %d-%d, %d lines with methods)%s\n", name, t.Kind, t.DocLine, t.EndLine, t.TotalLines, docSuffix(t.Doc))
+				}
+			}
 			cmd.Println("\n   Functions:")
 			for _, fn := range info.Functions {
 				if fn.Receiver != "" {
-					cmd.Printf("     • (%s) %s (lines %d-%d)\n", fn.Receiver, fn.Name, fn.Line, fn.EndLine)
+					cmd.Printf("     • (%s) %s (lines %d-%d)%s\n", fn.Receiver, fn.Name, fn.DocLine, fn.EndLine, docSuffix(fn.Doc))
 				} else {
-					cmd.Printf("     • %s (lines %d-%d)\n", fn.Name, fn.Line, fn.EndLine)
+					cmd.Printf("     • %s (lines %d-%d)%s\n", fn.Name, fn.DocLine, fn.EndLine, docSuffix(fn.Doc))
+				}
+			}
+			if len(result.Complexity) > 0 {
+				cmd.Println("\n   Complexity:")
+				for _, c := range result.Complexity {
+					cmd.Printf("     • %-3d %s (line %d)\n", c.Complexity, c.Name, c.Line)
 				}
 			}
 		}
 	}
 
-	// Call API for recommendations
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("reading file: %w", err)
+	if !verdict.Recommended && !anaCfg.Force {
+		if IsStructuredOutput() {
+			return PrintOutput(cmd.OutOrStdout(), result)
+		}
+		cmd.Println()
+		ui.Success(fmt.Sprintf("Split not recommended: %s", verdict.Reason))
+		ui.Info("Use --force to get AI recommendations anyway")
+		return nil
 	}
 
+	// Call API for recommendations
 	ui.StartSpinner("Getting AI recommendations...")
 
-	client := newAPIClient()
-	prompt := fmt.Sprintf(`Analyze this Go file and propose how to split it into smaller, focused files.
-
-Return a brief summary with:
+	client := newTracedClient(newAPIClient(cmd.ErrOrStderr()).WithRetryHook(ui.Retrying))
+	ask := `Return a brief summary with:
 1. Recommended file names
 2. What each file should contain
-3. Why this split makes sense
+3. Why this split makes sense`
+	if anaCfg.Structured {
+		ask = structuredRecommendationsPrompt
+	}
+	prompt := fmt.Sprintf(`Analyze this Go file and propose how to split it into smaller, focused files.
+
+%s
+
+Be concise. File content (%s):
+%s`, ask, filepath.Base(filename), string(content))
+	if result.TestStats != nil {
+		var source string
+		if sourceInfo != nil {
+			source = "\n\nDeclarations in the source file under test:\n" + summarizeFile(sourceInfo)
+		}
+		ask := `Return a brief summary with:
+1. Recommended test file names (mirroring the source files they test where possible)
+2. Which tests, benchmarks and examples each file should contain
+3. Why this split makes sense`
+		if anaCfg.Structured {
+			ask = structuredRecommendationsPrompt
+		}
+		prompt = fmt.Sprintf(`Analyze this Go test file and propose how to split the tests into smaller, focused _test.go files.
+
+%s
 
-Be concise. File content:
-%s`, string(content))
+Keep tests next to the code they exercise and shared helpers in one place.
 
-	response, err := client.Call(prompt, 1500)
+Be concise. Test file content (%s):
+%s%s`, ask, filepath.Base(filename), string(content), source)
+	}
+
+	response, err := client.Call(phaseAnalyze, result.File, prompt, 1500)
 	if err != nil {
 		ui.StopSpinnerMsg(false, "API call failed")
-		return fmt.Errorf("API call failed: %w", err)
+		return fmt.Errorf("API call failed: %w", apiError(err))
 	}
 
 	ui.StopSpinnerMsg(true, "Got recommendations")
-	result.Recommendations = response
+	result.Calls = client.calls
+	if anaCfg.Structured {
+		result.StructuredRecommendations = parseRecommendations(response)
+	}
+	if result.StructuredRecommendations == nil {
+		result.Recommendations = response
+	}
 
 	if IsStructuredOutput() {
 		return PrintOutput(cmd.OutOrStdout(), result)
 	}
 
 	ui.Header("📋 Recommendations")
-	cmd.Println(response)
+	if anaCfg.Structured && result.StructuredRecommendations == nil {
+		ui.Warning("Could not parse structured recommendations; showing the response as is")
+	}
+	for _, r := range result.StructuredRecommendations {
+		cmd.Printf("   %s: %s\n", r.Filename, r.ContentsDescription)
+		if len(r.Functions) > 0 {
+			cmd.Printf("     Functions: %s\n", strings.Join(r.Functions, ", "))
+		}
+		if r.Rationale != "" {
+			cmd.Printf("     Why: %s\n", r.Rationale)
+		}
+	}
+	if result.Recommendations != "" {
+		cmd.Println(response)
+	}
+	if cfg.Verbose {
+		printCallSummary(cmd, result.Calls)
+	}
 
 	return nil
 }
 
+// structuredRecommendationsPrompt asks for the recommendations as JSON that
+// parseRecommendations understands.
+const structuredRecommendationsPrompt = `Return ONLY a JSON array, one object per recommended file:
+[{"filename": "store.go", "contents_description": "what the file holds", "functions": ["NewStore", "Store.Get"], "rationale": "why these belong together"}]`
+
+// parseRecommendations extracts the recommended files from a JSON response,
+// returning nil if there is no usable array of them.
+func parseRecommendations(response string) []Recommendation {
+	start := strings.Index(response, "[")
+	end := strings.LastIndex(response, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+	var recs []Recommendation
+	if err := json.Unmarshal([]byte(response[start:end+1]), &recs); err != nil {
+		return nil
+	}
+	for _, r := range recs {
+		if r.Filename == "" {
+			return nil
+		}
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	return recs
+}
+
 func findTestFile(filename string) string {
 	base := strings.TrimSuffix(filename, ".go")
 	testFile := base + "_test.go"
@@ -142,6 +554,36 @@ func findTestFile(filename string) string {
 	return ""
 }
 
+// findSourceFile returns the source file a _test.go file tests, or "" if
+// it does not exist.
+func findSourceFile(testFilename string) string {
+	source := strings.TrimSuffix(testFilename, "_test.go") + ".go"
+	if _, err := os.Stat(source); err == nil {
+		return source
+	}
+	return ""
+}
+
+// testStats counts the test functions in info by kind.
+func testStats(info *analyzer.FileInfo) TestStats {
+	var st TestStats
+	for _, fn := range info.Functions {
+		switch analyzer.ClassifyTestFunc(fn) {
+		case analyzer.KindTest:
+			st.Tests++
+		case analyzer.KindBenchmark:
+			st.Benchmarks++
+		case analyzer.KindExample:
+			st.Examples++
+		case analyzer.KindFuzz:
+			st.Fuzz++
+		case analyzer.KindTestMain:
+			st.TestMain = true
+		}
+	}
+	return st
+}
+
 func countTestFunctions(info *analyzer.FileInfo) int {
 	count := 0
 	for _, fn := range info.Functions {
@@ -151,3 +593,27 @@ func countTestFunctions(info *analyzer.FileInfo) int {
 	}
 	return count
 }
+
+// funcComplexities lists the complexity of every function in info, most
+// complex first and in source order among equals.
+func funcComplexities(info *analyzer.FileInfo) []FuncComplexity {
+	var out []FuncComplexity
+	for _, fn := range info.Functions {
+		name := fn.Name
+		if fn.Receiver != "" {
+			name = fn.ReceiverType() + "." + fn.Name
+		}
+		out = append(out, FuncComplexity{Name: name, Line: fn.Line, Complexity: fn.Complexity})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Complexity > out[j].Complexity })
+	return out
+}
+
+// docSuffix returns " - " and the first sentence of a doc comment, for
+// verbose listings, or "" for an undocumented declaration.
+func docSuffix(doc string) string {
+	if summary := analyzer.DocSummary(doc); summary != "" {
+		return " - " + summary
+	}
+	return ""
+}
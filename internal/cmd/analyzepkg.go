@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// runAnalyzePackage analyzes every non-test Go file of dir without AI and
+// ranks them by line count, largest first, to find the file most in need
+// of a split.
+func runAnalyzePackage(cmd *cobra.Command, dir string) error {
+	for _, f := range []struct {
+		flag string
+		set  bool
+	}{
+		{"--dead-code", anaCfg.DeadCode},
+		{"--structured-recommendations", anaCfg.Structured},
+		{"--assume-package", anaCfg.AssumePackage != ""},
+		{"--strip-comments", anaCfg.StripComments},
+		{"--force", anaCfg.Force},
+		{"--format dot", GetFormat() == "dot"},
+	} {
+		if f.set {
+			return &usageError{err: fmt.Errorf("%s needs a file, not a directory: %s", f.flag, dir)}
+		}
+	}
+
+	infos, err := analyzer.ParsePackage(dir)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", dir, err)
+	}
+	if len(infos) == 0 {
+		return fmt.Errorf("no Go files in %s", dir)
+	}
+
+	results := make([]AnalyzeResult, len(infos))
+	for i, info := range infos {
+		result := newAnalyzeResult(info)
+		result.PackageMismatch = packageMismatch(info.Package, dir)
+		if isEmptyFile(info) {
+			result.Empty = true
+			result.SplitReason = "nothing to split: the file has no declarations"
+		} else {
+			result.Complexity = funcComplexities(info)
+			verdict := assessSplit(info)
+			result.SplitRecommended = verdict.Recommended
+			result.SplitReason = verdict.Reason
+		}
+		if testFile := findTestFile(info.Path); testFile != "" {
+			if testInfo, err := analyzer.ParseGoFile(testFile); err == nil {
+				result.TestFile = filepath.Base(testFile)
+				result.TestLines = testInfo.Lines
+				result.TestFunctions = countTestFunctions(testInfo)
+			}
+		}
+		results[i] = result
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Lines > results[j].Lines })
+
+	if IsStructuredOutput() {
+		return PrintOutput(cmd.OutOrStdout(), results)
+	}
+
+	ui := NewUI(cmd.OutOrStdout(), false)
+	var total, recommended int
+	for _, r := range results {
+		total += r.Lines
+		if r.SplitRecommended {
+			recommended++
+		}
+	}
+	ui.Header(fmt.Sprintf("📦 Analyzing %s (package %s, %d files, %d lines)", dir, results[0].Package, len(results), total))
+	cmd.Printf("   %3s  %-32s %6s %6s %6s %6s  %s\n", "#", "FILE", "LINES", "CODE", "FUNCS", "TYPES", "SPLIT")
+	for i, r := range results {
+		split := ""
+		if r.SplitRecommended {
+			split = "yes"
+		}
+		row := fmt.Sprintf("   %3d  %-32s %6d %6d %6d %6d  %s", i+1, truncateLeft(r.File, 32), r.Lines, r.CodeLines, r.Functions, r.Types, split)
+		cmd.Println(strings.TrimRight(row, " "))
+	}
+	cmd.Println()
+	if recommended == 0 {
+		ui.Success("No file needs splitting")
+		return nil
+	}
+	ui.Info(fmt.Sprintf("%d of %d files recommended for splitting; analyze one for details", recommended, len(results)))
+	return nil
+}
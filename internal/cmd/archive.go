@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// stdoutOutput is the --output value that streams generated files to
+// stdout as an archive instead of writing them next to the source.
+const stdoutOutput = "-"
+
+// runGenerateToArchive runs generate into a scratch directory and writes
+// the files it produced to stdout as a tar or zip archive. Progress and
+// structured results go to stderr so stdout carries only the archive.
+func runGenerateToArchive(cmd *cobra.Command, args []string) error {
+	if genCfg.Archive != "tar" && genCfg.Archive != "zip" {
+		return &usageError{err: fmt.Errorf("--archive must be tar or zip, got %q", genCfg.Archive)}
+	}
+	if genCfg.NewPackage {
+		return &usageError{err: fmt.Errorf("--new-package needs a directory inside the module, not --output -")}
+	}
+
+	scratch, err := os.MkdirTemp("", "go-split-")
+	if err != nil {
+		return fmt.Errorf("creating scratch directory: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+
+	stdout := cmd.OutOrStdout()
+	cmd.SetOut(cmd.ErrOrStderr())
+	defer cmd.SetOut(stdout)
+	cfg.OutputDir = scratch
+	defer func() { cfg.OutputDir = stdoutOutput }()
+	// The scratch directory is not a package go test can build
+	genCfg.SkipValidation = true
+
+	runErr := runGenerate(cmd, args)
+	if err := writeArchive(stdout, scratch, genCfg.Archive); err != nil {
+		return fmt.Errorf("writing %s archive: %w", genCfg.Archive, err)
+	}
+	return runErr
+}
+
+// writeArchive writes the regular files under dir, in path order, to w as
+// a tar or zip archive with entries named by their slash-separated path
+// relative to dir (the file name, unless --output-layout mirror made
+// subdirectories).
+func writeArchive(w io.Writer, dir, format string) error {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(name))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	var add func(name string, data []byte) error
+	var closer io.Closer
+	switch format {
+	case "zip":
+		zw := zip.NewWriter(w)
+		add = func(name string, data []byte) error {
+			hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+			hdr.SetMode(fileMode())
+			f, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = f.Write(data)
+			return err
+		}
+		closer = zw
+	default:
+		tw := tar.NewWriter(w)
+		add = func(name string, data []byte) error {
+			hdr := &tar.Header{Name: name, Mode: int64(fileMode()), Size: int64(len(data)), ModTime: time.Now()}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := tw.Write(data)
+			return err
+		}
+		closer = tw
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if err := add(name, data); err != nil {
+			return err
+		}
+	}
+	return closer.Close()
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// writeBarrel replaces the source file of a --new-package split with a
+// barrel (see buildBarrel), provided every output file was created, and
+// checks that the source package still builds.
+func writeBarrel(ui *UI, warn func(string), arg, filename string, src []byte, result *GenerateResult) error {
+	switch {
+	case !isLocalInput(arg):
+		return fmt.Errorf("the source is not a file")
+	case result.ImportPath == "":
+		return fmt.Errorf("the output package cannot be imported")
+	}
+	for _, f := range result.Files {
+		if f.Status != "created" {
+			return fmt.Errorf("%s was not created", f.Name)
+		}
+	}
+
+	code, skipped, err := buildBarrel(filename, src, result.Package, result.ImportPath)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filename, code); err != nil {
+		return err
+	}
+	result.Barrel = filepath.Base(filename)
+	ui.Info(fmt.Sprintf("Replaced %s with a barrel re-exporting %s", result.Barrel, result.ImportPath))
+	for _, s := range skipped {
+		warn(fmt.Sprintf("The barrel cannot re-export %s", s))
+	}
+	if !genCfg.SkipValidation {
+		if err := runGo(filepath.Dir(filename), genCfg.ValidateTimeout, "build", "-o", os.DevNull, "."); err != nil {
+			warn(fmt.Sprintf("%s does not build with the barrel: %v", filepath.Dir(filename), err))
+		}
+	}
+	return nil
+}
+
+// buildBarrel returns a replacement for the source file at filename whose
+// declarations all moved to the package pkgName at importPath: a thin file
+// in the original package re-exporting the moved API so existing callers
+// keep compiling. Exported types become aliases, constants refer to the
+// moved ones and functions forward their calls. Functions whose signature
+// names an unexported type become variables holding the moved function.
+// Exported variables cannot be re-exported (Go has no variable aliases), nor
+// can generic types before Go 1.24; they are returned in skipped.
+func buildBarrel(filename string, src []byte, pkgName, importPath string) (code []byte, skipped []string, err error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unexported := make(map[string]bool)
+	for _, name := range declaredTypeNames(file) {
+		if !ast.IsExported(name) {
+			unexported[name] = true
+		}
+	}
+	imports := make(map[string]*ast.ImportSpec)
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := analyzer.ImportName(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imports[name] = imp
+	}
+	used := make(map[*ast.ImportSpec]bool)
+
+	var decls []string
+	deprecated := func(name string) string {
+		return fmt.Sprintf("// Deprecated: Use %s.%s instead.\n", pkgName, name)
+	}
+	for _, d := range file.Decls {
+		switch decl := d.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv != nil || !ast.IsExported(name) {
+				continue
+			}
+			if namesAny(decl.Type, unexported) {
+				decls = append(decls, deprecated(name)+fmt.Sprintf("var %s = %s.%s", name, pkgName, name))
+				continue
+			}
+			for x := range selectorPackages(decl.Type) {
+				if imp, ok := imports[x]; ok {
+					used[imp] = true
+				}
+			}
+			decls = append(decls, deprecated(name)+forwarder(fset, decl, pkgName))
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					name := s.Name.Name
+					switch {
+					case !ast.IsExported(name):
+					case s.TypeParams != nil:
+						skipped = append(skipped, name+" (generic type aliases need Go 1.24)")
+					default:
+						decls = append(decls, deprecated(name)+fmt.Sprintf("type %s = %s.%s", name, pkgName, name))
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						switch {
+						case !ast.IsExported(n.Name):
+						case decl.Tok == token.CONST:
+							decls = append(decls, deprecated(n.Name)+fmt.Sprintf("const %s = %s.%s", n.Name, pkgName, n.Name))
+						default:
+							skipped = append(skipped, n.Name+" (Go has no variable aliases)")
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by go-split --barrel. The declarations of this file moved\n// to %s; import it directly instead.\n\n", importPath)
+	fmt.Fprintf(&b, "package %s\n\nimport (\n", file.Name.Name)
+	for _, imp := range file.Imports {
+		if used[imp] {
+			if imp.Name != nil {
+				fmt.Fprintf(&b, "\t%s %s\n", imp.Name.Name, imp.Path.Value)
+			} else {
+				fmt.Fprintf(&b, "\t%s\n", imp.Path.Value)
+			}
+		}
+	}
+	if len(used) > 0 {
+		b.WriteString("\n")
+	}
+	if pkgName != analyzer.ImportName(importPath) {
+		fmt.Fprintf(&b, "\t%s %q\n", pkgName, importPath)
+	} else {
+		fmt.Fprintf(&b, "\t%q\n", importPath)
+	}
+	b.WriteString(")\n")
+	for _, d := range decls {
+		b.WriteString("\n" + d + "\n")
+	}
+
+	code, err = format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("formatting barrel: %w", err)
+	}
+	return code, skipped, nil
+}
+
+// forwarder returns a function with the signature of fn that calls the
+// function of the same name in pkgName. Parameters are renamed p0, p1, ...
+// when unnamed, blank or shadowing pkgName.
+func forwarder(fset *token.FileSet, fn *ast.FuncDecl, pkgName string) string {
+	var params, args []string
+	i := 0
+	for _, field := range fn.Type.Params.List {
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		typ := nodeString(fset, field.Type)
+		for _, n := range names {
+			name := fmt.Sprintf("p%d", i)
+			if n != nil && n.Name != "_" && n.Name != pkgName {
+				name = n.Name
+			}
+			i++
+			params = append(params, name+" "+typ)
+			if _, ok := field.Type.(*ast.Ellipsis); ok {
+				name += "..."
+			}
+			args = append(args, name)
+		}
+	}
+
+	var typeParams, typeArgs []string
+	if tp := fn.Type.TypeParams; tp != nil {
+		for _, field := range tp.List {
+			var names []string
+			for _, n := range field.Names {
+				names = append(names, n.Name)
+			}
+			typeParams = append(typeParams, strings.Join(names, ", ")+" "+nodeString(fset, field.Type))
+			typeArgs = append(typeArgs, names...)
+		}
+	}
+
+	var b strings.Builder
+	name := fn.Name.Name
+	b.WriteString("func " + name)
+	call := pkgName + "." + name
+	if len(typeParams) > 0 {
+		b.WriteString("[" + strings.Join(typeParams, ", ") + "]")
+		call += "[" + strings.Join(typeArgs, ", ") + "]"
+	}
+	b.WriteString("(" + strings.Join(params, ", ") + ")")
+	if results := fn.Type.Results; results != nil {
+		var types []string
+		for _, field := range results.List {
+			for range max(len(field.Names), 1) {
+				types = append(types, nodeString(fset, field.Type))
+			}
+		}
+		b.WriteString(" (" + strings.Join(types, ", ") + ")")
+		call = "return " + call
+	}
+	b.WriteString(" {\n\t" + call + "(" + strings.Join(args, ", ") + ")\n}")
+	return b.String()
+}
+
+// declaredTypeNames returns the names of the types file declares.
+func declaredTypeNames(file *ast.File) []string {
+	var names []string
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.TYPE {
+			for _, spec := range gd.Specs {
+				names = append(names, spec.(*ast.TypeSpec).Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// namesAny reports whether node refers to any of names by a bare identifier.
+func namesAny(node ast.Node, names map[string]bool) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			return false
+		case *ast.Ident:
+			found = found || names[x.Name]
+		}
+		return !found
+	})
+	return found
+}
+
+// selectorPackages returns the identifiers qualifying selectors in node,
+// the package names of types such as io.Reader.
+func selectorPackages(node ast.Node) map[string]bool {
+	pkgs := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				pkgs[x.Name] = true
+			}
+			return false
+		}
+		return true
+	})
+	return pkgs
+}
+
+// nodeString prints node as Go source.
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
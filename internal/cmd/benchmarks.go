@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// MisplacedBenchmark is a benchmark that did not land in the test file
+// paired with the code it measures.
+type MisplacedBenchmark struct {
+	Benchmark string `json:"benchmark"`
+	File      string `json:"file"`
+	Want      string `json:"want"`
+}
+
+// benchmarkHome returns the test file a benchmark belongs in: the test file
+// paired with the source file declaring its subject, falling back to the
+// file holding the matching Test function. It returns "" when neither can
+// be located.
+func benchmarkHome(bench string, sources, tests []*analyzer.FileInfo) string {
+	subject := analyzer.TestSubject(bench)
+	if subject == "" {
+		return ""
+	}
+
+	// "Parse.Empty" may be a method or a variant of Parse; try both
+	candidates := []string{subject}
+	if i := strings.Index(subject, "."); i > 0 {
+		candidates = append(candidates, subject[:i])
+	}
+
+	for _, name := range candidates {
+		for _, src := range sources {
+			for _, sym := range src.Symbols() {
+				if sym.Name == name {
+					return testFileFor(filepath.Base(src.Path))
+				}
+			}
+		}
+	}
+
+	for _, name := range candidates {
+		testName := "Test" + strings.Replace(name, ".", "_", 1)
+		for _, tf := range tests {
+			for _, fn := range tf.Functions {
+				if fn.Name == testName && analyzer.ClassifyTestFunc(fn) == analyzer.KindTest {
+					return filepath.Base(tf.Path)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// findMisplacedBenchmarks reports generated benchmarks living apart from
+// the code they measure.
+func findMisplacedBenchmarks(sources, tests []*analyzer.FileInfo) []MisplacedBenchmark {
+	var misplaced []MisplacedBenchmark
+	for _, tf := range tests {
+		file := filepath.Base(tf.Path)
+		for _, fn := range tf.Functions {
+			if analyzer.ClassifyTestFunc(fn) != analyzer.KindBenchmark {
+				continue
+			}
+			if want := benchmarkHome(fn.Name, sources, tests); want != "" && want != file {
+				misplaced = append(misplaced, MisplacedBenchmark{Benchmark: fn.Name, File: file, Want: want})
+			}
+		}
+	}
+	sort.Slice(misplaced, func(i, j int) bool { return misplaced[i].Benchmark < misplaced[j].Benchmark })
+	return misplaced
+}
+
+// benchmarkRoutingRules describes, for the generation prompt, which code
+// each benchmark in the original test file measures.
+func benchmarkRoutingRules(testInfo *analyzer.FileInfo) string {
+	if testInfo == nil {
+		return ""
+	}
+	var rules []string
+	for _, fn := range testInfo.Functions {
+		if analyzer.ClassifyTestFunc(fn) != analyzer.KindBenchmark {
+			continue
+		}
+		if subject := analyzer.TestSubject(fn.Name); subject != "" {
+			rules = append(rules, fmt.Sprintf("- %s measures %s: put it in the same test file as %s and its tests", fn.Name, subject, subject))
+		}
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return "\n\nBenchmarks must stay with the code they measure:\n" + strings.Join(rules, "\n")
+}
+
+// testFileFor returns the test file name paired with a source file name.
+func testFileFor(name string) string {
+	return strings.TrimSuffix(name, ".go") + "_test.go"
+}
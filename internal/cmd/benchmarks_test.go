@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+func TestBenchmarkHome(t *testing.T) {
+	dir := t.TempDir()
+	parse := parseTestSource(t, dir, "parse.go", "package foo\n\nfunc Parse() {}\n")
+	client := parseTestSource(t, dir, "client.go", "package foo\n\ntype Client struct{}\n\nfunc (c *Client) Call() {}\n")
+	misc := parseTestSource(t, dir, "misc_test.go", "package foo\n\nimport \"testing\"\n\nfunc TestOrphan(t *testing.T) {}\n")
+	sources := []*analyzer.FileInfo{parse, client}
+	tests := []*analyzer.FileInfo{misc}
+
+	cases := map[string]string{
+		"BenchmarkParse":       "parse_test.go",
+		"BenchmarkParse_Large": "parse_test.go",
+		"BenchmarkClient_Call": "client_test.go",
+		"BenchmarkOrphan":      "misc_test.go",
+		"BenchmarkUnknown":     "",
+	}
+	for bench, want := range cases {
+		if got := benchmarkHome(bench, sources, tests); got != want {
+			t.Errorf("benchmarkHome(%q) = %q, want %q", bench, got, want)
+		}
+	}
+}
+
+func TestFindMisplacedBenchmarks(t *testing.T) {
+	dir := t.TempDir()
+	parse := parseTestSource(t, dir, "parse.go", "package foo\n\nfunc Parse() {}\n")
+	format := parseTestSource(t, dir, "format.go", "package foo\n\nfunc Format() {}\n")
+	parseTest := parseTestSource(t, dir, "parse_test.go", `package foo
+
+import "testing"
+
+func TestParse(t *testing.T) {}
+
+func BenchmarkParse(b *testing.B) {}
+
+func BenchmarkFormat(b *testing.B) {}
+`)
+	formatTest := parseTestSource(t, dir, "format_test.go", "package foo\n\nimport \"testing\"\n\nfunc TestFormat(t *testing.T) {}\n")
+
+	got := findMisplacedBenchmarks([]*analyzer.FileInfo{parse, format}, []*analyzer.FileInfo{parseTest, formatTest})
+	want := []MisplacedBenchmark{{Benchmark: "BenchmarkFormat", File: "parse_test.go", Want: "format_test.go"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findMisplacedBenchmarks() = %v, want %v", got, want)
+	}
+}
+
+func TestBenchmarkRoutingRules(t *testing.T) {
+	dir := t.TempDir()
+	testInfo := parseTestSource(t, dir, "big_test.go", `package foo
+
+import "testing"
+
+func TestParse(t *testing.T) {}
+
+func BenchmarkParse(b *testing.B) {}
+`)
+
+	rules := benchmarkRoutingRules(testInfo)
+	if !strings.Contains(rules, "BenchmarkParse measures Parse") {
+		t.Errorf("benchmarkRoutingRules() = %q, want rule for BenchmarkParse", rules)
+	}
+	if strings.Contains(rules, "TestParse measures") {
+		t.Errorf("benchmarkRoutingRules() should only describe benchmarks: %q", rules)
+	}
+}
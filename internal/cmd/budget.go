@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// Budget is a per-file size policy loaded from analyze --budget. A zero
+// limit is not enforced.
+type Budget struct {
+	MaxLines      int `yaml:"max_lines" json:"max_lines,omitempty"`
+	MaxFunctions  int `yaml:"max_functions" json:"max_functions,omitempty"`
+	MaxComplexity int `yaml:"max_complexity" json:"max_complexity,omitempty"` // per function
+}
+
+// BudgetViolation is one limit a file exceeds.
+type BudgetViolation struct {
+	Metric string `json:"metric"`           // lines, functions or complexity
+	Symbol string `json:"symbol,omitempty"` // function, for complexity
+	Limit  int    `json:"limit"`
+	Actual int    `json:"actual"`
+}
+
+// BudgetFileResult is the budget verdict for one file.
+type BudgetFileResult struct {
+	File       string            `json:"file"`
+	Lines      int               `json:"lines"`
+	Functions  int               `json:"functions"`
+	Passed     bool              `json:"passed"`
+	Violations []BudgetViolation `json:"violations,omitempty"`
+}
+
+// BudgetResult holds analyze --budget and --since results for JSON output.
+type BudgetResult struct {
+	Budget Budget             `json:"budget"`
+	Since  string             `json:"since,omitempty"` // git ref the files changed since
+	Passed bool               `json:"passed"`
+	Files  []BudgetFileResult `json:"files"`
+}
+
+// Markdown renders the result as a self-contained table for a PR comment.
+func (r BudgetResult) Markdown() string {
+	var b strings.Builder
+	title := "Go file sizes"
+	if r.Since != "" {
+		title += fmt.Sprintf(" (changed since `%s`)", r.Since)
+	}
+	fmt.Fprintf(&b, "### %s\n\n", title)
+	if len(r.Files) == 0 {
+		b.WriteString("No Go files to check.\n")
+		return b.String()
+	}
+
+	budgeted := r.Budget != (Budget{})
+	if budgeted {
+		b.WriteString("| File | Lines | Functions | Budget |\n|---|---:|---:|---|\n")
+	} else {
+		b.WriteString("| File | Lines | Functions |\n|---|---:|---:|\n")
+	}
+	failed := 0
+	for _, f := range r.Files {
+		fmt.Fprintf(&b, "| `%s` | %d | %d |", f.File, f.Lines, f.Functions)
+		if budgeted {
+			verdict := "✅"
+			if !f.Passed {
+				failed++
+				var over []string
+				for _, v := range f.Violations {
+					what := v.Metric
+					if v.Symbol != "" {
+						what = "`" + v.Symbol + "` " + what
+					}
+					over = append(over, fmt.Sprintf("%s %d > %d", what, v.Actual, v.Limit))
+				}
+				verdict = "❌ " + strings.Join(over, "; ")
+			}
+			fmt.Fprintf(&b, " %s |", verdict)
+		}
+		b.WriteString("\n")
+	}
+
+	if budgeted {
+		var limits []string
+		for _, l := range []struct {
+			name  string
+			value int
+		}{{"max_lines", r.Budget.MaxLines}, {"max_functions", r.Budget.MaxFunctions}, {"max_complexity", r.Budget.MaxComplexity}} {
+			if l.value > 0 {
+				limits = append(limits, fmt.Sprintf("%s %d", l.name, l.value))
+			}
+		}
+		fmt.Fprintf(&b, "\n%d of %d files exceed the budget (%s).\n", failed, len(r.Files), strings.Join(limits, ", "))
+	}
+	return b.String()
+}
+
+// loadBudget reads and validates a budget file.
+func loadBudget(path string) (Budget, error) {
+	var b Budget
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return b, fmt.Errorf("reading budget: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&b); err != nil {
+		return b, fmt.Errorf("parsing budget %s: %w", path, err)
+	}
+	if b.MaxLines < 0 || b.MaxFunctions < 0 || b.MaxComplexity < 0 {
+		return b, fmt.Errorf("budget %s: limits must not be negative", path)
+	}
+	if b == (Budget{}) {
+		return b, fmt.Errorf("budget %s sets no limits (max_lines, max_functions, max_complexity)", path)
+	}
+	return b, nil
+}
+
+// checkBudget returns the limits info exceeds, in lines, functions,
+// complexity order.
+func checkBudget(info *analyzer.FileInfo, b Budget) []BudgetViolation {
+	var violations []BudgetViolation
+	if b.MaxLines > 0 && info.Lines > b.MaxLines {
+		violations = append(violations, BudgetViolation{Metric: "lines", Limit: b.MaxLines, Actual: info.Lines})
+	}
+	if b.MaxFunctions > 0 && len(info.Functions) > b.MaxFunctions {
+		violations = append(violations, BudgetViolation{Metric: "functions", Limit: b.MaxFunctions, Actual: len(info.Functions)})
+	}
+	if b.MaxComplexity > 0 {
+		for _, fn := range info.Functions {
+			if fn.Complexity <= b.MaxComplexity {
+				continue
+			}
+			name := fn.Name
+			if fn.Receiver != "" {
+				name = fn.ReceiverType() + "." + fn.Name
+			}
+			violations = append(violations, BudgetViolation{Metric: "complexity", Symbol: name, Limit: b.MaxComplexity, Actual: fn.Complexity})
+		}
+	}
+	return violations
+}
+
+// budgetTargets parses the files to check: each argument is a Go file or a
+// directory, whose non-test files are all checked.
+func budgetTargets(args []string) ([]*analyzer.FileInfo, error) {
+	var infos []*analyzer.FileInfo
+	for _, arg := range args {
+		st, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("not found: %s", arg)
+		}
+		if st.IsDir() {
+			pkg, err := analyzer.ParsePackage(arg)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", arg, err)
+			}
+			infos = append(infos, pkg...)
+			continue
+		}
+		info, err := analyzer.ParseGoFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", arg, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// changedGoFiles lists the non-test Go files changed since ref, relative
+// to the working directory and limited to paths if any are given. Deleted
+// files are left out.
+func changedGoFiles(ref string, paths []string) ([]string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return nil, &usageError{err: fmt.Errorf("--since must be a git ref, got %q", ref)}
+	}
+	args := append([]string{"diff", "--name-only", "--relative", "--diff-filter=d", ref, "--"}, paths...)
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("listing files changed since %s: %s", ref, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("listing files changed since %s: %w", ref, err)
+	}
+	var files []string
+	for _, name := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if strings.HasSuffix(name, ".go") && !isTestFile(name) {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// runBudget checks every target against the --budget file, failing if any
+// file exceeds it. With --since the targets are the Go files changed since
+// that ref, and without --budget only their sizes are reported.
+func runBudget(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+
+	var budget Budget
+	var err error
+	if anaCfg.Budget != "" {
+		if budget, err = loadBudget(anaCfg.Budget); err != nil {
+			return err
+		}
+	}
+	targets := args
+	if anaCfg.Since != "" {
+		if targets, err = changedGoFiles(anaCfg.Since, args); err != nil {
+			return err
+		}
+	}
+	infos, err := budgetTargets(targets)
+	if err != nil {
+		return err
+	}
+
+	result := BudgetResult{Budget: budget, Since: anaCfg.Since, Passed: true}
+	failed := 0
+	for _, info := range infos {
+		fr := BudgetFileResult{File: info.Path, Lines: info.Lines, Functions: len(info.Functions), Violations: checkBudget(info, budget)}
+		fr.Passed = len(fr.Violations) == 0
+		if !fr.Passed {
+			result.Passed = false
+			failed++
+		}
+		result.Files = append(result.Files, fr)
+	}
+
+	if IsStructuredOutput() {
+		if err := PrintOutput(cmd.OutOrStdout(), result); err != nil {
+			return err
+		}
+	} else {
+		switch {
+		case anaCfg.Budget == "":
+			ui.Header(fmt.Sprintf("📏 %d Go files changed since %s", len(infos), anaCfg.Since))
+		case anaCfg.Since != "":
+			ui.Header(fmt.Sprintf("📏 Checking %d files changed since %s against %s", len(infos), anaCfg.Since, filepath.Base(anaCfg.Budget)))
+		default:
+			ui.Header(fmt.Sprintf("📏 Checking %d files against %s", len(infos), filepath.Base(anaCfg.Budget)))
+		}
+		for _, fr := range result.Files {
+			if anaCfg.Budget == "" {
+				cmd.Printf("   %s: %d lines, %d functions\n", fr.File, fr.Lines, fr.Functions)
+				continue
+			}
+			if fr.Passed {
+				if cfg.Verbose {
+					cmd.Printf("   ✓ %s\n", fr.File)
+				}
+				continue
+			}
+			cmd.Printf("   ✗ %s\n", fr.File)
+			for _, v := range fr.Violations {
+				if v.Symbol != "" {
+					cmd.Printf("        %s: %s %d > %d\n", v.Symbol, v.Metric, v.Actual, v.Limit)
+				} else {
+					cmd.Printf("        %s %d > %d\n", v.Metric, v.Actual, v.Limit)
+				}
+			}
+		}
+		cmd.Println()
+		if result.Passed && anaCfg.Budget != "" {
+			ui.Success(fmt.Sprintf("All %d files are within budget", len(infos)))
+		}
+	}
+
+	if !result.Passed {
+		// A violation is not a usage mistake; keep the help text out of CI logs
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d files exceed the budget", failed, len(infos))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aaronlippold/go-split/internal/api"
+)
+
+// Phases of a run, as reported in CallStat.Phase.
+const (
+	phaseAnalyze  = "analyze"
+	phasePlan     = "plan"
+	phaseGenerate = "generate"
+	phaseStubs    = "stubs"
+	phaseDocs     = "docs"
+)
+
+// CallStat records one model call made during a run.
+type CallStat struct {
+	Phase      string `json:"phase"`
+	Target     string `json:"target,omitempty"` // File the call produced, if any
+	Model      string `json:"model,omitempty"`  // Model that served the call
+	MaxTokens  int    `json:"max_tokens"`
+	DurationMS int64  `json:"duration_ms"`
+	Success    bool   `json:"success"`
+}
+
+// tracedClient wraps an API client and records every call made through it.
+type tracedClient struct {
+	*api.Client
+	calls    []CallStat
+	timeouts map[string]time.Duration // Per-phase overrides of the client timeout
+}
+
+func newTracedClient(client *api.Client) *tracedClient {
+	return &tracedClient{Client: client}
+}
+
+// Call sends prompt like api.Client.Call, recording it under phase and
+// target. The call is bounded by the phase's timeout when one is set.
+func (t *tracedClient) Call(phase, target, prompt string, maxTokens int) (string, error) {
+	start := time.Now()
+	response, model, err := t.Client.CallServed(prompt, maxTokens, t.timeouts[phase])
+	t.calls = append(t.calls, CallStat{
+		Phase:      phase,
+		Target:     target,
+		Model:      model,
+		MaxTokens:  maxTokens,
+		DurationMS: time.Since(start).Milliseconds(),
+		Success:    err == nil,
+	})
+	return response, err
+}
+
+// printCallSummary prints one line per call and the total time, for
+// --verbose text output.
+func printCallSummary(cmd *cobra.Command, calls []CallStat) {
+	if len(calls) == 0 {
+		return
+	}
+	var total int64
+	cmd.Println("\n   AI calls:")
+	cmd.Printf("     %-9s %-28s %10s %10s  %s\n", "PHASE", "TARGET", "MAX_TOKENS", "DURATION", "OK")
+	for _, c := range calls {
+		ok := "✓"
+		if !c.Success {
+			ok = "✗"
+		}
+		if c.Model != "" && c.Model != cfg.Model {
+			ok += " via " + c.Model
+		}
+		cmd.Printf("     %-9s %-28s %10d %9.1fs  %s\n", c.Phase, c.Target, c.MaxTokens, float64(c.DurationMS)/1000, ok)
+		total += c.DurationMS
+	}
+	cmd.Printf("     %d calls, %.1fs total\n", len(calls), float64(total)/1000)
+}
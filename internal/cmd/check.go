@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -16,6 +20,26 @@ type CheckResult struct {
 	Target string        `json:"target"`
 	Passed bool          `json:"passed"`
 	Checks []CheckStatus `json:"checks"`
+	// FixedFiles lists files rewritten by fixers (or that would be, with --dry-run).
+	FixedFiles []string `json:"fixed_files,omitempty"`
+	// FixDiffs holds the changes --fix would make, with --dry-run.
+	FixDiffs []FixDiff `json:"fix_diffs,omitempty"`
+	// FailFastSkipped lists checks not run because an earlier one failed (--fail-fast).
+	FailFastSkipped []string `json:"fail_fast_skipped,omitempty"`
+	// ToolVersions lists the version each tool that ran reported, sorted by name.
+	ToolVersions []ToolVersion `json:"tool_versions,omitempty"`
+}
+
+// ToolVersion is the version line a check tool reported.
+type ToolVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// FixDiff is the change a fixer would make to one file.
+type FixDiff struct {
+	File string `json:"file"`
+	Diff string `json:"diff"`
 }
 
 // CheckStatus describes a single check result.
@@ -32,7 +56,14 @@ func newCheckCmd() *cobra.Command {
 		Use:   "check <path>",
 		Short: "Run quality checks on Go files",
 		Long: `Run quality checks including gofmt, go vet, golangci-lint,
-gosec, go build, and go test on the specified file or directory.`,
+gosec, go build, and go test on the specified file or directory.
+
+Package patterns and import paths (./internal/..., example.com/mod/pkg)
+are resolved with go list and checked like the go toolchain would.
+
+Fixers run before the checks: --fix-imports (goimports) and --fix
+(gofmt). With the global --dry-run they only report the files they would
+change, and --fix also shows the diffs.`,
 		Args: cobra.ExactArgs(1),
 		RunE: runCheck,
 	}
@@ -45,6 +76,9 @@ gosec, go build, and go test on the specified file or directory.`,
 	cmd.Flags().BoolVar(&cfg.SkipSec, "skip-sec", false, "Skip gosec security check")
 	cmd.Flags().BoolVar(&cfg.SkipBuild, "skip-build", false, "Skip go build check")
 	cmd.Flags().BoolVar(&cfg.SkipTests, "skip-tests", false, "Skip go test check")
+	cmd.Flags().BoolVar(&cfg.FailFast, "fail-fast", false, "Stop at the first failed check and skip the rest")
+	cmd.Flags().BoolVar(&cfg.FixImports, "fix-imports", false, "Run goimports -w to fix missing/unused imports before checking")
+	cmd.Flags().BoolVar(&cfg.Fix, "fix", false, "Run gofmt -w to fix formatting before checking (with --dry-run, show the diffs)")
 
 	return cmd
 }
@@ -53,27 +87,58 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
 	format := GetFormat()
 
-	target := args[0]
-	info, err := os.Stat(target)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("not found: %s", target)
-	}
-
-	dir := target
-	if !info.IsDir() {
-		dir = filepath.Dir(target)
+	target, err := resolveCheckTarget(args[0])
+	if err != nil {
+		return err
 	}
+	dir := target.dir
 
 	result := CheckResult{
-		Target: dir,
+		Target: target.name,
 		Passed: true,
 		Checks: []CheckStatus{},
 	}
 
-	ui.Header(fmt.Sprintf("🔍 Running quality checks on %s", dir))
+	ui.Header(fmt.Sprintf("🔍 Running quality checks on %s", target.name))
+
+	if cfg.FixImports {
+		fixed, err := fixImports(target, cfg.DryRun)
+		if err != nil {
+			return err
+		}
+		result.FixedFiles = fixed
+		if len(fixed) > 0 {
+			verb := "Fixed imports in"
+			if cfg.DryRun {
+				verb = "Would fix imports in"
+			}
+			ui.Info(fmt.Sprintf("%s: %s", verb, strings.Join(fixed, ", ")))
+		}
+	}
+
+	if cfg.Fix {
+		fixed, diffs, err := fixFormatting(target, cfg.DryRun)
+		if err != nil {
+			return err
+		}
+		result.FixedFiles = mergeFixed(result.FixedFiles, fixed)
+		result.FixDiffs = diffs
+		if len(fixed) > 0 {
+			verb := "Fixed formatting in"
+			if cfg.DryRun {
+				verb = "Would fix formatting in"
+			}
+			ui.Info(fmt.Sprintf("%s: %s", verb, strings.Join(fixed, ", ")))
+			if !IsStructuredOutput() {
+				for _, d := range diffs {
+					cmd.Print(d.Diff)
+				}
+			}
+		}
+	}
 
 	if cfg.SkipChecks {
-		if format == "json" || format == "yaml" {
+		if format == "json" || format == "yaml" || format == "template" {
 			return PrintOutput(cmd.OutOrStdout(), result)
 		}
 		if format == "jsonl" {
@@ -89,21 +154,32 @@ func runCheck(cmd *cobra.Command, args []string) error {
 
 	jsonlEnc := json.NewEncoder(cmd.OutOrStdout())
 
+	// Pass build tags through so tagged files are vetted/built consistently
+	var goTags, lintTags, secTags []string
+	if tags := strings.Join(buildTags(), ","); tags != "" {
+		goTags = []string{"-tags", tags}
+		lintTags = []string{"--build-tags", tags}
+		secTags = []string{"-tags", tags}
+	}
+
 	checks := []struct {
 		name string
 		skip bool
 		tool string
 		args []string
 	}{
-		{"gofmt", cfg.SkipFmt, "gofmt", []string{"-l", "-d", "."}},
-		{"go vet", cfg.SkipVet, "go", []string{"vet", "./..."}},
-		{"golangci-lint", cfg.SkipLint, "golangci-lint", []string{"run", "--timeout", "2m"}},
-		{"gosec", cfg.SkipSec, "gosec", []string{"-quiet", "./..."}},
-		{"go build", cfg.SkipBuild, "go", []string{"build", "./..."}},
-		{"go test", cfg.SkipTests, "go", []string{"test", "-short", "./..."}},
+		{"gofmt", cfg.SkipFmt, "gofmt", withArgs([]string{"-l", "-d"}, nil, target.files...)},
+		{"go vet", cfg.SkipVet, "go", withArgs([]string{"vet"}, goTags, target.pkgs...)},
+		{"golangci-lint", cfg.SkipLint, "golangci-lint", withArgs([]string{"run", "--timeout", "2m"}, lintTags, target.dirs...)},
+		{"gosec", cfg.SkipSec, "gosec", withArgs([]string{"-quiet"}, secTags, target.dirs...)},
+		{"go build", cfg.SkipBuild, "go", withArgs([]string{"build"}, goTags, target.pkgs...)},
+		{"go test", cfg.SkipTests, "go", withArgs([]string{"test", "-short"}, goTags, target.pkgs...)},
 	}
 
 	for i, check := range checks {
+		if len(result.FailFastSkipped) > 0 {
+			break
+		}
 		status := CheckStatus{Name: check.name}
 
 		if check.skip {
@@ -138,6 +214,12 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			}
 		}
 
+		if !slices.ContainsFunc(result.ToolVersions, func(tv ToolVersion) bool { return tv.Name == check.tool }) {
+			if v := toolVersion(check.tool); v != "" {
+				result.ToolVersions = append(result.ToolVersions, ToolVersion{Name: check.tool, Version: v})
+			}
+		}
+
 		if !IsStructuredOutput() {
 			cmd.Printf("   [%d/%d] %s...", i+1, len(checks), check.name)
 		}
@@ -146,6 +228,11 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			status.Passed = false
 			status.Error = err.Error()
 			result.Passed = false
+			if cfg.FailFast {
+				for _, rest := range checks[i+1:] {
+					result.FailFastSkipped = append(result.FailFastSkipped, rest.name)
+				}
+			}
 		} else {
 			status.Passed = true
 		}
@@ -167,6 +254,7 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			cmd.Println(" ✓")
 		}
 	}
+	sort.Slice(result.ToolVersions, func(i, j int) bool { return result.ToolVersions[i].Name < result.ToolVersions[j].Name })
 
 	if format == "jsonl" {
 		if !result.Passed {
@@ -180,6 +268,9 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	}
 
 	cmd.Println()
+	if len(result.FailFastSkipped) > 0 {
+		ui.Info(fmt.Sprintf("Stopped at first failure (--fail-fast); skipped %s", strings.Join(result.FailFastSkipped, ", ")))
+	}
 	if result.Passed {
 		ui.Success("All quality checks passed")
 		return nil
@@ -188,13 +279,197 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	return fmt.Errorf("some checks failed")
 }
 
+// checkTarget is the resolved set of code a check run operates on.
+type checkTarget struct {
+	name  string   // Reported target (directory or original pattern)
+	dir   string   // Working directory for all tools
+	pkgs  []string // Package arguments for go vet/build/test
+	dirs  []string // Directory arguments for golangci-lint and gosec
+	files []string // File or directory arguments for gofmt
+}
+
+// resolveCheckTarget resolves a file, directory, or go package pattern
+// (e.g. ./internal/..., github.com/org/repo/pkg). Existing files and
+// directories keep the directory behavior of checking everything below
+// them; anything else is resolved with go list, like the go toolchain does.
+func resolveCheckTarget(arg string) (*checkTarget, error) {
+	if !strings.Contains(arg, "...") {
+		if info, err := os.Stat(arg); err == nil {
+			dir := arg
+			if !info.IsDir() {
+				dir = filepath.Dir(arg)
+			}
+			return &checkTarget{
+				name:  dir,
+				dir:   dir,
+				pkgs:  []string{"./..."},
+				dirs:  []string{"./..."},
+				files: []string{"."},
+			}, nil
+		}
+	}
+
+	listArgs := []string{"list", "-json"}
+	if tags := strings.Join(buildTags(), ","); tags != "" {
+		listArgs = append(listArgs, "-tags", tags)
+	}
+	list := exec.Command("go", append(listArgs, arg)...)
+	list.Env = toolEnv()
+	out, err := list.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("not found: %s (%s)", arg, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("not found: %s", arg)
+	}
+
+	target := &checkTarget{name: arg, dir: "."}
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var pkg struct {
+			ImportPath   string
+			Dir          string
+			GoFiles      []string
+			TestGoFiles  []string
+			XTestGoFiles []string
+		}
+		if err := dec.Decode(&pkg); err != nil {
+			return nil, fmt.Errorf("parsing go list output: %w", err)
+		}
+		target.pkgs = append(target.pkgs, pkg.ImportPath)
+		target.dirs = append(target.dirs, pkg.Dir)
+		for _, group := range [][]string{pkg.GoFiles, pkg.TestGoFiles, pkg.XTestGoFiles} {
+			for _, f := range group {
+				target.files = append(target.files, filepath.Join(pkg.Dir, f))
+			}
+		}
+	}
+	if len(target.pkgs) == 0 {
+		return nil, fmt.Errorf("not found: %s (no packages matched)", arg)
+	}
+	return target, nil
+}
+
+// fixImports runs goimports over the target. It returns the files whose
+// imports needed fixing and rewrites them unless dryRun is set.
+func fixImports(target *checkTarget, dryRun bool) ([]string, error) {
+	if _, err := exec.LookPath("goimports"); err != nil {
+		return nil, fmt.Errorf("--fix-imports requires goimports (go install golang.org/x/tools/cmd/goimports@latest)")
+	}
+
+	out, err := toolOutput(target.dir, "goimports", withArgs([]string{"-l"}, nil, target.files...)...)
+	if err != nil {
+		return nil, fmt.Errorf("goimports: %w", err)
+	}
+	files := strings.Fields(out)
+	if dryRun || len(files) == 0 {
+		return files, nil
+	}
+
+	if err := runTool(target.dir, "goimports", withArgs([]string{"-w"}, nil, files...)...); err != nil {
+		return nil, fmt.Errorf("goimports: %w", err)
+	}
+	return files, nil
+}
+
+// fixFormatting runs gofmt over the target. It returns the files gofmt
+// would change and rewrites them, or with dryRun leaves them alone and
+// returns their diffs instead.
+func fixFormatting(target *checkTarget, dryRun bool) ([]string, []FixDiff, error) {
+	out, err := toolOutput(target.dir, "gofmt", withArgs([]string{"-l"}, nil, target.files...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("gofmt: %w", err)
+	}
+	files := strings.Fields(out)
+	if len(files) == 0 {
+		return nil, nil, nil
+	}
+
+	if dryRun {
+		var diffs []FixDiff
+		for _, f := range files {
+			path := f
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(target.dir, f)
+			}
+			diff, err := gofmtDiff(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			diffs = append(diffs, FixDiff{File: f, Diff: diff})
+		}
+		return files, diffs, nil
+	}
+
+	if err := runTool(target.dir, "gofmt", withArgs([]string{"-w"}, nil, files...)...); err != nil {
+		return nil, nil, fmt.Errorf("gofmt: %w", err)
+	}
+	return files, nil, nil
+}
+
+// mergeFixed adds the files fixed by another fixer to fixed, keeping the
+// list sorted and free of duplicates.
+func mergeFixed(fixed, more []string) []string {
+	fixed = append(fixed, more...)
+	sort.Strings(fixed)
+	return slices.Compact(fixed)
+}
+
+// withArgs builds a tool argument list from a base, optional flags, and
+// trailing positional arguments.
+func withArgs(base, flags []string, rest ...string) []string {
+	args := append([]string{}, base...)
+	args = append(args, flags...)
+	return append(args, rest...)
+}
+
+// toolOutput runs a tool and returns its standard output.
+func toolOutput(dir, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = toolEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s", msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// toolVersion returns the first line of tool's version output, or "" if it
+// can't be run. gofmt has no version flag and reports the go toolchain's.
+func toolVersion(tool string) string {
+	args := map[string][]string{
+		"go":            {"version"},
+		"gofmt":         {"version"},
+		"golangci-lint": {"--version"},
+		"gosec":         {"-version"},
+	}[tool]
+	name := tool
+	if tool == "gofmt" {
+		name = "go"
+	}
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return line
+}
+
 func runTool(dir, name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	cmd.Dir = dir
+	cmd.Env = toolEnv()
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		if len(output) > 0 {
-			return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+			return offlineError(strings.TrimSpace(string(output)))
 		}
 		return err
 	}
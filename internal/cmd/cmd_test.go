@@ -3,8 +3,15 @@ package cmd_test
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
 
@@ -68,6 +75,42 @@ func TestAnalyzeMissingFile(t *testing.T) {
 	}
 }
 
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"runtime failure", []string{"--json-errors", "analyze", "/nonexistent/file.go"}, cmd.ExitError},
+		{"missing argument", []string{"--json-errors", "analyze"}, cmd.ExitUsage},
+		{"unknown flag", []string{"--json-errors", "analyze", "--bogus"}, cmd.ExitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := cmd.ExecuteWithArgs(tt.args, &stdout, &stderr)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if got := cmd.ExitCode(err); got != tt.code {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.code)
+			}
+
+			var jerr cmd.JSONError
+			if err := json.Unmarshal(stdout.Bytes(), &jerr); err != nil {
+				t.Fatalf("stdout is not a JSON error: %v\n%s", err, stdout.String())
+			}
+			if jerr.Error != err.Error() || jerr.Code != tt.code {
+				t.Errorf("JSONError = %+v, want {%q %d}", jerr, err.Error(), tt.code)
+			}
+			if stderr.Len() != 0 {
+				t.Errorf("stderr should be empty, got %q", stderr.String())
+			}
+		})
+	}
+}
+
 func TestAnalyzeNonexistentFile(t *testing.T) {
 	var stdout, stderr bytes.Buffer
 	err := cmd.ExecuteWithArgs([]string{"analyze", "/nonexistent/file.go"}, &stdout, &stderr)
@@ -76,6 +119,236 @@ func TestAnalyzeNonexistentFile(t *testing.T) {
 	}
 }
 
+func TestAnalyzeNormalizesInput(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "win.go")
+	if err := os.WriteFile(file, []byte("\xEF\xBB\xBFpackage win\r\n\r\nfunc Hello() {}\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", file}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v\n%s", err, stderr.String())
+	}
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+	}
+	if len(result.Normalized) != 2 {
+		t.Errorf("normalized = %v, want BOM and CRLF fixes", result.Normalized)
+	}
+	if result.Lines != 4 || result.Functions != 1 {
+		t.Errorf("lines = %d, functions = %d, want 4 and 1", result.Lines, result.Functions)
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "--normalize-eol=false", "analyze", file}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	result = cmd.AnalyzeResult{}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+	}
+	if result.Normalized != nil {
+		t.Errorf("normalized = %v with --normalize-eol=false, want none", result.Normalized)
+	}
+}
+
+func TestAnalyzeAssumePackage(t *testing.T) {
+	snippet := "type Buffer struct{ lines []string }\n\nfunc (b *Buffer) Flush() { write(b.lines) }\n"
+	run := func(args ...string) (cmd.AnalyzeResult, error) {
+		var stdout bytes.Buffer
+		root := cmd.NewRootCmd()
+		root.SetArgs(append([]string{"--format=json", "analyze"}, args...))
+		root.SetIn(strings.NewReader(snippet))
+		root.SetOut(&stdout)
+		root.SetErr(&stdout)
+		var result cmd.AnalyzeResult
+		if err := root.Execute(); err != nil {
+			return result, err
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+		}
+		return result, nil
+	}
+
+	if _, err := run("-"); err == nil {
+		t.Error("analyze succeeded on a snippet without a package clause")
+	}
+	result, err := run("--assume-package", "editor", "-")
+	if err != nil {
+		t.Fatalf("analyze --assume-package error = %v", err)
+	}
+	if result.Package != "editor" || result.AssumedPackage != "editor" {
+		t.Errorf("package = %q, assumed = %q; want editor", result.Package, result.AssumedPackage)
+	}
+	if result.Functions != 1 || result.Types != 1 || result.Lines != 4 {
+		t.Errorf("functions = %d, types = %d, lines = %d; want 1, 1 and 4", result.Functions, result.Types, result.Lines)
+	}
+
+	if _, err := run("--assume-package", "not-a-name", "-"); cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("invalid package name: exit code %d, want %d", cmd.ExitCode(err), cmd.ExitUsage)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	root := t.TempDir()
+	splits := map[string]map[string]string{
+		// Even sizes, but the files lean on each other and duplicate Clean
+		"a": {
+			"one.go": "package p\n\nfunc One() int { return Two() }\n\nfunc Clean() {}\n",
+			"two.go": "package p\n\nfunc Two() int { return 2 }\n\nfunc Clean() {}\n",
+		},
+		// Self-contained, but uneven
+		"b": {
+			"one.go": "package p\n\nfunc One() int { return 1 }\n",
+			"two.go": "package p\n\nfunc Two() int {\n\tx := 2\n\ty := x\n\treturn y\n}\n\nfunc Clean() {}\n",
+		},
+	}
+	for name, files := range splits {
+		for file, content := range files {
+			path := filepath.Join(root, name, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for metric, want := range map[string]string{"stddev": "a", "cross-refs": "b", "duplicates": "b"} {
+		var stdout, stderr bytes.Buffer
+		args := []string{"--format=json", "compare", "--metric", metric, filepath.Join(root, "a"), filepath.Join(root, "b")}
+		if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+			t.Fatalf("compare --metric %s error = %v", metric, err)
+		}
+		var result cmd.CompareResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+		}
+		if result.Winner != want {
+			t.Errorf("--metric %s: winner = %s, want %s (a = %+v, b = %+v)", metric, result.Winner, want, result.A, result.B)
+		}
+		if result.A.CrossRefs != 1 || len(result.A.Duplicates) != 1 || result.B.CrossRefs != 0 {
+			t.Errorf("scores a = %+v, b = %+v; want a with 1 cross-ref and a duplicate, b with none", result.A, result.B)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"compare", "--metric", "vibes", root, root}, &stdout, &stderr)
+	if cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("unknown metric: exit code %d, want %d", cmd.ExitCode(err), cmd.ExitUsage)
+	}
+}
+
+func TestAnalyzeRemoteInput(t *testing.T) {
+	analyze := func(arg string) (cmd.AnalyzeResult, error) {
+		var stdout, stderr bytes.Buffer
+		var result cmd.AnalyzeResult
+		if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", arg}, &stdout, &stderr); err != nil {
+			return result, err
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+		}
+		return result, nil
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/raw/pkg/remote.go" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("package remote\n\nfunc A() {}\n\nfunc B() {}\n"))
+	}))
+	defer server.Close()
+
+	result, err := analyze(server.URL + "/raw/pkg/remote.go?token=x")
+	if err != nil {
+		t.Fatalf("analyze URL error = %v", err)
+	}
+	if result.File != "remote.go" || result.Functions != 2 {
+		t.Errorf("file = %q, functions = %d, want remote.go and 2", result.File, result.Functions)
+	}
+	if _, err := analyze(server.URL + "/missing.go"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("analyze missing URL error = %v, want 404", err)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		c := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "pkg", "old.go")
+	if err := os.WriteFile(file, []byte("package pkg\n\nfunc A() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	if err := os.WriteFile(file, []byte("package pkg\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	result, err = analyze("git:HEAD:pkg/old.go")
+	if err != nil {
+		t.Fatalf("analyze git ref error = %v", err)
+	}
+	if result.File != "old.go" || result.Functions != 1 {
+		t.Errorf("file = %q, functions = %d, want the committed old.go with 1", result.File, result.Functions)
+	}
+	if _, err := analyze("git:HEAD"); cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("analyze git:HEAD exit code = %d, want usage error", cmd.ExitCode(err))
+	}
+}
+
+func TestAnalyzeDeadCode(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"util.go":  "package util\n\nfunc Public() { used() }\n\nfunc used() {}\n\nfunc stale() {}\n\nvar leftover = 1\n",
+		"other.go": "package util\n\nfunc Other() int { return leftover }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", "--dead-code", filepath.Join(dir, "util.go")}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+	}
+	want := []cmd.DeadSymbol{{Name: "stale", Kind: "func", Line: 7}}
+	if len(result.DeadCode) != 1 || result.DeadCode[0] != want[0] {
+		t.Errorf("dead_code = %+v, want %+v", result.DeadCode, want)
+	}
+}
+
 func TestValidateJSON(t *testing.T) {
 	dir := t.TempDir()
 	testFile := filepath.Join(dir, "test.go")
@@ -158,24 +431,37 @@ func TestCheckJSON_SkipAll(t *testing.T) {
 }
 
 func TestSubcommandHelp(t *testing.T) {
-	subcommands := []string{"analyze", "generate", "check", "validate"}
+	subcommands := []string{"analyze", "generate", "split", "check", "validate", "models", "rename", "compare", "doctor"}
 
 	for _, subcmd := range subcommands {
 		t.Run(subcmd, func(t *testing.T) {
-			var stdout, stderr bytes.Buffer
-			err := cmd.ExecuteWithArgs([]string{subcmd, "--help"}, &stdout, &stderr)
-			if err != nil {
-				t.Errorf("ExecuteWithArgs() error = %v", err)
-			}
+			for _, args := range [][]string{{subcmd, "--help"}, {subcmd, "-h"}, {"help", subcmd}} {
+				var stdout, stderr bytes.Buffer
+				err := cmd.ExecuteWithArgs(args, &stdout, &stderr)
+				if err != nil {
+					t.Errorf("ExecuteWithArgs(%v) error = %v", args, err)
+				}
 
-			output := stdout.String()
-			if !strings.Contains(output, "Usage:") {
-				t.Errorf("Expected usage info for %s", subcmd)
+				output := stdout.String()
+				if !strings.Contains(output, "Usage:") {
+					t.Errorf("Expected usage info for %v", args)
+				}
 			}
 		})
 	}
 }
 
+func TestSplitAlias(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"split", "--help"}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	output := stdout.String()
+	if !strings.Contains(output, "go-split generate") || !strings.Contains(output, "Aliases:") {
+		t.Errorf("split should be an alias of generate, got:\n%s", output)
+	}
+}
+
 func TestValidateJSONL(t *testing.T) {
 	dir := t.TempDir()
 	testFile1 := filepath.Join(dir, "test1.go")
@@ -211,6 +497,51 @@ func TestValidateJSONL(t *testing.T) {
 	}
 }
 
+func TestValidateManyFiles(t *testing.T) {
+	dir := t.TempDir()
+	const n = 200
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("package test\n\nfunc F%d() {}\n", i)
+		if i%50 == 0 {
+			content = "package test\n\nfunc broken( {\n"
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.go", i)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "validate", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	var result cmd.ValidateResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(result.Files) != n || result.Valid {
+		t.Fatalf("got %d files, valid=%v; want %d files, valid=false", len(result.Files), result.Valid, n)
+	}
+	invalid := 0
+	for i, f := range result.Files {
+		if want := fmt.Sprintf("f%03d.go", i); f.Name != want {
+			t.Fatalf("Files[%d] = %s, want %s (sorted)", i, f.Name, want)
+		}
+		if !f.Valid {
+			invalid++
+		}
+	}
+	if invalid != n/50 {
+		t.Errorf("invalid files = %d, want %d", invalid, n/50)
+	}
+
+	// JSONL streams one line per file
+	stdout.Reset()
+	_ = cmd.ExecuteWithArgs([]string{"--format=jsonl", "validate", dir}, &stdout, &stderr)
+	if lines := strings.Count(stdout.String(), "{\"name\""); lines != n {
+		t.Errorf("JSONL lines = %d, want %d", lines, n)
+	}
+}
+
 func TestCheckJSONL(t *testing.T) {
 	dir := t.TempDir()
 
@@ -307,3 +638,885 @@ func TestMkdirAllWithExistingDirectory(t *testing.T) {
 		t.Errorf("MkdirAll should be idempotent, got error: %v", err)
 	}
 }
+
+func TestValidateJSON_BuildConstraints(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows files are part of the build context on windows")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":         "package test\n\nfunc Hello() {}\n",
+		"main_windows.go": "package test\n\nimport \"syscall\"\n\nvar _ = syscall.GetCurrentProcessId\n",
+		"tagged.go":       "//go:build customtag\n\npackage test\n\nfunc Tagged() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	otherContext := func(args ...string) map[string]bool {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := cmd.ExecuteWithArgs(append(args, "validate", dir), &stdout, &stderr); err != nil {
+			t.Fatalf("ExecuteWithArgs() error = %v", err)
+		}
+		var result struct {
+			Valid bool `json:"valid"`
+			Files []struct {
+				Name              string `json:"name"`
+				OtherBuildContext bool   `json:"other_build_context"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+		}
+		if !result.Valid {
+			t.Errorf("Expected valid=true, got %s", stdout.String())
+		}
+		got := make(map[string]bool)
+		for _, f := range result.Files {
+			got[f.Name] = f.OtherBuildContext
+		}
+		return got
+	}
+
+	got := otherContext("--format=json")
+	if !got["main_windows.go"] || !got["tagged.go"] || got["main.go"] {
+		t.Errorf("unexpected other build context set without tags: %v", got)
+	}
+
+	got = otherContext("--format=json", "--build-tags=customtag")
+	if got["tagged.go"] {
+		t.Errorf("tagged.go should be in the build context with --build-tags=customtag")
+	}
+	if !got["main_windows.go"] {
+		t.Errorf("main_windows.go should still be in another build context")
+	}
+
+	// Syntax is checked whatever the build context
+	if err := os.WriteFile(filepath.Join(dir, "broken_windows.go"), []byte("package test\n\nfunc {\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "validate", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	var result cmd.ValidateResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if result.Valid {
+		t.Errorf("a syntax error in broken_windows.go passed validate: %s", stdout.String())
+	}
+}
+
+func TestValidateMismatchedConstraints(t *testing.T) {
+	run := func(files map[string]string) cmd.ValidateResult {
+		t.Helper()
+		dir := t.TempDir()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var stdout, stderr bytes.Buffer
+		if err := cmd.ExecuteWithArgs([]string{"--format=json", "--build-tags=linux", "validate", dir}, &stdout, &stderr); err != nil {
+			t.Fatalf("validate error = %v\n%s", err, stdout.String())
+		}
+		var result cmd.ValidateResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+		}
+		return result
+	}
+
+	// A split that dropped the constraint from one file
+	result := run(map[string]string{
+		"a.go":           "//go:build linux\n\npackage p\n",
+		"b.go":           "//go:build linux\n// +build linux\n\npackage p\n",
+		"c.go":           "package p\n",
+		"extra_arm64.go": "package p\n",
+	})
+	want := []cmd.ConstraintGroup{{Constraint: "//go:build linux", Files: []string{"a.go", "b.go"}}, {Files: []string{"c.go"}}}
+	if !reflect.DeepEqual(result.MismatchedConstraints, want) {
+		t.Errorf("mismatched constraints = %+v, want %+v", result.MismatchedConstraints, want)
+	}
+	if !result.Valid {
+		t.Error("a constraint mismatch made validation fail; it only warns")
+	}
+
+	// Complementary constraints are a deliberate pattern
+	result = run(map[string]string{
+		"a.go":      "package p\n",
+		"lock.go":   "//go:build unix\n\npackage p\n",
+		"nolock.go": "//go:build !unix\n\npackage p\n",
+	})
+	if result.MismatchedConstraints != nil {
+		t.Errorf("mismatched constraints = %+v, want none for unix/!unix", result.MismatchedConstraints)
+	}
+}
+
+func TestCheckJSON_PackagePattern(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":         "module example.com/demo\n\ngo 1.21\n",
+		"a/a.go":         "package a\n\nfunc A() {}\n",
+		"a/b/b.go":       "package b\n\nfunc B() {}\n",
+		"other/other.go": "package other\n\nfunc Other() {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	var stdout, stderr bytes.Buffer
+	err = cmd.ExecuteWithArgs([]string{"--format=json", "check", "--skip-lint", "--skip-sec", "--skip-tests", "./a/..."}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v\nOutput: %s", err, stdout.String())
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if result["target"] != "./a/..." {
+		t.Errorf("Expected target=./a/..., got %v", result["target"])
+	}
+	if result["passed"] != true {
+		t.Errorf("Expected passed=true, got %s", stdout.String())
+	}
+
+	stdout.Reset()
+	err = cmd.ExecuteWithArgs([]string{"--format=json", "check", "--skip-checks", "./missing/..."}, &stdout, &stderr)
+	if err == nil {
+		t.Error("Expected error for pattern matching no packages")
+	}
+}
+
+func TestValidateLintReceivers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go": "package test\n\ntype T struct{}\n\nfunc (t *T) A() {}\n",
+		"b.go": "package test\n\nfunc (x *T) B() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"validate", "--lint-receivers", dir}, &stdout, &stderr)
+	if err == nil {
+		t.Fatal("Expected error for inconsistent receiver names")
+	}
+	if !strings.Contains(stdout.String(), "(x) B") && !strings.Contains(stdout.String(), "(t) A") {
+		t.Errorf("Expected offending method in output, got: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"validate", dir}, &stdout, &stderr); err != nil {
+		t.Errorf("validate without --lint-receivers should pass, got %v", err)
+	}
+}
+
+func TestValidateGofmt(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"clean.go": "package test\n\nfunc A() {}\n",
+		"messy.go": "package test\n\nfunc  B( )  {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "validate", "--gofmt", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+
+	var result cmd.ValidateResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	for _, f := range result.Files {
+		switch f.Name {
+		case "clean.go":
+			if f.Unformatted || f.GofmtDiff != "" {
+				t.Errorf("clean.go = %+v, want gofmt-clean", f)
+			}
+		case "messy.go":
+			if !f.Unformatted || !strings.Contains(f.GofmtDiff, "+func B() {}") {
+				t.Errorf("messy.go = %+v, want a gofmt diff", f)
+			}
+		}
+	}
+
+	// Text mode fails, and the file is left as it was
+	if err := cmd.ExecuteWithArgs([]string{"validate", "--gofmt", dir}, &stdout, &stderr); err == nil {
+		t.Error("Expected error for unformatted file")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "messy.go")); string(data) != files["messy.go"] {
+		t.Errorf("messy.go was rewritten:\n%s", data)
+	}
+}
+
+func TestValidatePackageMismatch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, pkg := range map[string]string{"a.go": "store", "b.go": "other", "b_test.go": "store_test"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("package "+pkg+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "validate", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	var result cmd.ValidateResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	for _, f := range result.Files {
+		if want := f.Name == "b.go"; f.PackageMismatch != want {
+			t.Errorf("%s package_mismatch = %v, want %v", f.Name, f.PackageMismatch, want)
+		}
+	}
+}
+
+func TestModelsJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"id":"claude-a"},{"id":"claude-b"}]}`))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--use-wrapper", "--endpoint", server.URL + "/v1/messages", "--model", "claude-b", "--format=json", "models"}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+
+	var result cmd.ModelsResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if strings.Join(result.Models, ",") != "claude-a,claude-b" || result.Current != "claude-b" {
+		t.Errorf("result = %+v", result)
+	}
+
+	// An empty --endpoint falls back to the default instead of panicking
+	stdout.Reset()
+	args = []string{"--use-wrapper", "--endpoint", "", "--format=json", "models"}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err == nil {
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil || result.Backend != "http://localhost:8000/v1/messages" {
+			t.Errorf("models with an empty --endpoint = %s, want the default backend", stdout.String())
+		}
+	}
+}
+
+// installFakeTool puts an executable shell script named name first on PATH.
+func installFakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCheckToolVersions(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/demo\n\ngo 1.21\n",
+		"demo.go": "package demo\n\nfunc Demo() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"--format=json", "check", "--skip-fmt", "--skip-lint", "--skip-sec", "--skip-build", "--skip-tests", dir}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v\nOutput: %s", err, stdout.String())
+	}
+
+	var result cmd.CheckResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if len(result.ToolVersions) != 1 || result.ToolVersions[0].Name != "go" || !strings.HasPrefix(result.ToolVersions[0].Version, "go version") {
+		t.Errorf("tool_versions = %+v, want only the go version line", result.ToolVersions)
+	}
+}
+
+func TestCheckFixImports(t *testing.T) {
+	// Fake goimports: "-l" lists bad.go, "-w" marks the files it rewrites
+	installFakeTool(t, "goimports", `if [ "$1" = "-l" ]; then echo bad.go; exit 0; fi
+shift
+for f in "$@"; do echo "// fixed" >> "$f"; done
+`)
+
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "bad.go")
+	if err := os.WriteFile(badFile, []byte("package test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) map[string]interface{} {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+			t.Fatalf("ExecuteWithArgs(%v) error = %v", args, err)
+		}
+		var result map[string]interface{}
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+		}
+		return result
+	}
+
+	result := run("--format=json", "--dry-run", "check", "--skip-checks", "--fix-imports", dir)
+	if fixed, _ := result["fixed_files"].([]interface{}); len(fixed) != 1 || fixed[0] != "bad.go" {
+		t.Errorf("Expected fixed_files=[bad.go] in dry run, got %v", result["fixed_files"])
+	}
+	if data, _ := os.ReadFile(badFile); strings.Contains(string(data), "fixed") {
+		t.Error("--dry-run should not rewrite files")
+	}
+
+	run("--format=json", "check", "--skip-checks", "--fix-imports", dir)
+	if data, _ := os.ReadFile(badFile); !strings.Contains(string(data), "fixed") {
+		t.Error("--fix-imports should rewrite files")
+	}
+}
+
+func TestCheckFixDryRun(t *testing.T) {
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "bad.go")
+	unformatted := "package test\n\nfunc Hello( ) {\nreturn\n}\n"
+	if err := os.WriteFile(badFile, []byte(unformatted), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "--dry-run", "check", "--skip-checks", "--fix", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	var result cmd.CheckResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if strings.Join(result.FixedFiles, ",") != "bad.go" {
+		t.Errorf("fixed_files = %v, want [bad.go]", result.FixedFiles)
+	}
+	if len(result.FixDiffs) != 1 || !strings.Contains(result.FixDiffs[0].Diff, "+func Hello() {") {
+		t.Errorf("fix_diffs = %+v, want the gofmt diff for bad.go", result.FixDiffs)
+	}
+	if data, _ := os.ReadFile(badFile); string(data) != unformatted {
+		t.Error("--dry-run should not rewrite files")
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "check", "--skip-checks", "--fix", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	if data, _ := os.ReadFile(badFile); !strings.Contains(string(data), "func Hello() {\n\treturn\n}") {
+		t.Errorf("--fix should gofmt the file, got:\n%s", data)
+	}
+}
+
+func TestCheckFailFast(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.go"), []byte("package test\n\nfunc {\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	_ = cmd.ExecuteWithArgs([]string{"--format=json", "check", "--fail-fast", dir}, &stdout, &stderr)
+
+	var result cmd.CheckResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if result.Passed || len(result.Checks) != 1 || result.Checks[0].Name != "gofmt" {
+		t.Errorf("Expected only the failing gofmt check to run, got %+v", result.Checks)
+	}
+	want := []string{"go vet", "golangci-lint", "gosec", "go build", "go test"}
+	if strings.Join(result.FailFastSkipped, ",") != strings.Join(want, ",") {
+		t.Errorf("FailFastSkipped = %v, want %v", result.FailFastSkipped, want)
+	}
+}
+
+func TestValidateTemplateFormat(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmplFile := filepath.Join(t.TempDir(), "report.tmpl")
+	tmpl := `{{printf "%d" .FileCount}} files:{{range .Files}} {{upper .Name}}{{end}}`
+	if err := os.WriteFile(tmplFile, []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"--format=template", "--template-file", tmplFile, "validate", dir}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("ExecuteWithArgs() error = %v", err)
+	}
+	if got, want := stdout.String(), "1 files: A.GO"; got != want {
+		t.Errorf("template output = %q, want %q", got, want)
+	}
+}
+
+func TestTemplateFormatValidation(t *testing.T) {
+	dir := t.TempDir()
+	badTmpl := filepath.Join(dir, "bad.tmpl")
+	if err := os.WriteFile(badTmpl, []byte("{{.Target"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := [][]string{
+		{"--format=template", "validate", dir},
+		{"--format=template", "--template-file", badTmpl, "validate", dir},
+	}
+	for _, args := range tests {
+		var stdout, stderr bytes.Buffer
+		if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err == nil {
+			t.Errorf("ExecuteWithArgs(%v) expected error", args)
+		}
+	}
+}
+
+func TestAnalyzeBudget(t *testing.T) {
+	dir := t.TempDir()
+	budget := filepath.Join(dir, "budget.yaml")
+	files := map[string]string{
+		"budget.yaml": "max_lines: 10\nmax_complexity: 2\n",
+		"small.go":    "package p\n\nfunc A() {}\n",
+		"big.go":      "package p\n\nfunc B(x int) int {\n\tif x > 0 && x < 9 {\n\t\treturn 1\n\t}\n\treturn 0\n}\n\nfunc C() {}\n\nfunc D() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", "--budget", budget, dir}, &stdout, &stderr)
+	if err == nil || cmd.ExitCode(err) != cmd.ExitError {
+		t.Fatalf("ExecuteWithArgs() error = %v, want a budget failure", err)
+	}
+
+	var result cmd.BudgetResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if result.Passed || len(result.Files) != 2 {
+		t.Fatalf("result = %+v, want 2 files and a failure", result)
+	}
+	big := result.Files[0]
+	if filepath.Base(big.File) != "big.go" || big.Passed || len(big.Violations) != 2 {
+		t.Fatalf("big.go result = %+v", big)
+	}
+	if v := big.Violations[1]; v.Metric != "complexity" || v.Symbol != "B" || v.Actual != 3 || v.Limit != 2 {
+		t.Errorf("complexity violation = %+v", v)
+	}
+	if !result.Files[1].Passed {
+		t.Errorf("small.go result = %+v, want pass", result.Files[1])
+	}
+
+	// Within budget exits cleanly
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"analyze", "--budget", budget, filepath.Join(dir, "small.go")}, &stdout, &stderr); err != nil {
+		t.Errorf("within budget: error = %v", err)
+	}
+}
+
+func TestAnalyzeDOT(t *testing.T) {
+	dir := t.TempDir()
+	src := "package shop\n\ntype Cart struct{}\n\nfunc NewCart() *Cart { return &Cart{} }\n\nfunc (c *Cart) Add() { c.Sum() }\n\nfunc (c *Cart) Sum() {}\n\nfunc Run() { NewCart().Add() }\n"
+	path := filepath.Join(dir, "shop.go")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=dot", "analyze", path}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze --format dot error = %v\n%s", err, stderr.String())
+	}
+	want := `digraph "shop.go" {
+  rankdir=LR;
+  node [shape=box];
+  subgraph "cluster_Cart" {
+    label="Cart";
+    "Cart.Add";
+    "Cart.Sum";
+  }
+  "NewCart";
+  "Run";
+  "Cart.Add" -> "Cart.Sum";
+  "Run" -> "Cart.Add";
+  "Run" -> "NewCart";
+}
+`
+	if got := stdout.String(); got != want {
+		t.Errorf("analyze --format dot =\n%s\nwant\n%s", got, want)
+	}
+
+	// Other results have no graph to draw
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"--format=dot", "analyze", "--percentile", "50", dir}, &stdout, &stderr); err == nil {
+		t.Errorf("analyze --percentile --format dot succeeded:\n%s", stdout.String())
+	}
+}
+
+func TestAnalyzeComplexity(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "calc.go")
+	src := "package calc\n\nfunc Add(a, b int) int { return a + b }\n\ntype Acc struct{ n int }\n\nfunc (a *Acc) Sign() int {\n\tif a.n > 0 {\n\t\treturn 1\n\t}\n\tif a.n < 0 || a.n == -0 {\n\t\treturn -1\n\t}\n\treturn 0\n}\n\n// Fast is native. See fast_amd64.s.\nfunc Fast()\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", file}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v\n%s", err, stderr.String())
+	}
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+	}
+	want := []cmd.FuncComplexity{
+		{Name: "Acc.Sign", Line: 7, Complexity: 4},
+		{Name: "Add", Line: 3, Complexity: 1},
+		{Name: "Fast", Line: 18, Complexity: 0},
+	}
+	if !slices.Equal(result.Complexity, want) {
+		t.Errorf("complexity = %+v, want %+v", result.Complexity, want)
+	}
+	if result.ExportedFunctions != 3 || result.ExportedTypes != 1 {
+		t.Errorf("exported functions = %d, types = %d, want 3 and 1", result.ExportedFunctions, result.ExportedTypes)
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"--verbose", "analyze", file}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze --verbose error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Complexity:\n     • 4   Acc.Sign (line 7)") {
+		t.Errorf("verbose output lacks the complexity list:\n%s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "• Fast (lines 17-18) - Fast is native.\n") {
+		t.Errorf("verbose output lacks the doc summary:\n%s", stdout.String())
+	}
+}
+
+func TestAnalyzeStripComments(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "doc.go")
+	src := "// Package doc is mostly comments.\npackage doc\n\n// Hello greets.\n// It says hello.\nfunc Hello() {}\n"
+	if err := os.WriteFile(file, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", "--strip-comments", file}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze --strip-comments error = %v\n%s", err, stderr.String())
+	}
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+	}
+	want := cmd.StrippedMetrics{Lines: 2, CommentLines: 3, BlankLines: 1}
+	if result.Lines != 7 || result.CodeLines != 2 || result.Stripped == nil || *result.Stripped != want {
+		t.Errorf("lines = %d, code lines = %d, stripped = %+v, want 7, 2 and %+v", result.Lines, result.CodeLines, result.Stripped, want)
+	}
+}
+
+func TestAnalyzePackage(t *testing.T) {
+	dir := t.TempDir()
+	for name, funcs := range map[string]int{"a.go": 1, "big.go": 10, "big_test.go": 2, "doc.go": 0} {
+		src := "package p\n"
+		for i := range funcs {
+			src += fmt.Sprintf("\nfunc F%s%d() {}\n", strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test"), i)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze <dir> error = %v\n%s", err, stderr.String())
+	}
+	var results []cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+	}
+	var files []string
+	for _, r := range results {
+		files = append(files, r.File)
+	}
+	if want := []string{"big.go", "a.go", "doc.go"}; !slices.Equal(files, want) {
+		t.Fatalf("files = %v, want %v (largest first, tests left out)", files, want)
+	}
+	if big := results[0]; big.Functions != 10 || big.TestFile != "big_test.go" || big.TestFunctions != 0 {
+		t.Errorf("big.go = %+v, want 10 functions paired with big_test.go", big)
+	}
+	if !results[2].Empty {
+		t.Errorf("doc.go = %+v, want it reported empty", results[2])
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"analyze", dir}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze <dir> error = %v", err)
+	}
+	out := stdout.String()
+	if i, j := strings.Index(out, "big.go"), strings.Index(out, "a.go"); i < 0 || j < i {
+		t.Errorf("text output does not rank big.go above a.go:\n%s", out)
+	}
+
+	if err := cmd.ExecuteWithArgs([]string{"analyze", "--dead-code", dir}, &stdout, &stderr); err == nil {
+		t.Error("analyze --dead-code <dir> succeeded")
+	}
+}
+
+func TestAnalyzePercentile(t *testing.T) {
+	dir := t.TempDir()
+	for name, funcs := range map[string]int{"a.go": 1, "b.go": 2, "c.go": 3, "d.go": 4, "big.go": 10, "big_test.go": 50} {
+		src := "package p\n"
+		for i := range funcs {
+			src += fmt.Sprintf("\nfunc F%s%d() {}\n", strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test"), i)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analyze := func(p string) cmd.PercentileResult {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if err := cmd.ExecuteWithArgs([]string{"--format=json", "analyze", "--percentile", p, dir}, &stdout, &stderr); err != nil {
+			t.Fatalf("analyze --percentile %s error = %v", p, err)
+		}
+		var result cmd.PercentileResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+		}
+		return result
+	}
+
+	// Sizes 4, 6, 8, 10 and 22 lines; the test file is not measured
+	result := analyze("80")
+	if result.Files != 5 || fmt.Sprintf("%.1f", result.Threshold) != "12.4" {
+		t.Errorf("files = %d, threshold = %v, want 5 files and 12.4", result.Files, result.Threshold)
+	}
+	if len(result.Candidates) != 1 || filepath.Base(result.Candidates[0].File) != "big.go" || result.Candidates[0].Lines != 22 {
+		t.Errorf("candidates = %+v, want big.go", result.Candidates)
+	}
+
+	var got []string
+	for _, c := range analyze("50").Candidates {
+		got = append(got, filepath.Base(c.File))
+	}
+	if want := "big.go d.go"; strings.Join(got, " ") != want {
+		t.Errorf("p50 candidates = %v, want %s", got, want)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"analyze", "--percentile", "100", dir}, &stdout, &stderr)
+	if cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("--percentile 100 exit code = %d, want %d (err %v)", cmd.ExitCode(err), cmd.ExitUsage, err)
+	}
+}
+
+func TestAnalyzeSinceMarkdown(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		c := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("budget.yaml", "max_lines: 6\n")
+	write("same.go", "package p\n\nfunc A() {}\n")
+	write("grow.go", "package p\n\nfunc B() {}\n")
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	write("grow.go", "package p\n\nfunc B() {}\n\nfunc C() {}\n\nfunc D() {}\n")
+	write("grow_test.go", "package p\n")
+	write("new.go", "package p\n\nfunc E() {}\n")
+	git("add", "new.go")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	var stdout, stderr bytes.Buffer
+	err = cmd.ExecuteWithArgs([]string{"--format", "markdown", "analyze", "--since", "HEAD", "--budget", "budget.yaml"}, &stdout, &stderr)
+	if cmd.ExitCode(err) != cmd.ExitError {
+		t.Errorf("exit code = %d, want %d for a file over budget", cmd.ExitCode(err), cmd.ExitError)
+	}
+	want := "### Go file sizes (changed since `HEAD`)\n\n" +
+		"| File | Lines | Functions | Budget |\n|---|---:|---:|---|\n" +
+		"| `grow.go` | 8 | 3 | ❌ lines 8 > 6 |\n" +
+		"| `new.go` | 4 | 1 | ✅ |\n" +
+		"\n1 of 2 files exceed the budget (max_lines 6).\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("markdown report:\n%s\nwant:\n%s", got, want)
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs([]string{"analyze", "--since", "HEAD", "new.go"}, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze --since without a budget error = %v", err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "new.go: 4 lines, 1 functions") || strings.Contains(out, "grow.go") {
+		t.Errorf("--since limited to new.go:\n%s", out)
+	}
+}
+
+func TestAnalyzeStructuredRecommendations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "store.go")
+	if err := os.WriteFile(file, []byte("package store\n\nfunc Get() {}\n\nfunc Put() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response := "not JSON at all"
+	server := newStubAPI(t, func(prompt string) string {
+		if !strings.Contains(prompt, `"contents_description"`) {
+			t.Errorf("prompt does not ask for JSON:\n%s", prompt)
+		}
+		return response
+	})
+	analyze := func() cmd.AnalyzeResult {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		args := []string{"--use-wrapper", "--endpoint", server.URL, "--format=json", "analyze", "--force", "--structured-recommendations", file}
+		if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+			t.Fatalf("analyze error = %v\n%s", err, stderr.String())
+		}
+		var result cmd.AnalyzeResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\n%s", err, stdout.String())
+		}
+		return result
+	}
+
+	response = "```json\n" + `[
+  {"filename": "reads.go", "contents_description": "lookups", "functions": ["Get"], "rationale": "read path"},
+  {"filename": "writes.go", "contents_description": "mutations", "functions": ["Put"], "rationale": "write path"}
+]` + "\n```"
+	result := analyze()
+	want := []cmd.Recommendation{
+		{Filename: "reads.go", ContentsDescription: "lookups", Functions: []string{"Get"}, Rationale: "read path"},
+		{Filename: "writes.go", ContentsDescription: "mutations", Functions: []string{"Put"}, Rationale: "write path"},
+	}
+	if fmt.Sprint(result.StructuredRecommendations) != fmt.Sprint(want) {
+		t.Errorf("StructuredRecommendations = %+v, want %+v", result.StructuredRecommendations, want)
+	}
+	if result.Recommendations != "" {
+		t.Errorf("Recommendations = %q, want it empty when parsed", result.Recommendations)
+	}
+
+	response = "Split it into reads.go and writes.go."
+	result = analyze()
+	if result.StructuredRecommendations != nil || result.Recommendations != response {
+		t.Errorf("unparseable response: got %+v / %q, want the freeform text", result.StructuredRecommendations, result.Recommendations)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not available")
+	}
+	doctor := func(endpoint string) (cmd.DoctorResult, error) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		err := cmd.ExecuteWithArgs([]string{"--use-wrapper", "--endpoint", endpoint, "--format=json", "doctor"}, &stdout, &stderr)
+		var result cmd.DoctorResult
+		if jsonErr := json.Unmarshal(stdout.Bytes(), &result); jsonErr != nil {
+			t.Fatalf("Failed to parse JSON: %v\n%s", jsonErr, stdout.String())
+		}
+		return result, err
+	}
+	check := func(result cmd.DoctorResult, name string) cmd.DoctorCheck {
+		t.Helper()
+		for _, c := range result.Checks {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("no %s check in %+v", name, result.Checks)
+		return cmd.DoctorCheck{}
+	}
+
+	server := newStubAPI(t, func(string) string { return "" })
+	result, err := doctor(server.URL)
+	if err != nil || !result.Passed {
+		t.Fatalf("doctor = %+v, %v; want a pass", result, err)
+	}
+	if c := check(result, "go"); c.Status != "pass" || !strings.HasPrefix(c.Detail, "go version") {
+		t.Errorf("go check = %+v", c)
+	}
+
+	result, err = doctor("http://127.0.0.1:1/v1/messages")
+	if cmd.ExitCode(err) != cmd.ExitError || result.Passed {
+		t.Errorf("doctor with no wrapper = %+v, exit %d; want a failure", result, cmd.ExitCode(err))
+	}
+	if c := check(result, "api"); c.Status != "fail" || !strings.Contains(c.Hint, "--endpoint") {
+		t.Errorf("api check = %+v, want a failure hinting at --endpoint", c)
+	}
+
+	// An empty --endpoint checks the default instead of panicking
+	result, _ = doctor("")
+	if c := check(result, "api"); !strings.Contains(c.Detail, "localhost:8000") {
+		t.Errorf("api check with an empty --endpoint = %+v, want the default endpoint", c)
+	}
+}
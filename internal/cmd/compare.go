@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// CompareResult scores two candidate splits of the same code.
+type CompareResult struct {
+	Metric string     `json:"metric"`
+	A      SplitScore `json:"a"`
+	B      SplitScore `json:"b"`
+	Winner string     `json:"winner"` // "a", "b" or "tie"
+}
+
+// SplitScore measures one split: the non-test Go files of a directory.
+type SplitScore struct {
+	Dir         string   `json:"dir"`
+	Files       int      `json:"files"`
+	Lines       int      `json:"lines"`
+	MeanLines   float64  `json:"mean_lines"`
+	StdDevLines float64  `json:"stddev_lines"` // Lower means more even file sizes
+	CrossRefs   int      `json:"cross_refs"`   // Names a file uses from another file
+	Duplicates  []string `json:"duplicates,omitempty"`
+}
+
+// compareMetrics maps each --metric to the value it ranks splits by; lower
+// wins.
+var compareMetrics = map[string]func(SplitScore) float64{
+	"stddev":     func(s SplitScore) float64 { return s.StdDevLines },
+	"cross-refs": func(s SplitScore) float64 { return float64(s.CrossRefs) },
+	"duplicates": func(s SplitScore) float64 { return float64(len(s.Duplicates)) },
+}
+
+// compareConfig holds compare-specific configuration.
+type compareConfig struct {
+	Metric string
+}
+
+var cmpCfg = &compareConfig{}
+
+// newCompareCmd creates the compare command.
+func newCompareCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "compare <dir-a> <dir-b>",
+		Aliases: []string{"compare-split"},
+		Short:   "Score two candidate splits against each other",
+		Long: `Compare two splits of the same code, such as generate output from two
+models or prompts written to different --output directories.
+
+For the non-test Go files in each directory it reports the file count, the
+mean and standard deviation of file sizes in lines, cross-file references
+(package-level names a file uses that another file declares) and symbols
+declared in more than one file. The winner is the split with the lower
+--metric: stddev (default), cross-refs or duplicates.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCompare,
+	}
+
+	cmd.Flags().StringVar(&cmpCfg.Metric, "metric", "stddev", "Metric picking the winner (lower wins): stddev, cross-refs or duplicates")
+
+	return cmd
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+
+	metric, ok := compareMetrics[cmpCfg.Metric]
+	if !ok {
+		return &usageError{err: fmt.Errorf("unknown --metric %q (want stddev, cross-refs or duplicates)", cmpCfg.Metric)}
+	}
+
+	result := CompareResult{Metric: cmpCfg.Metric, Winner: "tie"}
+	var err error
+	if result.A, err = scoreSplit(args[0]); err != nil {
+		return err
+	}
+	if result.B, err = scoreSplit(args[1]); err != nil {
+		return err
+	}
+	switch a, b := metric(result.A), metric(result.B); {
+	case a < b:
+		result.Winner = "a"
+	case b < a:
+		result.Winner = "b"
+	}
+
+	if IsStructuredOutput() {
+		return PrintOutput(cmd.OutOrStdout(), result)
+	}
+
+	ui.Header("⚖️  Comparing splits")
+	cmd.Printf("   %-14s %14s %14s\n", "", "A", "B")
+	cmd.Printf("   %-14s %14s %14s\n", "dir", truncateLeft(result.A.Dir, 14), truncateLeft(result.B.Dir, 14))
+	cmd.Printf("   %-14s %14d %14d\n", "files", result.A.Files, result.B.Files)
+	cmd.Printf("   %-14s %14d %14d\n", "lines", result.A.Lines, result.B.Lines)
+	cmd.Printf("   %-14s %14.1f %14.1f\n", "mean lines", result.A.MeanLines, result.B.MeanLines)
+	cmd.Printf("   %-14s %14.1f %14.1f\n", "stddev lines", result.A.StdDevLines, result.B.StdDevLines)
+	cmd.Printf("   %-14s %14d %14d\n", "cross-refs", result.A.CrossRefs, result.B.CrossRefs)
+	cmd.Printf("   %-14s %14d %14d\n", "duplicates", len(result.A.Duplicates), len(result.B.Duplicates))
+	cmd.Println()
+	switch result.Winner {
+	case "a":
+		ui.Success(fmt.Sprintf("A (%s) wins on %s", result.A.Dir, result.Metric))
+	case "b":
+		ui.Success(fmt.Sprintf("B (%s) wins on %s", result.B.Dir, result.Metric))
+	default:
+		ui.Info(fmt.Sprintf("Tie on %s", result.Metric))
+	}
+	return nil
+}
+
+// scoreSplit measures the non-test Go files in dir.
+func scoreSplit(dir string) (SplitScore, error) {
+	score := SplitScore{Dir: dir}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return score, fmt.Errorf("not a directory: %s", dir)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return score, fmt.Errorf("finding files: %w", err)
+	}
+
+	var paths []string
+	var sizes []int
+	declared := make(map[string]int)
+	for _, path := range matches {
+		if isTestFile(path) || !matchesBuildContext(path) {
+			continue
+		}
+		info, err := analyzer.ParseGoFile(path)
+		if err != nil {
+			return score, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		paths = append(paths, path)
+		sizes = append(sizes, info.Lines)
+		seen := make(map[string]bool)
+		for _, sym := range info.Symbols() {
+			if sym.Name != "init" && !seen[sym.Name] {
+				seen[sym.Name] = true
+				declared[sym.Name]++
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return score, fmt.Errorf("no Go files in %s", dir)
+	}
+
+	score.Files = len(paths)
+	for _, n := range sizes {
+		score.Lines += n
+	}
+	score.MeanLines = float64(score.Lines) / float64(score.Files)
+	var variance float64
+	for _, n := range sizes {
+		variance += (float64(n) - score.MeanLines) * (float64(n) - score.MeanLines)
+	}
+	score.StdDevLines = math.Sqrt(variance / float64(score.Files))
+
+	if score.CrossRefs, err = analyzer.CrossFileReferences(paths); err != nil {
+		return score, err
+	}
+	for name, n := range declared {
+		if n > 1 {
+			score.Duplicates = append(score.Duplicates, name)
+		}
+	}
+	sort.Strings(score.Duplicates)
+	return score, nil
+}
+
+// truncateLeft shortens s to width, keeping its end ("…/split-a").
+func truncateLeft(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return "…" + string(r[len(r)-width+1:])
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+const (
+	// charsPerToken is the rough characters-per-token ratio used to
+	// estimate prompt sizes without a tokenizer.
+	charsPerToken = 4
+	// defaultPricePerMTok is the default input price in USD per million
+	// tokens (Claude Sonnet list price).
+	defaultPricePerMTok = 3.00
+)
+
+// CostEstimate is the projected input cost of a generate run.
+type CostEstimate struct {
+	Calls        []CallEstimate `json:"calls"`
+	InputTokens  int            `json:"input_tokens"`
+	PricePerMTok float64        `json:"price_per_mtok"` // USD per million input tokens
+	USD          float64        `json:"usd"`
+}
+
+// CallEstimate is one model call a run is expected to make.
+type CallEstimate struct {
+	Phase       string `json:"phase"`
+	Target      string `json:"target,omitempty"`
+	InputTokens int    `json:"input_tokens"`
+}
+
+// estimateTokens approximates the number of tokens in s.
+func estimateTokens(s string) int {
+	return (len(s) + charsPerToken - 1) / charsPerToken
+}
+
+// estimatePlannedFiles guesses how many files the planner will propose,
+// at about one per splitMinLines lines and never fewer than two.
+func estimatePlannedFiles(info *analyzer.FileInfo) int {
+	n := (info.Lines + splitMinLines - 1) / splitMinLines
+	if n < 2 {
+		n = 2
+	}
+	return n
+}
+
+// estimateCalls lists the calls a model-planned split of content would
+// make: the plan, one generate call per planned file and, without tests, a
+// stub call per file. The file count is guessed, so generated files are
+// named by position and each is assumed to get an equal share of the
+// source.
+func estimateCalls(info *analyzer.FileInfo, data promptData, content, testContent []byte, testInfo *analyzer.FileInfo, planTmpl, genTmpl *template.Template, hasTests, withStubs bool) ([]CallEstimate, error) {
+	planPrompt, err := buildPlanPrompt(data, planTmpl, hasTests, false)
+	if err != nil {
+		return nil, err
+	}
+	calls := []CallEstimate{{Phase: phasePlan, Target: data.Filename, InputTokens: estimateTokens(planPrompt)}}
+
+	n := estimatePlannedFiles(info)
+	for i := 1; i <= n; i++ {
+		target := fmt.Sprintf("file %d of %d", i, n)
+		genPrompt, err := buildGeneratePrompt(target, content, testContent, testInfo, genTmpl)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, CallEstimate{Phase: phaseGenerate, Target: target, InputTokens: estimateTokens(genPrompt)})
+		if withStubs {
+			calls = append(calls, CallEstimate{Phase: phaseStubs, Target: target, InputTokens: estimateTokens(buildStubPrompt(target, "")) + len(content)/n/charsPerToken})
+		}
+	}
+	return calls, nil
+}
+
+// newCostEstimate sums the input tokens of calls and prices them at
+// pricePerMTok USD per million tokens.
+func newCostEstimate(calls []CallEstimate, pricePerMTok float64) *CostEstimate {
+	est := &CostEstimate{Calls: calls, PricePerMTok: pricePerMTok}
+	for _, c := range calls {
+		est.InputTokens += c.InputTokens
+	}
+	est.USD = float64(est.InputTokens) * pricePerMTok / 1e6
+	return est
+}
+
+// defaultPrice returns the --price-per-mtok default, from
+// GO_SPLIT_PRICE_PER_MTOK when it is set to a valid number.
+func defaultPrice() float64 {
+	if p, err := strconv.ParseFloat(getEnvOrDefault("GO_SPLIT_PRICE_PER_MTOK", ""), 64); err == nil && p >= 0 {
+		return p
+	}
+	return defaultPricePerMTok
+}
+
+// printCostEstimate prints est, listing the calls in --verbose mode.
+func printCostEstimate(cmd *cobra.Command, ui *UI, est *CostEstimate) {
+	if cfg.Verbose && len(est.Calls) > 0 {
+		cmd.Println("\n   Estimated AI calls:")
+		cmd.Printf("     %-9s %-28s %12s\n", "PHASE", "TARGET", "INPUT_TOKENS")
+		for _, c := range est.Calls {
+			cmd.Printf("     %-9s %-28s %12d\n", c.Phase, c.Target, c.InputTokens)
+		}
+	}
+	ui.Info(fmt.Sprintf("Estimated cost: %d calls, ~%d input tokens at $%.2f/MTok ≈ $%.4f (no API calls made)",
+		len(est.Calls), est.InputTokens, est.PricePerMTok, est.USD))
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// UndocumentedSymbol is an exported declaration that lacks a doc comment.
+type UndocumentedSymbol struct {
+	File   string `json:"file"`
+	Symbol string `json:"symbol"`
+}
+
+// findUndocumented returns the exported functions, methods and types in
+// outputs that have no doc comment. Methods count as exported only when both
+// the method and its receiver type are exported.
+func findUndocumented(outputs []*analyzer.FileInfo) []UndocumentedSymbol {
+	var missing []UndocumentedSymbol
+	for _, info := range outputs {
+		file := filepath.Base(info.Path)
+		for _, fn := range info.Functions {
+			recv := fn.ReceiverType()
+			if fn.Doc != "" || !ast.IsExported(fn.Name) || (recv != "" && !ast.IsExported(recv)) {
+				continue
+			}
+			name := fn.Name
+			if recv != "" {
+				name = recv + "." + fn.Name
+			}
+			missing = append(missing, UndocumentedSymbol{File: file, Symbol: name})
+		}
+		for _, t := range info.Types {
+			if t.Doc == "" && ast.IsExported(t.Name) {
+				missing = append(missing, UndocumentedSymbol{File: file, Symbol: t.Name})
+			}
+		}
+	}
+	return missing
+}
+
+// addStubDocs asks the model to add doc comments for the undocumented symbols
+// in each file and rewrites the files in place. It returns the names of the
+// files that were rewritten.
+func addStubDocs(client *tracedClient, outDir string, undocumented []UndocumentedSymbol) ([]string, error) {
+	byFile := make(map[string][]string)
+	var order []string
+	for _, u := range undocumented {
+		if _, ok := byFile[u.File]; !ok {
+			order = append(order, u.File)
+		}
+		byFile[u.File] = append(byFile[u.File], u.Symbol)
+	}
+
+	var rewritten []string
+	for _, file := range order {
+		path := filepath.Join(outDir, file)
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return rewritten, fmt.Errorf("reading %s: %w", file, err)
+		}
+
+		prompt := fmt.Sprintf(`Add Go doc comments to these exported symbols: %s
+
+Each comment must start with the symbol's name and briefly describe it.
+Do not change any code or existing comments.
+
+File %s:
+%s
+
+Output ONLY the complete Go file. No markdown.`, strings.Join(byFile[file], ", "), file, string(code))
+
+		response, err := client.Call(phaseDocs, file, prompt, 3000)
+		if err != nil {
+			return rewritten, fmt.Errorf("adding docs to %s: %w", file, err)
+		}
+		if err := writeFileAtomic(path, []byte(cleanCode(response))); err != nil {
+			return rewritten, fmt.Errorf("writing %s: %w", file, err)
+		}
+		rewritten = append(rewritten, file)
+	}
+	return rewritten, nil
+}
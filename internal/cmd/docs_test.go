@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+func TestFindUndocumented(t *testing.T) {
+	dir := t.TempDir()
+	info := parseTestSource(t, dir, "server.go", `package foo
+
+// Server serves.
+type Server struct{}
+
+type Options struct{}
+
+type internal struct{}
+
+// Start starts the server.
+func (s *Server) Start() {}
+
+func (s *Server) Stop() {}
+
+func (i internal) Exported() {}
+
+func NewServer() *Server { return nil }
+
+func helper() {}
+`)
+
+	got := findUndocumented([]*analyzer.FileInfo{info})
+	want := []UndocumentedSymbol{
+		{File: "server.go", Symbol: "Server.Stop"},
+		{File: "server.go", Symbol: "NewServer"},
+		{File: "server.go", Symbol: "Options"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findUndocumented() = %v, want %v", got, want)
+	}
+}
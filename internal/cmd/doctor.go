@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aaronlippold/go-split/internal/api"
+)
+
+// DoctorResult holds the environment checks run by doctor.
+type DoctorResult struct {
+	Passed bool          `json:"passed"`
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// DoctorCheck is one environment check. Optional tools that are missing
+// warn rather than fail.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // pass, warn or fail
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"` // What to do about a warning or failure
+}
+
+// newDoctorCmd creates the doctor command.
+func newDoctorCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that go-split's tools and API backend are set up",
+		Long: `Check the environment go-split depends on and suggest fixes:
+
+  - the Go toolchain, gofmt and go vet (needed by generate and check)
+  - golangci-lint and gosec (optional; check skips them when missing)
+  - the API backend: in wrapper mode each --endpoint is asked for its
+    models, in direct mode the API key is used to list a model
+
+No tokens are spent. doctor exits nonzero if a required check fails.`,
+		Args: cobra.NoArgs,
+		RunE: runDoctor,
+	}
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+
+	result := DoctorResult{Passed: true}
+	add := func(c DoctorCheck) {
+		if c.Status == "fail" {
+			result.Passed = false
+		}
+		result.Checks = append(result.Checks, c)
+	}
+
+	goOK := true
+	if v := toolVersion("go"); v != "" {
+		add(DoctorCheck{Name: "go", Status: "pass", Detail: v})
+	} else {
+		goOK = false
+		add(DoctorCheck{Name: "go", Status: "fail", Detail: "not found in PATH", Hint: "Install Go from https://go.dev/dl/ and make sure go is in PATH"})
+	}
+	if path, err := exec.LookPath("gofmt"); err == nil {
+		add(DoctorCheck{Name: "gofmt", Status: "pass", Detail: path})
+	} else {
+		add(DoctorCheck{Name: "gofmt", Status: "fail", Detail: "not found in PATH", Hint: "gofmt ships with Go; add $(go env GOROOT)/bin to PATH"})
+	}
+	if goOK {
+		if out, err := exec.Command("go", "tool", "-n", "vet").Output(); err == nil {
+			add(DoctorCheck{Name: "go vet", Status: "pass", Detail: strings.TrimSpace(string(out))})
+		} else {
+			add(DoctorCheck{Name: "go vet", Status: "fail", Detail: err.Error(), Hint: "Reinstall Go; the vet tool is missing from the toolchain"})
+		}
+	}
+	for _, tool := range []struct{ name, install string }{
+		{"golangci-lint", "https://golangci-lint.run/welcome/install/"},
+		{"gosec", "go install github.com/securego/gosec/v2/cmd/gosec@latest"},
+	} {
+		if _, err := exec.LookPath(tool.name); err != nil {
+			add(DoctorCheck{Name: tool.name, Status: "warn", Detail: "not installed; check will skip it", Hint: "Install it: " + tool.install})
+			continue
+		}
+		add(DoctorCheck{Name: tool.name, Status: "pass", Detail: toolVersion(tool.name)})
+	}
+	add(apiCheck(cmd.ErrOrStderr()))
+
+	if IsStructuredOutput() {
+		if err := PrintOutput(cmd.OutOrStdout(), result); err != nil {
+			return err
+		}
+	} else {
+		ui.Header("🩺 Checking your go-split setup")
+		for _, c := range result.Checks {
+			icon := map[string]string{"pass": "✓", "warn": "!", "fail": "✗"}[c.Status]
+			cmd.Printf("   %s %-14s %s\n", icon, c.Name, c.Detail)
+			if c.Hint != "" {
+				cmd.Printf("     → %s\n", c.Hint)
+			}
+		}
+		cmd.Println()
+		if result.Passed {
+			ui.Success("Ready to go")
+		}
+	}
+
+	if !result.Passed {
+		cmd.SilenceUsage = true
+		failed := 0
+		for _, c := range result.Checks {
+			if c.Status == "fail" {
+				failed++
+			}
+		}
+		return fmt.Errorf("%d of %d checks failed", failed, len(result.Checks))
+	}
+	return nil
+}
+
+// apiCheck pings the API backend the other commands would use.
+func apiCheck(errOut io.Writer) DoctorCheck {
+	client := newAPIClient(errOut)
+	if client.IsDirectMode() {
+		c := DoctorCheck{Name: "api", Status: "pass", Detail: "Anthropic API key accepted"}
+		if err := client.Ping(); err != nil {
+			c.Status, c.Detail = "fail", err.Error()
+			c.Hint = "Check ANTHROPIC_API_KEY or --api-key, or pass --use-wrapper to use a wrapper endpoint instead"
+		}
+		return c
+	}
+
+	c := DoctorCheck{Name: "api", Status: "pass", Detail: fmt.Sprintf("wrapper at %s is up", client.Endpoint())}
+	if err := client.Ping(); err != nil {
+		c.Status, c.Detail = "fail", err.Error()
+		c.Hint = "Start the wrapper (see README) or point --endpoint / GO_SPLIT_ENDPOINT at it; to call the API directly, set ANTHROPIC_API_KEY"
+		var unreachable *api.UnreachableError
+		if !errors.As(err, &unreachable) {
+			c.Hint = "The wrapper answered with an error; check its logs and that --endpoint points at its messages route"
+		}
+	}
+	return c
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// CallGraphResult is the intra-file call graph of a source file, for
+// analyze --format dot.
+type CallGraphResult struct {
+	File  string          `json:"file"`
+	Nodes []CallGraphNode `json:"nodes"`
+	Edges []CallEdge      `json:"edges"`
+}
+
+// CallEdge is an edge of the graph: Caller calls Callee.
+type CallEdge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+}
+
+// CallGraphNode is a function or method of the graph.
+type CallGraphNode struct {
+	Name     string `json:"name"`               // As in symbols: "Type.Method" for methods
+	Receiver string `json:"receiver,omitempty"` // Type a method belongs to
+}
+
+// dotReport is implemented by results with a Graphviz rendering for
+// --format=dot.
+type dotReport interface {
+	DOT() string
+}
+
+// newCallGraphResult builds the call graph of the functions in info, with
+// edges in the order of their callers.
+func newCallGraphResult(info *analyzer.FileInfo) *CallGraphResult {
+	result := &CallGraphResult{File: filepath.Base(info.Path)}
+	for _, fn := range info.Functions {
+		node := CallGraphNode{Name: fn.Name, Receiver: fn.ReceiverType()}
+		if node.Receiver != "" {
+			node.Name = node.Receiver + "." + fn.Name
+		}
+		result.Nodes = append(result.Nodes, node)
+		for _, callee := range info.Calls[node.Name] {
+			result.Edges = append(result.Edges, CallEdge{Caller: node.Name, Callee: callee})
+		}
+	}
+	return result
+}
+
+// DOT renders the graph for Graphviz, one cluster per receiver type, so
+// that dot -Tpng draws the file's natural split boundaries.
+func (g *CallGraphResult) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(g.File))
+	b.WriteString("  rankdir=LR;\n  node [shape=box];\n")
+
+	// Receiver types in order of their first method
+	var receivers []string
+	members := make(map[string][]string)
+	for _, n := range g.Nodes {
+		if n.Receiver == "" {
+			continue
+		}
+		if _, ok := members[n.Receiver]; !ok {
+			receivers = append(receivers, n.Receiver)
+		}
+		members[n.Receiver] = append(members[n.Receiver], n.Name)
+	}
+	for _, r := range receivers {
+		fmt.Fprintf(&b, "  subgraph %s {\n    label=%s;\n", strconv.Quote("cluster_"+r), strconv.Quote(r))
+		for _, name := range members[r] {
+			fmt.Fprintf(&b, "    %s;\n", strconv.Quote(name))
+		}
+		b.WriteString("  }\n")
+	}
+	for _, n := range g.Nodes {
+		if n.Receiver == "" {
+			fmt.Fprintf(&b, "  %s;\n", strconv.Quote(n.Name))
+		}
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", strconv.Quote(e.Caller), strconv.Quote(e.Callee))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes returned by the CLI.
+const (
+	ExitError = 1 // General failure
+	ExitUsage = 2 // Bad flags or arguments
+)
+
+// usageError marks a failure caused by how the command was invoked.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+// ExitCode returns the process exit code for err: 0 for nil, ExitUsage for
+// bad flags, ExitError otherwise.
+func ExitCode(err error) int {
+	var usage *usageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &usage):
+		return ExitUsage
+	default:
+		return ExitError
+	}
+}
+
+// markArgErrors wraps cmd's argument validator so bad arguments are
+// reported as usage errors.
+func markArgErrors(cmd *cobra.Command) {
+	validate := cmd.Args
+	if validate == nil {
+		return
+	}
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			silenceForJSONErrors(cmd)
+			return &usageError{err: err}
+		}
+		return nil
+	}
+}
+
+// JSONError is printed to stdout on failure with --json-errors.
+type JSONError struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// writeJSONError prints err as a JSONError document.
+func writeJSONError(w io.Writer, err error) {
+	_ = json.NewEncoder(w).Encode(JSONError{Error: err.Error(), Code: ExitCode(err)})
+}
+
+// silenceForJSONErrors stops cobra printing the error and usage text, which
+// would otherwise be mixed into the JSON error document.
+func silenceForJSONErrors(cmd *cobra.Command) {
+	if cfg.JSONErrors {
+		cmd.Root().SilenceErrors = true
+		cmd.Root().SilenceUsage = true
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package cmd
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; appends of a single
+// short line are still written in one call.
+func lockFile(f *os.File) error { return nil }
+
+// unlockFile is a no-op, matching lockFile.
+func unlockFile(f *os.File) error { return nil }
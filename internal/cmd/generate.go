@@ -4,11 +4,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
 	"github.com/aaronlippold/go-split/internal/analyzer"
+	"github.com/aaronlippold/go-split/internal/splitter"
 )
 
 // GenerateResult holds generation results for JSON output.
@@ -20,6 +26,75 @@ type GenerateResult struct {
 	Files            []GeneratedFile `json:"files"`
 	ValidationPassed bool            `json:"validation_passed,omitempty"`
 	ValidationError  string          `json:"validation_error,omitempty"`
+	TestFailures     []TestFailure   `json:"test_failures,omitempty"` // Parsed from ValidationError
+	// SymbolMap lists, per original symbol, the output files declaring it.
+	SymbolMap         []SymbolLocation `json:"symbol_map,omitempty"`
+	DroppedSymbols    []string         `json:"dropped_symbols,omitempty"`
+	DuplicatedSymbols []string         `json:"duplicated_symbols,omitempty"`
+	Verification      *VerifyResult    `json:"verification,omitempty"`
+	// Undocumented lists exported output symbols without doc comments (--require-docs).
+	Undocumented []UndocumentedSymbol `json:"undocumented,omitempty"`
+	// Package extraction (output directory is a different package)
+	Package      string   `json:"package,omitempty"`
+	ImportPath   string   `json:"import_path,omitempty"`
+	UpdatedFiles []string `json:"updated_files,omitempty"` // Source files rewritten by --update-imports
+	Barrel       string   `json:"barrel,omitempty"`        // Source file replaced by --barrel
+	// MisplacedBenchmarks lists benchmarks split away from the code they measure.
+	MisplacedBenchmarks []MisplacedBenchmark `json:"misplaced_benchmarks,omitempty"`
+	// InitOrderRisks lists what in a package main source depends on
+	// initialization order, which splitting can change.
+	InitOrderRisks []string `json:"init_order_risks,omitempty"`
+	// Calls lists the model calls made, in order, with their latencies.
+	Calls []CallStat `json:"calls,omitempty"`
+	// Normalized lists the fixes --normalize-eol applied to the input.
+	Normalized []string `json:"normalized,omitempty"`
+	// Warnings lists the problems reported during the run (fatal with --fail-on-warnings).
+	Warnings []string `json:"warnings,omitempty"`
+	// Empty is set when the source has no declarations and nothing was done.
+	Empty bool `json:"empty,omitempty"`
+	// EstimatedCost projects the input cost of a run (--estimate-cost).
+	EstimatedCost *CostEstimate `json:"estimated_cost,omitempty"`
+	// DroppedDirectives lists directive comments (//nolint, //go:...) that
+	// did not stay with their declaration.
+	DroppedDirectives []string `json:"dropped_directives,omitempty"`
+	// ModifiedBodies lists the functions whose body the split changed.
+	ModifiedBodies []string `json:"modified_bodies,omitempty"`
+	// ReusedCache is the key of the cached run whose files were reused
+	// instead of calling the API (--reuse-cache).
+	ReusedCache string `json:"reused_cache,omitempty"`
+	// TestMainFile is the generated test file declaring TestMain, which a
+	// package may declare only once.
+	TestMainFile string `json:"test_main_file,omitempty"`
+	// SourcePath is the source as given, with --output-layout mirror.
+	SourcePath string `json:"source_path,omitempty"`
+	// Preflight reports the planned split without generating it (--preflight).
+	Preflight *PreflightResult `json:"preflight,omitempty"`
+
+	inventory []InventorySymbol // Symbols of the generated files, for --emit-inventory
+	moves     []SymbolMove      // Where each source symbol went, for --emit-moves
+}
+
+// PreflightResult is the granularity of a planned split: the files it
+// would produce and whether they are more than --max-files.
+type PreflightResult struct {
+	Files    []string `json:"files"`
+	Count    int      `json:"count"`
+	MaxFiles int      `json:"max_files,omitempty"`
+	OverCap  bool     `json:"over_cap"`
+}
+
+// BulkGenerateResult holds the results of generating several files.
+type BulkGenerateResult struct {
+	Results   []GenerateResult `json:"results"`
+	Errors    []FileError      `json:"errors,omitempty"`
+	Processed int              `json:"processed"`
+	Aborted   bool             `json:"aborted,omitempty"` // Stopped early by --abort-after
+}
+
+// FileError records a file whose run failed.
+type FileError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
 }
 
 // GeneratedFile describes a generated file.
@@ -29,6 +104,11 @@ type GeneratedFile struct {
 	Status    string `json:"status"` // "created", "failed", "skipped"
 	Error     string `json:"error,omitempty"`
 	TestCount int    `json:"test_count,omitempty"` // Number of tests in file (for test files)
+	// Dry run only: the planner's rationale and the expected size
+	Description    string `json:"description,omitempty"`
+	EstimatedLines int    `json:"estimated_lines,omitempty"`
+	// Calls repeated because the output did not parse (--retry-on-parse-failure)
+	Retries int `json:"retries,omitempty"`
 }
 
 // SplitPlan represents the AI's plan for splitting source and tests together.
@@ -48,58 +128,479 @@ type SplitFile struct {
 // generateConfig holds generate-specific configuration.
 type generateConfig struct {
 	SkipTests      bool
+	TestsAsContext bool // Show the tests to the planner without splitting them
+	NoStubs        bool // Split existing tests but never generate stubs
 	SkipValidation bool
+	PlanPromptFile string
+	GenPromptFile  string
+	Verify         bool
+	AllowDrop      []string
+	RequireDocs    bool
+	AddDocs        bool
+	NewPackage     bool
+	UpdateImports  bool
+	Barrel         bool // With NewPackage, leave re-exports in the source file
+	ByType         bool
+	HelpersFile    string // With ByType, one file for every free function
+	MinTypeLines   int    // With ByType, smaller types stay in the primary file
+	PreserveOrder  bool   // Prefix output names so file order follows the source
+	OnlyExported   bool   // Move exported declarations to APIFile without AI
+	APIFile        string // With OnlyExported, the file for the exported API
+	GroupBy        string // "comment": one file per section divider comment
+	SectionRegex   string // With GroupBy comment, the divider pattern
+	sectionRe      *regexp.Regexp
+	PlanFile       string // Outline of files and their symbols, instead of planning
+	outline        map[string][]string
+	Even           int
+	// WithPackageContext adds sibling-file declarations to the planning prompt
+	WithPackageContext bool
+	AbortAfter         int
+	Archive            string  // tar or zip, for --output -
+	EstimateCost       bool    // Project the cost of a run without calling the API
+	PricePerMTok       float64 // USD per million input tokens, for EstimateCost
+	FailOnWarnings     bool    // Exit nonzero when the run reports any warning
+	StrictPreserve     bool    // Fail the run if the split changed any function body
+	Force              bool    // Split files that cannot be split safely, such as cgo files
+	MaxInputLines      int     // Refuse larger files unless Force; 0 for no limit
+	EmitInventory      string  // Write the generated files' symbols to this JSON file
+	EmitMoves          string  // Write each symbol's old and new location to this JSON file
+	PromptPreview      bool    // Print the rendered prompts to stderr instead of calling the API
+	ReuseCache         bool    // Reuse the files of an identical earlier run, and record this one
+	OutputLayout       string  // flat, or mirror to recreate source directories under --output
+	Preflight          bool    // Only plan, reporting the file count against MaxFiles
+	MaxFiles           int     // Most files a split may produce; 0 for no limit
+	// Calls repeated with the syntax error when generated code does not parse
+	RetryOnParseFailure int
+	// Review and rearrange the AI plan in a terminal UI, then split as edited
+	TUI bool
+	// Never call the API: split by type unless another mode without AI is set
+	NoAI bool
+	// Per-phase timeouts; zero plan and generate timeouts use --timeout
+	PlanTimeout     time.Duration
+	GenTimeout      time.Duration
+	ValidateTimeout time.Duration
 }
 
 var genCfg = &generateConfig{}
 
+// defaultMaxInputLines is the largest file generate sends to the API
+// without --force.
+const defaultMaxInputLines = 20000
+
+// splitsLocally reports whether the split is computed without the model.
+func (c *generateConfig) splitsLocally() bool {
+	return c.ByType || c.Even > 0 || c.OnlyExported || c.GroupBy != "" || c.PlanFile != ""
+}
+
+// skipsTests reports whether existing tests are left as they are, neither
+// split nor stubbed.
+func (c *generateConfig) skipsTests() bool {
+	return c.SkipTests || c.TestsAsContext || c.TUI
+}
+
 // newGenerateCmd creates the generate command.
 func newGenerateCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "generate <file>",
-		Short: "Generate split files from a Go file",
+		Use:     "generate <file|->...",
+		Aliases: []string{"split"},
+		Short:   "Generate split files from a Go file",
 		Long: `Generate split files based on AI analysis. The AI will determine
 how to best split the file and generate the new files.
 
 When a test file exists, the AI receives both source and tests together
 to plan splits that maintain test coverage. When no tests exist, the AI
-generates test stubs for each output file.`,
-		Args: cobra.ExactArgs(1),
+generates test stubs for each output file unless --no-stubs is set.
+--skip-tests ignores tests entirely: existing tests are neither split nor
+stubbed, so it implies --no-stubs. --tests-as-context leaves the tests
+alone too, but includes them in the planning prompt so tested units are
+planned into the same file.
+
+With --by-type the split is done locally without AI: each type moves to
+its own file with its methods and constructors, free functions go to
+<name>_helpers.go and the rest stays in <name>.go. --even N instead packs
+declarations in order into files of at most N lines: <name>.go, then
+<name>_part2.go, <name>_part3.go and so on.
+--only-exported moves every exported declaration to api.go (or
+--api-file) and leaves the unexported ones in <name>.go. --group-by comment
+follows the file's own section divider comments ("// --- Handlers ---",
+"// MARK: - Handlers", or --section-regex): each section goes to
+<name>_<section>.go and anything before the first divider stays in
+<name>.go. --plan-file takes the split from an outline instead, a YAML or
+JSON file mapping each output file to its symbols (methods as Type.Method):
+
+  handlers.go: [HandleGet, Server.ServeHTTP]
+  store.go: [Store, NewStore]
+
+Types bring their unplaced methods along, and symbols the outline leaves
+out stay in <name>.go with a warning. Tests are left as-is in these modes.
+
+--no-ai guarantees that no API call is made, for CI without network
+access or an API key: it splits by type (as --by-type, but with free
+functions in helpers.go) unless one of the other modes above is given,
+and refuses --add-docs.
+
+Use "-" to read the source from stdin; --stdin-name sets the filename it
+is treated as (default stdin.go).
+
+Files using cgo (import "C") are refused: the cgo preamble applies only to
+the file importing "C", so moving code that calls C.* breaks the build.
+--force splits them anyway, keeping //export directives with their
+functions.
+
+Files over --max-input-lines (default 20000) are refused as well, since
+they are usually generated by mistake and costly to send to the API; --force
+sends them anyway. The limit does not apply to the splits made without AI.
+
+Several files may be given; they are split one after another. If the API
+fails for --abort-after files in a row the run stops early.
+
+With --output - nothing is written next to the source: the generated files
+are streamed to stdout as a tar archive (zip with --archive zip) and
+progress goes to stderr. Validation is skipped in this mode.
+
+--output-layout mirror recreates the directory of each source, relative
+to the working directory, under --output: with -o out/, pkg/a/big.go is
+split into out/pkg/a/. Combined with --output - the archive holds the
+mirrored tree, leaving the original tree untouched.
+
+--emit-inventory <file> writes a JSON array of every top-level symbol in
+the generated files, tests included, with its file, kind, line range and
+whether it is exported, for indexing and code navigation tools.
+--emit-moves <file> writes where each symbol of the source went: its old
+and new file and line range, for scripts that keep history readable.
+
+When --output is another directory that already holds Go files of the
+package, the planner is told their names and declarations so it neither
+recreates them nor duplicates their symbols; a plan naming one of them
+anyway is rejected before anything is written.
+
+--new-package extracts into a separate package at --output. Callers of the
+moved symbols then break; --update-imports rewrites the other files of the
+source package to import them, and --barrel instead replaces the source
+file with type aliases, constants and function forwarders re-exporting
+them, so existing importers keep compiling. The barrel is checked with go
+build unless --skip-validation is set.
+
+--estimate-cost makes no API calls and writes nothing: it estimates the
+input tokens of every call a real run would make (about 4 characters per
+token, guessing one planned file per 300 source lines) and prices them at
+--price-per-mtok, which defaults to $GO_SPLIT_PRICE_PER_MTOK or 3.00.
+
+--prompt-preview prints the planning and generation prompts, exactly as
+they would be sent, to stderr and stops before any API call. The file
+names come from the plan, so the generation prompt is shown for a
+placeholder name. With --dry-run the planning prompt asks for the detailed
+plan a dry run requests. Use it to debug --plan-prompt-file and
+--gen-prompt-file templates offline.
+
+--reuse-cache records each successful run under --cache, keyed on the
+source and test content, model, prompt templates and the flags that shape
+the output. A later run with identical inputs writes the recorded files
+instead of calling the API, which makes CI re-runs free and deterministic;
+validation and the other checks still run. List the recorded runs with
+go-split cache list.
+
+--preflight makes only the planning call and reports the files the split
+would produce and how many, then stops. With --max-files N it exits
+nonzero when the plan has more than N files; a full run over --max-files
+stops after planning, before any generation call.
+
+--tui shows the plan full screen before anything is generated: each
+proposed file with the declarations it gets. Select declarations with the
+arrow keys and space, move them to the previous or next file with left
+and right, to file N with its number, or to a new file with n (a type
+brings its methods); d drops a file and enter confirms. The split is then
+made as edited, without AI, the way --plan-file splits; tests are left as
+they are. It needs an interactive terminal and a single source file.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: runGenerate,
 	}
 
 	cmd.Flags().BoolVar(&genCfg.SkipTests, "skip-tests", false, "Skip test file splitting/generation")
+	cmd.Flags().BoolVar(&genCfg.TestsAsContext, "tests-as-context", false, "Include the test file in the planning prompt without splitting it or generating stubs (implies --skip-tests)")
+	cmd.Flags().BoolVar(&genCfg.NoStubs, "no-stubs", false, "Split existing tests but don't generate test stubs when there are none")
 	cmd.Flags().BoolVar(&genCfg.SkipValidation, "skip-validation", false, "Skip running go test after split")
+	cmd.Flags().BoolVar(&genCfg.Verify, "verify", false, "Fail if output files lose or add top-level symbols relative to the source")
+	cmd.Flags().StringSliceVar(&genCfg.AllowDrop, "allow-drop", nil, "Symbols intentionally removed by the split (ignored by --verify)")
+	cmd.Flags().BoolVar(&genCfg.RequireDocs, "require-docs", false, "Report exported symbols in the output that lack doc comments")
+	cmd.Flags().BoolVar(&genCfg.AddDocs, "add-docs", false, "With --require-docs, ask the model to add stub doc comments")
+	cmd.Flags().BoolVar(&genCfg.NewPackage, "new-package", false, "Treat --output as a separate package inside the module (sets package name and import path)")
+	cmd.Flags().BoolVar(&genCfg.UpdateImports, "update-imports", false, "With --new-package, qualify references to moved symbols in the remaining source")
+	cmd.Flags().BoolVar(&genCfg.Barrel, "barrel", false, "With --new-package, replace the source file with aliases and forwarders to the moved symbols so callers keep compiling")
+	cmd.Flags().IntVar(&genCfg.MaxInputLines, "max-input-lines", defaultMaxInputLines, "Refuse to send files longer than this to the API unless --force is set (0 = no limit)")
+	cmd.Flags().BoolVar(&genCfg.Force, "force", false, "Split files go-split would refuse, such as files using cgo (import \"C\")")
+	cmd.Flags().BoolVar(&genCfg.StrictPreserve, "strict-preserve", false, "Fail if the split changed any function body beyond formatting, comments and package qualifiers")
+	cmd.Flags().StringVar(&genCfg.EmitInventory, "emit-inventory", "", "Write every symbol of the generated files (file, kind, lines, exported) to this JSON file")
+	cmd.Flags().StringVar(&genCfg.EmitMoves, "emit-moves", "", "Write each source symbol's old and new file and lines to this JSON file")
+	cmd.Flags().BoolVar(&genCfg.FailOnWarnings, "fail-on-warnings", false, "Exit nonzero if the run reports any warning (dropped or duplicated symbols, init order, ...)")
+	cmd.Flags().DurationVar(&genCfg.PlanTimeout, "plan-timeout", 0, "Timeout for the planning call (default --timeout)")
+	cmd.Flags().DurationVar(&genCfg.GenTimeout, "gen-timeout", 0, "Timeout for each file generation call (default --timeout)")
+	cmd.Flags().DurationVar(&genCfg.ValidateTimeout, "validate-timeout", defaultValidateTimeout, "Timeout for running go test on the split")
+	cmd.Flags().IntVar(&genCfg.RetryOnParseFailure, "retry-on-parse-failure", 0, "Call again with the syntax error, up to this many times, when a generated file does not parse before marking it failed")
+	cmd.Flags().IntVar(&genCfg.AbortAfter, "abort-after", 3, "With several files, stop after this many consecutive failures (0 = never)")
+	cmd.Flags().StringVar(&genCfg.OutputLayout, "output-layout", "flat", "Where files go under --output: flat, or mirror to recreate each source's directory")
+	cmd.Flags().StringVar(&genCfg.Archive, "archive", "tar", "Archive format for --output -: tar or zip")
+	cmd.Flags().BoolVar(&genCfg.EstimateCost, "estimate-cost", false, "Estimate the input tokens and cost of the run without calling the API")
+	cmd.Flags().BoolVar(&genCfg.ReuseCache, "reuse-cache", false, "Reuse the output of an identical earlier run under --cache instead of calling the API, and record successful runs")
+	cmd.Flags().BoolVar(&genCfg.Preflight, "preflight", false, "Only plan the split: report the files it would produce and their count, then exit")
+	cmd.Flags().BoolVar(&genCfg.TUI, "tui", false, "Review and rearrange the planned files' declarations in a terminal UI, then split as edited without generation calls")
+	cmd.Flags().IntVar(&genCfg.MaxFiles, "max-files", 0, "Fail when the planned split has more than this many files, before generating any (0 = no limit)")
+	cmd.Flags().BoolVar(&genCfg.PromptPreview, "prompt-preview", false, "Print the rendered planning and generation prompts to stderr and exit without calling the API")
+	cmd.Flags().Float64Var(&genCfg.PricePerMTok, "price-per-mtok", defaultPrice(), "Price in USD per million input tokens for --estimate-cost (env: GO_SPLIT_PRICE_PER_MTOK)")
+	cmd.Flags().BoolVar(&genCfg.NoAI, "no-ai", false, "Never call the API: split from the syntax tree, by type unless another split without AI is chosen")
+	cmd.Flags().BoolVar(&genCfg.ByType, "by-type", false, "Split deterministically without AI: one file per type (with methods and constructors), helpers and the rest")
+	cmd.Flags().IntVar(&genCfg.Even, "even", 0, "Split deterministically without AI into <name>.go and <name>_partN.go files of at most N declaration lines")
+	cmd.Flags().BoolVar(&genCfg.PreserveOrder, "preserve-order", false, "Prefix output file names (01_, 02_, ...) so initialization order follows the original file")
+	cmd.Flags().IntVar(&genCfg.MinTypeLines, "min-type-lines", 0, "With --by-type, keep types whose declaration plus methods span fewer lines in <name>.go")
+	cmd.Flags().StringVar(&genCfg.HelpersFile, "helpers-file", "", "With --by-type, put every function without a receiver (constructors included) in this file")
+	cmd.Flags().BoolVar(&genCfg.OnlyExported, "only-exported", false, "Split deterministically without AI: exported declarations to api.go, unexported ones stay")
+	cmd.Flags().StringVar(&genCfg.APIFile, "api-file", "", "With --only-exported, the file for exported declarations (default api.go)")
+	cmd.Flags().StringVar(&genCfg.GroupBy, "group-by", "", "Split deterministically without AI: \"comment\" makes one file per section divider comment (// --- Name ---)")
+	cmd.Flags().StringVar(&genCfg.SectionRegex, "section-regex", splitter.DefaultSectionPattern, "With --group-by comment, the regexp matching divider comments; its first non-empty group names the section")
+	cmd.Flags().StringVar(&genCfg.PlanFile, "plan-file", "", "Split deterministically without AI as a YAML/JSON outline says: output file -> symbols")
+	cmd.MarkFlagsMutuallyExclusive("by-type", "even", "only-exported", "group-by", "plan-file")
+	cmd.Flags().BoolVar(&genCfg.WithPackageContext, "with-package-context", false, "Include declarations from other files in the package in the planning prompt")
+	cmd.Flags().StringVar(&genCfg.PlanPromptFile, "plan-prompt-file", "", "Template file overriding the planning prompt (text/template, requires {{.Content}})")
+	cmd.Flags().StringVar(&genCfg.GenPromptFile, "gen-prompt-file", "", "Template file overriding the generation prompt (text/template, requires {{.Content}} and {{.Filename}})")
 
 	return cmd
 }
 
 func runGenerate(cmd *cobra.Command, args []string) error {
+	if genCfg.NoAI {
+		if genCfg.AddDocs {
+			return &usageError{err: fmt.Errorf("--add-docs asks the model for doc comments; it cannot be combined with --no-ai")}
+		}
+		if !genCfg.splitsLocally() {
+			genCfg.ByType = true
+		}
+	}
+	if genCfg.Even < 0 {
+		return &usageError{err: fmt.Errorf("--even must be a positive line count")}
+	}
+	if h := genCfg.HelpersFile; h != "" {
+		if !genCfg.ByType {
+			return &usageError{err: fmt.Errorf("--helpers-file requires --by-type")}
+		}
+		if filepath.Base(h) != h || filepath.Ext(h) != ".go" || strings.HasSuffix(h, "_test.go") {
+			return &usageError{err: fmt.Errorf("--helpers-file must be a .go file name, got %q", h)}
+		}
+		for _, arg := range args {
+			if arg == "-" {
+				arg = cfg.StdinName
+			}
+			if filepath.Base(arg) == h {
+				return &usageError{err: fmt.Errorf("--helpers-file %s is the source file itself", h)}
+			}
+		}
+	}
+	if genCfg.MinTypeLines != 0 && !genCfg.ByType {
+		return &usageError{err: fmt.Errorf("--min-type-lines requires --by-type")}
+	}
+	if genCfg.UpdateImports && !genCfg.NewPackage {
+		return &usageError{err: fmt.Errorf("--update-imports requires --new-package")}
+	}
+	if genCfg.Barrel && !genCfg.NewPackage {
+		return &usageError{err: fmt.Errorf("--barrel requires --new-package")}
+	}
+	if a := genCfg.APIFile; a != "" {
+		if !genCfg.OnlyExported {
+			return &usageError{err: fmt.Errorf("--api-file requires --only-exported")}
+		}
+		if filepath.Base(a) != a || filepath.Ext(a) != ".go" || strings.HasSuffix(a, "_test.go") {
+			return &usageError{err: fmt.Errorf("--api-file must be a .go file name, got %q", a)}
+		}
+	}
+	if genCfg.GroupBy != "" && genCfg.GroupBy != "comment" {
+		return &usageError{err: fmt.Errorf("--group-by must be comment, got %q", genCfg.GroupBy)}
+	}
+	if cmd.Flags().Changed("section-regex") && genCfg.GroupBy == "" {
+		return &usageError{err: fmt.Errorf("--section-regex requires --group-by comment")}
+	}
+	re, err := regexp.Compile(genCfg.SectionRegex)
+	if err != nil {
+		return &usageError{err: fmt.Errorf("invalid --section-regex: %w", err)}
+	}
+	genCfg.sectionRe = re
+	if genCfg.PlanTimeout < 0 || genCfg.GenTimeout < 0 || genCfg.ValidateTimeout <= 0 {
+		return &usageError{err: fmt.Errorf("--plan-timeout, --gen-timeout and --validate-timeout must be positive")}
+	}
+	switch genCfg.OutputLayout {
+	case "flat":
+	case "mirror":
+		if cfg.OutputDir == "" {
+			return &usageError{err: fmt.Errorf("--output-layout mirror requires --output")}
+		}
+	default:
+		return &usageError{err: fmt.Errorf("--output-layout must be flat or mirror, got %q", genCfg.OutputLayout)}
+	}
+	genCfg.outline = nil
+	if genCfg.PromptPreview && genCfg.splitsLocally() {
+		return &usageError{err: fmt.Errorf("--prompt-preview has no prompts to show for a split without AI")}
+	}
+	if genCfg.MaxFiles < 0 {
+		return &usageError{err: fmt.Errorf("--max-files must not be negative")}
+	}
+	if genCfg.RetryOnParseFailure < 0 {
+		return &usageError{err: fmt.Errorf("--retry-on-parse-failure must not be negative")}
+	}
+	if genCfg.Preflight && (genCfg.EstimateCost || genCfg.PromptPreview || cfg.OutputDir == stdoutOutput) {
+		return &usageError{err: fmt.Errorf("--preflight cannot be combined with --estimate-cost, --prompt-preview or --output -")}
+	}
+	if genCfg.TUI {
+		switch {
+		case len(args) > 1 || args[0] == "-":
+			return &usageError{err: fmt.Errorf("--tui reviews the plan of a single source file")}
+		case genCfg.splitsLocally() || genCfg.Preflight || genCfg.EstimateCost || genCfg.PromptPreview || genCfg.ReuseCache || cfg.OutputDir == stdoutOutput:
+			return &usageError{err: fmt.Errorf("--tui reviews an AI plan before writing files; it cannot be combined with splits without AI, --preflight, --estimate-cost, --prompt-preview, --reuse-cache or --output -")}
+		case IsStructuredOutput() || !isTerminal() || !term.IsTerminal(int(os.Stdin.Fd())) || os.Getenv("CI") != "":
+			return &usageError{err: fmt.Errorf("--tui needs an interactive terminal")}
+		}
+	}
+	if genCfg.PlanFile != "" {
+		if len(args) > 1 {
+			return &usageError{err: fmt.Errorf("--plan-file outlines a single file, got %d", len(args))}
+		}
+		if genCfg.outline, err = loadOutline(genCfg.PlanFile); err != nil {
+			return err
+		}
+	}
+	for _, arg := range args {
+		if isRemoteInput(arg) {
+			return &usageError{err: fmt.Errorf("generate needs a local file or -, got %s (analyze accepts git: and URL inputs)", arg)}
+		}
+	}
+	if cfg.OutputDir == stdoutOutput {
+		if genCfg.EmitInventory != "" || genCfg.EmitMoves != "" {
+			return &usageError{err: fmt.Errorf("--emit-inventory and --emit-moves need --output to be a directory, not -")}
+		}
+		return runGenerateToArchive(cmd, args)
+	}
+	if len(args) == 1 {
+		result, err := generateFile(cmd, args[0])
+		if result != nil && IsStructuredOutput() {
+			if printErr := PrintOutput(cmd.OutOrStdout(), *result); printErr != nil {
+				return printErr
+			}
+		}
+		if result != nil {
+			if reportErr := writeSymbolReports([]GenerateResult{*result}); err == nil {
+				err = reportErr
+			}
+		}
+		return err
+	}
+	return runBulkGenerate(cmd, args)
+}
+
+// runBulkGenerate generates each file in turn. After --abort-after
+// consecutive failures it stops, on the assumption that the problem is
+// systemic (API down, credentials expired) rather than per file.
+func runBulkGenerate(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+	bulk := BulkGenerateResult{Results: []GenerateResult{}}
+
+	consecutive := 0
+	var lastErr error
+	for _, arg := range args {
+		result, err := generateFile(cmd, arg)
+		bulk.Processed++
+		if result != nil {
+			bulk.Results = append(bulk.Results, *result)
+		}
+		if err == nil {
+			consecutive = 0
+			continue
+		}
+
+		bulk.Errors = append(bulk.Errors, FileError{File: arg, Error: err.Error()})
+		ui.Error(fmt.Sprintf("%s: %v", arg, err))
+		consecutive++
+		lastErr = err
+		if genCfg.AbortAfter > 0 && consecutive >= genCfg.AbortAfter {
+			bulk.Aborted = true
+			break
+		}
+	}
+
+	if IsStructuredOutput() {
+		if err := PrintOutput(cmd.OutOrStdout(), bulk); err != nil {
+			return err
+		}
+	}
+	if err := writeSymbolReports(bulk.Results); err != nil {
+		return err
+	}
+
+	switch {
+	case bulk.Aborted:
+		return fmt.Errorf("aborting after %d consecutive failures (%d of %d files processed): %w", consecutive, bulk.Processed, len(args), lastErr)
+	case len(bulk.Errors) > 0:
+		return fmt.Errorf("%d of %d files failed", len(bulk.Errors), len(args))
+	}
+	return nil
+}
+
+// generateFile splits a single file. The result is returned for printing
+// by the caller in structured mode; it is nil when the run failed before
+// anything was planned.
+func generateFile(cmd *cobra.Command, arg string) (*GenerateResult, error) {
 	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
 
-	filename := args[0]
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return fmt.Errorf("file not found: %s", filename)
+	filename, content, normalized, err := readInput(cmd, arg)
+	if err != nil {
+		return nil, err
 	}
 
-	content, err := os.ReadFile(filename)
+	info, err := analyzer.ParseGoSource(filename, content)
 	if err != nil {
-		return fmt.Errorf("reading file: %w", err)
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+
+	// Load prompt overrides up front so a bad template fails before any API call
+	var planTmpl, genTmpl *template.Template
+	if genCfg.PlanPromptFile != "" {
+		if planTmpl, err = loadPromptTemplate(genCfg.PlanPromptFile, "Content"); err != nil {
+			return nil, err
+		}
+	}
+	if genCfg.GenPromptFile != "" {
+		if genTmpl, err = loadPromptTemplate(genCfg.GenPromptFile, "Content", "Filename"); err != nil {
+			return nil, err
+		}
 	}
 
-	info, err := analyzer.ParseGoFile(filename)
+	outDir, err := outputDirFor(arg, filename)
 	if err != nil {
-		return fmt.Errorf("parsing file: %w", err)
+		return nil, err
+	}
+
+	// A package clause and comments alone are not worth an API call
+	if isEmptyFile(info) {
+		ui.Success(fmt.Sprintf("Nothing to split: %s has no declarations", filepath.Base(filename)))
+		return &GenerateResult{
+			SourceFile: filepath.Base(filename),
+			OutputDir:  outDir,
+			DryRun:     cfg.DryRun,
+			Files:      []GeneratedFile{},
+			Normalized: normalized,
+			Empty:      true,
+		}, nil
 	}
 
-	outDir := cfg.OutputDir
-	if outDir == "" {
-		outDir = filepath.Dir(filename)
+	// The cgo preamble only applies to the file with import "C"
+	if info.CgoUsed && !genCfg.Force {
+		return nil, fmt.Errorf("%s uses cgo; code moved away from its import \"C\" and preamble will not build (use --force to split anyway)", filepath.Base(filename))
+	}
+
+	// A file this big is most likely generated or vendored, and expensive to send
+	if limit := genCfg.MaxInputLines; limit > 0 && info.Lines > limit && !genCfg.Force && !genCfg.splitsLocally() && !genCfg.EstimateCost && !genCfg.PromptPreview {
+		return nil, fmt.Errorf("%s has %d lines, more than --max-input-lines %d; it may be generated code (use --force to split it anyway)", filepath.Base(filename), info.Lines, limit)
 	}
 
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(outDir, 0755); err != nil {
-		return fmt.Errorf("creating output directory: %w", err)
+		return nil, fmt.Errorf("creating output directory: %w", err)
 	}
 
 	// Inform user if directory was created (not in structured output mode)
@@ -116,106 +617,345 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 		OutputDir:  outDir,
 		DryRun:     cfg.DryRun,
 		Files:      []GeneratedFile{},
+		Normalized: normalized,
+	}
+	if genCfg.OutputLayout == "mirror" {
+		result.SourcePath = arg
+		ui.Info(fmt.Sprintf("Mirroring %s to %s", arg, outDir))
+	}
+	// warn reports a problem that does not stop the run
+	warn := func(msg string) {
+		result.Warnings = append(result.Warnings, msg)
+		ui.Warning(msg)
+	}
+
+	if info.CgoUsed {
+		warn("Splitting a cgo file (--force): only files that import \"C\" see the preamble, so code using C.* must stay with it")
+	}
+
+	// A separate package needs its own package name and should live inside
+	// the module so the remaining source can import it.
+	newPackage := false
+	if genCfg.NewPackage {
+		srcAbs, _ := filepath.Abs(filepath.Dir(filename))
+		outAbs, _ := filepath.Abs(outDir)
+		if srcAbs == outAbs {
+			return nil, fmt.Errorf("--new-package requires --output to be a different directory")
+		}
+		newPackage = true
+		result.Package = packageNameFor(outDir)
+		if importPath, err := importPathFor(outDir); err != nil {
+			warn(fmt.Sprintf("Output directory is outside the module (%v); it cannot be imported", err))
+		} else {
+			result.ImportPath = importPath
+			ui.Info(fmt.Sprintf("Extracting to package %s (%s)", result.Package, importPath))
+		}
+	}
+	finalize := func(code string) string {
+		code = cleanCode(code)
+		if newPackage {
+			code = setPackageName(code, result.Package)
+		}
+		return withBuildConstraints(code, info.BuildTags)
 	}
 
 	// Check for associated test file
 	testFilePath := findTestFile(filename)
 	var testContent []byte
 	hasTests := false
-	if testFilePath != "" && !genCfg.SkipTests {
+	if testFilePath != "" && !genCfg.skipsTests() && !genCfg.splitsLocally() {
 		result.TestFile = filepath.Base(testFilePath)
 		testContent, err = os.ReadFile(testFilePath)
 		if err != nil {
 			testContent = nil
 		} else {
 			hasTests = true
+			if cfg.NormalizeEOL {
+				testContent, _ = analyzer.NormalizeSource(testContent)
+			}
+		}
+	}
+	// With --tests-as-context the planner sees the tests, nothing else does
+	var contextTests []byte
+	if testFilePath != "" && genCfg.TestsAsContext && !genCfg.splitsLocally() {
+		if contextTests, err = os.ReadFile(testFilePath); err != nil {
+			warn(fmt.Sprintf("Planning without tests: %v", err))
+			contextTests = nil
+		} else if cfg.NormalizeEOL {
+			contextTests, _ = analyzer.NormalizeSource(contextTests)
 		}
 	}
+	planWithTests := hasTests || contextTests != nil
 
 	ui.Header(fmt.Sprintf("📄 Splitting %s (%d lines)", filepath.Base(filename), info.Lines))
+	if len(normalized) > 0 {
+		ui.Info(fmt.Sprintf("Normalized input: %s", strings.Join(normalized, ", ")))
+	}
+
+	result.InitOrderRisks = initOrderRisks(info)
+	if len(result.InitOrderRisks) > 0 && !genCfg.PreserveOrder {
+		warn(fmt.Sprintf("Splitting may change initialization order, which follows file names across files (%s); use --preserve-order to keep it",
+			strings.Join(result.InitOrderRisks, "; ")))
+	}
 
+	var testInfo *analyzer.FileInfo
 	if hasTests {
-		testInfo, _ := analyzer.ParseGoFile(testFilePath)
+		testInfo, _ = analyzer.ParseGoFile(testFilePath)
 		if testInfo != nil {
 			testCount := countTestFunctions(testInfo)
 			ui.Info(fmt.Sprintf("Found test file: %s (%d lines, %d tests) - will split alongside source", result.TestFile, testInfo.Lines, testCount))
 		}
-	} else if !genCfg.SkipTests {
-		ui.Info("No test file found - will generate test stubs")
+	} else if contextTests != nil {
+		ui.Info(fmt.Sprintf("Found test file: %s - planning with it as context, tests left as they are (--tests-as-context)", filepath.Base(testFilePath)))
+	} else if !genCfg.skipsTests() && !genCfg.splitsLocally() {
+		if genCfg.NoStubs {
+			ui.Info("No test file found - skipping test stubs (--no-stubs)")
+		} else {
+			ui.Info("No test file found - will generate test stubs")
+		}
 	}
 
-	ui.StartSpinner("Planning split...")
-
-	client := newAPIClient()
+	data := promptData{
+		Filename:     filepath.Base(filename),
+		Content:      string(content),
+		TestFilename: result.TestFile,
+		TestContent:  string(testContent),
+		InitFuncs:    info.InitFuncs,
+	}
+	if contextTests != nil {
+		data.TestFilename = filepath.Base(testFilePath)
+		data.TestContent = string(contextTests)
+	}
+	if genCfg.WithPackageContext && !genCfg.splitsLocally() {
+		ctx, err := packageContext(filepath.Dir(filename), filename, maxPackageContext)
+		if err != nil {
+			warn(fmt.Sprintf("Skipping package context: %v", err))
+		}
+		data.PackageContext = ctx
+	}
+	// Splitting into another directory that already holds part of the package
+	var existingFiles []string
+	if !genCfg.splitsLocally() {
+		existingFiles, data.ExistingFiles, err = existingPackageFiles(outDir, filename, maxPackageContext)
+		if err != nil {
+			warn(fmt.Sprintf("Planning without the files already in %s: %v", outDir, err))
+		} else if len(existingFiles) > 0 {
+			ui.Info(fmt.Sprintf("Output directory already has %s - planning around them", strings.Join(existingFiles, ", ")))
+		}
+	}
+	withTests := !genCfg.skipsTests() && !genCfg.splitsLocally() && (hasTests || !genCfg.NoStubs)
 
-	// Build planning prompt with BOTH source and tests if available
-	var planPrompt string
-	if hasTests {
-		planPrompt = fmt.Sprintf(`Analyze this Go source file AND its test file together.
-Return ONLY a JSON array of source filenames to create (not test files - those will be generated to match).
+	if genCfg.PromptPreview {
+		if err := previewPrompts(cmd.ErrOrStderr(), data, content, testContent, testInfo, planTmpl, genTmpl, planWithTests); err != nil {
+			return nil, err
+		}
+		if !genCfg.EstimateCost {
+			ui.Info("Prompt preview - no API calls made")
+			return &result, nil
+		}
+	}
 
-Example response: ["types.go", "helpers.go", "handlers.go"]
+	if genCfg.EstimateCost {
+		calls := []CallEstimate{}
+		if !genCfg.splitsLocally() {
+			if calls, err = estimateCalls(info, data, content, testContent, testInfo, planTmpl, genTmpl, planWithTests, withTests && !hasTests); err != nil {
+				return nil, err
+			}
+		}
+		result.EstimatedCost = newCostEstimate(calls, genCfg.PricePerMTok)
+		if !IsStructuredOutput() {
+			printCostEstimate(cmd, ui, result.EstimatedCost)
+		}
+		return &result, nil
+	}
 
-Rules:
-- Use descriptive names based on content
-- Keep related code together (types with their methods)
-- Separate helpers from main logic
-- Consider test coverage: functions tested together should stay together
-- Each output file should have meaningful, testable units
+	client := newTracedClient(newAPIClient(cmd.ErrOrStderr()).WithRetryHook(ui.Retrying))
+	client.timeouts = map[string]time.Duration{
+		phasePlan:     genCfg.PlanTimeout,
+		phaseGenerate: genCfg.GenTimeout,
+		phaseStubs:    genCfg.GenTimeout,
+		phaseDocs:     genCfg.GenTimeout,
+	}
 
-SOURCE FILE (%s):
-%s
+	// An identical earlier run makes the API calls unnecessary
+	var cacheKey string
+	var cacheEntry *RunCacheEntry
+	var cached map[string]string
+	if genCfg.ReuseCache && !genCfg.splitsLocally() {
+		if cacheKey, err = runCacheKey(cmd, data, content, testContent, planTmpl, genTmpl, planWithTests, result.Package); err != nil {
+			return nil, err
+		}
+		if cacheEntry, cached, err = loadRunCache(cacheKey); err != nil {
+			warn(fmt.Sprintf("Ignoring the run cache: %v", err))
+		} else if cacheEntry != nil {
+			result.ReusedCache = cacheKey
+			ui.Info(fmt.Sprintf("Reusing the output of the run cached %s (%s)", cacheEntry.Created.Local().Format("2006-01-02 15:04"), shortKey(cacheKey)))
+		}
+	}
 
-TEST FILE (%s):
-%s`, filepath.Base(filename), string(content), result.TestFile, string(testContent))
+	var filenames []string
+	var plan []SplitFile
+	planned := make(map[string]string)      // Content for files split without AI or cached
+	plannedTests := make(map[string]string) // Cached test files
+	if result.ReusedCache != "" {
+		for _, name := range cacheEntry.Files {
+			if isTestFile(name) {
+				plannedTests[name] = cached[name]
+			} else {
+				filenames = append(filenames, name)
+				planned[name] = cached[name]
+			}
+		}
+		ui.Success(fmt.Sprintf("Will create: %s", strings.Join(filenames, ", ")))
+	} else if genCfg.splitsLocally() {
+		var files []splitter.File
+		switch {
+		case genCfg.ByType:
+			opts := splitter.ByTypeOptions{HelpersFile: genCfg.HelpersFile}
+			if genCfg.NoAI {
+				opts.FuncsFile = "helpers.go"
+			}
+			for _, t := range info.Types {
+				if t.TotalLines < genCfg.MinTypeLines {
+					opts.Keep = append(opts.Keep, t.Name)
+				}
+			}
+			files, err = splitter.ByType(filename, content, opts)
+		case genCfg.OnlyExported:
+			apiFile := genCfg.APIFile
+			if apiFile == "" {
+				apiFile = "api.go"
+			}
+			files, err = splitter.Exported(filename, content, apiFile)
+		case genCfg.GroupBy == "comment":
+			files, err = splitter.BySection(filename, content, genCfg.sectionRe)
+		case genCfg.outline != nil:
+			var unassigned []string
+			files, unassigned, err = splitter.ByOutline(filename, content, genCfg.outline)
+			if len(unassigned) > 0 {
+				warn(fmt.Sprintf("Not in %s, staying in %s: %s", genCfg.PlanFile, filepath.Base(filename), strings.Join(unassigned, ", ")))
+			}
+		default:
+			files, err = splitter.Even(filename, content, genCfg.Even)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			filenames = append(filenames, f.Name)
+			planned[f.Name] = string(f.Content)
+		}
+		ui.Success(fmt.Sprintf("Will create: %s", strings.Join(filenames, ", ")))
 	} else {
-		planPrompt = fmt.Sprintf(`Analyze this Go file and return ONLY a JSON array of filenames to create.
-Example: ["helpers.go", "handlers.go", "types.go"]
-
-Rules:
-- Use descriptive names based on content
-- Keep related code together
-- Separate helpers from main logic
+		detailed := (cfg.DryRun || genCfg.TUI) && !genCfg.Preflight
+		if plan, err = planSplit(ui, client, data, planTmpl, planWithTests, detailed); err != nil {
+			return nil, err
+		}
+		var clashes []string
+		for _, f := range plan {
+			filenames = append(filenames, f.Name)
+			if slices.Contains(existingFiles, f.Name) {
+				clashes = append(clashes, f.Name)
+			}
+		}
+		if len(clashes) > 0 {
+			return nil, fmt.Errorf("the plan recreates %s, already in %s; rerun to plan again, or split into another directory", strings.Join(clashes, ", "), outDir)
+		}
 
-File content:
-%s`, string(content))
+		// The reviewed plan is split locally like an outline
+		if genCfg.TUI {
+			var files []splitter.File
+			check := func(outline map[string][]string) error {
+				for name := range outline {
+					if slices.Contains(existingFiles, name) {
+						return fmt.Errorf("%s is already in %s", name, outDir)
+					}
+				}
+				files, _, err = splitter.ByOutline(filename, content, outline)
+				return err
+			}
+			primary := strings.TrimSuffix(filepath.Base(filename), ".go") + ".go"
+			if _, err := reviewPlan(cmd.OutOrStdout(), primary, info.Symbols(), plan, check); err != nil {
+				return nil, err
+			}
+			filenames, plan = nil, nil
+			for _, f := range files {
+				filenames = append(filenames, f.Name)
+				planned[f.Name] = string(f.Content)
+			}
+			ui.Success(fmt.Sprintf("Will create: %s", strings.Join(filenames, ", ")))
+		}
 	}
 
-	planResult, err := client.Call(planPrompt, 500)
-	if err != nil {
-		ui.StopSpinnerMsg(false, "Planning failed")
-		return fmt.Errorf("planning failed: %w", err)
+	// Stop before spending on generation if the split is too fine-grained
+	overCap := genCfg.MaxFiles > 0 && len(filenames) > genCfg.MaxFiles
+	if genCfg.Preflight {
+		result.Preflight = &PreflightResult{Files: filenames, Count: len(filenames), MaxFiles: genCfg.MaxFiles, OverCap: overCap}
+		result.Calls = client.calls
+		if !IsStructuredOutput() {
+			ui.Info(fmt.Sprintf("Preflight: %d files planned for %s", len(filenames), result.SourceFile))
+		}
 	}
-
-	filenames := parseFilenames(planResult)
-	if len(filenames) == 0 {
-		ui.StopSpinnerMsg(false, "Could not determine files to create")
-		return fmt.Errorf("could not determine files to create")
+	if overCap {
+		// Like a budget violation, not a usage mistake
+		cmd.SilenceUsage = true
+		return &result, fmt.Errorf("%s would be split into %d files, more than --max-files %d", result.SourceFile, len(filenames), genCfg.MaxFiles)
+	}
+	if genCfg.Preflight {
+		if !IsStructuredOutput() && genCfg.MaxFiles > 0 {
+			ui.Success(fmt.Sprintf("Within --max-files %d", genCfg.MaxFiles))
+		}
+		return &result, nil
 	}
-
-	ui.StopSpinnerMsg(true, fmt.Sprintf("Will create: %s", strings.Join(filenames, ", ")))
 
 	if cfg.DryRun {
-		for _, fname := range filenames {
-			result.Files = append(result.Files, GeneratedFile{
-				Name:   fname,
-				Status: "skipped",
-			})
-			if !genCfg.SkipTests {
+		estimates := estimatePlanLines(info, plan)
+		for i, fname := range filenames {
+			file := GeneratedFile{Name: fname, Status: "skipped"}
+			if code, ok := planned[fname]; ok {
+				file.EstimatedLines = analyzer.CountLines(code)
+			} else {
+				file.Description = plan[i].Description
+				file.EstimatedLines = estimates[i]
+			}
+			result.Files = append(result.Files, file)
+			if withTests {
 				testFname := strings.TrimSuffix(fname, ".go") + "_test.go"
-				result.Files = append(result.Files, GeneratedFile{
-					Name:   testFname,
-					Status: "skipped",
-				})
+				testFile := GeneratedFile{Name: testFname, Status: "skipped"}
+				if testInfo != nil {
+					testFile.EstimatedLines = testInfo.Lines / len(filenames)
+				}
+				result.Files = append(result.Files, testFile)
 			}
 		}
 
-		if IsStructuredOutput() {
-			return PrintOutput(cmd.OutOrStdout(), result)
+		result.Calls = client.calls
+		if !IsStructuredOutput() {
+			for _, f := range result.Files {
+				line := fmt.Sprintf("   %s (~%d lines)", f.Name, f.EstimatedLines)
+				if f.Description != "" {
+					line += " - " + f.Description
+				}
+				cmd.Println(line)
+			}
+			ui.Info("Dry run - no files will be created")
+			if cfg.Verbose {
+				printCallSummary(cmd, result.Calls)
+			}
 		}
+		return &result, warningsError(&result)
+	}
 
-		ui.Info("Dry run - no files will be created")
-		return nil
+	// Replacing the source (and its tests) is the point of a split, but
+	// clobbering unrelated files needs explicit consent.
+	if existing := existingOutputs(outDir, filenames, withTests, filename, testFilePath); len(existing) > 0 {
+		ok, err := ui.Confirm(fmt.Sprintf("Overwrite existing files %s", strings.Join(existing, ", ")))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("aborted: output files already exist")
+		}
 	}
 
 	cmd.Println()
@@ -224,34 +964,49 @@ File content:
 	for i, fname := range filenames {
 		testFname := strings.TrimSuffix(fname, ".go") + "_test.go"
 
+		if code, ok := planned[fname]; ok {
+			ui.Step(i+1, len(filenames), fmt.Sprintf("Writing %s", fname))
+			code = finalize(code)
+			if err := writeFileAtomic(filepath.Join(outDir, fname), []byte(code)); err != nil {
+				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error()})
+				cmd.Println(" ✗ (write error)")
+				continue
+			}
+			lines := analyzer.CountLines(code)
+			result.Files = append(result.Files, GeneratedFile{Name: fname, Lines: lines, Status: "created"})
+			if testCode, ok := plannedTests[testFname]; ok {
+				if err := writeFileAtomic(filepath.Join(outDir, testFname), []byte(testCode)); err != nil {
+					result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error()})
+				} else {
+					result.Files = append(result.Files, GeneratedFile{Name: testFname, Lines: analyzer.CountLines(testCode), Status: "created", TestCount: countTestsInCode(testCode)})
+				}
+			}
+			cmd.Printf(" ✓ (%d lines)\n", lines)
+			continue
+		}
+
 		// Generate source and test together in one prompt if tests exist
-		if hasTests && !genCfg.SkipTests {
+		if hasTests && !genCfg.skipsTests() {
 			ui.Step(i+1, len(filenames), fmt.Sprintf("Generating %s + %s", fname, testFname))
 
-			genPrompt := fmt.Sprintf(`You are splitting a Go file and its tests. Generate BOTH files.
-
-OUTPUT FORMAT - Return exactly this JSON structure:
-{
-  "source": "// source code here",
-  "test": "// test code here"
-}
-
-SOURCE FILE to split - extract code for %s:
-%s
-
-TEST FILE to split - extract tests for %s:
-%s
-
-Rules:
-- Include package declaration and imports in both files
-- Move tests that test functions/types in the source file to the test file
-- Maintain test coverage relationships
-- Output valid Go code (no markdown)`, fname, string(content), testFname, string(testContent))
+			genPrompt, err := buildGeneratePrompt(fname, content, testContent, testInfo, genTmpl)
+			if err != nil {
+				return nil, err
+			}
 
-			response, err := client.Call(genPrompt, 6000)
+			response, retries, err := callParsed(client, phaseGenerate, fname, genPrompt, 6000, func(response string) error {
+				sourceCode, testCode := parseSourceAndTest(response)
+				if err := parseError(fname, finalize(sourceCode)); err != nil {
+					return err
+				}
+				if testCode = finalize(testCode); testCode != "" {
+					return parseError(testFname, testCode)
+				}
+				return nil
+			})
 			if err != nil {
-				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error()})
-				result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error()})
+				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error(), Retries: retries})
+				result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error(), Retries: retries})
 				cmd.Printf(" ✗ (%v)\n", err)
 				continue
 			}
@@ -264,99 +1019,186 @@ Rules:
 			}
 
 			// Write source file
-			sourceCode = cleanCode(sourceCode)
-			if err := os.WriteFile(filepath.Join(outDir, fname), []byte(sourceCode), 0644); err != nil {
+			sourceCode = finalize(sourceCode)
+			if err := writeFileAtomic(filepath.Join(outDir, fname), []byte(sourceCode)); err != nil {
 				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error()})
 				cmd.Println(" ✗ (write error)")
 				continue
 			}
 			lines := analyzer.CountLines(sourceCode)
-			result.Files = append(result.Files, GeneratedFile{Name: fname, Lines: lines, Status: "created"})
+			result.Files = append(result.Files, GeneratedFile{Name: fname, Lines: lines, Status: "created", Retries: retries})
 
 			// Write test file
-			testCode = cleanCode(testCode)
+			testCode = finalize(testCode)
 			if testCode != "" {
-				if err := os.WriteFile(filepath.Join(outDir, testFname), []byte(testCode), 0644); err != nil {
+				if err := writeFileAtomic(filepath.Join(outDir, testFname), []byte(testCode)); err != nil {
 					result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error()})
 				} else {
 					testLines := analyzer.CountLines(testCode)
 					testCount := countTestsInCode(testCode)
-					result.Files = append(result.Files, GeneratedFile{Name: testFname, Lines: testLines, Status: "created", TestCount: testCount})
+					result.Files = append(result.Files, GeneratedFile{Name: testFname, Lines: testLines, Status: "created", TestCount: testCount, Retries: retries})
 				}
 			}
-			cmd.Printf(" ✓ (%d lines + %d test lines)\n", lines, analyzer.CountLines(testCode))
+			cmd.Printf(" ✓ (%d lines + %d test lines%s)\n", lines, analyzer.CountLines(testCode), retryNote(retries))
 
 		} else {
 			// Source only (no existing tests or --skip-tests)
 			ui.Step(i+1, len(filenames), fmt.Sprintf("Generating %s", fname))
 
-			genPrompt := fmt.Sprintf(`You are splitting a Go file. Generate %s.
-
-Source:
-%s
-
-Output ONLY valid Go code. Include package and imports. No markdown.`, fname, string(content))
+			genPrompt, err := buildGeneratePrompt(fname, content, nil, nil, genTmpl)
+			if err != nil {
+				return nil, err
+			}
 
-			code, err := client.Call(genPrompt, 3000)
+			code, retries, err := callParsed(client, phaseGenerate, fname, genPrompt, 3000, func(response string) error {
+				return parseError(fname, finalize(response))
+			})
 			if err != nil {
-				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error()})
+				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error(), Retries: retries})
 				cmd.Printf(" ✗ (%v)\n", err)
 				continue
 			}
 
-			code = cleanCode(code)
-			if err := os.WriteFile(filepath.Join(outDir, fname), []byte(code), 0644); err != nil {
+			code = finalize(code)
+			if err := writeFileAtomic(filepath.Join(outDir, fname), []byte(code)); err != nil {
 				result.Files = append(result.Files, GeneratedFile{Name: fname, Status: "failed", Error: err.Error()})
 				cmd.Println(" ✗ (write error)")
 				continue
 			}
 
 			lines := analyzer.CountLines(code)
-			result.Files = append(result.Files, GeneratedFile{Name: fname, Lines: lines, Status: "created"})
-			cmd.Printf(" ✓ (%d lines)\n", lines)
+			result.Files = append(result.Files, GeneratedFile{Name: fname, Lines: lines, Status: "created", Retries: retries})
+			cmd.Printf(" ✓ (%d lines%s)\n", lines, retryNote(retries))
 
 			// Generate test stubs if no tests exist and not skipping
-			if !hasTests && !genCfg.SkipTests {
+			if !hasTests && !genCfg.skipsTests() && !genCfg.NoStubs {
 				ui.Step(i+1, len(filenames), fmt.Sprintf("Generating %s (stubs)", testFname))
 
-				stubPrompt := fmt.Sprintf(`Generate test stubs for this Go source file.
-Each exported function should have a corresponding test stub with t.Skip("TODO: implement").
-
-Source file %s:
-%s
-
-Output ONLY valid Go test code. Include package and imports. No markdown.`, fname, code)
-
-				stubCode, err := client.Call(stubPrompt, 2000)
+				stubCode, retries, err := callParsed(client, phaseStubs, testFname, buildStubPrompt(fname, code), 2000, func(response string) error {
+					return parseError(testFname, finalize(response))
+				})
 				if err != nil {
-					result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error()})
+					result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error(), Retries: retries})
 					cmd.Printf(" ✗ (%v)\n", err)
 					continue
 				}
 
-				stubCode = cleanCode(stubCode)
-				if err := os.WriteFile(filepath.Join(outDir, testFname), []byte(stubCode), 0644); err != nil {
+				stubCode = finalize(stubCode)
+				if err := writeFileAtomic(filepath.Join(outDir, testFname), []byte(stubCode)); err != nil {
 					result.Files = append(result.Files, GeneratedFile{Name: testFname, Status: "failed", Error: err.Error()})
 					cmd.Println(" ✗ (write error)")
 					continue
 				}
 
 				testLines := analyzer.CountLines(stubCode)
-				result.Files = append(result.Files, GeneratedFile{Name: testFname, Lines: testLines, Status: "created"})
-				cmd.Printf(" ✓ (%d lines, stubs)\n", testLines)
+				result.Files = append(result.Files, GeneratedFile{Name: testFname, Lines: testLines, Status: "created", Retries: retries})
+				cmd.Printf(" ✓ (%d lines, stubs%s)\n", testLines, retryNote(retries))
+			}
+		}
+	}
+
+	// TestMain runs the whole package's tests; a second one does not compile
+	home, removed, err := dedupeTestMain(outDir, result.Files)
+	result.TestMainFile = home
+	switch {
+	case err != nil:
+		warn(fmt.Sprintf("Checking TestMain placement: %v", err))
+	case len(removed) > 0:
+		warn(fmt.Sprintf("TestMain was generated in several test files; kept it in %s and removed it from %s", home, strings.Join(removed, ", ")))
+	case home == "" && hasTestMain(testInfo):
+		warn(fmt.Sprintf("TestMain from %s is missing from the generated test files", result.TestFile))
+	}
+
+	if genCfg.PreserveOrder {
+		if err := preserveFileOrder(outDir, result.Files, info); err != nil {
+			return nil, err
+		}
+	}
+
+	// Trace where each original symbol ended up
+	outputs := parseGeneratedSources(outDir, result.Files)
+
+	if genCfg.RequireDocs {
+		undocumented := findUndocumented(outputs)
+		if genCfg.AddDocs && len(undocumented) > 0 {
+			ui.StartSpinner("Adding doc comments...")
+			rewritten, err := addStubDocs(client, outDir, undocumented)
+			if err != nil {
+				ui.StopSpinnerMsg(false, "Adding doc comments failed")
+				warn(err.Error())
+			} else {
+				ui.StopSpinnerMsg(true, fmt.Sprintf("Added doc comments to %d files", len(rewritten)))
 			}
+			refreshLineCounts(outDir, result.Files, rewritten)
+			outputs = parseGeneratedSources(outDir, result.Files)
+			undocumented = findUndocumented(outputs)
+		}
+		result.Undocumented = undocumented
+		for _, u := range undocumented {
+			warn(fmt.Sprintf("%s: exported %s has no doc comment", u.File, u.Symbol))
+		}
+	}
+
+	result.SymbolMap, result.DroppedSymbols, result.DuplicatedSymbols = buildSymbolMap(info, outputs)
+	if len(result.DroppedSymbols) > 0 {
+		warn(fmt.Sprintf("Symbols missing from all output files: %s", strings.Join(result.DroppedSymbols, ", ")))
+	}
+	if len(result.DuplicatedSymbols) > 0 {
+		warn(fmt.Sprintf("Symbols declared in multiple output files: %s", strings.Join(result.DuplicatedSymbols, ", ")))
+	}
+	result.DroppedDirectives = droppedDirectives(info, outputs)
+	if len(result.DroppedDirectives) > 0 {
+		warn(fmt.Sprintf("Directive comments lost in the split: %s", strings.Join(result.DroppedDirectives, "; ")))
+	}
+	result.ModifiedBodies = modifiedBodies(filename, content, outDir, result.Files)
+	if len(result.ModifiedBodies) > 0 {
+		warn(fmt.Sprintf("Function bodies changed in the split: %s", strings.Join(result.ModifiedBodies, ", ")))
+	}
+	if genCfg.EmitInventory != "" {
+		result.inventory = buildInventory(outDir, result.Files)
+	}
+	if genCfg.EmitMoves != "" {
+		result.moves = buildMoves(filename, info, outputs)
+	}
+	// Point the code left behind at the new package
+	if genCfg.UpdateImports && result.ImportPath != "" {
+		updated, err := updateImportReferences(filepath.Dir(filename), outputs, result.Package, result.ImportPath, filename, testFilePath)
+		result.UpdatedFiles = updated
+		if err != nil {
+			warn(fmt.Sprintf("Updating imports: %v", err))
+		}
+		if len(updated) > 0 {
+			ui.Info(fmt.Sprintf("Updated references in %s", strings.Join(updated, ", ")))
+		}
+	}
+	if genCfg.Barrel {
+		if err := writeBarrel(ui, warn, arg, filename, content, &result); err != nil {
+			warn(fmt.Sprintf("Skipping --barrel: %v", err))
+		}
+	}
+
+	if hasTests {
+		result.MisplacedBenchmarks = findMisplacedBenchmarks(outputs, parseGeneratedTests(outDir, result.Files))
+		for _, m := range result.MisplacedBenchmarks {
+			warn(fmt.Sprintf("%s is in %s but belongs in %s", m.Benchmark, m.File, m.Want))
 		}
 	}
+	result.Calls = client.calls
+	if cfg.Verbose && !IsStructuredOutput() {
+		printSymbolMap(cmd, result.SymbolMap)
+		printCallSummary(cmd, result.Calls)
+	}
 
 	// Run validation unless skipped or dry-run
 	if !cfg.DryRun && !genCfg.SkipValidation {
 		cmd.Println()
 		ui.StartSpinner("Validating split (go test)...")
 
-		if err := runValidation(outDir); err != nil {
+		if err := runValidation(outDir, genCfg.ValidateTimeout); err != nil {
 			ui.StopSpinnerMsg(false, "Validation failed")
 			result.ValidationPassed = false
 			result.ValidationError = err.Error()
+			result.TestFailures = parseTestFailures(err.Error())
 			ui.Error(fmt.Sprintf("go test failed: %v", err))
 		} else {
 			ui.StopSpinnerMsg(true, "All tests pass")
@@ -364,8 +1206,46 @@ Output ONLY valid Go test code. Include package and imports. No markdown.`, fnam
 		}
 	}
 
+	if cacheKey != "" && result.ReusedCache == "" && !cfg.DryRun && runSucceeded(&result) {
+		if err := storeRunCache(cacheKey, result.SourceFile, outDir, result.Files); err != nil {
+			warn(fmt.Sprintf("Recording the run in the cache: %v", err))
+		}
+	}
+
+	if genCfg.Verify {
+		v := verifySymbols(info, outputs, genCfg.AllowDrop)
+		result.Verification = &v
+	}
+
 	if IsStructuredOutput() {
-		return PrintOutput(cmd.OutOrStdout(), result)
+		if result.Verification != nil && !result.Verification.Passed {
+			return &result, fmt.Errorf("symbol verification failed")
+		}
+		if err := preserveError(&result); err != nil {
+			return &result, err
+		}
+		return &result, warningsError(&result)
+	}
+
+	if v := result.Verification; v != nil {
+		cmd.Println()
+		if v.Passed {
+			ui.Success("Symbol verification passed")
+		} else {
+			if len(v.Missing) > 0 {
+				ui.Error(fmt.Sprintf("Lost symbols: %s", strings.Join(v.Missing, ", ")))
+			}
+			if len(v.Added) > 0 {
+				ui.Error(fmt.Sprintf("Added symbols: %s", strings.Join(v.Added, ", ")))
+			}
+			return &result, fmt.Errorf("symbol verification failed")
+		}
+	}
+
+	if err := preserveError(&result); err != nil {
+		cmd.Println()
+		ui.Error(fmt.Sprintf("Changed bodies: %s", strings.Join(result.ModifiedBodies, ", ")))
+		return &result, err
 	}
 
 	cmd.Println()
@@ -374,5 +1254,178 @@ Output ONLY valid Go test code. Include package and imports. No markdown.`, fnam
 	} else {
 		ui.Warning("Generation complete but validation failed")
 	}
-	return nil
+	return &result, warningsError(&result)
+}
+
+// runSucceeded reports whether every file of result was created and the
+// split passed validation, if it ran.
+func runSucceeded(result *GenerateResult) bool {
+	for _, f := range result.Files {
+		if f.Status != "created" {
+			return false
+		}
+	}
+	return len(result.Files) > 0 && (result.ValidationPassed || genCfg.SkipValidation)
+}
+
+// preserveError fails a run that changed function bodies under
+// --strict-preserve.
+func preserveError(result *GenerateResult) error {
+	if !genCfg.StrictPreserve || len(result.ModifiedBodies) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d function bodies changed with --strict-preserve", len(result.ModifiedBodies))
+}
+
+// warningsError fails a run that reported warnings under --fail-on-warnings.
+func warningsError(result *GenerateResult) error {
+	if !genCfg.FailOnWarnings || len(result.Warnings) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d warnings with --fail-on-warnings", len(result.Warnings))
+}
+
+// planSplit asks the model which source files to split data.Filename into.
+// With detailed set the model is also asked why, and for the declarations
+// each file gets.
+func planSplit(ui *UI, client *tracedClient, data promptData, planTmpl *template.Template, hasTests, detailed bool) ([]SplitFile, error) {
+	ui.StartSpinner("Planning split...")
+
+	planPrompt, err := buildPlanPrompt(data, planTmpl, hasTests, detailed)
+	if err != nil {
+		ui.StopSpinnerMsg(false, "Planning failed")
+		return nil, err
+	}
+
+	planResult, err := client.Call(phasePlan, data.Filename, planPrompt, 500)
+	if err != nil {
+		ui.StopSpinnerMsg(false, "Planning failed")
+		return nil, fmt.Errorf("planning failed: %w", apiError(err))
+	}
+
+	plan := parsePlan(planResult)
+	if len(plan) == 0 {
+		ui.StopSpinnerMsg(false, "Could not determine files to create")
+		return nil, fmt.Errorf("could not determine files to create")
+	}
+
+	var filenames []string
+	for _, f := range plan {
+		filenames = append(filenames, f.Name)
+	}
+	ui.StopSpinnerMsg(true, fmt.Sprintf("Will create: %s", strings.Join(filenames, ", ")))
+	return plan, nil
+}
+
+// buildPlanPrompt returns the planning prompt for data, rendered from
+// planTmpl when one is given. detailed asks for a rationale and the
+// assigned declarations per file rather than bare names.
+func buildPlanPrompt(data promptData, planTmpl *template.Template, hasTests, detailed bool) (string, error) {
+	if planTmpl != nil {
+		return renderPrompt(planTmpl, data)
+	}
+
+	var suffix string
+	if data.PackageContext != "" {
+		suffix = fmt.Sprintf("\n\nOTHER FILES IN THIS PACKAGE (already exist - do not plan files duplicating these symbols):\n%s", data.PackageContext)
+	}
+	if data.ExistingFiles != "" {
+		suffix += fmt.Sprintf("\n\nFILES ALREADY IN THE OUTPUT DIRECTORY (do not reuse these filenames or plan files duplicating these symbols):\n%s", data.ExistingFiles)
+	}
+	if data.InitFuncs > 0 {
+		suffix += fmt.Sprintf("\n\nINIT FUNCTIONS: %s declares %d init function(s). They run in file name order with side effects, so plan one file to hold all of them together with the package-level state they set up; do not scatter initialization across files.", data.Filename, data.InitFuncs)
+	}
+	if detailed {
+		suffix += `
+
+Instead of bare filenames, make each JSON array element an object with a one-line rationale and the declarations the file gets:
+[{"name": "types.go", "description": "Core data types", "functions": ["NewServer"], "types": ["Server"]}]`
+	}
+
+	// Build planning prompt with BOTH source and tests if available
+	if hasTests {
+		return fmt.Sprintf(`Analyze this Go source file AND its test file together.
+Return ONLY a JSON array of source filenames to create (not test files - those will be generated to match).
+
+Example response: ["types.go", "helpers.go", "handlers.go"]
+
+Rules:
+- Use descriptive names based on content
+- Keep related code together (types with their methods)
+- Separate helpers from main logic
+- Consider test coverage: functions tested together should stay together
+- Benchmarks stay with the code they measure
+- Each output file should have meaningful, testable units
+
+SOURCE FILE (%s):
+%s
+
+TEST FILE (%s):
+%s%s`, data.Filename, data.Content, data.TestFilename, data.TestContent, suffix), nil
+	}
+	return fmt.Sprintf(`Analyze this Go file and return ONLY a JSON array of filenames to create.
+Example: ["helpers.go", "handlers.go", "types.go"]
+
+Rules:
+- Use descriptive names based on content
+- Keep related code together
+- Separate helpers from main logic
+
+File content (%s):
+%s%s`, data.Filename, data.Content, suffix), nil
+}
+
+// buildGeneratePrompt returns the prompt that generates fname from content.
+// With testContent the prompt asks for the source and its test file
+// together; otherwise for the source alone.
+func buildGeneratePrompt(fname string, content, testContent []byte, testInfo *analyzer.FileInfo, genTmpl *template.Template) (string, error) {
+	if testContent == nil {
+		if genTmpl != nil {
+			return renderPrompt(genTmpl, promptData{Filename: fname, Content: string(content)})
+		}
+		return fmt.Sprintf(`You are splitting a Go file. Generate %s.
+
+Source:
+%s
+
+Keep directive comments (//nolint, //go:..., //export) directly above the declarations they annotate.%s
+Output ONLY valid Go code. Include package and imports. No markdown.`, fname, string(content), constraintRule(content, "Start the file")), nil
+	}
+
+	testFname := strings.TrimSuffix(fname, ".go") + "_test.go"
+	if genTmpl != nil {
+		return renderPrompt(genTmpl, promptData{Filename: fname, Content: string(content), TestFilename: testFname, TestContent: string(testContent)})
+	}
+	return fmt.Sprintf(`You are splitting a Go file and its tests. Generate BOTH files.
+
+OUTPUT FORMAT - Return exactly this JSON structure:
+{
+  "source": "// source code here",
+  "test": "// test code here"
+}
+
+SOURCE FILE to split - extract code for %s:
+%s
+
+TEST FILE to split - extract tests for %s:
+%s
+
+Rules:
+- Include package declaration and imports in both files
+- Move tests that test functions/types in the source file to the test file
+- Maintain test coverage relationships
+- Keep directive comments (//nolint, //go:..., //export) directly above the declarations they annotate
+- Output valid Go code (no markdown)%s%s`, fname, string(content), testFname, string(testContent), constraintRule(content, "- Start both files"), benchmarkRoutingRules(testInfo)), nil
+}
+
+// buildStubPrompt returns the prompt that generates test stubs for the
+// generated source code of fname.
+func buildStubPrompt(fname, code string) string {
+	return fmt.Sprintf(`Generate test stubs for this Go source file.
+Each exported function should have a corresponding test stub with t.Skip("TODO: implement").
+
+Source file %s:
+%s
+
+Output ONLY valid Go test code. Include package and imports. No markdown.`, fname, code)
 }
@@ -0,0 +1,1849 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+	"github.com/aaronlippold/go-split/internal/api"
+	"github.com/aaronlippold/go-split/internal/cmd"
+)
+
+// newStubAPI starts a wrapper-compatible server that answers each prompt
+// with respond(prompt).
+func newStubAPI(t *testing.T, respond func(prompt string) string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text := respond(req.Messages[len(req.Messages)-1].Content)
+		_ = json.NewEncoder(w).Encode(api.Response{Content: []api.ContentBlock{{Type: "text", Text: text}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// runGenerate runs generate against server with wrapper mode forced.
+func runGenerate(server *httptest.Server, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	base := []string{"--use-wrapper", "--endpoint", server.URL, "generate", "--skip-validation"}
+	err := cmd.ExecuteWithArgs(append(base, args...), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGenerate_OverwriteRequiresConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"big.go":   "package foo\n\nfunc Hello() {}\n",
+		"other.go": "package foo\n\n// keep me\n",
+	})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["other.go"]`
+		}
+		return "package foo\n\nfunc Hello() {}\n"
+	})
+
+	_, err := runGenerate(server, "--skip-tests", filepath.Join(dir, "big.go"))
+	if err == nil || !strings.Contains(err.Error(), "--assume-yes") {
+		t.Fatalf("Expected confirmation error mentioning --assume-yes, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "other.go")); !strings.Contains(string(data), "keep me") {
+		t.Error("other.go was overwritten without confirmation")
+	}
+
+	if _, err := runGenerate(server, "--assume-yes", "--skip-tests", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate --assume-yes error = %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "other.go")); !strings.Contains(string(data), "func Hello") {
+		t.Errorf("other.go not overwritten with --assume-yes: %s", data)
+	}
+}
+
+func TestGenerate_WritesTrailingNewline(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n"})
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go"]`
+		}
+		return "```go\npackage foo\n\nfunc Hello() {}\n```"
+	})
+
+	if _, err := runGenerate(server, "--skip-tests", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "hello.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package foo\n\nfunc Hello() {}\n"; string(data) != want {
+		t.Errorf("hello.go = %q, want %q", data, want)
+	}
+}
+
+func TestGenerate_KeepsBuildConstraints(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "//go:build linux\n\npackage foo\n\nfunc Hello() {}\n\nfunc World() {}\n"})
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go"]`
+		}
+		if !strings.Contains(prompt, "build constraints, then a blank line:\n//go:build linux") {
+			t.Errorf("generation prompt lacks the build constraint:\n%s", prompt)
+		}
+		return "```go\npackage foo\n\nfunc Hello() {}\n```"
+	})
+
+	if _, err := runGenerate(server, "--skip-tests", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "hello.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "//go:build linux\n\npackage foo\n\nfunc Hello() {}\n"; string(data) != want {
+		t.Errorf("hello.go = %q, want %q", data, want)
+	}
+}
+
+func TestGenerate_ReplacingSourceNeedsNoConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n"})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["big.go", "world.go"]`
+		}
+		if strings.Contains(prompt, "Generate world.go") {
+			return "package foo\n\nfunc World() {}\n"
+		}
+		return "package foo\n\nfunc Hello() {}\n"
+	})
+
+	if _, err := runGenerate(server, "--skip-tests", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+}
+
+func TestGenerate_NoStubs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n"})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "Generate test stubs") {
+			t.Errorf("unexpected stub request with --no-stubs")
+		}
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go"]`
+		}
+		return "package foo\n\nfunc Hello() {}\n"
+	})
+
+	if _, err := runGenerate(server, "--no-stubs", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hello.go")); err != nil {
+		t.Errorf("hello.go not written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hello_test.go")); err == nil {
+		t.Error("hello_test.go written despite --no-stubs")
+	}
+}
+
+func TestGenerate_ReportsCalls(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n"})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go"]`
+		}
+		if strings.Contains(prompt, "Generate test stubs") {
+			return "package foo\n\nimport \"testing\"\n\nfunc TestHello(t *testing.T) { t.Skip(\"TODO: implement\") }\n"
+		}
+		return "package foo\n\nfunc Hello() {}\n"
+	})
+
+	out, err := runGenerate(server, "--skip-validation", "--format=json", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+
+	var got []string
+	for _, c := range result.Calls {
+		if !c.Success || c.MaxTokens == 0 {
+			t.Errorf("call %+v, want a successful call with a token limit", c)
+		}
+		got = append(got, c.Phase+":"+c.Target)
+	}
+	if want := "plan:big.go generate:hello.go stubs:hello_test.go"; strings.Join(got, " ") != want {
+		t.Errorf("calls = %v, want %s", got, want)
+	}
+}
+
+func TestGenerate_ReuseCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"src/big.go": "package foo\n\nfunc Hello() {}\n"})
+	var calls atomic.Int32
+	server := newStubAPI(t, func(prompt string) string {
+		calls.Add(1)
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go"]`
+		}
+		if strings.Contains(prompt, "Generate test stubs") {
+			return "package foo\n\nimport \"testing\"\n\nfunc TestHello(t *testing.T) { t.Skip(\"TODO: implement\") }\n"
+		}
+		return "package foo\n\nfunc Hello() {}\n"
+	})
+	cacheDir := filepath.Join(dir, "cache")
+	generate := func(out string, extra ...string) cmd.GenerateResult {
+		t.Helper()
+		args := append([]string{"--format=json", "--reuse-cache", "--cache", cacheDir, "-o", filepath.Join(dir, out)}, extra...)
+		stdout, err := runGenerate(server, append(args, filepath.Join(dir, "src", "big.go"))...)
+		if err != nil {
+			t.Fatalf("generate -o %s error = %v\n%s", out, err, stdout)
+		}
+		var result cmd.GenerateResult
+		if err := json.Unmarshal([]byte(stdout[strings.Index(stdout, "{"):]), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout)
+		}
+		return result
+	}
+
+	first := generate("a")
+	if first.ReusedCache != "" || calls.Load() != 3 {
+		t.Fatalf("first run reused %q with %d calls, want a fresh run with 3 calls", first.ReusedCache, calls.Load())
+	}
+
+	second := generate("b")
+	if second.ReusedCache == "" || calls.Load() != 3 {
+		t.Errorf("second run reused %q with %d more calls, want the cached run and no calls", second.ReusedCache, calls.Load()-3)
+	}
+	for _, name := range []string{"hello.go", "hello_test.go"} {
+		want, _ := os.ReadFile(filepath.Join(dir, "a", name))
+		got, err := os.ReadFile(filepath.Join(dir, "b", name))
+		if err != nil || string(got) != string(want) {
+			t.Errorf("reused %s = %q (%v), want %q", name, got, err, want)
+		}
+	}
+	if len(second.Files) != 2 || second.Files[1].TestCount != 1 {
+		t.Errorf("reused files = %+v, want hello.go and hello_test.go with its test", second.Files)
+	}
+
+	// Another model is another run
+	if third := generate("c", "--model", "other-model"); third.ReusedCache != "" || calls.Load() != 6 {
+		t.Errorf("run with another model reused %q after %d calls, want a fresh run", third.ReusedCache, calls.Load())
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := cmd.ExecuteWithArgs([]string{"--format=json", "--cache", cacheDir, "cache", "list"}, &stdout, &stderr); err != nil {
+		t.Fatalf("cache list error = %v\n%s", err, stderr.String())
+	}
+	var list cmd.CacheListResult
+	if err := json.Unmarshal(stdout.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if len(list.Entries) != 2 {
+		t.Fatalf("cache list = %+v, want the two fresh runs", list.Entries)
+	}
+	if e := list.Entries[1]; e.Key != second.ReusedCache || e.Source != "big.go" || !slices.Equal(e.Files, []string{"hello.go", "hello_test.go"}) {
+		t.Errorf("oldest entry = %+v, want the first run of big.go", e)
+	}
+	if runs, err := os.ReadDir(filepath.Join(cacheDir, "runs")); err != nil || len(runs) != 2 {
+		t.Errorf("runs/ in --cache = %v, %v; want the two recorded runs", runs, err)
+	}
+}
+
+func TestGenerate_PromptPreview(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"big.go":    "package foo\n\nfunc Hello() {}\n",
+		"plan.tmpl": "Split {{.Filename}} please:\n{{.Content}}",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call with --prompt-preview")
+		return ""
+	})
+
+	for _, dryRun := range []bool{false, true} {
+		args := []string{"--use-wrapper", "--endpoint", server.URL, "generate", "--prompt-preview", "--plan-prompt-file", filepath.Join(dir, "plan.tmpl"), filepath.Join(dir, "big.go")}
+		if dryRun {
+			args = append([]string{"--dry-run"}, args...)
+		}
+		var stdout, stderr bytes.Buffer
+		if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+			t.Fatalf("dry-run %v: generate error = %v\n%s", dryRun, err, stderr.String())
+		}
+		preview := stderr.String()
+		for _, want := range []string{"plan prompt: big.go", "Split big.go please:\npackage foo\n\nfunc Hello() {}", "generate prompt: <planned file>.go", "func Hello() {}"} {
+			if !strings.Contains(preview, want) {
+				t.Errorf("dry-run %v: preview missing %q:\n%s", dryRun, want, preview)
+			}
+		}
+		if strings.Contains(stdout.String(), "func Hello") {
+			t.Errorf("dry-run %v: prompts written to stdout:\n%s", dryRun, stdout.String())
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*_test.go")); len(matches) > 0 {
+		t.Errorf("--prompt-preview wrote files: %v", matches)
+	}
+
+	_, err := runGenerate(server, "--prompt-preview", "--by-type", filepath.Join(dir, "big.go"))
+	if cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("--prompt-preview --by-type exit code = %d, want %d (err %v)", cmd.ExitCode(err), cmd.ExitUsage, err)
+	}
+}
+
+func TestGenerate_TUIRequiresTerminal(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n"})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call: %.60s", prompt)
+		return ""
+	})
+
+	for _, args := range [][]string{
+		{"--tui", filepath.Join(dir, "big.go")},
+		{"--tui", "--by-type", filepath.Join(dir, "big.go")},
+		{"--tui", filepath.Join(dir, "big.go"), filepath.Join(dir, "big.go")},
+	} {
+		if _, err := runGenerate(server, args...); err == nil || !strings.Contains(err.Error(), "--tui") {
+			t.Errorf("generate %v error = %v, want a --tui usage error", args, err)
+		}
+	}
+}
+
+func TestGenerate_Preflight(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n\nfunc Bye() {}\n"})
+
+	var prompts []string
+	server := newStubAPI(t, func(prompt string) string {
+		prompts = append(prompts, prompt)
+		if !strings.Contains(prompt, "JSON array") {
+			t.Errorf("unexpected non-planning call with --preflight")
+		}
+		return `["hello.go", "bye.go", "util.go"]`
+	})
+
+	preflight := func(args ...string) (cmd.PreflightResult, error) {
+		t.Helper()
+		out, err := runGenerate(server, append([]string{"--format=json", "--preflight"}, args...)...)
+		var result cmd.GenerateResult
+		if jsonErr := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); jsonErr != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", jsonErr, out)
+		}
+		if result.Preflight == nil {
+			t.Fatalf("preflight missing: %s", out)
+		}
+		return *result.Preflight, err
+	}
+
+	got, err := preflight("--max-files", "3", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	want := cmd.PreflightResult{Files: []string{"hello.go", "bye.go", "util.go"}, Count: 3, MaxFiles: 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("preflight = %+v, want %+v", got, want)
+	}
+	if len(prompts) != 1 {
+		t.Errorf("made %d API calls, want only the planning call", len(prompts))
+	}
+
+	got, err = preflight("--max-files", "2", filepath.Join(dir, "big.go"))
+	if cmd.ExitCode(err) != cmd.ExitError || !strings.Contains(err.Error(), "--max-files 2") {
+		t.Errorf("over the cap: exit code = %d, err = %v, want a --max-files failure", cmd.ExitCode(err), err)
+	}
+	if !got.OverCap || got.Count != 3 {
+		t.Errorf("over the cap: preflight = %+v, want over_cap with 3 files", got)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.go")); len(matches) != 1 {
+		t.Errorf("--preflight wrote files: %v", matches)
+	}
+
+	// A full run over the cap stops after planning
+	prompts = nil
+	if _, err := runGenerate(server, "--max-files", "2", filepath.Join(dir, "big.go")); err == nil {
+		t.Error("generate over --max-files succeeded")
+	}
+	if len(prompts) != 1 {
+		t.Errorf("generate over --max-files made %d API calls, want only the planning call", len(prompts))
+	}
+
+	_, err = runGenerate(server, "--preflight", "--estimate-cost", filepath.Join(dir, "big.go"))
+	if cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("--preflight --estimate-cost exit code = %d, want %d (err %v)", cmd.ExitCode(err), cmd.ExitUsage, err)
+	}
+}
+
+func TestGenerate_EstimateCost(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n"})
+
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call with --estimate-cost")
+		return ""
+	})
+
+	out, err := runGenerate(server, "--format=json", "--estimate-cost", "--price-per-mtok", "10", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+
+	est := result.EstimatedCost
+	if est == nil {
+		t.Fatalf("estimated_cost missing: %s", out)
+	}
+	var phases []string
+	total := 0
+	for _, c := range est.Calls {
+		phases = append(phases, c.Phase)
+		total += c.InputTokens
+	}
+	// A small file is planned as two files, each generated and stubbed
+	if want := "plan generate stubs generate stubs"; strings.Join(phases, " ") != want {
+		t.Errorf("phases = %v, want %s", phases, want)
+	}
+	if est.InputTokens != total || total == 0 {
+		t.Errorf("input_tokens = %d, want sum of calls %d", est.InputTokens, total)
+	}
+	if want := float64(total) * 10 / 1e6; est.USD != want {
+		t.Errorf("usd = %v, want %v", est.USD, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hello.go")); err == nil {
+		t.Error("--estimate-cost wrote files")
+	}
+}
+
+func TestGenerate_DryRunEstimates(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\ntype Server struct{}\n\nfunc (s *Server) Run() {}\n\nfunc helper() {}\n"})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if !strings.Contains(prompt, `"description"`) {
+			t.Errorf("dry-run plan prompt should ask for a rationale")
+		}
+		return `[{"name": "server.go", "description": "The server type", "types": ["Server"]},
+			{"name": "helpers.go", "description": "Free functions", "functions": ["helper"]}]`
+	})
+
+	out, err := runGenerate(server, "--dry-run", "--skip-tests", "--format=json", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+
+	if len(result.Files) != 2 {
+		t.Fatalf("files = %+v, want server.go and helpers.go", result.Files)
+	}
+	for _, f := range result.Files {
+		if f.Status != "skipped" || f.Description == "" || f.EstimatedLines == 0 {
+			t.Errorf("file %+v, want a skipped file with a description and estimated lines", f)
+		}
+	}
+	// Package clause, then the type and its method
+	if got := result.Files[0].EstimatedLines; got != 6 {
+		t.Errorf("server.go estimated_lines = %d, want 6", got)
+	}
+}
+
+func TestGenerate_ReportsMisplacedBenchmarks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"big.go":      "package foo\n\nfunc Parse() {}\n\nfunc Format() {}\n",
+		"big_test.go": "package foo\n\nimport \"testing\"\n\nfunc TestParse(t *testing.T) {}\n\nfunc BenchmarkParse(b *testing.B) {}\n",
+	})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["parse.go", "format.go"]`
+		}
+		if strings.Contains(prompt, "extract code for parse.go") {
+			return `{"source": "package foo\n\nfunc Parse() {}\n", "test": "package foo\n\nimport \"testing\"\n\nfunc TestParse(t *testing.T) {}\n"}`
+		}
+		return `{"source": "package foo\n\nfunc Format() {}\n", "test": "package foo\n\nimport \"testing\"\n\nfunc BenchmarkParse(b *testing.B) {}\n"}`
+	})
+
+	out, err := runGenerate(server, "--format=json", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+
+	// Per-file progress marks precede the JSON document
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	want := []cmd.MisplacedBenchmark{{Benchmark: "BenchmarkParse", File: "format_test.go", Want: "parse_test.go"}}
+	if len(result.MisplacedBenchmarks) != 1 || result.MisplacedBenchmarks[0] != want[0] {
+		t.Errorf("MisplacedBenchmarks = %+v, want %+v", result.MisplacedBenchmarks, want)
+	}
+}
+
+func TestGenerate_KeepsOneTestMain(t *testing.T) {
+	dir := t.TempDir()
+	testMain := "// TestMain sets up the package.\nfunc TestMain(m *testing.M) {\n\t// run them all\n\tos.Exit(m.Run())\n}\n"
+	writeFiles(t, dir, map[string]string{
+		"big.go":      "package foo\n\nfunc Parse() {}\n\nfunc Format() {}\n",
+		"big_test.go": "package foo\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\n" + testMain + "\nfunc TestParse(t *testing.T) {}\n\nfunc TestFormat(t *testing.T) {}\n",
+	})
+
+	// The model copies TestMain into every test file
+	respond := func(fn string) string {
+		test := "package foo\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\n" + testMain + "\nfunc Test" + fn + "(t *testing.T) {}\n"
+		data, _ := json.Marshal(map[string]string{"source": "package foo\n\nfunc " + fn + "() {}\n", "test": test})
+		return string(data)
+	}
+	server := newStubAPI(t, func(prompt string) string {
+		switch {
+		case strings.Contains(prompt, "JSON array"):
+			return `["parse.go", "format.go"]`
+		case strings.Contains(prompt, "extract code for parse.go"):
+			return respond("Parse")
+		default:
+			return respond("Format")
+		}
+	})
+
+	out, err := runGenerate(server, "--format=json", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v\n%s", err, out)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if result.TestMainFile != "parse_test.go" {
+		t.Errorf("test_main_file = %q, want parse_test.go", result.TestMainFile)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "removed it from format_test.go") {
+		t.Errorf("warnings = %v, want the duplicate TestMain reported", result.Warnings)
+	}
+
+	count := 0
+	for _, name := range []string{"parse_test.go", "format_test.go"} {
+		info, err := analyzer.ParseGoFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s does not parse: %v", name, err)
+		}
+		for _, fn := range info.Functions {
+			if fn.Name == "TestMain" {
+				count++
+			}
+		}
+	}
+	if count != 1 {
+		t.Errorf("TestMain declared %d times, want once", count)
+	}
+	format, _ := os.ReadFile(filepath.Join(dir, "format_test.go"))
+	if want := "package foo\n\nimport (\n\t\"testing\"\n)\n\nfunc TestFormat(t *testing.T) {}\n"; string(format) != want {
+		t.Errorf("format_test.go = %q, want %q", format, want)
+	}
+	for _, f := range result.Files {
+		if f.Name == "format_test.go" && f.TestCount != 1 {
+			t.Errorf("format_test.go test_count = %d, want 1", f.TestCount)
+		}
+	}
+}
+
+func TestGenerate_NewPackageFlagsRequireNewPackage(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package demo\n\nfunc Hello() {}\n"})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call: %.60q", prompt)
+		return ""
+	})
+
+	for _, flag := range []string{"--update-imports", "--barrel"} {
+		outDir := filepath.Join(dir, "out")
+		_, err := runGenerate(server, flag, "--output", outDir, filepath.Join(dir, "big.go"))
+		if cmd.ExitCode(err) != cmd.ExitUsage {
+			t.Errorf("%s without --new-package: exit code %d, want %d (err %v)", flag, cmd.ExitCode(err), cmd.ExitUsage, err)
+		}
+		if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+			t.Errorf("%s without --new-package created the output directory", flag)
+		}
+	}
+}
+
+func TestGenerate_NewPackageUpdatesImports(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":  "module example.com/demo\n\ngo 1.21\n",
+		"big.go":  "package demo\n\nfunc Hello() string { return \"hi\" }\n",
+		"main.go": "package demo\n\nfunc Greet() string { return Hello() }\n",
+	})
+	outDir := filepath.Join(root, "greeting")
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go"]`
+		}
+		return "package demo\n\nfunc Hello() string { return \"hi\" }\n"
+	})
+
+	out, err := runGenerate(server, "--skip-tests", "--new-package", "--update-imports", "--output", outDir, "--format=json", filepath.Join(root, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if result.ImportPath != "example.com/demo/greeting" || len(result.UpdatedFiles) != 1 || result.UpdatedFiles[0] != "main.go" {
+		t.Errorf("ImportPath = %q, UpdatedFiles = %v", result.ImportPath, result.UpdatedFiles)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(root, "main.go"))
+	if !strings.Contains(string(data), `"example.com/demo/greeting"`) || !strings.Contains(string(data), "greeting.Hello()") {
+		t.Errorf("main.go not updated:\n%s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outDir, "hello.go")); !strings.Contains(string(data), "package greeting") {
+		t.Errorf("hello.go package not renamed:\n%s", data)
+	}
+}
+
+func TestGenerate_Barrel(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"shop/shop.go": `package shop
+
+import (
+	"io"
+	"strings"
+)
+
+const Limit = 3
+
+var Default = NewCart()
+
+type Cart struct{ items []string }
+
+func NewCart(items ...string) *Cart { return &Cart{items: items} }
+
+func (c *Cart) Add(item string) { c.items = append(c.items, item) }
+
+func (c *Cart) Len() int { return len(c.items) }
+
+func Read(r io.Reader) (n int, err error) {
+	b, err := io.ReadAll(r)
+	return len(strings.Fields(string(b))), err
+}
+
+func First[T any](items []T) T { return items[0] }
+
+type ledger struct{}
+
+func Ledger() *ledger { return &ledger{} }
+`,
+		"main.go": `package main
+
+import (
+	"strings"
+
+	"example.com/app/shop"
+)
+
+func main() {
+	var c *shop.Cart = shop.NewCart("a", "b")
+	c.Add("c")
+	n, _ := shop.Read(strings.NewReader("x y"))
+	_ = c.Len() + n + shop.Limit + shop.First([]int{1})
+	_ = shop.Ledger()
+}
+`,
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	outDir := filepath.Join(root, "shop", "core")
+	out, err := runGenerate(server, "--format=json", "--by-type", "--new-package", "--barrel", "--output", outDir, filepath.Join(root, "shop", "shop.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v\n%s", err, out)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if result.Barrel != "shop.go" {
+		t.Errorf("barrel = %q, want shop.go", result.Barrel)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "Default") {
+		t.Errorf("warnings = %v, want one for the variable Default", result.Warnings)
+	}
+
+	barrel, _ := os.ReadFile(filepath.Join(root, "shop", "shop.go"))
+	for _, want := range []string{"type Cart = core.Cart", "return core.NewCart(items...)", "return core.First[T](items)", "var Ledger = core.Ledger"} {
+		if !strings.Contains(string(barrel), want) {
+			t.Errorf("barrel missing %q:\n%s", want, barrel)
+		}
+	}
+
+	build := exec.Command("go", "build", "./...")
+	build.Dir = root
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Errorf("callers do not build through the barrel: %v\n%s\n%s", err, output, barrel)
+	}
+}
+
+func TestGenerate_WithPackageContext(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"big.go":  "package foo\n\nfunc Parse() {}\n",
+		"util.go": "package foo\n\ntype Cache struct{}\n\nfunc trimAll(s string) string { return s }\n",
+	})
+
+	var planPrompt string
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			planPrompt = prompt
+			return `["parse.go"]`
+		}
+		return "package foo\n\nfunc Parse() {}\n"
+	})
+
+	if _, err := runGenerate(server, "--skip-tests", "--with-package-context", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	for _, want := range []string{"util.go:", "type Cache struct", "func trimAll"} {
+		if !strings.Contains(planPrompt, want) {
+			t.Errorf("planning prompt missing %q:\n%s", want, planPrompt)
+		}
+	}
+	if strings.Contains(planPrompt, "big.go:\n") {
+		t.Errorf("planning prompt lists the file being split:\n%s", planPrompt)
+	}
+}
+
+func TestGenerate_TestsAsContext(t *testing.T) {
+	dir := t.TempDir()
+	tests := "package foo\n\nimport \"testing\"\n\nfunc TestHelloWorld(t *testing.T) {\n\tHello()\n\tWorld()\n}\n"
+	writeFiles(t, dir, map[string]string{
+		"big.go":      "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n",
+		"big_test.go": tests,
+	})
+
+	var planPrompt string
+	server := newStubAPI(t, func(prompt string) string {
+		switch {
+		case strings.Contains(prompt, "JSON array"):
+			planPrompt = prompt
+			return `["greet.go"]`
+		case strings.Contains(prompt, "Generate test stubs"), strings.Contains(prompt, "TestHelloWorld"):
+			t.Errorf("tests used beyond planning with --tests-as-context:\n%s", prompt)
+		}
+		return "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n"
+	})
+
+	if _, err := runGenerate(server, "--tests-as-context", filepath.Join(dir, "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if !strings.Contains(planPrompt, "func TestHelloWorld") {
+		t.Errorf("planning prompt missing the tests:\n%s", planPrompt)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "greet.go")); err != nil {
+		t.Errorf("greet.go not written: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*_test.go")); len(matches) != 1 {
+		t.Errorf("test files = %v, want only big_test.go", matches)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "big_test.go")); string(data) != tests {
+		t.Errorf("big_test.go changed:\n%s", data)
+	}
+}
+
+func TestGenerate_RetryOnParseFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"big.go": "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n"})
+
+	var retryPrompts []string
+	server := newStubAPI(t, func(prompt string) string {
+		switch {
+		case strings.Contains(prompt, "JSON array"):
+			return `["hello.go", "world.go"]`
+		case strings.Contains(prompt, "did not parse"):
+			retryPrompts = append(retryPrompts, prompt)
+		}
+		switch {
+		case strings.Contains(prompt, "Generate hello.go") && len(retryPrompts) > 0:
+			return "package foo\n\nfunc Hello() {}\n"
+		case strings.Contains(prompt, "Generate hello.go"):
+			return "package foo\n\nfunc Hello() {\n"
+		}
+		return "package foo\n\nfunc World( {}\n" // Never parses
+	})
+
+	out, err := runGenerate(server, "--format=json", "--no-stubs", "--retry-on-parse-failure", "2", filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	files := map[string]cmd.GeneratedFile{}
+	for _, f := range result.Files {
+		files[f.Name] = f
+	}
+	if f := files["hello.go"]; f.Status != "created" || f.Retries != 1 {
+		t.Errorf("hello.go = %+v, want created after 1 retry", f)
+	}
+	if f := files["world.go"]; f.Status != "failed" || f.Retries != 2 || !strings.Contains(f.Error, "does not parse") {
+		t.Errorf("world.go = %+v, want failed after 2 retries", f)
+	}
+	if len(retryPrompts) != 3 || !strings.Contains(retryPrompts[0], "hello.go:3:") {
+		t.Errorf("retry prompts = %q, want 3 carrying the syntax error", retryPrompts)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "hello.go")); string(data) != "package foo\n\nfunc Hello() {}\n" {
+		t.Errorf("hello.go = %q, want the retried code", data)
+	}
+}
+
+func TestGenerate_IntoExistingPackage(t *testing.T) {
+	dir := t.TempDir()
+	helpers := "package foo\n\nfunc clean(s string) string { return s }\n"
+	writeFiles(t, dir, map[string]string{
+		"src/big.go":     "package foo\n\nfunc Hello() {}\n\nfunc trim(s string) string { return s }\n",
+		"out/helpers.go": helpers,
+	})
+	outDir := filepath.Join(dir, "out")
+
+	insist := false
+	var planPrompt string
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			planPrompt = prompt
+			if !insist && strings.Contains(prompt, "FILES ALREADY IN THE OUTPUT DIRECTORY") {
+				return `["hello.go", "strings.go"]`
+			}
+			return `["hello.go", "helpers.go"]`
+		}
+		if strings.Contains(prompt, "Generate hello.go") {
+			return "package foo\n\nfunc Hello() {}\n"
+		}
+		return "package foo\n\nfunc trim(s string) string { return s }\n"
+	})
+
+	if _, err := runGenerate(server, "--skip-tests", "-o", outDir, filepath.Join(dir, "src", "big.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if !strings.Contains(planPrompt, "helpers.go:\n  func clean") {
+		t.Errorf("planning prompt missing the existing files:\n%s", planPrompt)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "strings.go")); err != nil {
+		t.Errorf("strings.go not written: %v", err)
+	}
+
+	// A plan recreating an existing file is rejected before anything is written
+	insist = true
+	_, err := runGenerate(server, "--skip-tests", "--assume-yes", "-o", outDir, filepath.Join(dir, "src", "big.go"))
+	if err == nil || !strings.Contains(err.Error(), "helpers.go") {
+		t.Errorf("generate error = %v, want the plan recreating helpers.go rejected", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(outDir, "helpers.go")); string(data) != helpers {
+		t.Errorf("helpers.go overwritten:\n%s", data)
+	}
+}
+
+func TestGenerate_OutputArchive(t *testing.T) {
+	dir := t.TempDir()
+	source := "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n"
+	writeFiles(t, dir, map[string]string{"big.go": source})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go", "world.go"]`
+		}
+		if strings.Contains(prompt, "Generate world.go") {
+			return "package foo\n\nfunc World() {}\n"
+		}
+		return "package foo\n\nfunc Hello() {}\n"
+	})
+
+	want := map[string]string{
+		"hello.go": "package foo\n\nfunc Hello() {}\n",
+		"world.go": "package foo\n\nfunc World() {}\n",
+	}
+	for _, format := range []string{"tar", "zip"} {
+		out, err := runGenerate(server, "--skip-tests", "--output", "-", "--archive", format, filepath.Join(dir, "big.go"))
+		if err != nil {
+			t.Fatalf("%s: generate error = %v", format, err)
+		}
+
+		got := make(map[string]string)
+		if format == "tar" {
+			tr := tar.NewReader(strings.NewReader(out))
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("reading tar: %v", err)
+				}
+				data, _ := io.ReadAll(tr)
+				got[hdr.Name] = string(data)
+			}
+		} else {
+			zr, err := zip.NewReader(strings.NewReader(out), int64(len(out)))
+			if err != nil {
+				t.Fatalf("reading zip: %v", err)
+			}
+			for _, f := range zr.File {
+				rc, _ := f.Open()
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				got[f.Name] = string(data)
+			}
+		}
+
+		if len(got) != len(want) {
+			t.Errorf("%s entries = %v, want %v", format, got, want)
+		}
+		for name, content := range want {
+			if strings.TrimSpace(got[name]) != strings.TrimSpace(content) {
+				t.Errorf("%s %s = %q, want %q", format, name, got[name], content)
+			}
+		}
+	}
+
+	// Nothing was written next to the source
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("source directory has %d entries, want only big.go", len(entries))
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "big.go")); string(data) != source {
+		t.Errorf("big.go changed:\n%s", data)
+	}
+}
+
+func TestGenerate_OutputLayoutMirror(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"src/pkg/a/shop.go": "package a\n\ntype Cart struct{}\n\nfunc (Cart) Total() int { return 0 }\n\nfunc clean() {}\n",
+		"src/pkg/b/user.go": "package b\n\ntype User struct{}\n\nfunc (User) Name() string { return \"\" }\n\nfunc check() {}\n",
+	}
+	writeFiles(t, dir, sources)
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(filepath.Join(dir, "src")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	out, err := runGenerate(server, "--format=json", "--by-type", "--output-layout", "mirror", "-o", "../out", "pkg/a/shop.go", "pkg/b/user.go")
+	if err != nil {
+		t.Fatalf("generate error = %v\n%s", err, out)
+	}
+	var bulk cmd.BulkGenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &bulk); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	for i, want := range []struct{ source, dir string }{{"pkg/a/shop.go", "../out/pkg/a"}, {"pkg/b/user.go", "../out/pkg/b"}} {
+		r := bulk.Results[i]
+		if r.SourcePath != want.source || r.OutputDir != filepath.FromSlash(want.dir) {
+			t.Errorf("result %d maps %s to %s, want %s to %s", i, r.SourcePath, r.OutputDir, want.source, want.dir)
+		}
+		for _, f := range r.Files {
+			if _, err := os.Stat(filepath.Join(dir, "out", strings.TrimPrefix(want.dir, "../out/"), f.Name)); err != nil {
+				t.Errorf("%s not mirrored: %v", f.Name, err)
+			}
+		}
+	}
+	for name, content := range sources {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+			t.Errorf("%s changed:\n%s", name, data)
+		}
+	}
+
+	// The archive holds the mirrored tree
+	out, err = runGenerate(server, "--by-type", "--output-layout", "mirror", "-o", "-", "pkg/a/shop.go", "pkg/b/user.go")
+	if err != nil {
+		t.Fatalf("generate -o - error = %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(strings.NewReader(out))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if want := "pkg/a/shop.go pkg/a/shop_cart.go pkg/a/shop_helpers.go pkg/b/user.go pkg/b/user_helpers.go"; strings.Join(names, " ") != want {
+		t.Errorf("archive entries = %v, want %s", names, want)
+	}
+
+	if _, err := runGenerate(server, "--by-type", "--output-layout", "mirror", "pkg/a/shop.go"); cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("mirror without --output exit code = %d, want %d (err %v)", cmd.ExitCode(err), cmd.ExitUsage, err)
+	}
+}
+
+func TestGenerate_ByTypeMakesNoAPICalls(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"store.go": "package store\n\nimport \"strings\"\n\ntype Item struct{ name string }\n\nfunc (i Item) Name() string { return strings.TrimSpace(i.name) }\n\nfunc clean(s string) string { return s }\n",
+	})
+
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call: %.60q", prompt)
+		return ""
+	})
+
+	if _, err := runGenerate(server, "--by-type", "--verify", filepath.Join(dir, "store.go")); err != nil {
+		t.Fatalf("generate --by-type error = %v", err)
+	}
+	for name, want := range map[string]string{
+		"store_item.go":    "func (i Item) Name()",
+		"store_helpers.go": "func clean(",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, %v; want it to contain %q", name, data, err, want)
+		}
+	}
+}
+
+func TestGenerate_NoAI(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"store.go": "package store\n\nimport \"strings\"\n\nvar registry = map[string]Item{}\n\nfunc init() { registry[\"x\"] = Item{} }\n\ntype Item struct{ name string }\n\nfunc (i Item) Name() string { return strings.TrimSpace(i.name) }\n\nfunc clean(s string) string { return s }\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call: %.60q", prompt)
+		return ""
+	})
+
+	if _, err := runGenerate(server, "--no-ai", "--add-docs", "--require-docs", filepath.Join(dir, "store.go")); err == nil {
+		t.Error("generate --no-ai --add-docs succeeded")
+	}
+	if _, err := runGenerate(server, "--no-ai", "--verify", filepath.Join(dir, "store.go")); err != nil {
+		t.Fatalf("generate --no-ai error = %v", err)
+	}
+	for name, want := range map[string][]string{
+		"store.go":      {"var registry", "func init()"},
+		"store_item.go": {"import \"strings\"", "type Item", "func (i Item) Name()"},
+		"helpers.go":    {"func clean("},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		for _, w := range want {
+			if err != nil || !strings.Contains(string(data), w) {
+				t.Errorf("%s = %q, %v; want it to contain %q", name, data, err, w)
+			}
+		}
+		if name != "store_item.go" && strings.Contains(string(data), "strings") {
+			t.Errorf("%s keeps the unused strings import:\n%s", name, data)
+		}
+	}
+}
+
+func TestGenerate_OnlyExported(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":   "module example.com/store\n\ngo 1.21\n",
+		"store.go": "package store\n\nimport \"strings\"\n\n// Item is stored.\ntype Item struct{ name string }\n\n// Name returns the name.\nfunc (i Item) Name() string { return clean(i.name) }\n\nfunc clean(s string) string { return strings.TrimSpace(s) }\n",
+	})
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--format=json", "generate", "--only-exported", "--api-file", "public.go", filepath.Join(dir, "store.go")}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("generate --only-exported error = %v\n%s", err, stdout.String())
+	}
+	out := stdout.String()
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if !result.ValidationPassed {
+		t.Errorf("split does not build: %s", result.ValidationError)
+	}
+	for name, want := range map[string]string{
+		"public.go": "func (i Item) Name()",
+		"store.go":  "func clean(",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, %v; want it to contain %q", name, data, err, want)
+		}
+	}
+}
+
+func TestEmptyFileMakesNoAPICalls(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"doc.go": "// Package foo does things.\npackage foo\n\n// More to come.\n"})
+
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call: %.60q", prompt)
+		return ""
+	})
+
+	out, err := runGenerate(server, "--format=json", filepath.Join(dir, "doc.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var gen cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &gen); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if !gen.Empty || len(gen.Files) != 0 {
+		t.Errorf("generate result = %+v, want empty with no files", gen)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--use-wrapper", "--endpoint", server.URL, "--format=json", "analyze", "--force", filepath.Join(dir, "doc.go")}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	var ana cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &ana); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if !ana.Empty || ana.SplitRecommended {
+		t.Errorf("analyze result = %+v, want empty and no split", ana)
+	}
+}
+
+func TestAnalyze_ResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"shop.go": "package shop\n\nfunc Buy() {}\n"})
+	calls := 0
+	server := newStubAPI(t, func(string) string {
+		calls++
+		return fmt.Sprintf("Recommendation %d", calls)
+	})
+
+	cache := filepath.Join(t.TempDir(), "responses")
+	analyze := func(flags ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"--use-wrapper", "--endpoint", server.URL, "--format=json", "--cache", cache}, flags...)
+		args = append(args, "analyze", "--force", filepath.Join(dir, "shop.go"))
+		if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+			t.Fatalf("analyze error = %v", err)
+		}
+		var result cmd.AnalyzeResult
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+		}
+		return result.Recommendations
+	}
+
+	if first, again := analyze(), analyze(); first != "Recommendation 1" || again != first {
+		t.Errorf("recommendations = %q then %q, want the second from the cache", first, again)
+	}
+	if fresh := analyze("--no-cache"); fresh != "Recommendation 2" || calls != 2 {
+		t.Errorf("--no-cache recommendations = %q after %d calls, want a fresh call", fresh, calls)
+	}
+}
+
+func TestAnalyze_ServedByGoesToErrorWriter(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"shop.go": "package shop\n\nfunc Buy() {}\n"})
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	server := newStubAPI(t, func(string) string { return "Looks fine" })
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--use-wrapper", "--verbose", "--endpoint", dead.URL, "--endpoint", server.URL, "analyze", "--force", filepath.Join(dir, "shop.go")}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	if want := "(served by " + server.URL + ")"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+	}
+}
+
+func TestAnalyze_StreamDeltasGoToErrorWriter(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"shop.go": "package shop\n\nfunc Buy() {}\n"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"Looks \"}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"fine\"}}\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--use-wrapper", "--verbose", "--stream", "--endpoint", server.URL, "analyze", "--force", filepath.Join(dir, "shop.go")}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	if !strings.Contains(stderr.String(), "Looks fine") {
+		t.Errorf("stderr = %q, want the streamed response", stderr.String())
+	}
+}
+
+func TestAnalyzeTestFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"parse.go":      "package parse\n\nfunc Parse() {}\n",
+		"parse_test.go": "package parse\n\nimport \"testing\"\n\nfunc TestParse(t *testing.T) {}\n\nfunc TestParseEmpty(t *testing.T) {}\n\nfunc BenchmarkParse(b *testing.B) {}\n\nfunc ExampleParse() {}\n",
+	})
+
+	var prompt string
+	server := newStubAPI(t, func(p string) string {
+		prompt = p
+		return "Split into parse_basic_test.go and parse_bench_test.go"
+	})
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--use-wrapper", "--endpoint", server.URL, "--format=json", "analyze", "--force", filepath.Join(dir, "parse_test.go")}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+
+	if result.SourceFile != "parse.go" || result.TestFile != "" {
+		t.Errorf("source_file = %q, test_file = %q; want parse.go and none", result.SourceFile, result.TestFile)
+	}
+	want := cmd.TestStats{Tests: 2, Benchmarks: 1, Examples: 1}
+	if result.TestStats == nil || *result.TestStats != want {
+		t.Errorf("test_stats = %+v, want %+v", result.TestStats, want)
+	}
+	if !strings.Contains(prompt, "split the tests") || !strings.Contains(prompt, "func Parse") {
+		t.Errorf("prompt should ask for a test split with the source declarations:\n%s", prompt)
+	}
+}
+
+func TestGenerate_FailOnWarnings(t *testing.T) {
+	source := "package main\n\nfunc init() {}\n\nfunc main() {}\n"
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	for _, strict := range []bool{false, true} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"main.go": source})
+		args := []string{"--by-type", "--format=json", filepath.Join(dir, "main.go")}
+		if strict {
+			args = append(args, "--fail-on-warnings")
+		}
+
+		out, err := runGenerate(server, args...)
+		if (err != nil) != strict {
+			t.Errorf("strict=%v: error = %v", strict, err)
+		}
+		var result cmd.GenerateResult
+		if err := json.NewDecoder(strings.NewReader(out[strings.Index(out, "{"):])).Decode(&result); err != nil {
+			t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+		}
+		if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "initialization order") {
+			t.Errorf("strict=%v: warnings = %q, want the init order warning", strict, result.Warnings)
+		}
+	}
+}
+
+func TestGenerate_GroupByComment(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.21\n",
+		"app.go": "package app\n\n// region: Parsing\n\nfunc Parse() {}\n\n// region: Output\n\nfunc Print() {}\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	if _, err := runGenerate(server, "--group-by", "comment", filepath.Join(dir, "app.go")); err == nil {
+		t.Error("generate --group-by comment succeeded without matching dividers")
+	}
+	if _, err := runGenerate(server, "--group-by", "comment", "--section-regex", `^// region: (\w+)$`, filepath.Join(dir, "app.go")); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	for _, name := range []string{"app_parsing.go", "app_output.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+}
+
+func TestGenerate_InPlaceSplitBuilds(t *testing.T) {
+	// Every declaration leaves big.go, which must still be rewritten
+	src := "package big\n\nimport \"strings\"\n\ntype Foo struct{ name string }\n\nfunc NewFoo() *Foo { return &Foo{} }\n\nfunc (f *Foo) Name() string { return clean(f.name) }\n\nfunc clean(s string) string { return strings.TrimSpace(s) }\n"
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	for _, args := range [][]string{
+		{"--by-type"},
+		{"--even", "3"},
+		{"--plan-file", "outline.yaml"},
+	} {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"go.mod":       "module example.com/big\n\ngo 1.21\n",
+			"big.go":       src,
+			"outline.yaml": "foo.go: [Foo, NewFoo, clean]\n",
+		})
+		if args[0] == "--plan-file" {
+			args = []string{args[0], filepath.Join(dir, args[1])}
+		}
+		if _, err := runGenerate(server, append(args, filepath.Join(dir, "big.go"))...); err != nil {
+			t.Fatalf("generate %v error = %v", args, err)
+		}
+		build := exec.Command("go", "build", "./...")
+		build.Dir = dir
+		if output, err := build.CombinedOutput(); err != nil {
+			t.Errorf("package does not build after generate %v: %v\n%s", args, err, output)
+		}
+	}
+}
+
+func TestGenerate_EvenMustBePositive(t *testing.T) {
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+	if _, err := runGenerate(server, "--even", "-1", "big.go"); cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("--even -1 exit code = %d, want %d (err %v)", cmd.ExitCode(err), cmd.ExitUsage, err)
+	}
+}
+
+func TestGenerate_HelpersFileIsNotTheSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"store.go": "package store\n\ntype Item struct{}\n\nfunc clean() {}\n"})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+	_, err := runGenerate(server, "--by-type", "--helpers-file", "store.go", filepath.Join(dir, "store.go"))
+	if cmd.ExitCode(err) != cmd.ExitUsage {
+		t.Errorf("--helpers-file store.go exit code = %d, want %d (err %v)", cmd.ExitCode(err), cmd.ExitUsage, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "store_item.go")); err == nil {
+		t.Error("store_item.go was written despite the usage error")
+	}
+}
+
+func TestGenerate_PlanFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":       "module example.com/app\n\ngo 1.21\n",
+		"app.go":       "package app\n\ntype Store struct{}\n\nfunc (s *Store) Get() {}\n\nfunc NewStore() *Store { return nil }\n\nfunc Parse() {}\n\nfunc helper() {}\n",
+		"outline.yaml": "store.go: [Store, NewStore]\nparse.go:\n  - Parse\n",
+		"bad.json":     `{"store.go": ["Store", "Missing"]}`,
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	out, err := runGenerate(server, "--format=json", "--plan-file", filepath.Join(dir, "outline.yaml"), filepath.Join(dir, "app.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	store, _ := os.ReadFile(filepath.Join(dir, "store.go"))
+	if !strings.Contains(string(store), "func (s *Store) Get()") || !strings.Contains(string(store), "func NewStore()") {
+		t.Errorf("store.go missing Store's method or constructor:\n%s", store)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "helper") {
+		t.Errorf("warnings = %v, want one naming the unassigned helper", result.Warnings)
+	}
+
+	if _, err := runGenerate(server, "--plan-file", filepath.Join(dir, "bad.json"), filepath.Join(dir, "app.go")); err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Errorf("generate with an unknown symbol error = %v, want it named", err)
+	}
+}
+
+func TestGenerate_RefusesCgo(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"native.go": "package native\n\n// #include <stdlib.h>\nimport \"C\"\n\ntype Buf struct{}\n\n//export Add\nfunc Add(a, b C.int) C.int { return a + b }\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	_, err := runGenerate(server, "--by-type", filepath.Join(dir, "native.go"))
+	if err == nil || !strings.Contains(err.Error(), "cgo") {
+		t.Fatalf("generate error = %v, want a cgo refusal", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.go")); len(matches) != 1 {
+		t.Errorf("files after refusal = %v, want only native.go", matches)
+	}
+
+	out, err := runGenerate(server, "--by-type", "--force", "--format=json", "-o", filepath.Join(dir, "split"), filepath.Join(dir, "native.go"))
+	if err != nil {
+		t.Fatalf("generate --force error = %v", err)
+	}
+	if !strings.Contains(out, "cgo") {
+		t.Errorf("generate --force did not warn about cgo:\n%s", out)
+	}
+}
+
+func TestGenerate_FileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permission bits")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"store.go": "package store\n\ntype Item struct{}\n\nfunc (i *Item) Get() {}\n\nfunc helper() {}\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	out, err := runGenerate(server, "--format=json", "--by-type", "--file-mode", "0664", filepath.Join(dir, "store.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if len(result.Files) == 0 {
+		t.Fatal("no files generated")
+	}
+	for _, f := range result.Files {
+		info, err := os.Stat(filepath.Join(dir, f.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0664 {
+			t.Errorf("%s mode = %v, want 0664", f.Name, info.Mode().Perm())
+		}
+	}
+
+	for _, mode := range []string{"0999", "rw-r--r--", "0", "01777"} {
+		if _, err := runGenerate(server, "--by-type", "--file-mode", mode, filepath.Join(dir, "store.go")); cmd.ExitCode(err) != cmd.ExitUsage {
+			t.Errorf("--file-mode %s: exit code %d, want %d", mode, cmd.ExitCode(err), cmd.ExitUsage)
+		}
+	}
+}
+
+func TestGenerate_MaxInputLines(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"big.go": "package big\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n",
+	})
+	calls := 0
+	server := newStubAPI(t, func(prompt string) string {
+		calls++
+		if strings.Contains(prompt, "JSON array") {
+			return `["a.go"]`
+		}
+		return "package big\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n"
+	})
+
+	_, err := runGenerate(server, "--skip-tests", "--max-input-lines", "5", filepath.Join(dir, "big.go"))
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("generate over --max-input-lines error = %v, want a refusal naming --force", err)
+	}
+	if calls != 0 {
+		t.Errorf("%d API calls made for a refused file", calls)
+	}
+
+	if _, err := runGenerate(server, "--skip-tests", "--max-input-lines", "5", "--force", filepath.Join(dir, "big.go")); err != nil {
+		t.Errorf("generate --force error = %v", err)
+	}
+	if _, err := runGenerate(server, "--by-type", "--max-input-lines", "5", filepath.Join(dir, "big.go")); err != nil {
+		t.Errorf("generate --by-type error = %v, want no limit without AI", err)
+	}
+}
+
+func TestGenerate_Offline(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	t.Setenv("GOMODCACHE", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":    "module example.com/quotes\n\ngo 1.21\n\nrequire rsc.io/quote v1.5.2\n",
+		"go.sum":    "rsc.io/quote v1.5.2 h1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y=\nrsc.io/quote v1.5.2/go.mod h1:LzX7hefJvL54yjefDEDHNONDjII0t9xZLPXsUe+TKr0=\n",
+		"quotes.go": "package quotes\n\nimport \"rsc.io/quote\"\n\ntype Book struct{}\n\nfunc (b *Book) Quote() string { return quote.Go() }\n\nfunc helper() {}\n",
+	})
+
+	var stdout, stderr bytes.Buffer
+	err := cmd.ExecuteWithArgs([]string{"--offline", "--format=json", "generate", "--by-type", filepath.Join(dir, "quotes.go")}, &stdout, &stderr)
+	out := stdout.String()
+	if !strings.Contains(out, "{") {
+		t.Fatalf("generate error = %v, no JSON output:\n%s", err, out)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if result.ValidationPassed || !strings.Contains(result.ValidationError, "--offline") {
+		t.Errorf("validation error = %q, want one explaining the missing module under --offline", result.ValidationError)
+	}
+}
+
+func TestGenerate_EmitInventory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/shop\n\ngo 1.21\n",
+		"shop.go": "package shop\n\nconst Limit = 3\n\ntype Cart struct{ items []string }\n\nfunc NewCart() *Cart { return &Cart{} }\n\nfunc (c *Cart) Add(item string) { c.items = append(c.items, item) }\n\nfunc total(n int) int { return n }\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	inventoryPath := filepath.Join(t.TempDir(), "inventory.json")
+	out, err := runGenerate(server, "--format=json", "--by-type", "--emit-inventory", inventoryPath, filepath.Join(dir, "shop.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v\n%s", err, out)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	data, err := os.ReadFile(inventoryPath)
+	if err != nil {
+		t.Fatalf("inventory not written: %v", err)
+	}
+	var inventory []cmd.InventorySymbol
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		t.Fatalf("inventory is not JSON: %v\n%s", err, data)
+	}
+
+	// Every symbol of every generated file is listed, and nothing else
+	want := map[string]bool{}
+	for _, f := range result.Files {
+		info, err := analyzer.ParseGoFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, sym := range info.Symbols() {
+			want[f.Name+" "+sym.Name] = true
+		}
+	}
+	got := map[string]cmd.InventorySymbol{}
+	for _, sym := range inventory {
+		got[filepath.Base(sym.File)+" "+sym.Symbol] = sym
+	}
+	if len(got) != len(want) || len(inventory) != len(want) {
+		t.Errorf("inventory has %d symbols, want %d: %v", len(inventory), len(want), inventory)
+	}
+	for key := range want {
+		if _, ok := got[key]; !ok {
+			t.Errorf("inventory is missing %s", key)
+		}
+	}
+	if add := got["shop_cart.go Cart.Add"]; add.Kind != "method" || !add.Exported || add.Line == 0 || add.EndLine < add.Line {
+		t.Errorf("Cart.Add = %+v, want an exported method with its lines", add)
+	}
+	if total := got["shop_helpers.go total"]; total.Kind != "func" || total.Exported {
+		t.Errorf("total = %+v, want an unexported func", total)
+	}
+}
+
+func TestGenerate_EmitMoves(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/shop\n\ngo 1.21\n",
+		"shop.go": "package shop\n\nconst Limit = 3\n\ntype Cart struct{ items []string }\n\nfunc NewCart() *Cart { return &Cart{} }\n\nfunc (c *Cart) Add(item string) { c.items = append(c.items, item) }\n\nfunc total(n int) int { return n }\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	movesPath := filepath.Join(t.TempDir(), "moves.json")
+	out, err := runGenerate(server, "--format=json", "--by-type", "--emit-moves", movesPath, filepath.Join(dir, "shop.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(movesPath)
+	if err != nil {
+		t.Fatalf("moves not written: %v", err)
+	}
+	var moves []cmd.SymbolMove
+	if err := json.Unmarshal(data, &moves); err != nil {
+		t.Fatalf("moves are not JSON: %v\n%s", err, data)
+	}
+
+	got := map[string]cmd.SymbolMove{}
+	for _, m := range moves {
+		got[m.Symbol] = m
+	}
+	if len(moves) != 5 {
+		t.Errorf("got %d moves, want one per source symbol: %v", len(moves), moves)
+	}
+	add := got["Cart.Add"]
+	if filepath.Base(add.FromFile) != "shop.go" || add.FromLines != [2]int{9, 9} {
+		t.Errorf("Cart.Add moved from %s:%v, want shop.go:[9 9]", add.FromFile, add.FromLines)
+	}
+	if filepath.Base(add.ToFile) != "shop_cart.go" || add.ToLines[0] == 0 || add.ToLines[1] < add.ToLines[0] {
+		t.Errorf("Cart.Add moved to %s:%v, want a line range in shop_cart.go", add.ToFile, add.ToLines)
+	}
+	if total := got["total"]; filepath.Base(total.ToFile) != "shop_helpers.go" || total.FromLines != [2]int{11, 11} {
+		t.Errorf("total = %+v, want shop.go:[11 11] moved to shop_helpers.go", total)
+	}
+}
+
+func TestGenerate_PlanTimeout(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return `["main.go"]`
+	})
+
+	_, err := runGenerate(server, "--timeout", "10s", "--plan-timeout", "20ms", filepath.Join(dir, "main.go"))
+	if err == nil || !strings.Contains(err.Error(), "planning failed") {
+		t.Errorf("generate error = %v, want the planning call to time out", err)
+	}
+}
+
+func TestGenerate_PreserveOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.go": "package main\n\ntype Server struct{}\n\nfunc (s *Server) Run() {}\n\nvar cfg = load()\n\nfunc init() {}\n\nfunc load() int { return 1 }\n\nfunc main() {}\n",
+	})
+	server := newStubAPI(t, func(prompt string) string {
+		t.Errorf("unexpected API call")
+		return ""
+	})
+
+	out, err := runGenerate(server, "--by-type", "--preserve-order", "--format=json", filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+
+	if len(result.InitOrderRisks) != 2 {
+		t.Errorf("InitOrderRisks = %q, want init function and cfg", result.InitOrderRisks)
+	}
+	var names []string
+	for _, f := range result.Files {
+		names = append(names, f.Name)
+		if _, err := os.Stat(filepath.Join(dir, f.Name)); err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	sort.Strings(names)
+	// Server is declared first, then cfg/init, then the helpers
+	if want := "01_main_server.go,02_main.go,03_main_helpers.go"; strings.Join(names, ",") != want {
+		t.Errorf("files = %v, want %s", names, want)
+	}
+}
+
+func TestStdinInputUsesStdinName(t *testing.T) {
+	src := "package widget\n\ntype Widget struct{}\n\nfunc (w *Widget) Spin() {}\n\nfunc helper() {}\n"
+
+	var prompts []string
+	server := newStubAPI(t, func(prompt string) string {
+		prompts = append(prompts, prompt)
+		return "Split it."
+	})
+
+	var stdout bytes.Buffer
+	root := cmd.NewRootCmd()
+	root.SetArgs([]string{"--use-wrapper", "--endpoint", server.URL, "--format=json", "--stdin-name", "widget.go", "analyze", "--force", "-"})
+	root.SetIn(strings.NewReader(src))
+	root.SetOut(&stdout)
+	root.SetErr(&stdout)
+	if err := root.Execute(); err != nil {
+		t.Fatalf("analyze - error = %v", err)
+	}
+
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if result.File != "widget.go" || result.Package != "widget" {
+		t.Errorf("File = %q, Package = %q; want widget.go, widget", result.File, result.Package)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "widget.go") {
+		t.Errorf("prompt does not name widget.go: %v", prompts)
+	}
+
+	outDir := t.TempDir()
+	root = cmd.NewRootCmd()
+	root.SetArgs([]string{"--stdin-name", "widget.go", "--output", outDir, "generate", "--by-type", "--skip-validation", "-"})
+	root.SetIn(strings.NewReader(src))
+	root.SetOut(&stdout)
+	root.SetErr(&stdout)
+	if err := root.Execute(); err != nil {
+		t.Fatalf("generate - error = %v", err)
+	}
+	for _, name := range []string{"widget.go", "widget_helpers.go"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+}
+
+func TestGenerate_AbortAfterConsecutiveFailures(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go": "package foo\n\nfunc A() {}\n",
+		"b.go": "package foo\n\nfunc B() {}\n",
+		"c.go": "package foo\n\nfunc C() {}\n",
+	})
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "token expired", http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	out, err := runGenerate(server, "--skip-tests", "--abort-after", "2", "--format=json",
+		filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "c.go"))
+	if err == nil || !strings.Contains(err.Error(), "2 of 3 files processed") {
+		t.Fatalf("Expected abort error reporting progress, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("API calls = %d, want 2 (third file skipped)", calls)
+	}
+
+	// Usage text follows the JSON document on error
+	var bulk cmd.BulkGenerateResult
+	if err := json.NewDecoder(strings.NewReader(out)).Decode(&bulk); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if !bulk.Aborted || bulk.Processed != 2 || len(bulk.Errors) != 2 {
+		t.Errorf("bulk = %+v, want aborted after 2 processed with 2 errors", bulk)
+	}
+}
+
+func TestAnalyze_SkipsAIWhenSplitNotRecommended(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"small.go": "package foo\n\nfunc Hello() {}\n"})
+
+	calls := 0
+	server := newStubAPI(t, func(prompt string) string {
+		calls++
+		return "Split it."
+	})
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--use-wrapper", "--endpoint", server.URL, "--format=json", "analyze", filepath.Join(dir, "small.go")}
+	if err := cmd.ExecuteWithArgs(args, &stdout, &stderr); err != nil {
+		t.Fatalf("analyze error = %v", err)
+	}
+	var result cmd.AnalyzeResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, stdout.String())
+	}
+	if result.SplitRecommended || result.SplitReason == "" || result.Recommendations != "" {
+		t.Errorf("result = %+v, want not recommended with a reason and no recommendations", result)
+	}
+	if calls != 0 {
+		t.Errorf("API calls = %d, want 0", calls)
+	}
+
+	stdout.Reset()
+	if err := cmd.ExecuteWithArgs(append(args[:4:4], "analyze", "--force", filepath.Join(dir, "small.go")), &stdout, &stderr); err != nil {
+		t.Fatalf("analyze --force error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("API calls with --force = %d, want 1", calls)
+	}
+}
+
+func TestGenerate_ModifiedBodies(t *testing.T) {
+	dir := t.TempDir()
+	src := "package foo\n\nimport \"strings\"\n\nfunc Hello(s string) string {\n\treturn strings.TrimSpace(s)\n}\n\nfunc World() int { return 1 }\n"
+	writeFiles(t, dir, map[string]string{"big.go": src})
+
+	server := newStubAPI(t, func(prompt string) string {
+		if strings.Contains(prompt, "JSON array") {
+			return `["hello.go", "world.go"]`
+		}
+		if strings.Contains(prompt, "Generate world.go") {
+			// "Improved" while moving
+			return "package foo\n\nfunc World() int {\n\treturn 2\n}\n"
+		}
+		// Reformatted and commented, but the same code
+		return "package foo\n\nimport (\n\t\"strings\"\n)\n\n// Hello trims s.\nfunc Hello(s string) string { return strings.TrimSpace(s) }\n"
+	})
+
+	out, err := runGenerate(server, "--skip-tests", "--format=json", "-o", filepath.Join(dir, "a"), filepath.Join(dir, "big.go"))
+	if err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	var result cmd.GenerateResult
+	if err := json.Unmarshal([]byte(out[strings.Index(out, `{"source_file"`):]), &result); err != nil {
+		t.Fatalf("Failed to parse JSON: %v\nOutput: %s", err, out)
+	}
+	if want := []string{"World"}; !reflect.DeepEqual(result.ModifiedBodies, want) {
+		t.Errorf("ModifiedBodies = %v, want %v", result.ModifiedBodies, want)
+	}
+
+	_, err = runGenerate(server, "--skip-tests", "--strict-preserve", "-o", filepath.Join(dir, "b"), filepath.Join(dir, "big.go"))
+	if err == nil || !strings.Contains(err.Error(), "--strict-preserve") {
+		t.Errorf("generate --strict-preserve error = %v, want a failure", err)
+	}
+}
@@ -1,10 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
 )
 
 // parseFilenames extracts Go filenames from an AI response.
@@ -38,7 +49,8 @@ func parseFilenames(response string) []string {
 	return filenames
 }
 
-// cleanCode removes markdown fences and trims whitespace from code.
+// cleanCode removes markdown fences and surrounding whitespace from code and
+// ends it with exactly one newline, as gofmt expects. Empty code stays empty.
 func cleanCode(code string) string {
 	code = strings.TrimSpace(code)
 
@@ -51,11 +63,58 @@ func cleanCode(code string) string {
 			} else {
 				lines = lines[1:]
 			}
-			code = strings.Join(lines, "\n")
+			code = strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+	}
+
+	if code == "" {
+		return ""
+	}
+	return code + "\n"
+}
+
+// parseError returns the first syntax error in the Go code of filename, or
+// nil if it parses.
+func parseError(filename, code string) error {
+	_, err := parser.ParseFile(token.NewFileSet(), filename, code, 0)
+	return err
+}
+
+// callParsed makes a generation call whose output must parse as Go. check
+// returns a response's syntax error, if any; while there is one the call is
+// made again, up to --retry-on-parse-failure times, with the error appended
+// to the prompt. It returns the last response and the number of retries.
+// Without retries the response is not checked.
+func callParsed(client *tracedClient, phase, target, prompt string, maxTokens int, check func(response string) error) (string, int, error) {
+	response, err := client.Call(phase, target, prompt, maxTokens)
+	if err != nil || genCfg.RetryOnParseFailure == 0 {
+		return response, 0, err
+	}
+	for retries := 0; ; retries++ {
+		parseErr := check(response)
+		if parseErr == nil {
+			return response, retries, nil
+		}
+		if retries == genCfg.RetryOnParseFailure {
+			return "", retries, fmt.Errorf("output does not parse after %d retries: %w", retries, parseErr)
+		}
+		retry := fmt.Sprintf("%s\n\nYour previous output for %s did not parse as Go:\n%v\n\nRegenerate it in full with the error fixed, in the same output format.", prompt, target, parseErr)
+		if response, err = client.Call(phase, target, retry, maxTokens); err != nil {
+			return "", retries + 1, err
 		}
 	}
+}
 
-	return code
+// retryNote describes the parse failure retries of a call for progress
+// output, empty if there were none.
+func retryNote(retries int) string {
+	switch retries {
+	case 0:
+		return ""
+	case 1:
+		return ", 1 retry"
+	}
+	return fmt.Sprintf(", %d retries", retries)
 }
 
 // parseSourceAndTest extracts source and test code from a JSON response.
@@ -120,16 +179,246 @@ func countTestsInCode(code string) int {
 	return count
 }
 
-// runValidation runs go test on the output directory.
-func runValidation(dir string) error {
-	cmd := exec.Command("go", "test", "./...")
+// validationWaitDelay is how long runValidation waits for output after
+// killing go test.
+const validationWaitDelay = 5 * time.Second
+
+// runValidation runs go test on the output directory. It gives up after
+// timeout or on an interrupt, killing go test along with the test binaries
+// it started.
+func runValidation(dir string, timeout time.Duration) error {
+	return runGo(dir, timeout, "test", "./...")
+}
+
+// runGo runs the go command with args in dir as runValidation does,
+// returning its output as the error when it fails.
+func runGo(dir string, timeout time.Duration, args ...string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", args...)
 	cmd.Dir = dir
+	cmd.Env = toolEnv()
+	cmd.WaitDelay = validationWaitDelay
+	killGroupOnCancel(cmd)
 	output, err := cmd.CombinedOutput()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("validation timed out after %s (raise --validate-timeout)", timeout)
+	case ctx.Err() != nil:
+		return fmt.Errorf("validation cancelled")
+	}
 	if err != nil {
 		if len(output) > 0 {
-			return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+			return offlineError(strings.TrimSpace(string(output)))
 		}
 		return err
 	}
 	return nil
 }
+
+// writeFileAtomic writes data to path so that path holds either its old
+// content or all of data, never a truncated file: the data goes to a temp
+// file in the same directory that is then renamed into place.
+func writeFileAtomic(path string, data []byte) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeAtomic is writeFileAtomic with the content written by write.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // no-op once renamed
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fileMode()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// outputDirFor returns the directory the split of arg (read as filename)
+// is written to: --output, the source's own directory without it, or with
+// --output-layout mirror the source's directory relative to the working
+// directory recreated under --output. Stdin goes to the root of --output.
+func outputDirFor(arg, filename string) (string, error) {
+	switch {
+	case cfg.OutputDir == "":
+		return filepath.Dir(filename), nil
+	case genCfg.OutputLayout != "mirror" || !isLocalInput(arg):
+		return cfg.OutputDir, nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the working directory, which --output-layout mirror paths are relative to", arg)
+	}
+	return filepath.Join(cfg.OutputDir, rel), nil
+}
+
+// refreshLineCounts updates the line counts of the named files after they
+// were rewritten on disk.
+func refreshLineCounts(dir string, files []GeneratedFile, names []string) {
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		for i := range files {
+			if files[i].Name == name {
+				files[i].Lines = analyzer.CountLines(string(content))
+			}
+		}
+	}
+}
+
+// existingOutputs returns the planned output files (and their test files
+// when withTests is set) that already exist in dir, ignoring the paths in
+// replaced, which the split is expected to overwrite.
+func existingOutputs(dir string, filenames []string, withTests bool, replaced ...string) []string {
+	skip := make(map[string]bool)
+	for _, p := range replaced {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	var existing []string
+	for _, fname := range filenames {
+		names := []string{fname}
+		if withTests {
+			names = append(names, testFileFor(fname))
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				existing = append(existing, name)
+			}
+		}
+	}
+	return existing
+}
+
+// parsePlan extracts the planned files from an AI response. Plans given as
+// objects, with a description and the declarations assigned to each file,
+// are understood as well as plain filename lists.
+func parsePlan(response string) []SplitFile {
+	start := strings.Index(response, "[")
+	end := strings.LastIndex(response, "]")
+	if start >= 0 && end > start {
+		var files []SplitFile
+		if err := json.Unmarshal([]byte(response[start:end+1]), &files); err == nil {
+			var plan []SplitFile
+			for _, f := range files {
+				if strings.HasSuffix(f.Name, ".go") {
+					plan = append(plan, f)
+				}
+			}
+			if len(plan) > 0 {
+				return plan
+			}
+		}
+	}
+
+	var plan []SplitFile
+	for _, name := range parseFilenames(response) {
+		plan = append(plan, SplitFile{Name: name})
+	}
+	return plan
+}
+
+// estimatePlanLines estimates the length of each planned file from the
+// declarations the plan assigns it: their lines, including doc comments,
+// plus the source's package clause and imports. A type brings its methods
+// along. Files with no recognized declarations get an equal share of the
+// source.
+func estimatePlanLines(info *analyzer.FileInfo, plan []SplitFile) []int {
+	header := info.Lines
+	for _, fn := range info.Functions {
+		header = min(header, fn.DocLine-1)
+	}
+	for _, t := range info.Types {
+		header = min(header, t.DocLine-1)
+	}
+	for _, v := range info.Vars {
+		header = min(header, v.Line-1)
+	}
+
+	estimates := make([]int, len(plan))
+	for i, f := range plan {
+		assigned := make(map[string]bool)
+		for _, name := range append(f.Functions, f.Types...) {
+			assigned[name] = true
+		}
+
+		lines := 0
+		for _, fn := range info.Functions {
+			owner := fn.ReceiverType()
+			if assigned[fn.Name] || (owner != "" && (assigned[owner] || assigned[owner+"."+fn.Name])) {
+				lines += fn.EndLine - fn.DocLine + 2 // and the blank line after
+			}
+		}
+		for _, t := range info.Types {
+			if assigned[t.Name] {
+				lines += t.EndLine - t.DocLine + 2
+			}
+		}
+
+		if lines == 0 {
+			estimates[i] = info.Lines / len(plan)
+		} else {
+			estimates[i] = header + lines
+		}
+	}
+	return estimates
+}
+
+// constraintRule asks, in a sentence starting with lead, for the build
+// constraints of the source content to head the generated code, or returns
+// "" if it has none.
+func constraintRule(content []byte, lead string) string {
+	lines, _ := analyzer.BuildConstraints(content)
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n%s with the source's build constraints, then a blank line:\n%s", lead, strings.Join(lines, "\n"))
+}
+
+// withBuildConstraints puts the source's build constraint lines at the top
+// of generated code that lacks them, so a split keeps its platform gating.
+func withBuildConstraints(code string, lines []string) string {
+	if code == "" || len(lines) == 0 || strings.Contains(code, "//go:build") || strings.Contains(code, "// +build") {
+		return code
+	}
+	return strings.Join(lines, "\n") + "\n\n" + code
+}
@@ -1,7 +1,15 @@
 package cmd
 
 import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
 )
 
 func TestParseSourceAndTest(t *testing.T) {
@@ -113,18 +121,28 @@ func TestCleanCode(t *testing.T) {
 	}{
 		{
 			name:     "already clean",
+			input:    "package main\n\nfunc Hello() {}\n",
+			expected: "package main\n\nfunc Hello() {}\n",
+		},
+		{
+			name:     "no trailing newline",
 			input:    "package main\n\nfunc Hello() {}",
-			expected: "package main\n\nfunc Hello() {}",
+			expected: "package main\n\nfunc Hello() {}\n",
 		},
 		{
 			name:     "with markdown fence",
-			input:    "```go\npackage main\n\nfunc Hello() {}\n```",
-			expected: "package main\n\nfunc Hello() {}",
+			input:    "```go\npackage main\n\nfunc Hello() {}\n\n```",
+			expected: "package main\n\nfunc Hello() {}\n",
 		},
 		{
 			name:     "with whitespace",
-			input:    "\n  package main\n\nfunc Hello() {}  \n",
-			expected: "package main\n\nfunc Hello() {}",
+			input:    "\n  package main\n\nfunc Hello() {}  \n\n\n",
+			expected: "package main\n\nfunc Hello() {}\n",
+		},
+		{
+			name:     "empty",
+			input:    "  \n",
+			expected: "",
 		},
 	}
 
@@ -176,3 +194,103 @@ func TestParseFilenames(t *testing.T) {
 		})
 	}
 }
+
+func TestParsePlan(t *testing.T) {
+	plan := parsePlan("Plan:\n[{\"name\": \"types.go\", \"description\": \"Data types\", \"types\": [\"Server\"]}, {\"name\": \"notes.txt\"}]")
+	if len(plan) != 1 || plan[0].Name != "types.go" || plan[0].Description != "Data types" || len(plan[0].Types) != 1 {
+		t.Errorf("parsePlan(objects) = %+v", plan)
+	}
+
+	plan = parsePlan(`["a.go", "b.go"]`)
+	if len(plan) != 2 || plan[0].Name != "a.go" || plan[1].Name != "b.go" {
+		t.Errorf("parsePlan(names) = %+v", plan)
+	}
+}
+
+func TestEstimatePlanLines(t *testing.T) {
+	src := `package foo
+
+import "fmt"
+
+// Server serves.
+type Server struct{}
+
+func (s *Server) Run() { fmt.Println() }
+
+func helper() {
+	fmt.Println()
+}
+`
+	info, err := analyzer.ParseGoSource("foo.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := []SplitFile{
+		{Name: "server.go", Types: []string{"Server"}},
+		{Name: "helpers.go", Functions: []string{"helper"}},
+		{Name: "other.go"},
+	}
+	got := estimatePlanLines(info, plan)
+	// Header is 4 lines; Server is 2 lines plus its 1-line method, each with a blank line
+	want := []int{4 + 3 + 2, 4 + 4, info.Lines / 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("estimatePlanLines()[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRunValidation_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":       "module slow\n\ngo 1.21\n",
+		"slow_test.go": "package slow\n\nimport (\n\t\"testing\"\n\t\"time\"\n)\n\nfunc TestSlow(t *testing.T) { time.Sleep(time.Minute) }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	err := runValidation(dir, 3*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("runValidation() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second+validationWaitDelay {
+		t.Errorf("runValidation() took %s; the test binary was not killed", elapsed)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.go")
+	if err := os.WriteFile(path, []byte("package old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that dies halfway must leave the old file alone
+	err := writeAtomic(path, func(w io.Writer) error {
+		_, _ = w.Write([]byte("package ne"))
+		return errors.New("killed")
+	})
+	if err == nil {
+		t.Fatal("writeAtomic() error = nil, want the write error")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "package old\n" {
+		t.Errorf("after a failed write the file holds %q, want the old content", got)
+	}
+
+	if err := writeFileAtomic(path, []byte("package new\n")); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "package new\n" {
+		t.Errorf("file holds %q, want the new content", got)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %v, want 0644", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("dir has %d entries, want only out.go (temp files left behind)", len(entries))
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// initOrderRisks lists what in a package main file depends on
+// initialization order: init functions, which run file by file in file
+// name order, and var initializers that refer to other declarations.
+// Returns nil for other packages or when nothing is order-sensitive.
+func initOrderRisks(info *analyzer.FileInfo) []string {
+	if info.Package != "main" {
+		return nil
+	}
+	var risks []string
+	if info.InitFuncs > 0 {
+		risks = append(risks, fmt.Sprintf("%d init function(s)", info.InitFuncs))
+	}
+	for _, v := range info.Vars {
+		if v.IsVar && len(v.DependsOn) > 0 {
+			risks = append(risks, fmt.Sprintf("var %s initialized from %s", v.Name, strings.Join(v.DependsOn, ", ")))
+		}
+	}
+	return risks
+}
+
+// preserveFileOrder renames the created output files with a numeric prefix
+// ("01_config.go") so that file name order, which drives initialization
+// order, follows where each file's declarations appeared in the source.
+// Test files are renamed along with their source file. files is updated in
+// place.
+func preserveFileOrder(outDir string, files []GeneratedFile, source *analyzer.FileInfo) error {
+	firstLine := make(map[string]int)
+	for _, sym := range source.Symbols() {
+		if l, ok := firstLine[sym.Name]; !ok || sym.Line < l {
+			firstLine[sym.Name] = sym.Line
+		}
+	}
+
+	type ranked struct {
+		name string
+		line int
+	}
+	var sources []ranked
+	for _, f := range files {
+		if f.Status != "created" || isTestFile(f.Name) {
+			continue
+		}
+		line := int(^uint(0) >> 1) // Files with no known symbols go last
+		if info, err := analyzer.ParseGoFile(filepath.Join(outDir, f.Name)); err == nil {
+			for _, sym := range info.Symbols() {
+				if l, ok := firstLine[sym.Name]; ok && l < line {
+					line = l
+				}
+			}
+		}
+		sources = append(sources, ranked{f.Name, line})
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].line < sources[j].line })
+
+	width := len(fmt.Sprint(len(sources)))
+	if width < 2 {
+		width = 2
+	}
+	renamed := make(map[string]string)
+	for i, r := range sources {
+		prefix := fmt.Sprintf("%0*d_", width, i+1)
+		renamed[r.name] = prefix + r.name
+		renamed[testFileFor(r.name)] = prefix + testFileFor(r.name)
+	}
+
+	for i, f := range files {
+		to, ok := renamed[f.Name]
+		if !ok || f.Status != "created" {
+			continue
+		}
+		if err := os.Rename(filepath.Join(outDir, f.Name), filepath.Join(outDir, to)); err != nil {
+			return fmt.Errorf("renaming %s: %w", f.Name, err)
+		}
+		files[i].Name = to
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// ModelsResult holds the models available from the configured backend.
+type ModelsResult struct {
+	Backend string   `json:"backend"` // Endpoint queried, or "anthropic" in direct mode
+	Current string   `json:"current"` // The --model in effect
+	Models  []string `json:"models"`
+}
+
+// newModelsCmd creates the models command.
+func newModelsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "models",
+		Short: "List the models the backend accepts",
+		Long: `List the model names that can be passed to --model.
+
+In wrapper mode the endpoint's models route is queried (for the default
+endpoint, http://localhost:8000/v1/models). In direct API mode the models
+known to this build are listed.`,
+		Args: cobra.NoArgs,
+		RunE: runModels,
+	}
+}
+
+func runModels(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+	client := newAPIClient(cmd.ErrOrStderr())
+
+	result := ModelsResult{Backend: "anthropic", Current: cfg.Model}
+	if !client.IsDirectMode() {
+		result.Backend = client.Endpoint()
+	}
+
+	models, err := client.ListModels()
+	if err != nil {
+		return fmt.Errorf("listing models: %w", apiError(err))
+	}
+	result.Models = models
+
+	if IsStructuredOutput() {
+		return PrintOutput(cmd.OutOrStdout(), result)
+	}
+
+	ui.Header(fmt.Sprintf("🤖 Models available from %s", result.Backend))
+	for _, m := range result.Models {
+		marker := " "
+		if m == result.Current {
+			marker = "*"
+		}
+		cmd.Printf("   %s %s\n", marker, m)
+	}
+	if len(result.Models) == 0 {
+		ui.Info("The backend reported no models")
+	}
+	return nil
+}
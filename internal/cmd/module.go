@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// findModule walks up from dir to the nearest go.mod and returns the module
+// root directory and module path.
+func findModule(dir string) (root, modPath string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		gomod := filepath.Join(dir, "go.mod")
+		if _, statErr := os.Stat(gomod); statErr == nil {
+			modPath, err = readModulePath(gomod)
+			return dir, modPath, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", fmt.Errorf("no go.mod found")
+		}
+		dir = parent
+	}
+}
+
+// readModulePath returns the module path declared in a go.mod file.
+func readModulePath(gomod string) (string, error) {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "module"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			path := strings.TrimSpace(rest)
+			if unquoted, err := strconv.Unquote(path); err == nil {
+				path = unquoted
+			}
+			return path, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s: no module directive", gomod)
+}
+
+// importPathFor returns the import path of dir. It returns an error when dir
+// is not inside a module.
+func importPathFor(dir string) (string, error) {
+	root, modPath, err := findModule(dir)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is outside module %s", dir, modPath)
+	}
+	if rel == "." {
+		return modPath, nil
+	}
+	return modPath + "/" + filepath.ToSlash(rel), nil
+}
+
+// packageNameFor returns the package name files in dir should declare: the
+// package of any existing non-test Go files, otherwise a name derived from
+// the directory (lowercased, letters and digits only).
+func packageNameFor(dir string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, m := range matches {
+		if isTestFile(m) {
+			continue
+		}
+		if info, err := analyzer.ParseGoFile(m); err == nil {
+			return info.Package
+		}
+	}
+	return dirPackageName(dir)
+}
+
+// dirPackageName derives a package name from dir's base name: lowercased,
+// letters and digits only, "split" if nothing is left.
+func dirPackageName(dir string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(dir)) {
+		if unicode.IsLetter(r) || (unicode.IsDigit(r) && b.Len() > 0) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "split"
+	}
+	return b.String()
+}
+
+// packageMismatch reports whether pkg breaks the convention that a package
+// is named after its directory. main and external test packages are exempt,
+// and a major-version directory ("v2") stands for its parent.
+func packageMismatch(pkg, dir string) bool {
+	if pkg == "main" || strings.HasSuffix(pkg, "_test") {
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	if base := filepath.Base(abs); len(base) > 1 && base[0] == 'v' && strings.Trim(base[1:], "0123456789") == "" {
+		abs = filepath.Dir(abs)
+	}
+	return pkg != filepath.Base(abs) && pkg != dirPackageName(abs)
+}
+
+// setPackageName rewrites the package clause of code to name, keeping an
+// external test package's _test suffix. Code that does not parse is returned
+// unchanged.
+func setPackageName(code, name string) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.PackageClauseOnly)
+	if err != nil {
+		return code
+	}
+	if strings.HasSuffix(file.Name.Name, "_test") {
+		name += "_test"
+	}
+	start := fset.Position(file.Name.Pos()).Offset
+	end := fset.Position(file.Name.End()).Offset
+	return code[:start] + name + code[end:]
+}
+
+// qualifyMovedSymbols rewrites references to the moved exported symbols in
+// the Go file at path as pkgName.Symbol and imports importPath. It reports
+// whether the file changed. Identifiers resolved within the file itself
+// (locals, params, same-file declarations) are left alone.
+func qualifyMovedSymbols(path string, moved map[string]bool, pkgName, importPath string) (bool, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return false, err
+	}
+
+	// Identifiers that name things rather than reference them
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			skip[x.Sel] = true
+		case *ast.KeyValueExpr:
+			if id, ok := x.Key.(*ast.Ident); ok {
+				skip[id] = true
+			}
+		case *ast.Field:
+			for _, id := range x.Names {
+				skip[id] = true
+			}
+		}
+		return true
+	})
+
+	var offsets []int
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || skip[id] || id.Obj != nil || !moved[id.Name] {
+			return true
+		}
+		offsets = append(offsets, fset.Position(id.Pos()).Offset)
+		return true
+	})
+	if len(offsets) == 0 {
+		return false, nil
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	out := string(src)
+	for _, off := range offsets {
+		out = out[:off] + pkgName + "." + out[off:]
+	}
+
+	out = addImport(out, importPath)
+	formatted, err := format.Source([]byte(out))
+	if err != nil {
+		return false, fmt.Errorf("formatting %s: %w", path, err)
+	}
+	return true, os.WriteFile(path, formatted, 0644)
+}
+
+// addImport adds importPath to code's imports, joining an existing
+// parenthesized import block when there is one.
+func addImport(code, importPath string) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.ImportsOnly)
+	if err != nil {
+		return code
+	}
+	for _, imp := range file.Imports {
+		if strings.Trim(imp.Path.Value, `"`) == importPath {
+			return code
+		}
+	}
+
+	quoted := strconv.Quote(importPath)
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT && gd.Lparen.IsValid() {
+			at := fset.Position(gd.Lparen).Offset + 1
+			return code[:at] + "\n\t" + quoted + code[at:]
+		}
+	}
+	end := fset.Position(file.Name.End()).Offset
+	return code[:end] + "\n\nimport " + quoted + code[end:]
+}
+
+// updateImportReferences qualifies references to exported symbols moved
+// into outputs in the other Go files of srcDir, skipping the files in
+// exclude. It returns the names of the files it rewrote.
+func updateImportReferences(srcDir string, outputs []*analyzer.FileInfo, pkgName, importPath string, exclude ...string) ([]string, error) {
+	moved := make(map[string]bool)
+	for _, out := range outputs {
+		for _, sym := range out.Symbols() {
+			if sym.Kind != "method" && ast.IsExported(sym.Name) {
+				moved[sym.Name] = true
+			}
+		}
+	}
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	skip := make(map[string]bool)
+	for _, p := range exclude {
+		if abs, err := filepath.Abs(p); err == nil && p != "" {
+			skip[abs] = true
+		}
+	}
+
+	matches, err := filepath.Glob(filepath.Join(srcDir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var updated []string
+	for _, m := range matches {
+		if abs, err := filepath.Abs(m); err == nil && skip[abs] {
+			continue
+		}
+		changed, err := qualifyMovedSymbols(m, moved, pkgName, importPath)
+		if err != nil {
+			return updated, err
+		}
+		if changed {
+			updated = append(updated, filepath.Base(m))
+		}
+	}
+	return updated, nil
+}
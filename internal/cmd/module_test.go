@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+func TestImportPathFor(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/demo\n\ngo 1.21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "internal", "store")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := importPathFor(sub)
+	if err != nil {
+		t.Fatalf("importPathFor() error = %v", err)
+	}
+	if want := "example.com/demo/internal/store"; got != want {
+		t.Errorf("importPathFor() = %q, want %q", got, want)
+	}
+
+	if got, _ := importPathFor(root); got != "example.com/demo" {
+		t.Errorf("importPathFor(root) = %q, want example.com/demo", got)
+	}
+}
+
+func TestPackageNameFor(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "my-store2")
+	if got := packageNameFor(empty); got != "mystore2" {
+		t.Errorf("packageNameFor(new dir) = %q, want mystore2", got)
+	}
+
+	existing := t.TempDir()
+	if err := os.WriteFile(filepath.Join(existing, "a.go"), []byte("package custom\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := packageNameFor(existing); got != "custom" {
+		t.Errorf("packageNameFor(existing) = %q, want custom", got)
+	}
+}
+
+func TestPackageMismatch(t *testing.T) {
+	tests := []struct {
+		pkg, dir string
+		want     bool
+	}{
+		{"store", "/src/store", false},
+		{"gosplit", "/src/go-split", false},
+		{"store", "/src/store/v2", false},
+		{"main", "/src/cmd/tool", false},
+		{"store_test", "/src/other", false},
+		{"bar", "/src/foo", true},
+	}
+	for _, tt := range tests {
+		if got := packageMismatch(tt.pkg, tt.dir); got != tt.want {
+			t.Errorf("packageMismatch(%q, %q) = %v, want %v", tt.pkg, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSetPackageName(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"// Doc.\npackage main\n\nfunc A() {}\n", "// Doc.\npackage store\n\nfunc A() {}\n"},
+		{"package main_test\n", "package store_test\n"},
+		{"not go", "not go"},
+	}
+	for _, tt := range tests {
+		if got := setPackageName(tt.code, "store"); got != tt.want {
+			t.Errorf("setPackageName(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateImportReferences(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+
+	moved := parseTestSource(t, outDir, "store.go", "package store\n\ntype Store struct{}\n\nfunc NewStore() *Store { return nil }\n\nfunc helper() {}\n")
+	if err := os.WriteFile(filepath.Join(srcDir, "main.go"), []byte(`package main
+
+import "fmt"
+
+func run() {
+	s := NewStore()
+	var other *Store = s
+	fmt.Println(other)
+}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "big.go"), []byte("package main\n\nfunc NewStore() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := updateImportReferences(srcDir, []*analyzer.FileInfo{moved}, "store", "example.com/demo/store", filepath.Join(srcDir, "big.go"))
+	if err != nil {
+		t.Fatalf("updateImportReferences() error = %v", err)
+	}
+	if len(updated) != 1 || updated[0] != "main.go" {
+		t.Fatalf("updated = %v, want [main.go]", updated)
+	}
+
+	data, err := os.ReadFile(filepath.Join(srcDir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{`"example.com/demo/store"`, "store.NewStore()", "*store.Store"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("main.go missing %q:\n%s", want, got)
+		}
+	}
+	if _, err := analyzer.ParseGoFile(filepath.Join(srcDir, "main.go")); err != nil {
+		t.Errorf("rewritten main.go does not parse: %v", err)
+	}
+}
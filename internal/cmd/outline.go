@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadOutline reads a generate --plan-file: a YAML (or JSON) mapping of
+// output file names to the symbols each gets.
+//
+//	handlers.go: [HandleGet, HandlePut, Server.ServeHTTP]
+//	store.go:
+//	  - Store
+//	  - NewStore
+func loadOutline(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading plan file: %w", err)
+	}
+	var outline map[string][]string
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&outline); err != nil {
+		return nil, fmt.Errorf("parsing plan file %s: %w", path, err)
+	}
+	if len(outline) == 0 {
+		return nil, fmt.Errorf("plan file %s lists no files", path)
+	}
+	for name := range outline {
+		if filepath.Base(name) != name || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			return nil, fmt.Errorf("plan file %s: %q is not a .go file name", path, name)
+		}
+	}
+	return outline, nil
+}
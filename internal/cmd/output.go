@@ -2,7 +2,12 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
 
 	"github.com/drewstinnett/gout/v2"
 	"github.com/drewstinnett/gout/v2/formats"
@@ -14,7 +19,9 @@ import (
 
 // outputConfig holds output formatting configuration.
 type outputConfig struct {
-	Format string
+	Format       string
+	TemplateFile string
+	template     *template.Template // Parsed from TemplateFile by validateOutputFlags
 }
 
 var outCfg = &outputConfig{}
@@ -22,15 +29,68 @@ var outCfg = &outputConfig{}
 // BindOutputFlags adds --format flag to a command.
 // This should be called on the root command.
 func BindOutputFlags(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&outCfg.Format, "format", "plain", "Output format: plain, json, yaml, jsonl")
+	cmd.PersistentFlags().StringVar(&outCfg.Format, "format", "plain", "Output format: plain, json, yaml, jsonl, markdown, template, dot (analyze)")
+	cmd.PersistentFlags().StringVar(&outCfg.TemplateFile, "template-file", "", "Go text/template file used with --format=template")
+}
+
+// templateFuncs are the helpers available to --format=template templates,
+// in addition to the text/template builtins (printf, len, index, ...).
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.MarshalIndent(v, "", "  ")
+		return string(b), err
+	},
+}
+
+// validateOutputFlags checks output flags before a command runs, so a bad
+// template fails fast instead of after expensive work.
+func validateOutputFlags() error {
+	outCfg.template = nil
+	if outCfg.Format != "template" {
+		return nil
+	}
+	if outCfg.TemplateFile == "" {
+		return fmt.Errorf("--format=template requires --template-file")
+	}
+	text, err := os.ReadFile(outCfg.TemplateFile)
+	if err != nil {
+		return fmt.Errorf("reading template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(outCfg.TemplateFile)).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("parsing template: %w", err)
+	}
+	outCfg.template = tmpl
+	return nil
 }
 
 // PrintOutput prints data in the configured format.
+//
+// Result types must serialize deterministically so output can be diffed and
+// snapshot-tested: use slices sorted by a stable key (e.g. []SymbolLocation)
+// rather than maps, whose ordering varies between formatters.
 func PrintOutput(w io.Writer, data interface{}) error {
 	// Handle JSONL specially since gout doesn't have it built-in
 	if outCfg.Format == "jsonl" {
 		return printJSONL(w, data)
 	}
+	if outCfg.Format == "template" && outCfg.template != nil {
+		return outCfg.template.Execute(w, data)
+	}
+	if outCfg.Format == "markdown" {
+		return printMarkdown(w, data)
+	}
+	if outCfg.Format == "dot" {
+		r, ok := data.(dotReport)
+		if !ok {
+			return fmt.Errorf("--format=dot is only supported by analyze of a single file")
+		}
+		_, err := io.WriteString(w, r.DOT())
+		return err
+	}
 
 	// Use gout for standard formats
 	g := gout.New(gout.WithWriter(w))
@@ -52,6 +112,27 @@ func PrintOutput(w io.Writer, data interface{}) error {
 	return g.Print(data)
 }
 
+// markdownReport is implemented by results with a Markdown rendering for
+// --format=markdown, such as a table to post as a PR comment.
+type markdownReport interface {
+	Markdown() string
+}
+
+// printMarkdown prints data's Markdown rendering, or data as a fenced JSON
+// block if it has none, so the output is always self-contained Markdown.
+func printMarkdown(w io.Writer, data interface{}) error {
+	if r, ok := data.(markdownReport); ok {
+		_, err := io.WriteString(w, r.Markdown())
+		return err
+	}
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "```json\n%s\n```\n", b)
+	return err
+}
+
 // printJSONL prints data as a JSON line (for streaming).
 func printJSONL(w io.Writer, data interface{}) error {
 	enc := json.NewEncoder(w)
@@ -61,7 +142,7 @@ func printJSONL(w io.Writer, data interface{}) error {
 // IsStructuredOutput returns true if the output format is structured (JSON, YAML, etc.)
 func IsStructuredOutput() bool {
 	switch outCfg.Format {
-	case "json", "yaml", "toml", "jsonl":
+	case "json", "yaml", "toml", "jsonl", "markdown", "template", "dot":
 		return true
 	default:
 		return false
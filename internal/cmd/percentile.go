@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// PercentileResult holds analyze --percentile results for JSON output.
+type PercentileResult struct {
+	Percentile float64 `json:"percentile"`
+	Threshold  float64 `json:"threshold"` // Lines at the percentile
+	Files      int     `json:"files"`     // Files measured
+	// Candidates are the files above the threshold, largest first.
+	Candidates []SizeCandidate `json:"candidates"`
+}
+
+// SizeCandidate is a file large enough to be worth splitting.
+type SizeCandidate struct {
+	File  string `json:"file"`
+	Lines int    `json:"lines"`
+}
+
+// percentile returns the p-th percentile (0-100) of sorted, interpolating
+// linearly between the closest ranks.
+func percentile(sorted []int, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return float64(sorted[lo]) + (rank-float64(lo))*float64(sorted[hi]-sorted[lo])
+}
+
+// runPercentile lists the non-test Go files of the targets whose line
+// count is above the --percentile of them all.
+func runPercentile(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+
+	p := anaCfg.Percentile
+	if p <= 0 || p >= 100 {
+		return &usageError{err: fmt.Errorf("--percentile must be between 0 and 100, got %g", p)}
+	}
+	if anaCfg.Budget != "" || anaCfg.Since != "" {
+		return &usageError{err: fmt.Errorf("--percentile cannot be combined with --budget or --since")}
+	}
+	infos, err := budgetTargets(args)
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return fmt.Errorf("no Go files to measure")
+	}
+
+	sizes := make([]int, len(infos))
+	for i, info := range infos {
+		sizes[i] = info.Lines
+	}
+	sort.Ints(sizes)
+
+	result := PercentileResult{Percentile: p, Threshold: percentile(sizes, p), Files: len(infos), Candidates: []SizeCandidate{}}
+	for _, info := range infos {
+		if float64(info.Lines) > result.Threshold {
+			result.Candidates = append(result.Candidates, SizeCandidate{File: info.Path, Lines: info.Lines})
+		}
+	}
+	sort.SliceStable(result.Candidates, func(i, j int) bool { return result.Candidates[i].Lines > result.Candidates[j].Lines })
+
+	if IsStructuredOutput() {
+		return PrintOutput(cmd.OutOrStdout(), result)
+	}
+
+	ui.Header(fmt.Sprintf("📊 %d Go files, p%g = %.0f lines", result.Files, p, result.Threshold))
+	if len(result.Candidates) == 0 {
+		ui.Success(fmt.Sprintf("No file is above p%g", p))
+		return nil
+	}
+	for _, c := range result.Candidates {
+		cmd.Printf("   %s: %d lines\n", c.File, c.Lines)
+	}
+	cmd.Println()
+	ui.Info(fmt.Sprintf("%d split candidates above p%g", len(result.Candidates), p))
+	return nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// maxPackageContext caps the size of the sibling-file summary added to the
+// planning prompt, so large packages don't crowd out the file being split.
+const maxPackageContext = 4000
+
+// packageContext summarizes the declarations of the other non-test files in
+// dir, one file per block, skipping the file being split. Files beyond
+// limit bytes are counted but not listed.
+func packageContext(dir, skip string, limit int) (string, error) {
+	infos, err := analyzer.ParsePackage(dir)
+	if err != nil {
+		return "", err
+	}
+	return summarizeFiles(infos, skip, limit), nil
+}
+
+// existingPackageFiles returns the names of the non-test Go files already
+// in outDir, and a summary of their declarations for the planning prompt,
+// when outDir is not the directory of source: a split into an existing
+// package must neither recreate those files nor duplicate their symbols.
+func existingPackageFiles(outDir, source string, limit int) ([]string, string, error) {
+	srcAbs, _ := filepath.Abs(filepath.Dir(source))
+	outAbs, _ := filepath.Abs(outDir)
+	if srcAbs == outAbs {
+		return nil, "", nil
+	}
+	infos, err := analyzer.ParsePackage(outDir)
+	if err != nil {
+		return nil, "", err
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = filepath.Base(info.Path)
+	}
+	return names, summarizeFiles(infos, "", limit), nil
+}
+
+// summarizeFiles summarizes infos one file per block, skipping the file
+// named skip. Files beyond limit bytes are counted but not listed.
+func summarizeFiles(infos []*analyzer.FileInfo, skip string, limit int) string {
+	var b strings.Builder
+	omitted := 0
+	for _, info := range infos {
+		if filepath.Base(info.Path) == filepath.Base(skip) {
+			continue
+		}
+		block := summarizeFile(info)
+		if b.Len()+len(block) > limit {
+			omitted++
+			continue
+		}
+		b.WriteString(block)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "... (%d more files omitted)\n", omitted)
+	}
+	return b.String()
+}
+
+// summarizeFile lists a file's top-level declarations by name.
+func summarizeFile(info *analyzer.FileInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", filepath.Base(info.Path))
+	for _, t := range info.Types {
+		fmt.Fprintf(&b, "  type %s %s\n", t.Name, t.Kind)
+	}
+	for _, fn := range info.Functions {
+		if fn.Receiver != "" {
+			fmt.Fprintf(&b, "  func (%s) %s\n", fn.Receiver, fn.Name)
+		} else {
+			fmt.Fprintf(&b, "  func %s\n", fn.Name)
+		}
+	}
+	for _, v := range info.Vars {
+		kind := "const"
+		if v.IsVar {
+			kind = "var"
+		}
+		fmt.Fprintf(&b, "  %s %s\n", kind, v.Name)
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageContext(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go":      "package p\n\ntype Store struct{}\n\nfunc (s *Store) Get() {}\n",
+		"b.go":      "package p\n\nconst Limit = 3\n\nfunc helper() {}\n",
+		"big.go":    "package p\n\nfunc Big() {}\n",
+		"a_test.go": "package p\n\nfunc TestX() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := packageContext(dir, filepath.Join(dir, "big.go"), maxPackageContext)
+	if err != nil {
+		t.Fatalf("packageContext() error = %v", err)
+	}
+	for _, want := range []string{"a.go:\n", "type Store struct", "func (*Store) Get", "b.go:\n", "const Limit", "func helper"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("packageContext() missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "big.go") || strings.Contains(got, "TestX") {
+		t.Errorf("packageContext() includes the split file or tests:\n%s", got)
+	}
+
+	// A tight limit keeps the first file and counts the rest
+	got, err = packageContext(dir, filepath.Join(dir, "big.go"), 60)
+	if err != nil {
+		t.Fatalf("packageContext() error = %v", err)
+	}
+	if !strings.Contains(got, "a.go:") || strings.Contains(got, "b.go:") || !strings.Contains(got, "(1 more files omitted)") {
+		t.Errorf("packageContext() with limit = %q", got)
+	}
+}
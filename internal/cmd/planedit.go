@@ -0,0 +1,461 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// planEditor holds the plan being reviewed with generate --tui: which file
+// each declaration of the source goes to.
+type planEditor struct {
+	primary string            // The source's own file, for what stays
+	files   []string          // Output files in display order, primary first
+	symbols []analyzer.Symbol // Declarations in source order
+	dest    map[string]string // Symbol name -> output file
+	notes   map[string]string // Output file -> planner's description
+}
+
+// newPlanEditor seeds the editor from the AI plan. Declarations the plan
+// names go to its files, methods it leaves out follow their type, and the
+// rest stay in primary.
+func newPlanEditor(primary string, symbols []analyzer.Symbol, plan []SplitFile) *planEditor {
+	e := &planEditor{
+		primary: primary,
+		files:   []string{primary},
+		symbols: symbols,
+		dest:    make(map[string]string),
+		notes:   make(map[string]string),
+	}
+	for _, f := range plan {
+		e.addFile(f.Name)
+		e.notes[f.Name] = f.Description
+		for _, name := range append(slices.Clone(f.Types), f.Functions...) {
+			if sym := e.lookup(name); sym != "" {
+				e.dest[sym] = f.Name
+			}
+		}
+	}
+	for _, sym := range symbols {
+		if _, ok := e.dest[sym.Name]; ok {
+			continue
+		}
+		e.dest[sym.Name] = primary
+		if typ, _, ok := strings.Cut(sym.Name, "."); ok && sym.Kind == "method" {
+			if file, ok := e.dest[typ]; ok {
+				e.dest[sym.Name] = file
+			}
+		}
+	}
+	return e
+}
+
+// addFile adds an output file unless it is already listed.
+func (e *planEditor) addFile(name string) {
+	if !slices.Contains(e.files, name) {
+		e.files = append(e.files, name)
+	}
+}
+
+// lookup resolves a name as typed or planned to a declaration: exactly, or
+// a method by its bare name when only one type declares it.
+func (e *planEditor) lookup(name string) string {
+	var match string
+	for _, sym := range e.symbols {
+		if sym.Name == name {
+			return sym.Name
+		}
+		if _, method, ok := strings.Cut(sym.Name, "."); ok && method == name {
+			if match != "" {
+				return ""
+			}
+			match = sym.Name
+		}
+	}
+	return match
+}
+
+// move assigns a declaration to file. A type brings along the methods
+// that were in the same file as it.
+func (e *planEditor) move(name, file string) error {
+	sym := e.lookup(name)
+	if sym == "" {
+		return fmt.Errorf("no declaration %s", name)
+	}
+	from := e.dest[sym]
+	for _, s := range e.symbols {
+		if typ, _, ok := strings.Cut(s.Name, "."); ok && typ == sym && e.dest[s.Name] == from {
+			e.dest[s.Name] = file
+		}
+	}
+	e.dest[sym] = file
+	e.addFile(file)
+	return nil
+}
+
+// remove drops an output file, returning its declarations to the primary
+// file.
+func (e *planEditor) remove(file string) error {
+	if file == e.primary {
+		return fmt.Errorf("%s is the source file and cannot be removed", file)
+	}
+	i := slices.Index(e.files, file)
+	if i < 0 {
+		return fmt.Errorf("no file %s in the plan", file)
+	}
+	e.files = slices.Delete(e.files, i, i+1)
+	for sym, f := range e.dest {
+		if f == file {
+			e.dest[sym] = e.primary
+		}
+	}
+	return nil
+}
+
+// outline returns the plan as a --plan-file outline: each file other than
+// the primary with the declarations it gets. Empty files are left out.
+func (e *planEditor) outline() map[string][]string {
+	outline := make(map[string][]string)
+	for _, sym := range e.symbols {
+		if file := e.dest[sym.Name]; file != e.primary {
+			outline[file] = append(outline[file], sym.Name)
+		}
+	}
+	return outline
+}
+
+// Terminal control sequences the plan TUI draws with.
+const (
+	escAltScreen  = "\x1b[?1049h\x1b[?25l" // Switch to the alternate screen, hide the cursor
+	escMainScreen = "\x1b[?25h\x1b[?1049l" // Show the cursor, switch back
+	escClear      = "\x1b[H\x1b[2J"
+	escReverse    = "\x1b[7m"
+	escBold       = "\x1b[1m"
+	escDim        = "\x1b[2m"
+	escReset      = "\x1b[0m"
+)
+
+// Keys the plan TUI reads, beyond printable characters. Arrow keys, sent
+// as escape sequences, get negative codes.
+const (
+	keyCtrlC     = 0x03
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+	keyUp        = -1
+	keyDown      = -2
+	keyLeft      = -3
+	keyRight     = -4
+)
+
+// planTUIHelp is the key summary shown under the plan.
+const planTUIHelp = "↑/↓ select · space mark · ←/→ move to previous/next file · 1-9 move to file · n new file · d drop file · enter split · q quit"
+
+// planTUI is the full-screen plan review of generate --tui: every output
+// file with its declarations, a cursor on one declaration, and keys to move
+// the marked declarations (or the one under the cursor) between files.
+type planTUI struct {
+	e      *planEditor
+	order  []analyzer.Symbol // Declarations in source line order
+	cursor string            // Name of the declaration under the cursor
+	marked map[string]bool
+	status string  // Result of the last key, shown under the plan
+	input  *string // Name being typed for a new file, nil when not asking
+	width  int
+	height int
+}
+
+// reviewPlan runs the plan TUI on the terminal, with standard input in raw
+// mode for the duration, and returns the confirmed outline.
+func reviewPlan(out io.Writer, primary string, symbols []analyzer.Symbol, plan []SplitFile, check func(map[string][]string) error) (map[string][]string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("setting up the terminal: %w", err)
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	return runPlanTUI(os.Stdin, out, width, height, primary, symbols, plan, check)
+}
+
+// runPlanTUI shows the plan full screen on out, reading keys from in, and
+// returns it as an outline once the user confirms it. check vets the
+// outline before it is accepted, so a plan the splitter rejects can be
+// fixed without starting over. in is expected to be a terminal in raw mode
+// of width by height cells.
+func runPlanTUI(in io.Reader, out io.Writer, width, height int, primary string, symbols []analyzer.Symbol, plan []SplitFile, check func(map[string][]string) error) (map[string][]string, error) {
+	t := &planTUI{
+		e:      newPlanEditor(primary, symbols, plan),
+		order:  slices.Clone(symbols),
+		marked: make(map[string]bool),
+		width:  width,
+		height: height,
+	}
+	sort.SliceStable(t.order, func(i, j int) bool { return t.order[i].Line < t.order[j].Line })
+	if rows := t.rows(); len(rows) > 0 {
+		t.cursor = rows[0]
+	}
+
+	fmt.Fprint(out, escAltScreen)
+	defer fmt.Fprint(out, escMainScreen)
+	keys := bufio.NewReader(in)
+	for {
+		t.draw(out)
+		key, err := readKey(keys)
+		if err != nil {
+			return nil, fmt.Errorf("aborted: plan not confirmed")
+		}
+		outline, done, err := t.handle(key, check)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return outline, nil
+		}
+	}
+}
+
+// readKey reads one key press: a byte, or an arrow key's escape sequence.
+// An escape not followed at once by the rest of a sequence is the Escape
+// key itself.
+func readKey(r *bufio.Reader) (rune, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != keyEscape || r.Buffered() == 0 {
+		return rune(b), nil
+	}
+	next, _ := r.ReadByte()
+	if next != '[' && next != 'O' {
+		_ = r.UnreadByte()
+		return keyEscape, nil
+	}
+	final, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch final {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	}
+	return keyEscape, nil // Other sequences are ignored as a bare Escape
+}
+
+// rows returns the declarations in display order: file by file, each in
+// source order.
+func (t *planTUI) rows() []string {
+	var rows []string
+	for _, file := range t.e.files {
+		for _, sym := range t.order {
+			if t.e.dest[sym.Name] == file {
+				rows = append(rows, sym.Name)
+			}
+		}
+	}
+	return rows
+}
+
+// selection returns the declarations a move applies to: the marked ones,
+// or the one under the cursor.
+func (t *planTUI) selection() []string {
+	var names []string
+	for _, sym := range t.order {
+		if t.marked[sym.Name] {
+			names = append(names, sym.Name)
+		}
+	}
+	if len(names) == 0 && t.cursor != "" {
+		names = []string{t.cursor}
+	}
+	return names
+}
+
+// moveTo moves the selection to file and clears the marks.
+func (t *planTUI) moveTo(file string) {
+	names := t.selection()
+	for _, name := range names {
+		if err := t.e.move(name, file); err != nil {
+			t.status = "✗ " + err.Error()
+			return
+		}
+	}
+	t.marked = make(map[string]bool)
+	t.status = fmt.Sprintf("Moved %s to %s", strings.Join(names, ", "), file)
+}
+
+// handle applies one key. It reports done with the outline once the plan
+// is confirmed, and an error once the user gives up.
+func (t *planTUI) handle(key rune, check func(map[string][]string) error) (map[string][]string, bool, error) {
+	if t.input != nil {
+		t.handleInput(key)
+		return nil, false, nil
+	}
+
+	t.status = ""
+	rows := t.rows()
+	at := slices.Index(rows, t.cursor)
+	file := t.e.dest[t.cursor]
+	fileAt := slices.Index(t.e.files, file)
+	switch {
+	case key == 'q' || key == keyCtrlC || key == keyEscape:
+		return nil, false, fmt.Errorf("aborted: plan not confirmed")
+	case key == keyUp || key == 'k':
+		if at > 0 {
+			t.cursor = rows[at-1]
+		}
+	case key == keyDown || key == 'j':
+		if at >= 0 && at < len(rows)-1 {
+			t.cursor = rows[at+1]
+		}
+	case key == ' ':
+		if t.cursor != "" {
+			t.marked[t.cursor] = !t.marked[t.cursor]
+		}
+	case key == keyLeft || key == 'h':
+		if fileAt > 0 {
+			t.moveTo(t.e.files[fileAt-1])
+		}
+	case key == keyRight || key == 'l':
+		if fileAt >= 0 && fileAt < len(t.e.files)-1 {
+			t.moveTo(t.e.files[fileAt+1])
+		}
+	case key >= '1' && key <= '9':
+		if n := int(key - '1'); n < len(t.e.files) {
+			t.moveTo(t.e.files[n])
+		} else {
+			t.status = fmt.Sprintf("✗ no file %c", key)
+		}
+	case key == 'n':
+		name := ""
+		t.input = &name
+	case key == 'd':
+		if err := t.e.remove(file); err != nil {
+			t.status = "✗ " + err.Error()
+		} else {
+			t.status = fmt.Sprintf("Dropped %s", file)
+		}
+	case key == '\r' || key == '\n':
+		outline := t.e.outline()
+		if len(outline) == 0 {
+			t.status = fmt.Sprintf("✗ every declaration stays in %s; move some or quit", t.e.primary)
+			break
+		}
+		if err := check(outline); err != nil {
+			t.status = "✗ " + err.Error()
+			break
+		}
+		return outline, true, nil
+	}
+	return nil, false, nil
+}
+
+// handleInput edits the name of a new file; enter moves the selection to
+// it and Escape or Ctrl-C cancels.
+func (t *planTUI) handleInput(key rune) {
+	name := *t.input
+	switch {
+	case key == keyEscape || key == keyCtrlC:
+		t.input = nil
+	case key == '\r' || key == '\n':
+		if filepath.Base(name) != name || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			t.status = fmt.Sprintf("✗ %q is not a .go file name", name)
+			return
+		}
+		t.input = nil
+		t.moveTo(name)
+	case key == keyBackspace || key == '\b':
+		if name != "" {
+			_, size := utf8.DecodeLastRuneInString(name)
+			*t.input = name[:len(name)-size]
+		}
+	case key >= ' ' && key < keyBackspace:
+		*t.input = name + string(key)
+	}
+}
+
+// draw renders the whole screen: a title, the plan scrolled to keep the
+// cursor in view, the status line and the key summary.
+func (t *planTUI) draw(out io.Writer) {
+	var lines []string
+	cursorLine := 0
+	for i, file := range t.e.files {
+		header := fmt.Sprintf("%d %s", i+1, file)
+		switch {
+		case file == t.e.primary:
+			header += " (stays)"
+		case t.e.notes[file] != "":
+			header += " - " + t.e.notes[file]
+		}
+		lines = append(lines, escBold+t.fit(header)+escReset)
+		empty := true
+		for _, sym := range t.order {
+			if t.e.dest[sym.Name] != file {
+				continue
+			}
+			empty = false
+			mark := "[ ]"
+			if t.marked[sym.Name] {
+				mark = "[x]"
+			}
+			line := t.fit(fmt.Sprintf("    %s %s %s", mark, sym.Name, sym.Kind))
+			if sym.Name == t.cursor {
+				cursorLine = len(lines)
+				line = escReverse + line + escReset
+			}
+			lines = append(lines, line)
+		}
+		if empty {
+			lines = append(lines, escDim+"    (empty)"+escReset)
+		}
+	}
+
+	// Title, blank line, status and help take four rows
+	view := max(t.height-4, 1)
+	top := 0
+	if cursorLine >= view {
+		top = cursorLine - view + 1
+	}
+	lines = lines[top:min(top+view, len(lines))]
+
+	status := t.status
+	if t.input != nil {
+		status = "New file name: " + *t.input + "█"
+	}
+	var b strings.Builder
+	b.WriteString(escClear)
+	b.WriteString(escBold + t.fit("go-split plan for "+t.e.primary) + escReset + "\r\n\r\n")
+	for _, line := range lines {
+		b.WriteString(line + "\r\n")
+	}
+	b.WriteString("\r\n" + t.fit(status) + "\r\n")
+	b.WriteString(escDim + t.fit(planTUIHelp) + escReset)
+	fmt.Fprint(out, b.String())
+}
+
+// fit cuts s to the screen width.
+func (t *planTUI) fit(s string) string {
+	if t.width <= 0 || utf8.RuneCountInString(s) <= t.width {
+		return s
+	}
+	return string([]rune(s)[:t.width])
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// Arrow keys as a terminal sends them.
+const (
+	arrowUp    = "\x1b[A"
+	arrowDown  = "\x1b[B"
+	arrowRight = "\x1b[C"
+	arrowLeft  = "\x1b[D"
+)
+
+func TestPlanTUI(t *testing.T) {
+	src := `package shop
+
+type Store struct{}
+
+func NewStore() *Store { return &Store{} }
+
+func (s *Store) Get() {}
+
+func (s *Store) Put() {}
+
+func Handle() {}
+
+func main() {}
+`
+	info, err := analyzer.ParseGoSource("shop.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := []SplitFile{
+		{Name: "store.go", Description: "Persistence", Types: []string{"Store"}, Functions: []string{"NewStore", "Put"}},
+		{Name: "util.go", Functions: []string{"Handle"}},
+	}
+
+	var checked []map[string][]string
+	check := func(outline map[string][]string) error {
+		checked = append(checked, outline)
+		if len(checked) == 1 {
+			return fmt.Errorf("not yet")
+		}
+		return nil
+	}
+	// Rows start as shop.go: main; store.go: Store, NewStore, Store.Get,
+	// Store.Put; util.go: Handle. New files are listed last.
+	keys := strings.Join([]string{
+		" ",                       // mark main
+		arrowDown, arrowDown, " ", // and NewStore
+		"nhandlers.gx\x7fo\r", // into a new file; both move
+		"\r",                  // rejected by check
+		arrowUp, arrowUp,      // Store.Put, past Handle
+		"nap\x1bnapi.go\r",         // escape cancels the first name
+		strings.Repeat(arrowUp, 5), // the cursor follows Store.Put; up to Store
+		arrowLeft,                  // Store to shop.go, with Store.Get
+		arrowRight,                 // and back to store.go
+		"3d",                       // Store to util.go, then drop util.go
+		"\r",
+	}, "")
+
+	var out bytes.Buffer
+	outline, err := runPlanTUI(strings.NewReader(keys), &out, 80, 24, "shop.go", info.Symbols(), plan, check)
+	if err != nil {
+		t.Fatalf("runPlanTUI() error = %v\n%s", err, out.String())
+	}
+	want := map[string][]string{
+		"handlers.go": {"NewStore", "main"},
+		"api.go":      {"Store.Put"},
+	}
+	if !reflect.DeepEqual(outline, want) {
+		t.Errorf("runPlanTUI() = %v, want %v", outline, want)
+	}
+	if len(checked) != 2 {
+		t.Errorf("check called %d times, want 2", len(checked))
+	}
+	for _, msg := range []string{"2 store.go - Persistence", "✗ not yet", "Dropped util.go", "\x1b[?1049l"} {
+		if !strings.Contains(out.String(), msg) {
+			t.Errorf("output lacks %q:\n%s", msg, out.String())
+		}
+	}
+
+	// Running out of keys is not a confirmation, and q quits
+	for _, keys := range []string{"1", "q\r"} {
+		if _, err := runPlanTUI(strings.NewReader(keys), &out, 80, 24, "shop.go", info.Symbols(), plan, check); err == nil {
+			t.Errorf("runPlanTUI(%q) succeeded, want it aborted", keys)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cmd
+
+import "os/exec"
+
+// killGroupOnCancel leaves cmd's default cancellation, which kills only
+// cmd itself; cmd.WaitDelay bounds the wait for its children.
+func killGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// promptData is the data available to user-supplied prompt templates.
+type promptData struct {
+	Filename     string // File being planned (source) or generated (target)
+	Content      string // Source file content
+	TestFilename string // Associated test file, if any
+	TestContent  string // Test file content, if any
+	// PackageContext summarizes the package's other files (--with-package-context)
+	PackageContext string
+	// ExistingFiles summarizes the files already in an output directory
+	// other than the source's
+	ExistingFiles string
+	// InitFuncs counts the source's init functions, which should stay together
+	InitFuncs int
+}
+
+// loadPromptTemplate parses the template at path and checks that every
+// required field (e.g. "Content") is referenced somewhere in it.
+func loadPromptTemplate(path string, required ...string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading prompt template: %w", err)
+	}
+
+	tmpl, err := template.New(path).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("parsing prompt template %s: %w", path, err)
+	}
+
+	fields := make(map[string]bool)
+	if tmpl.Tree != nil {
+		collectTemplateFields(tmpl.Tree.Root, fields)
+	}
+
+	var missing []string
+	for _, f := range required {
+		if !fields[f] {
+			missing = append(missing, "{{."+f+"}}")
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("prompt template %s is missing required placeholders: %s", path, strings.Join(missing, ", "))
+	}
+
+	// Catch references to unknown fields before any API call is made
+	if err := tmpl.Execute(io.Discard, promptData{}); err != nil {
+		return nil, fmt.Errorf("prompt template %s: %w", path, err)
+	}
+
+	return tmpl, nil
+}
+
+// renderPrompt executes tmpl with data.
+func renderPrompt(tmpl *template.Template, data promptData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("rendering prompt template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// collectTemplateFields records the top-level field names referenced in node.
+func collectTemplateFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		collectTemplateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			collectTemplateFields(c, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectTemplateFields(arg, fields)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) > 0 {
+			fields[n.Ident[0]] = true
+		}
+	case *parse.IfNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.RangeNode:
+		collectBranchFields(&n.BranchNode, fields)
+	case *parse.WithNode:
+		collectBranchFields(&n.BranchNode, fields)
+	}
+}
+
+func collectBranchFields(n *parse.BranchNode, fields map[string]bool) {
+	collectTemplateFields(n.Pipe, fields)
+	collectTemplateFields(n.List, fields)
+	if n.ElseList != nil {
+		collectTemplateFields(n.ElseList, fields)
+	}
+}
+
+// previewPlaceholder stands in for the generated file names in
+// --prompt-preview, as they are only known once the plan is made.
+const previewPlaceholder = "<planned file>.go"
+
+// previewPrompts writes the planning prompt for data and the generation
+// prompt for a placeholder file to w, as --prompt-preview.
+func previewPrompts(w io.Writer, data promptData, content, testContent []byte, testInfo *analyzer.FileInfo, planTmpl, genTmpl *template.Template, hasTests bool) error {
+	planPrompt, err := buildPlanPrompt(data, planTmpl, hasTests, cfg.DryRun)
+	if err != nil {
+		return err
+	}
+	genPrompt, err := buildGeneratePrompt(previewPlaceholder, content, testContent, testInfo, genTmpl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "===== %s prompt: %s (%d chars) =====\n%s\n", phasePlan, data.Filename, len(planPrompt), planPrompt)
+	fmt.Fprintf(w, "===== %s prompt: %s (%d chars) =====\n%s\n", phaseGenerate, previewPlaceholder, len(genPrompt), genPrompt)
+	return nil
+}
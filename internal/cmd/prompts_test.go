@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePromptFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prompt.tmpl")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPromptTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		required []string
+		wantErr  string
+	}{
+		{
+			name:     "all placeholders present",
+			content:  "Split {{.Filename}}:\n{{.Content}}",
+			required: []string{"Content", "Filename"},
+		},
+		{
+			name:     "placeholder inside conditional",
+			content:  "{{if .TestContent}}Tests:\n{{.TestContent}}{{end}}\n{{.Content}}",
+			required: []string{"Content"},
+		},
+		{
+			name:     "missing required placeholder",
+			content:  "Split this file please",
+			required: []string{"Content"},
+			wantErr:  "{{.Content}}",
+		},
+		{
+			name:     "unknown field",
+			content:  "{{.Content}} {{.Bogus}}",
+			required: []string{"Content"},
+			wantErr:  "Bogus",
+		},
+		{
+			name:     "syntax error",
+			content:  "{{.Content",
+			required: []string{"Content"},
+			wantErr:  "parsing prompt template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadPromptTemplate(writePromptFile(t, tt.content), tt.required...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("loadPromptTemplate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadPromptTemplate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	tmpl, err := loadPromptTemplate(writePromptFile(t, "File {{.Filename}}:\n{{.Content}}"), "Content", "Filename")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := renderPrompt(tmpl, promptData{Filename: "big.go", Content: "package foo"})
+	if err != nil {
+		t.Fatalf("renderPrompt() error = %v", err)
+	}
+	if want := "File big.go:\npackage foo"; got != want {
+		t.Errorf("renderPrompt() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildPlanPrompt_InitFuncs(t *testing.T) {
+	data := promptData{Filename: "main.go", Content: "package main"}
+	got, err := buildPlanPrompt(data, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "INIT FUNCTIONS") {
+		t.Errorf("prompt mentions init functions the file lacks:\n%s", got)
+	}
+
+	data.InitFuncs = 3
+	if got, err = buildPlanPrompt(data, nil, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "main.go declares 3 init function(s)") {
+		t.Errorf("prompt does not point out the init functions:\n%s", got)
+	}
+}
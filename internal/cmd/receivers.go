@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// ReceiverIssue describes a type whose methods use more than one receiver name.
+type ReceiverIssue struct {
+	Type      string   `json:"type"`
+	Preferred string   `json:"preferred"` // Most common receiver name
+	Names     []string `json:"names"`     // All receiver names in use
+	Methods   []string `json:"methods"`   // Offending methods as "file: (name) Method"
+}
+
+// lintReceivers groups methods across files by receiver type and reports
+// types whose methods disagree on the receiver name. Unnamed and blank
+// receivers are ignored.
+func lintReceivers(infos []*analyzer.FileInfo) []ReceiverIssue {
+	type method struct {
+		file string
+		fn   analyzer.FuncInfo
+	}
+	byType := make(map[string][]method)
+	for _, info := range infos {
+		for _, fn := range info.Functions {
+			if fn.Receiver == "" || fn.ReceiverName == "" || fn.ReceiverName == "_" {
+				continue
+			}
+			typ := fn.ReceiverType()
+			byType[typ] = append(byType[typ], method{file: filepath.Base(info.Path), fn: fn})
+		}
+	}
+
+	var issues []ReceiverIssue
+	for typ, methods := range byType {
+		counts := make(map[string]int)
+		for _, m := range methods {
+			counts[m.fn.ReceiverName]++
+		}
+		if len(counts) < 2 {
+			continue
+		}
+
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		preferred := names[0]
+		for _, name := range names {
+			if counts[name] > counts[preferred] {
+				preferred = name
+			}
+		}
+
+		issue := ReceiverIssue{Type: typ, Preferred: preferred, Names: names}
+		for _, m := range methods {
+			if m.fn.ReceiverName != preferred {
+				issue.Methods = append(issue.Methods, fmt.Sprintf("%s: (%s) %s", m.file, m.fn.ReceiverName, m.fn.Name))
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Type < issues[j].Type })
+	return issues
+}
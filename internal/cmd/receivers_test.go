@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+func TestLintReceivers(t *testing.T) {
+	dir := t.TempDir()
+	a := parseTestSource(t, dir, "a.go", `package foo
+
+type Server struct{}
+
+func (s *Server) Start() {}
+
+func (s *Server) Stop() {}
+
+type Client struct{}
+
+func (c *Client) Call() {}
+
+func (Client) Close() {}
+`)
+	b := parseTestSource(t, dir, "b.go", `package foo
+
+func (self *Server) Restart() {}
+
+func (_ *Client) Reset() {}
+`)
+
+	got := lintReceivers([]*analyzer.FileInfo{a, b})
+	want := []ReceiverIssue{{
+		Type:      "Server",
+		Preferred: "s",
+		Names:     []string{"s", "self"},
+		Methods:   []string{"b.go: (self) Restart"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lintReceivers() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// maxRemoteInputBytes caps the size of source fetched from a URL.
+const maxRemoteInputBytes = 10 << 20
+
+// gitInputPrefix marks an input read from git: "git:<ref>:<path>".
+const gitInputPrefix = "git:"
+
+// isRemoteInput reports whether arg names source outside the working tree:
+// a git object ("git:HEAD~1:path/to/file.go") or an http(s) URL.
+func isRemoteInput(arg string) bool {
+	return strings.HasPrefix(arg, gitInputPrefix) || strings.HasPrefix(arg, "https://") || strings.HasPrefix(arg, "http://")
+}
+
+// isLocalInput reports whether arg is a file on disk, as opposed to stdin
+// or a remote input, so that it has a directory, package and tests around
+// it.
+func isLocalInput(arg string) bool {
+	return arg != "-" && !isRemoteInput(arg)
+}
+
+// readRemoteInput fetches the source named by a remote input. The filename
+// is the base name of the path in it, or --stdin-name when that doesn't end
+// in .go.
+func readRemoteInput(arg string) (filename string, content []byte, err error) {
+	var name string
+	if rest, ok := strings.CutPrefix(arg, gitInputPrefix); ok {
+		ref, file, ok := strings.Cut(rest, ":")
+		if !ok || ref == "" || file == "" {
+			return "", nil, &usageError{err: fmt.Errorf("git input must be git:<ref>:<path>, got %q", arg)}
+		}
+		name = file
+		content, err = readGitObject(ref, file)
+	} else {
+		name = strings.SplitN(arg, "?", 2)[0]
+		content, err = fetchURL(arg)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	filename = path.Base(name)
+	if path.Ext(filename) != ".go" {
+		filename = cfg.StdinName
+	}
+	return filename, content, nil
+}
+
+// readGitObject returns the content of file at ref in the repository
+// around the working directory, like git show <ref>:<file>.
+func readGitObject(ref, file string) ([]byte, error) {
+	out, err := exec.Command("git", "show", ref+":"+file).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("reading %s at %s: %s", file, ref, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("reading %s at %s: %w", file, ref, err)
+	}
+	return out, nil
+}
+
+// fetchURL downloads url within the API timeout, refusing responses over
+// maxRemoteInputBytes.
+func fetchURL(url string) ([]byte, error) {
+	client := &http.Client{Timeout: cfg.Timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteInputBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	if len(content) > maxRemoteInputBytes {
+		return nil, fmt.Errorf("fetching %s: larger than %d MiB", url, maxRemoteInputBytes>>20)
+	}
+	return content, nil
+}
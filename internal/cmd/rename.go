@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// RenameResult holds the renames made (or planned, with --dry-run).
+type RenameResult struct {
+	Dir     string       `json:"dir"`
+	Scheme  string       `json:"scheme"`
+	DryRun  bool         `json:"dry_run"`
+	Renames []FileRename `json:"renames"`
+}
+
+// FileRename is one file renamed to follow the scheme.
+type FileRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// renameConfig holds rename-specific configuration.
+type renameConfig struct {
+	Scheme string
+}
+
+var renCfg = &renameConfig{}
+
+// renameSchemes maps each --scheme to the function converting a file name
+// stem to it.
+var renameSchemes = map[string]func(string) string{
+	"snake": snakeCase,
+	"lower": func(s string) string { return strings.ReplaceAll(snakeCase(s), "_", "") },
+}
+
+// Build constraint suffixes that must survive a rename (see go/build).
+var (
+	knownOS = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios",
+		"js", "linux", "nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows", "zos"}
+	knownArch = []string{"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64",
+		"mips", "mipsle", "mips64", "mips64le", "mips64p32", "mips64p32le", "ppc", "ppc64", "ppc64le",
+		"riscv", "riscv64", "s390", "s390x", "sparc", "sparc64", "wasm"}
+)
+
+// newRenameCmd creates the rename command.
+func newRenameCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rename <dir>",
+		Short: "Rename Go files in a directory to a naming scheme",
+		Long: `Rename the .go files in a directory to a consistent naming scheme,
+typically after a split. Only file names change, and a rename that would
+change which builds include a file is refused.
+
+Schemes:
+  snake  HTTPServer.go -> http_server.go (default)
+  lower  HTTPServer.go -> httpserver.go
+
+A _test.go file is renamed together with the file it tests, and build
+constraint suffixes such as _linux or _amd64 are kept. Nothing is renamed
+if any new name would collide with another file or would gain such a
+suffix (ServerLinux.go -> server_linux.go, ServerTest.go -> server_test.go). Use --dry-run to preview.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runRename,
+	}
+
+	cmd.Flags().StringVar(&renCfg.Scheme, "scheme", "snake", "Naming scheme: snake or lower")
+
+	return cmd
+}
+
+func runRename(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+
+	convert, ok := renameSchemes[renCfg.Scheme]
+	if !ok {
+		return &usageError{err: fmt.Errorf("unknown --scheme %q (want snake or lower)", renCfg.Scheme)}
+	}
+	dir := args[0]
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	renames, err := planRenames(dir, convert)
+	if err != nil {
+		return err
+	}
+	result := RenameResult{Dir: dir, Scheme: renCfg.Scheme, DryRun: cfg.DryRun, Renames: renames}
+
+	if !cfg.DryRun {
+		for _, r := range renames {
+			if err := os.Rename(filepath.Join(dir, r.From), filepath.Join(dir, r.To)); err != nil {
+				return fmt.Errorf("renaming %s: %w", r.From, err)
+			}
+		}
+	}
+
+	if IsStructuredOutput() {
+		return PrintOutput(cmd.OutOrStdout(), result)
+	}
+
+	ui.Header(fmt.Sprintf("✏️  Renaming Go files in %s (%s)", dir, renCfg.Scheme))
+	for _, r := range renames {
+		cmd.Printf("   %s → %s\n", r.From, r.To)
+	}
+	switch {
+	case len(renames) == 0:
+		ui.Success("All files already follow the scheme")
+	case cfg.DryRun:
+		ui.Info(fmt.Sprintf("Would rename %d file(s) (dry run)", len(renames)))
+	default:
+		ui.Success(fmt.Sprintf("Renamed %d file(s)", len(renames)))
+	}
+	return nil
+}
+
+// planRenames works out the new name of each .go file in dir. Test files
+// follow the file they test, so a pair stays a pair; test files without a
+// source file are converted on their own. Fails without renaming anything
+// if two files would get the same name or a new name is already taken.
+func planRenames(dir string, convert func(string) string) ([]FileRename, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, fmt.Errorf("finding files: %w", err)
+	}
+	sort.Strings(matches)
+
+	targets := make(map[string]string) // new name -> old name
+	var renames []FileRename
+	add := func(from, to string) error {
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("%s and %s would both be renamed to %s", other, from, to)
+		}
+		targets[to] = from
+		if from != to {
+			renames = append(renames, FileRename{From: from, To: to})
+		}
+		return nil
+	}
+
+	paired := make(map[string]bool)
+	for _, path := range matches {
+		name := filepath.Base(path)
+		if isTestFile(name) {
+			continue
+		}
+		to, err := renameFile(name, convert)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(name, to); err != nil {
+			return nil, err
+		}
+		if test := findTestFile(path); test != "" {
+			paired[filepath.Base(test)] = true
+			if err := add(filepath.Base(test), testFileFor(to)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, path := range matches {
+		name := filepath.Base(path)
+		if isTestFile(name) && !paired[name] {
+			to, err := renameFile(name, convert)
+			if err != nil {
+				return nil, err
+			}
+			if err := add(name, to); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Renaming onto a file that moves away too would depend on the order
+	for _, r := range renames {
+		if slices.ContainsFunc(matches, func(m string) bool { return filepath.Base(m) == r.To }) {
+			return nil, fmt.Errorf("cannot rename %s: %s already exists", r.From, r.To)
+		}
+	}
+	return renames, nil
+}
+
+// renameFile converts the stem of a .go file name with convert, keeping any
+// _test and GOOS/GOARCH suffix as is. A conversion that would add such a
+// suffix ("ServerLinux.go" -> "server_linux.go") is an error, as it would
+// change which builds include the file.
+func renameFile(name string, convert func(string) string) (string, error) {
+	stem := strings.TrimSuffix(name, ".go")
+	var suffix string
+	if s, ok := strings.CutSuffix(stem, "_test"); ok {
+		stem, suffix = s, "_test"
+	}
+	for _, known := range [][]string{knownArch, knownOS} {
+		i := strings.LastIndex(stem, "_")
+		if i > 0 && slices.Contains(known, stem[i+1:]) {
+			stem, suffix = stem[:i], stem[i:]+suffix
+		}
+	}
+	converted := convert(stem)
+	if i := strings.LastIndex(converted, "_"); i > 0 {
+		if word := converted[i+1:]; word == "test" || slices.Contains(knownOS, word) || slices.Contains(knownArch, word) {
+			return "", fmt.Errorf("cannot rename %s to %s: the _%s suffix would change which builds include it", name, converted+suffix+".go", word)
+		}
+	}
+	return converted + suffix + ".go", nil
+}
+
+// snakeCase converts s to lower snake case, splitting words at case changes
+// ("HTTPServer" -> "http_server") and at hyphens, spaces and underscores.
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	sep := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+			b.WriteByte('_')
+		}
+	}
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ':
+			sep()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				sep()
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
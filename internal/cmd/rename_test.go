@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenameFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		scheme  string
+		want    string
+		wantErr bool
+	}{
+		{"HTTPServer.go", "snake", "http_server.go", false},
+		{"serverConfig.go", "snake", "server_config.go", false},
+		{"server-config.go", "snake", "server_config.go", false},
+		{"parseV2API.go", "snake", "parse_v2_api.go", false},
+		{"already_snake.go", "snake", "already_snake.go", false},
+		{"HTTPServer_test.go", "snake", "http_server_test.go", false},
+		{"pollFD_linux_amd64.go", "snake", "poll_fd_linux_amd64.go", false},
+		{"pollFD_windows_test.go", "snake", "poll_fd_windows_test.go", false},
+		{"server_config.go", "lower", "serverconfig.go", false},
+		{"HTTPServer_linux.go", "lower", "httpserver_linux.go", false},
+		// Suffixes Go gives meaning to must not appear from the conversion
+		{"ServerLinux.go", "snake", "", true},
+		{"ServerTest.go", "snake", "", true},
+		{"ServerARM64_test.go", "snake", "", true},
+	}
+	for _, tt := range tests {
+		got, err := renameFile(tt.name, renameSchemes[tt.scheme])
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("renameFile(%q, %s) = %q, %v; want %q (error %v)", tt.name, tt.scheme, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRenameCommand(t *testing.T) {
+	newDir := func(names ...string) string {
+		dir := t.TempDir()
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("package demo\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+	list := func(dir string) []string {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for i, m := range matches {
+			matches[i] = filepath.Base(m)
+		}
+		return matches
+	}
+	run := func(args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		err := ExecuteWithArgs(append([]string{"rename"}, args...), &stdout, &stderr)
+		return stdout.String(), err
+	}
+
+	dir := newDir("HTTPServer.go", "HTTPServer_test.go", "orphanHelper_test.go", "util.go")
+	out, err := run("--dry-run", dir)
+	if err != nil {
+		t.Fatalf("rename --dry-run error = %v", err)
+	}
+	if !strings.Contains(out, "HTTPServer_test.go → http_server_test.go") {
+		t.Errorf("dry run output missing the test pair:\n%s", out)
+	}
+	if !slices.Contains(list(dir), "HTTPServer.go") {
+		t.Error("--dry-run renamed files")
+	}
+
+	if _, err := run(dir); err != nil {
+		t.Fatalf("rename error = %v", err)
+	}
+	want := []string{"http_server.go", "http_server_test.go", "orphan_helper_test.go", "util.go"}
+	if got := list(dir); !slices.Equal(got, want) {
+		t.Errorf("files after rename = %v, want %v", got, want)
+	}
+
+	dir = newDir("FooBar.go", "foo_bar.go")
+	if _, err := run(dir); err == nil {
+		t.Error("rename succeeded although two files map to foo_bar.go")
+	}
+	if got := list(dir); len(got) != 2 || !slices.Contains(got, "FooBar.go") {
+		t.Errorf("files after failed rename = %v, want them untouched", got)
+	}
+
+	if _, err := run("--scheme", "camel", dir); ExitCode(err) != ExitUsage {
+		t.Errorf("unknown scheme: exit code %d, want %d", ExitCode(err), ExitUsage)
+	}
+}
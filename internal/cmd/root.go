@@ -2,12 +2,19 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"go/build"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/aaronlippold/go-split/internal/analyzer"
 	"github.com/aaronlippold/go-split/internal/api"
 )
 
@@ -18,11 +25,16 @@ const (
 	defaultEndpoint = "http://localhost:8000/v1/messages"
 	defaultModel    = "claude-sonnet-4-5-20250929"
 	defaultTimeout  = 120 * time.Second
+	// defaultValidateTimeout bounds go test on a split, which may need far
+	// longer than an API call
+	defaultValidateTimeout = 10 * time.Minute
+	// defaultFileMode is the permissions of generated files
+	defaultFileMode = 0644
 )
 
 // Config holds CLI configuration shared across commands.
 type Config struct {
-	Endpoint   string
+	Endpoints  []string // Wrapper endpoints, tried in order
 	Model      string
 	Timeout    time.Duration
 	Verbose    bool
@@ -31,7 +43,25 @@ type Config struct {
 	CaptureDir string
 	APIKey     string
 	NoColor    bool
-	UseWrapper bool // Force wrapper mode even if ANTHROPIC_API_KEY is set
+	UseWrapper bool   // Force wrapper mode even if ANTHROPIC_API_KEY is set
+	BuildTags  string // Comma-separated build tags for constraint matching and go tools
+	Offline    bool   // Run go tools with GOPROXY=off and -mod=readonly
+	AssumeYes  bool   // Answer yes to all confirmation prompts
+	StdinName  string // Logical filename for source read from stdin ("-")
+	JSONErrors bool   // Report failures as {"error","code"} on stdout
+	Stream     bool   // Request server-sent events from the wrapper
+	UsageLog   string // Local file to append a JSON line per run to
+	CacheDir   string // Where API responses and generate --reuse-cache runs are kept
+	NoCache    bool   // Ignore cached API responses and always call the API
+	// MaxConcurrencyAPI caps API calls in flight at once, 0 for no limit
+	MaxConcurrencyAPI int
+	// ModelFallback is tried once when Model stays rate limited or overloaded
+	ModelFallback string
+	// NormalizeEOL strips byte order marks and CRLF line endings from input
+	NormalizeEOL bool
+	// FileMode is the octal permissions of generated files and captures
+	FileMode string
+	fileMode os.FileMode
 	// Check flags
 	SkipFmt    bool
 	SkipVet    bool
@@ -40,6 +70,9 @@ type Config struct {
 	SkipBuild  bool
 	SkipTests  bool
 	SkipChecks bool
+	FailFast   bool
+	FixImports bool
+	Fix        bool // Rewrite files gofmt would change
 }
 
 // Global config instance used by commands
@@ -49,10 +82,11 @@ var cfg = &Config{}
 // This factory function allows creating fresh command trees for testing.
 func NewRootCmd() *cobra.Command {
 	// Reset config to defaults
+	inputLines = 0
 	*cfg = Config{
-		Endpoint: defaultEndpoint,
-		Model:    defaultModel,
-		Timeout:  defaultTimeout,
+		Endpoints: []string{defaultEndpoint},
+		Model:     defaultModel,
+		Timeout:   defaultTimeout,
 	}
 
 	rootCmd := &cobra.Command{
@@ -62,18 +96,43 @@ func NewRootCmd() *cobra.Command {
 into smaller, more focused modules. It can also generate the split files
 and run quality checks.`,
 		Version: Version,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			silenceForJSONErrors(cmd)
+			if err := parseFileMode(); err != nil {
+				return err
+			}
+			return validateOutputFlags()
+		},
 	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		silenceForJSONErrors(cmd)
+		return &usageError{err: err}
+	})
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&cfg.Endpoint, "endpoint", getEnvOrDefault("GO_SPLIT_ENDPOINT", defaultEndpoint), "API endpoint URL")
+	rootCmd.PersistentFlags().StringSliceVar(&cfg.Endpoints, "endpoint", strings.Split(getEnvOrDefault("GO_SPLIT_ENDPOINT", defaultEndpoint), ","), "API endpoint URL; repeat or comma-separate for failover")
 	rootCmd.PersistentFlags().StringVar(&cfg.Model, "model", getEnvOrDefault("GO_SPLIT_MODEL", defaultModel), "Model to use")
+	rootCmd.PersistentFlags().StringVar(&cfg.ModelFallback, "model-fallback", getEnvOrDefault("GO_SPLIT_MODEL_FALLBACK", ""), "Model to try once when --model is still rate limited or overloaded after retries")
+	rootCmd.PersistentFlags().DurationVar(&cfg.Timeout, "timeout", defaultTimeout, "Timeout for each API call")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxConcurrencyAPI, "max-concurrency-api", 0, "Maximum API calls in flight at once, whatever the file concurrency (0 = no limit)")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "V", false, "Verbose output")
 	rootCmd.PersistentFlags().BoolVar(&cfg.DryRun, "dry-run", false, "Preview changes without writing files")
-	rootCmd.PersistentFlags().StringVarP(&cfg.OutputDir, "output", "o", "", "Output directory (default: same as input)")
+	rootCmd.PersistentFlags().StringVarP(&cfg.OutputDir, "output", "o", "", "Output directory (default: same as input; - streams generate output to stdout as an archive)")
 	rootCmd.PersistentFlags().StringVar(&cfg.CaptureDir, "capture", getEnvOrDefault("GO_SPLIT_CAPTURE", ""), "Capture API requests/responses to directory")
+	rootCmd.PersistentFlags().StringVar(&cfg.CacheDir, "cache", getEnvOrDefault("GO_SPLIT_CACHE", ""), "Reuse API responses cached in directory, keyed by model, max tokens and prompt; generate --reuse-cache records runs in its runs/ subdirectory")
+	rootCmd.PersistentFlags().BoolVar(&cfg.NoCache, "no-cache", false, "Ignore --cache and GO_SPLIT_CACHE: always call the API")
 	rootCmd.PersistentFlags().StringVar(&cfg.APIKey, "api-key", "", "Anthropic API key (uses ANTHROPIC_API_KEY env if not set)")
 	rootCmd.PersistentFlags().BoolVar(&cfg.NoColor, "no-color", false, "Disable colored output")
 	rootCmd.PersistentFlags().BoolVar(&cfg.UseWrapper, "use-wrapper", false, "Force wrapper/proxy mode (ignore ANTHROPIC_API_KEY)")
+	rootCmd.PersistentFlags().BoolVarP(&cfg.AssumeYes, "assume-yes", "y", false, "Answer yes to all prompts (required for prompts in CI/non-interactive runs)")
+	rootCmd.PersistentFlags().StringVar(&cfg.BuildTags, "build-tags", "", "Comma-separated build tags used to match files and passed to go tools")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Offline, "offline", false, "Never download modules: run go build/test/vet with GOPROXY=off and -mod=readonly")
+	rootCmd.PersistentFlags().BoolVar(&cfg.JSONErrors, "json-errors", false, "On failure print {\"error\", \"code\"} JSON to stdout instead of text to stderr")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Stream, "stream", false, "Stream wrapper responses (SSE); falls back if the wrapper doesn't stream")
+	rootCmd.PersistentFlags().BoolVar(&cfg.NormalizeEOL, "normalize-eol", true, "Strip a UTF-8 byte order mark and convert CRLF line endings in input before parsing")
+	rootCmd.PersistentFlags().StringVar(&cfg.UsageLog, "usage-log", getEnvOrDefault("GO_SPLIT_USAGE_LOG", ""), "Append a JSON line per run (time, command, files, lines, outcome) to this local file")
+	rootCmd.PersistentFlags().StringVar(&cfg.FileMode, "file-mode", "0644", "Permissions (octal) for generated files and captures")
+	rootCmd.PersistentFlags().StringVar(&cfg.StdinName, "stdin-name", "stdin.go", "Filename to use for source read from stdin (file argument \"-\")")
 
 	// Output format flag (uses gout)
 	BindOutputFlags(rootCmd)
@@ -86,13 +145,23 @@ and run quality checks.`,
 	rootCmd.AddCommand(newGenerateCmd())
 	rootCmd.AddCommand(checkCmd)
 	rootCmd.AddCommand(newValidateCmd())
+	rootCmd.AddCommand(newModelsCmd())
+	rootCmd.AddCommand(newRenameCmd())
+	rootCmd.AddCommand(newCompareCmd())
+	rootCmd.AddCommand(newDoctorCmd())
+	rootCmd.AddCommand(newCacheCmd())
+
+	for _, sub := range rootCmd.Commands() {
+		markArgErrors(sub)
+	}
 
 	return rootCmd
 }
 
-// Execute runs the CLI.
+// Execute runs the CLI. Use ExitCode to map the returned error to a
+// process exit code.
 func Execute() error {
-	return NewRootCmd().Execute()
+	return execute(NewRootCmd())
 }
 
 // ExecuteWithArgs runs the CLI with custom args and writers (for testing).
@@ -101,7 +170,40 @@ func ExecuteWithArgs(args []string, stdout, stderr io.Writer) error {
 	cmd.SetArgs(args)
 	cmd.SetOut(stdout)
 	cmd.SetErr(stderr)
-	return cmd.Execute()
+	return execute(cmd)
+}
+
+// execute runs cmd, reporting a failure as JSON when --json-errors is set
+// and recording the run in the --usage-log file if one is configured.
+func execute(cmd *cobra.Command) error {
+	ran, err := cmd.ExecuteC()
+	if err != nil && cfg.JSONErrors {
+		writeJSONError(cmd.OutOrStdout(), err)
+	}
+	if cfg.UsageLog != "" {
+		if logErr := logUsage(cmd, ran, err); logErr != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v\n", logErr)
+		}
+	}
+	return err
+}
+
+// parseFileMode checks --file-mode, which must be octal permission bits.
+func parseFileMode() error {
+	mode, err := strconv.ParseUint(cfg.FileMode, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return &usageError{err: fmt.Errorf("--file-mode must be octal permissions such as 0644 or 0664, got %q", cfg.FileMode)}
+	}
+	cfg.fileMode = os.FileMode(mode)
+	return nil
+}
+
+// fileMode returns the permissions for generated files set by --file-mode.
+func fileMode() os.FileMode {
+	if cfg.fileMode == 0 {
+		return defaultFileMode
+	}
+	return cfg.fileMode
 }
 
 func getEnvOrDefault(key, defaultVal string) string {
@@ -111,9 +213,88 @@ func getEnvOrDefault(key, defaultVal string) string {
 	return defaultVal
 }
 
-// newAPIClient creates an API client with configured options.
-func newAPIClient() *api.Client {
-	client := api.NewClient(cfg.Endpoint, cfg.Model, cfg.Timeout)
+// buildTags returns the configured build tags as a slice.
+func buildTags() []string {
+	var tags []string
+	for _, t := range strings.Split(cfg.BuildTags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// toolEnv returns the environment for go and the tools built on it: the
+// process environment, with --offline forbidding module downloads and
+// go.mod updates. A nil result inherits the environment unchanged.
+func toolEnv() []string {
+	if !cfg.Offline {
+		return nil
+	}
+	goflags := []string{"-mod=readonly"}
+	for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if !strings.HasPrefix(f, "-mod=") {
+			goflags = append(goflags, f)
+		}
+	}
+	return append(os.Environ(), "GOPROXY=off", "GOFLAGS="+strings.Join(goflags, " "))
+}
+
+// offlineError explains a go tool failure caused by --offline: the module
+// cache lacks a dependency the build needs.
+func offlineError(output string) error {
+	if cfg.Offline && strings.Contains(output, "GOPROXY=off") {
+		return fmt.Errorf("dependencies are missing from the module cache and --offline forbids downloading them (run go mod download while online):\n%s", output)
+	}
+	return fmt.Errorf("%s", output)
+}
+
+// matchesBuildContext reports whether the file at path would be included in
+// a build for the current platform and configured build tags.
+func matchesBuildContext(path string) bool {
+	ctx := build.Default
+	ctx.BuildTags = buildTags()
+	match, err := ctx.MatchFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		// Let the parser report unreadable or malformed files
+		return true
+	}
+	return match
+}
+
+// apiError adds the underlying network error to endpoint-unreachable errors
+// in verbose mode; the default message stays short and actionable.
+func apiError(err error) error {
+	var unreachable *api.UnreachableError
+	if cfg.Verbose && errors.As(err, &unreachable) {
+		return fmt.Errorf("%w (cause: %v)", err, unreachable.Err)
+	}
+	return err
+}
+
+// newAPIClient creates an API client with configured options. Verbose
+// progress from the client is written to errOut.
+func newAPIClient(errOut io.Writer) *api.Client {
+	endpoints := cfg.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{defaultEndpoint}
+	}
+	client := api.NewClient(endpoints[0], cfg.Model, cfg.Timeout).WithFallbackEndpoints(endpoints[1:]...)
+	client = client.WithMaxConcurrency(cfg.MaxConcurrencyAPI).WithFallbackModel(cfg.ModelFallback)
+	if cfg.Verbose && len(endpoints) > 1 {
+		client = client.WithServedHook(func(endpoint string) {
+			fmt.Fprintf(errOut, "   (served by %s)\n", endpoint)
+		})
+	}
+
+	if cfg.Stream {
+		var onDelta func(string)
+		if cfg.Verbose {
+			// Show the response as it arrives
+			onDelta = func(text string) { fmt.Fprint(errOut, text) }
+		}
+		client = client.WithStreaming(onDelta)
+	}
 
 	// Use direct Anthropic API unless --use-wrapper is set
 	if !cfg.UseWrapper && (cfg.APIKey != "" || os.Getenv("ANTHROPIC_API_KEY") != "") {
@@ -121,8 +302,51 @@ func newAPIClient() *api.Client {
 	}
 
 	if cfg.CaptureDir != "" {
-		client = client.WithCapture(cfg.CaptureDir)
+		client = client.WithCapture(cfg.CaptureDir).WithCaptureMode(fileMode())
+	}
+
+	if cfg.CacheDir != "" && !cfg.NoCache {
+		client = client.WithCache(cfg.CacheDir)
 	}
 
 	return client
 }
+
+// readInput reads the Go source named by arg. An arg of "-" reads standard
+// input, which then goes by the --stdin-name filename so package naming,
+// test pairing and output names work as they would for a real file. Remote
+// inputs (see isRemoteInput) are fetched into memory.
+// With --normalize-eol the content is normalized and normalized describes
+// what was changed.
+func readInput(cmd *cobra.Command, arg string) (filename string, content []byte, normalized []string, err error) {
+	filename = arg
+	if isRemoteInput(arg) {
+		filename, content, err = readRemoteInput(arg)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	} else if arg == "-" {
+		filename = cfg.StdinName
+		if filepath.Ext(filename) != ".go" {
+			return "", nil, nil, fmt.Errorf("--stdin-name must end in .go: %s", filename)
+		}
+		content, err = io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("reading stdin: %w", err)
+		}
+	} else {
+		if _, err := os.Stat(arg); os.IsNotExist(err) {
+			return "", nil, nil, fmt.Errorf("file not found: %s", arg)
+		}
+		content, err = os.ReadFile(arg)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("reading file: %w", err)
+		}
+	}
+
+	if cfg.NormalizeEOL {
+		content, normalized = analyzer.NormalizeSource(content)
+	}
+	inputLines += analyzer.CountLines(string(content))
+	return filename, content, normalized, nil
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// RunCacheEntry describes a successful generate run recorded by
+// --reuse-cache. The generated files are stored next to it.
+type RunCacheEntry struct {
+	Key     string    `json:"key"`
+	Created time.Time `json:"created"`
+	Source  string    `json:"source"` // Source file name
+	Model   string    `json:"model"`
+	Files   []string  `json:"files"` // Generated files, tests included
+}
+
+// CacheListResult is the output of cache list.
+type CacheListResult struct {
+	Dir     string          `json:"dir"`
+	Entries []RunCacheEntry `json:"entries"`
+}
+
+// runCacheKeyFlags are the generate flags that change what a run
+// generates beyond the prompts, and so are part of the run cache key.
+var runCacheKeyFlags = []string{"skip-tests", "tests-as-context", "no-stubs", "require-docs", "add-docs", "new-package", "preserve-order", "with-package-context"}
+
+// runCacheDir returns the directory holding the recorded runs: runs/ in
+// the --cache directory, next to the cached API responses.
+func runCacheDir() (string, error) {
+	if cfg.CacheDir == "" {
+		return "", fmt.Errorf("no cache directory: set --cache or GO_SPLIT_CACHE")
+	}
+	return filepath.Join(cfg.CacheDir, "runs"), nil
+}
+
+// runCacheKey identifies a generate run by everything its output depends
+// on: the model, the rendered prompts (source, tests, package context and
+// templates), the output package name and runCacheKeyFlags.
+func runCacheKey(cmd *cobra.Command, data promptData, content, testContent []byte, planTmpl, genTmpl *template.Template, hasTests bool, pkg string) (string, error) {
+	planPrompt, err := buildPlanPrompt(data, planTmpl, hasTests, false)
+	if err != nil {
+		return "", err
+	}
+	genPrompt, err := buildGeneratePrompt(previewPlaceholder, content, testContent, nil, genTmpl)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "model=%s\npackage=%s\n", cfg.Model, pkg)
+	for _, name := range runCacheKeyFlags {
+		if f := cmd.Flags().Lookup(name); f != nil {
+			fmt.Fprintf(h, "%s=%s\n", name, f.Value.String())
+		}
+	}
+	fmt.Fprintf(h, "%d\n%s\n%d\n%s", len(planPrompt), planPrompt, len(genPrompt), genPrompt)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadRunCache returns the run recorded under key and the content of its
+// files by name, or a nil entry if there is none.
+func loadRunCache(key string) (*RunCacheEntry, map[string]string, error) {
+	dir, err := runCacheDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key, "entry.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var entry RunCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, nil, fmt.Errorf("reading cached run %s: %w", shortKey(key), err)
+	}
+	files := make(map[string]string, len(entry.Files))
+	for _, name := range entry.Files {
+		code, err := os.ReadFile(filepath.Join(dir, key, "files", filepath.Base(name)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading cached run %s: %w", shortKey(key), err)
+		}
+		files[name] = string(code)
+	}
+	return &entry, files, nil
+}
+
+// storeRunCache records the files generated in outDir under key. The entry
+// is assembled in a scratch directory and renamed into place, so readers
+// never see a partial entry.
+func storeRunCache(key, source, outDir string, files []GeneratedFile) error {
+	dir, err := runCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }() // no-op once renamed
+
+	entry := RunCacheEntry{Key: key, Created: time.Now().UTC(), Source: source, Model: cfg.Model}
+	if err := os.Mkdir(filepath.Join(tmp, "files"), 0755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		code, err := os.ReadFile(filepath.Join(outDir, f.Name))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(tmp, "files", f.Name), code, 0644); err != nil {
+			return err
+		}
+		entry.Files = append(entry.Files, f.Name)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "entry.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	// A concurrent run may have recorded the same key first
+	_ = os.RemoveAll(filepath.Join(dir, key))
+	return os.Rename(tmp, filepath.Join(dir, key))
+}
+
+// listRunCache returns the recorded runs, newest first. Unreadable entries
+// are skipped.
+func listRunCache() ([]RunCacheEntry, error) {
+	dir, err := runCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []RunCacheEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []RunCacheEntry{}
+	for _, d := range dirs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, d.Name(), "entry.json"))
+		if err != nil {
+			continue
+		}
+		var entry RunCacheEntry
+		if json.Unmarshal(data, &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.After(entries[j].Created) })
+	return entries, nil
+}
+
+// shortKey abbreviates a cache key for display.
+func shortKey(key string) string {
+	if len(key) > 12 {
+		return key[:12]
+	}
+	return key
+}
+
+// newCacheCmd creates the cache command.
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect the generate run cache",
+		Long: `Inspect the runs recorded by generate --reuse-cache in the runs/
+subdirectory of --cache (default: $GO_SPLIT_CACHE).`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the recorded generate runs, newest first",
+		Args:  cobra.NoArgs,
+		RunE:  runCacheList,
+	})
+	return cmd
+}
+
+func runCacheList(cmd *cobra.Command, args []string) error {
+	ui := NewUI(cmd.OutOrStdout(), IsStructuredOutput())
+
+	entries, err := listRunCache()
+	if err != nil {
+		return err
+	}
+	result := CacheListResult{Dir: cfg.CacheDir, Entries: entries}
+	if IsStructuredOutput() {
+		return PrintOutput(cmd.OutOrStdout(), result)
+	}
+
+	ui.Header(fmt.Sprintf("🗄️  Cached runs in %s", result.Dir))
+	if len(entries) == 0 {
+		ui.Info("No cached runs")
+		return nil
+	}
+	cmd.Printf("   %-12s  %-19s  %-24s  %-28s  %s\n", "KEY", "CREATED", "SOURCE", "MODEL", "FILES")
+	for _, e := range entries {
+		cmd.Printf("   %-12s  %-19s  %-24s  %-28s  %d\n", shortKey(e.Key), e.Created.Local().Format("2006-01-02 15:04:05"), e.Source, e.Model, len(e.Files))
+	}
+	return nil
+}
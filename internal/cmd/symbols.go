@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// SymbolLocation records the output files declaring an original symbol.
+type SymbolLocation struct {
+	Symbol string   `json:"symbol"`
+	Files  []string `json:"files"`
+}
+
+// buildSymbolMap maps each top-level symbol of the source file to the output
+// files that declare it, sorted by symbol. Symbols found in no output file
+// are reported as dropped, symbols found in more than one as duplicated.
+// init functions are exempt from duplicate detection since a package may
+// declare many.
+func buildSymbolMap(source *analyzer.FileInfo, outputs []*analyzer.FileInfo) (symbolMap []SymbolLocation, dropped, duplicated []string) {
+	located := make(map[string][]string)
+	for _, out := range outputs {
+		name := filepath.Base(out.Path)
+		for _, sym := range out.Symbols() {
+			files := located[sym.Name]
+			if len(files) == 0 || files[len(files)-1] != name {
+				located[sym.Name] = append(files, name)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, sym := range source.Symbols() {
+		if seen[sym.Name] {
+			continue
+		}
+		seen[sym.Name] = true
+		files := located[sym.Name]
+		symbolMap = append(symbolMap, SymbolLocation{Symbol: sym.Name, Files: files})
+		switch {
+		case len(files) == 0:
+			dropped = append(dropped, sym.Name)
+		case len(files) > 1 && sym.Name != "init":
+			duplicated = append(duplicated, sym.Name)
+		}
+	}
+
+	sort.Slice(symbolMap, func(i, j int) bool { return symbolMap[i].Symbol < symbolMap[j].Symbol })
+	sort.Strings(dropped)
+	sort.Strings(duplicated)
+	return symbolMap, dropped, duplicated
+}
+
+// droppedDirectives lists the directive comments on the source's functions
+// and types that are missing from the output declaring the same symbol,
+// as "//nolint:dupl on labelAddCmd". Symbols dropped altogether are
+// reported by buildSymbolMap instead.
+func droppedDirectives(source *analyzer.FileInfo, outputs []*analyzer.FileInfo) []string {
+	want := make(map[string][]string)
+	for _, fn := range source.Functions {
+		if len(fn.Directives) > 0 && fn.Name != "init" {
+			want[funcSymbol(fn)] = fn.Directives
+		}
+	}
+	for _, t := range source.Types {
+		if len(t.Directives) > 0 {
+			want[t.Name] = t.Directives
+		}
+	}
+	if len(want) == 0 {
+		return nil
+	}
+
+	got := make(map[string][]string)
+	for _, out := range outputs {
+		for _, fn := range out.Functions {
+			got[funcSymbol(fn)] = append(got[funcSymbol(fn)], fn.Directives...)
+		}
+		for _, t := range out.Types {
+			got[t.Name] = append(got[t.Name], t.Directives...)
+		}
+	}
+
+	var dropped []string
+	for name, directives := range want {
+		have, ok := got[name]
+		if !ok {
+			continue
+		}
+		for _, d := range directives {
+			if !slices.Contains(have, d) {
+				dropped = append(dropped, d+" on "+name)
+			}
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// modifiedBodies lists the functions and methods of the source whose body
+// differs, beyond layout and comments, in an output file declaring them.
+// Output files that don't parse are skipped; validation reports those.
+func modifiedBodies(filename string, source []byte, outDir string, files []GeneratedFile) []string {
+	want, err := analyzer.FuncBodies(filename, source)
+	if err != nil {
+		return nil
+	}
+
+	modified := make(map[string]bool)
+	for _, f := range files {
+		if f.Status != "created" || isTestFile(f.Name) {
+			continue
+		}
+		path := filepath.Join(outDir, f.Name)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		got, err := analyzer.FuncBodies(path, content)
+		if err != nil {
+			continue
+		}
+		for name, body := range got {
+			if orig, ok := want[name]; ok && body != orig {
+				modified[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(modified))
+	for name := range modified {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// funcSymbol names fn as Symbols does: "Type.Method" for methods.
+func funcSymbol(fn analyzer.FuncInfo) string {
+	if fn.Receiver != "" {
+		return fn.ReceiverType() + "." + fn.Name
+	}
+	return fn.Name
+}
+
+// InventorySymbol is one top-level declaration in a generated file, as
+// written by --emit-inventory.
+type InventorySymbol struct {
+	File     string `json:"file"`   // Path of the generated file
+	Symbol   string `json:"symbol"` // "Type.Method" for methods
+	Kind     string `json:"kind"`   // func, method, type, var, const
+	Line     int    `json:"line"`
+	EndLine  int    `json:"end_line"`
+	Exported bool   `json:"exported"`
+}
+
+// buildInventory lists the symbols declared in the created files in
+// outDir, tests included, by file and line.
+func buildInventory(outDir string, files []GeneratedFile) []InventorySymbol {
+	var inventory []InventorySymbol
+	for _, out := range append(parseGeneratedSources(outDir, files), parseGeneratedTests(outDir, files)...) {
+		for _, sym := range out.Symbols() {
+			name := sym.Name[strings.LastIndex(sym.Name, ".")+1:]
+			inventory = append(inventory, InventorySymbol{
+				File:     out.Path,
+				Symbol:   sym.Name,
+				Kind:     sym.Kind,
+				Line:     sym.Line,
+				EndLine:  sym.EndLine,
+				Exported: ast.IsExported(name),
+			})
+		}
+	}
+	sort.SliceStable(inventory, func(i, j int) bool {
+		if inventory[i].File != inventory[j].File {
+			return inventory[i].File < inventory[j].File
+		}
+		return inventory[i].Line < inventory[j].Line
+	})
+	return inventory
+}
+
+// SymbolMove records where a top-level symbol of the source ended up, as
+// written by --emit-moves. Line ranges are [first, last].
+type SymbolMove struct {
+	Symbol    string `json:"symbol"`
+	FromFile  string `json:"from_file"`
+	ToFile    string `json:"to_file"`
+	FromLines [2]int `json:"from_lines"`
+	ToLines   [2]int `json:"to_lines"`
+}
+
+// buildMoves pairs each symbol of the source at filename with its
+// declaration in outputs. A symbol declared more than once (init) is
+// paired in order; dropped symbols are left out.
+func buildMoves(filename string, source *analyzer.FileInfo, outputs []*analyzer.FileInfo) []SymbolMove {
+	type declared struct {
+		path string
+		sym  analyzer.Symbol
+	}
+	located := make(map[string][]declared)
+	for _, out := range outputs {
+		for _, sym := range out.Symbols() {
+			located[sym.Name] = append(located[sym.Name], declared{out.Path, sym})
+		}
+	}
+
+	var moves []SymbolMove
+	for _, sym := range source.Symbols() {
+		found := located[sym.Name]
+		if len(found) == 0 {
+			continue
+		}
+		to := found[0]
+		located[sym.Name] = found[1:]
+		moves = append(moves, SymbolMove{
+			Symbol:    sym.Name,
+			FromFile:  filename,
+			ToFile:    to.path,
+			FromLines: [2]int{sym.Line, sym.EndLine},
+			ToLines:   [2]int{to.sym.Line, to.sym.EndLine},
+		})
+	}
+	return moves
+}
+
+// writeSymbolReports writes the --emit-inventory and --emit-moves files,
+// when set, covering every result. Dry runs and preflights write nothing.
+func writeSymbolReports(results []GenerateResult) error {
+	if cfg.DryRun || genCfg.Preflight {
+		return nil
+	}
+	inventory := []InventorySymbol{}
+	moves := []SymbolMove{}
+	for _, r := range results {
+		inventory = append(inventory, r.inventory...)
+		moves = append(moves, r.moves...)
+	}
+	if genCfg.EmitInventory != "" {
+		if err := writeJSONReport(genCfg.EmitInventory, inventory); err != nil {
+			return fmt.Errorf("writing inventory: %w", err)
+		}
+	}
+	if genCfg.EmitMoves != "" {
+		if err := writeJSONReport(genCfg.EmitMoves, moves); err != nil {
+			return fmt.Errorf("writing moves: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeJSONReport writes v to path as indented JSON.
+func writeJSONReport(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// parseGeneratedSources parses the created, non-test files in files.
+// Files that fail to parse are skipped; validation reports those separately.
+func parseGeneratedSources(outDir string, files []GeneratedFile) []*analyzer.FileInfo {
+	return parseGenerated(outDir, files, false)
+}
+
+// parseGeneratedTests parses the created test files in files.
+func parseGeneratedTests(outDir string, files []GeneratedFile) []*analyzer.FileInfo {
+	return parseGenerated(outDir, files, true)
+}
+
+func parseGenerated(outDir string, files []GeneratedFile, tests bool) []*analyzer.FileInfo {
+	var infos []*analyzer.FileInfo
+	for _, f := range files {
+		if f.Status != "created" || isTestFile(f.Name) != tests {
+			continue
+		}
+		info, err := analyzer.ParseGoFile(filepath.Join(outDir, f.Name))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// isTestFile reports whether name is a Go test file.
+func isTestFile(name string) bool {
+	return strings.HasSuffix(name, "_test.go")
+}
+
+// printSymbolMap prints each original symbol and where it landed.
+func printSymbolMap(cmd *cobra.Command, symbolMap []SymbolLocation) {
+	cmd.Println("\n   Symbol map:")
+	for _, loc := range symbolMap {
+		if len(loc.Files) == 0 {
+			cmd.Printf("     • %s → (dropped)\n", loc.Symbol)
+			continue
+		}
+		cmd.Printf("     • %s → %s\n", loc.Symbol, strings.Join(loc.Files, ", "))
+	}
+}
+
+// VerifyResult holds the outcome of comparing output symbols to the source.
+type VerifyResult struct {
+	Passed  bool     `json:"passed"`
+	Missing []string `json:"missing,omitempty"` // In the source but in no output file
+	Added   []string `json:"added,omitempty"`   // In an output file but not in the source
+}
+
+// verifySymbols compares the union of symbols across outputs against the
+// source's top-level symbols. Names in allowDrop may be missing without
+// failing verification.
+func verifySymbols(source *analyzer.FileInfo, outputs []*analyzer.FileInfo, allowDrop []string) VerifyResult {
+	allowed := make(map[string]bool, len(allowDrop))
+	for _, name := range allowDrop {
+		allowed[name] = true
+	}
+
+	want := make(map[string]bool)
+	for _, sym := range source.Symbols() {
+		want[sym.Name] = true
+	}
+	have := make(map[string]bool)
+	for _, out := range outputs {
+		for _, sym := range out.Symbols() {
+			have[sym.Name] = true
+		}
+	}
+
+	var res VerifyResult
+	for name := range want {
+		if !have[name] && !allowed[name] {
+			res.Missing = append(res.Missing, name)
+		}
+	}
+	for name := range have {
+		if !want[name] {
+			res.Added = append(res.Added, name)
+		}
+	}
+	sort.Strings(res.Missing)
+	sort.Strings(res.Added)
+	res.Passed = len(res.Missing) == 0 && len(res.Added) == 0
+	return res
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+func parseTestSource(t *testing.T, dir, name, content string) *analyzer.FileInfo {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := analyzer.ParseGoFile(path)
+	if err != nil {
+		t.Fatalf("ParseGoFile(%s) error = %v", name, err)
+	}
+	return info
+}
+
+func TestBuildSymbolMap(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+
+	source := parseTestSource(t, srcDir, "big.go", "package foo\n\nfunc Hello() {}\n\nfunc World() {}\n")
+	hello := parseTestSource(t, outDir, "hello.go", "package foo\n\nfunc Hello() {}\n")
+	world := parseTestSource(t, outDir, "world.go", "package foo\n\nfunc World() {}\n")
+
+	symbolMap, dropped, duplicated := buildSymbolMap(source, []*analyzer.FileInfo{hello, world})
+
+	want := []SymbolLocation{
+		{Symbol: "Hello", Files: []string{"hello.go"}},
+		{Symbol: "World", Files: []string{"world.go"}},
+	}
+	if !reflect.DeepEqual(symbolMap, want) {
+		t.Errorf("symbolMap = %v, want %v", symbolMap, want)
+	}
+	if len(dropped) != 0 {
+		t.Errorf("dropped = %v, want none", dropped)
+	}
+	if len(duplicated) != 0 {
+		t.Errorf("duplicated = %v, want none", duplicated)
+	}
+}
+
+func TestBuildSymbolMap_DroppedAndDuplicated(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+
+	source := parseTestSource(t, srcDir, "big.go", "package foo\n\ntype T struct{}\n\nfunc (t *T) Run() {}\n\nfunc Lost() {}\n")
+	a := parseTestSource(t, outDir, "a.go", "package foo\n\ntype T struct{}\n\nfunc (t *T) Run() {}\n")
+	b := parseTestSource(t, outDir, "b.go", "package foo\n\nfunc (t *T) Run() {}\n")
+
+	symbolMap, dropped, duplicated := buildSymbolMap(source, []*analyzer.FileInfo{a, b})
+
+	want := []SymbolLocation{
+		{Symbol: "Lost"},
+		{Symbol: "T", Files: []string{"a.go"}},
+		{Symbol: "T.Run", Files: []string{"a.go", "b.go"}},
+	}
+	if !reflect.DeepEqual(symbolMap, want) {
+		t.Errorf("symbolMap = %v, want %v", symbolMap, want)
+	}
+	if !reflect.DeepEqual(dropped, []string{"Lost"}) {
+		t.Errorf("dropped = %v, want [Lost]", dropped)
+	}
+	if !reflect.DeepEqual(duplicated, []string{"T.Run"}) {
+		t.Errorf("duplicated = %v, want [T.Run]", duplicated)
+	}
+}
+
+func TestDroppedDirectives(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+
+	source := parseTestSource(t, srcDir, "big.go", "package foo\n\ntype T struct{}\n\n//nolint:dupl\nfunc (t *T) Run() {}\n\n//go:noinline\nfunc Keep() {}\n\n//nolint\nfunc Lost() {}\n")
+	a := parseTestSource(t, outDir, "a.go", "package foo\n\ntype T struct{}\n\nfunc (t *T) Run() {}\n")
+	b := parseTestSource(t, outDir, "b.go", "package foo\n\n//go:noinline\nfunc Keep() {}\n")
+
+	got := droppedDirectives(source, []*analyzer.FileInfo{a, b})
+	if want := []string{"//nolint:dupl on T.Run"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("droppedDirectives() = %v, want %v", got, want)
+	}
+}
+
+func TestVerifySymbols(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+
+	source := parseTestSource(t, srcDir, "big.go", "package foo\n\nfunc Hello() {}\n\nfunc Old() {}\n\nfunc Gone() {}\n")
+	out := parseTestSource(t, outDir, "hello.go", "package foo\n\nfunc Hello() {}\n\nfunc Invented() {}\n")
+
+	res := verifySymbols(source, []*analyzer.FileInfo{out}, []string{"Old"})
+	if res.Passed {
+		t.Error("expected verification to fail")
+	}
+	if !reflect.DeepEqual(res.Missing, []string{"Gone"}) {
+		t.Errorf("Missing = %v, want [Gone]", res.Missing)
+	}
+	if !reflect.DeepEqual(res.Added, []string{"Invented"}) {
+		t.Errorf("Added = %v, want [Invented]", res.Added)
+	}
+
+	full := parseTestSource(t, outDir, "all.go", "package foo\n\nfunc Hello() {}\n\nfunc Gone() {}\n")
+	if res := verifySymbols(source, []*analyzer.FileInfo{full}, []string{"Old"}); !res.Passed {
+		t.Errorf("expected verification to pass, got %+v", res)
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TestFailure is one failure reported by go test: a failed test, or a
+// package that did not build (no Test).
+type TestFailure struct {
+	Package string `json:"package,omitempty"`
+	Test    string `json:"test,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	// "--- FAIL: TestName/sub (0.00s)", indented for subtests
+	failedTestRe = regexp.MustCompile(`^\s*--- FAIL: (\S+)`)
+	// "FAIL	example.com/pkg	0.01s" or "FAIL	example.com/pkg [build failed]"
+	failedPkgRe = regexp.MustCompile(`^FAIL\t(\S+)(?:\s+\[(\w+) failed\]|\s|$)`)
+	// "# example.com/pkg [example.com/pkg.test]" heads compiler errors
+	buildHeaderRe = regexp.MustCompile(`^# (\S+)`)
+)
+
+// parseTestFailures extracts the failed tests and packages from the plain
+// text output of go test. A test's message is the output indented under
+// its "--- FAIL" line; a package's build errors follow its "# pkg" header.
+// Output it does not recognize is ignored, so the result may be empty.
+func parseTestFailures(output string) []TestFailure {
+	var failures []TestFailure
+	pending := 0 // failures[pending:] await their package's FAIL line
+	buildErrors := map[string][]string{}
+	var test *TestFailure // test collecting message lines
+	var buildPkg string   // package collecting compiler errors
+	var message []string
+
+	flush := func() {
+		if test != nil {
+			test.Message = strings.Join(message, "\n")
+			failures = append(failures, *test)
+		}
+		test, message = nil, nil
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := failedTestRe.FindStringSubmatch(line); m != nil {
+			flush()
+			buildPkg = ""
+			test = &TestFailure{Test: m[1]}
+			continue
+		}
+		if m := failedPkgRe.FindStringSubmatch(line); m != nil {
+			flush()
+			buildPkg = ""
+			if m[2] != "" {
+				failures = append(failures, TestFailure{Package: m[1], Message: strings.Join(buildErrors[m[1]], "\n")})
+			}
+			for i := pending; i < len(failures); i++ {
+				failures[i].Package = m[1]
+			}
+			pending = len(failures)
+			continue
+		}
+		if m := buildHeaderRe.FindStringSubmatch(line); m != nil {
+			flush()
+			buildPkg = m[1]
+			continue
+		}
+
+		switch {
+		case test != nil && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			message = append(message, strings.TrimSpace(line))
+		case buildPkg != "" && line != "":
+			buildErrors[buildPkg] = append(buildErrors[buildPkg], line)
+		default:
+			flush()
+			buildPkg = ""
+		}
+	}
+	flush()
+	return failures
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTestFailures(t *testing.T) {
+	output := `--- FAIL: TestParse (0.00s)
+    parse_test.go:12: Parse("x") = 1, want 2
+    parse_test.go:13: second problem
+--- FAIL: TestFormat (0.00s)
+    --- FAIL: TestFormat/empty (0.00s)
+        format_test.go:20: got "", want "-"
+FAIL
+FAIL	example.com/shop	0.012s
+ok  	example.com/shop/util	0.004s
+# example.com/shop/api [example.com/shop/api.test]
+./handler.go:14:2: undefined: render
+./handler.go:20:9: too many return values
+FAIL	example.com/shop/api [build failed]
+FAIL`
+
+	want := []TestFailure{
+		{Package: "example.com/shop", Test: "TestParse", Message: "parse_test.go:12: Parse(\"x\") = 1, want 2\nparse_test.go:13: second problem"},
+		{Package: "example.com/shop", Test: "TestFormat"},
+		{Package: "example.com/shop", Test: "TestFormat/empty", Message: "format_test.go:20: got \"\", want \"-\""},
+		{Package: "example.com/shop/api", Message: "./handler.go:14:2: undefined: render\n./handler.go:20:9: too many return values"},
+	}
+	if got := parseTestFailures(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTestFailures() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := parseTestFailures("go: cannot find main module"); got != nil {
+		t.Errorf("parseTestFailures(unrecognized) = %+v, want nil", got)
+	}
+}
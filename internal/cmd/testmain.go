@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// hasTestMain reports whether info declares TestMain.
+func hasTestMain(info *analyzer.FileInfo) bool {
+	if info == nil {
+		return false
+	}
+	for _, fn := range info.Functions {
+		if analyzer.ClassifyTestFunc(fn) == analyzer.KindTestMain {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupeTestMain keeps TestMain, which a package may declare only once, in
+// the first created test file of files declaring it and removes it from
+// the others, updating their line and test counts. It returns the file
+// keeping TestMain ("" if none declares it) and the files it was removed
+// from.
+func dedupeTestMain(outDir string, files []GeneratedFile) (home string, removed []string, err error) {
+	for i, f := range files {
+		if f.Status != "created" || !isTestFile(f.Name) {
+			continue
+		}
+		p := filepath.Join(outDir, f.Name)
+		info, err := analyzer.ParseGoFile(p)
+		if err != nil || !hasTestMain(info) {
+			continue
+		}
+		if home == "" {
+			home = f.Name
+			continue
+		}
+
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return home, removed, err
+		}
+		code, err := removeFunc(p, src, "TestMain")
+		if err != nil {
+			return home, removed, fmt.Errorf("removing TestMain from %s: %w", f.Name, err)
+		}
+		if err := writeFileAtomic(p, code); err != nil {
+			return home, removed, err
+		}
+		files[i].TestCount--
+		removed = append(removed, f.Name)
+	}
+	refreshLineCounts(outDir, files, removed)
+	return home, removed, nil
+}
+
+// removeFunc returns src without the top-level function name and its doc
+// comment. Imports only that function used are dropped too.
+func removeFunc(filename string, src []byte, name string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []ast.Decl
+	for _, d := range file.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != name {
+			decls = append(decls, d)
+			continue
+		}
+		// Its doc and the comments inside it go with it
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		var comments []*ast.CommentGroup
+		for _, c := range file.Comments {
+			if c.Pos() < start || c.End() > fn.End() {
+				comments = append(comments, c)
+			}
+		}
+		file.Comments = comments
+	}
+	file.Decls = decls
+
+	// Drop the imports nothing refers to any more
+	used := selectorPackages(file)
+	for _, d := range file.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		specs := gd.Specs[:0]
+		for _, spec := range gd.Specs {
+			imp := spec.(*ast.ImportSpec)
+			p, _ := strconv.Unquote(imp.Path.Value)
+			name := analyzer.ImportName(p)
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			if name == "_" || name == "." || used[name] {
+				specs = append(specs, spec)
+			}
+		}
+		gd.Specs = specs
+	}
+	decls = file.Decls[:0]
+	for _, d := range file.Decls {
+		if gd, ok := d.(*ast.GenDecl); !ok || gd.Tok != token.IMPORT || len(gd.Specs) > 0 {
+			decls = append(decls, d)
+		}
+	}
+	file.Decls = decls
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemoveFunc(t *testing.T) {
+	src := `package conf
+
+import (
+	"os"
+	"testing"
+
+	"example.com/conf/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// TestMain sets up the package.
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+func TestLoad(t *testing.T) {
+	_, _ = yaml.Marshal(conf.Default)
+}
+`
+	got, err := removeFunc("conf_test.go", []byte(src), "TestMain")
+	if err != nil {
+		t.Fatalf("removeFunc() error = %v", err)
+	}
+	out := string(got)
+	if strings.Contains(out, "TestMain") || strings.Contains(out, `"os"`) {
+		t.Errorf("TestMain or its os import survived:\n%s", out)
+	}
+	for _, imp := range []string{`"testing"`, `"example.com/conf/v2"`, `"gopkg.in/yaml.v3"`} {
+		if !strings.Contains(out, imp) {
+			t.Errorf("import %s still used by TestLoad was dropped:\n%s", imp, out)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"bufio"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
@@ -11,10 +14,12 @@ import (
 
 // UI provides user interface helpers.
 type UI struct {
-	out       io.Writer
-	spinner   *spinner.Spinner
-	json      bool
-	noColor   bool
+	in             io.Reader
+	out            io.Writer
+	spinner        *spinner.Spinner
+	spinnerMsg     string
+	json           bool
+	noColor        bool
 	nonInteractive bool
 }
 
@@ -31,6 +36,7 @@ func NewUI(out io.Writer, jsonMode bool) *UI {
 	}
 
 	return &UI{
+		in:             os.Stdin,
 		out:            out,
 		json:           jsonMode,
 		noColor:        noColor,
@@ -44,6 +50,7 @@ func (u *UI) StartSpinner(msg string) {
 		return
 	}
 	u.spinner = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+	u.spinnerMsg = msg
 	u.spinner.Suffix = " " + msg
 	u.spinner.Writer = u.out
 	u.spinner.Start()
@@ -77,6 +84,23 @@ func (u *UI) StopSpinnerMsg(success bool, msg string) {
 	u.spinner = nil
 }
 
+// Retrying reports that an API call is being retried after err, as
+// attempt of at most attempts: in the spinner's message while it runs,
+// otherwise on a line of its own. It fits api.Client.WithRetryHook.
+func (u *UI) Retrying(attempt, attempts int, err error) {
+	if u.json {
+		return
+	}
+	note := fmt.Sprintf("retrying (%d/%d)...", attempt, attempts)
+	if u.spinner != nil {
+		u.spinner.Lock()
+		u.spinner.Suffix = " " + u.spinnerMsg + " " + note
+		u.spinner.Unlock()
+		return
+	}
+	color.New(color.FgYellow).Fprintf(u.out, "↻ %v; %s\n", err, note)
+}
+
 // Success prints a success message.
 func (u *UI) Success(msg string) {
 	if u.json {
@@ -126,6 +150,31 @@ func (u *UI) Step(current, total int, msg string) {
 	color.New(color.FgWhite).Fprintf(u.out, "%s", msg)
 }
 
+// Confirm asks a yes/no question, defaulting to no. With --assume-yes it
+// answers yes without asking. When nobody can answer (non-interactive
+// sessions or structured output) it returns an error pointing at
+// --assume-yes rather than guessing.
+func (u *UI) Confirm(question string) (bool, error) {
+	if cfg.AssumeYes {
+		return true, nil
+	}
+	if u.json || u.nonInteractive {
+		return false, fmt.Errorf("%s: confirmation required in non-interactive mode (use --assume-yes)", question)
+	}
+
+	color.New(color.FgYellow).Fprintf(u.out, "? %s [y/N] ", question)
+	answer, err := bufio.NewReader(u.in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
 func isTerminal() bool {
 	if fileInfo, _ := os.Stdout.Stat(); (fileInfo.Mode() & os.ModeCharDevice) != 0 {
 		return true
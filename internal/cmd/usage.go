@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// UsageRecord is one line of the --usage-log file. Nothing in it leaves
+// the machine.
+type UsageRecord struct {
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command"`
+	Files    []string  `json:"files,omitempty"` // Positional arguments
+	Lines    int       `json:"lines,omitempty"` // Source lines read
+	Outcome  string    `json:"outcome"`         // "success", "failure" or "usage_error"
+	ExitCode int       `json:"exit_code"`
+}
+
+// inputLines counts the source lines read by readInput during a run, for
+// the usage log.
+var inputLines int
+
+// logUsage appends a record of the run of cmd (the executed subcommand)
+// that ended with err to the --usage-log file. Help and bare root
+// invocations are not recorded.
+func logUsage(root, cmd *cobra.Command, err error) error {
+	if cmd == nil || cmd == root || cmd.Name() == "help" {
+		return nil
+	}
+	if help, _ := cmd.Flags().GetBool("help"); help {
+		return nil
+	}
+
+	record := UsageRecord{
+		Time:     time.Now().UTC(),
+		Command:  cmd.Name(),
+		Files:    cmd.Flags().Args(),
+		Lines:    inputLines,
+		Outcome:  "success",
+		ExitCode: ExitCode(err),
+	}
+	switch record.ExitCode {
+	case ExitUsage:
+		record.Outcome = "usage_error"
+	case ExitError:
+		record.Outcome = "failure"
+	}
+	return appendUsage(cfg.UsageLog, record)
+}
+
+// appendUsage appends record as a JSON line to the file at path, holding
+// an exclusive lock so concurrent runs don't interleave their lines.
+func appendUsage(path string, record UsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening usage log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("locking usage log: %w", err)
+	}
+	defer func() { _ = unlockFile(f) }()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing usage log: %w", err)
+	}
+	return nil
+}
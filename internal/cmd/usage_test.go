@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func readUsageLog(t *testing.T, path string) []UsageRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("usage log line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestUsageLog(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "usage.jsonl")
+	file := filepath.Join(dir, "small.go")
+	if err := os.WriteFile(file, []byte("package small\n\nfunc A() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := [][]string{
+		{"--usage-log", log, "--format=json", "analyze", file},
+		{"--usage-log", log, "analyze", filepath.Join(dir, "missing.go")},
+		{"--usage-log", log, "analyze", "--help"},
+	}
+	for _, args := range runs {
+		var stdout, stderr bytes.Buffer
+		_ = ExecuteWithArgs(args, &stdout, &stderr)
+	}
+
+	records := readUsageLog(t, log)
+	if len(records) != 2 {
+		t.Fatalf("usage log has %d records, want 2 (help is not logged): %+v", len(records), records)
+	}
+	if r := records[0]; r.Command != "analyze" || r.Outcome != "success" || r.Lines != 4 || len(r.Files) != 1 || r.Files[0] != file {
+		t.Errorf("first record = %+v, want a successful 4-line analyze of %s", r, file)
+	}
+	if r := records[1]; r.Outcome != "failure" || r.ExitCode != ExitError || r.Lines != 0 {
+		t.Errorf("second record = %+v, want a failure without lines", r)
+	}
+}
+
+func TestAppendUsageConcurrent(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "usage.jsonl")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := appendUsage(log, UsageRecord{Command: "analyze", Files: []string{"big.go"}, Lines: i, Outcome: "success"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if records := readUsageLog(t, log); len(records) != 20 {
+		t.Errorf("usage log has %d records, want 20", len(records))
+	}
+}
@@ -1,10 +1,18 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go/format"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 
@@ -17,6 +25,17 @@ type ValidateResult struct {
 	FileCount int             `json:"file_count"`
 	Valid     bool            `json:"valid"`
 	Files     []ValidatedFile `json:"files,omitempty"`
+	// ReceiverIssues lists types with inconsistent receiver names (--lint-receivers).
+	ReceiverIssues []ReceiverIssue `json:"receiver_issues,omitempty"`
+	// MismatchedConstraints groups the files by build constraint when some
+	// carry one and the rest none, as when a split drops it from a file.
+	MismatchedConstraints []ConstraintGroup `json:"mismatched_constraints,omitempty"`
+}
+
+// ConstraintGroup is a set of files with the same build constraint.
+type ConstraintGroup struct {
+	Constraint string   `json:"constraint,omitempty"` // As written, empty for none
+	Files      []string `json:"files"`
 }
 
 // ValidatedFile describes a validated file.
@@ -24,17 +43,47 @@ type ValidatedFile struct {
 	Name  string `json:"name"`
 	Valid bool   `json:"valid"`
 	Error string `json:"error,omitempty"`
+	// OtherBuildContext is set for files build constraints exclude from
+	// the current build context; their syntax is checked all the same.
+	OtherBuildContext bool `json:"other_build_context,omitempty"`
+	// Unformatted is set when the file differs from gofmt output (--gofmt);
+	// GofmtDiff holds the diff gofmt would apply.
+	Unformatted bool   `json:"unformatted,omitempty"`
+	GofmtDiff   string `json:"gofmt_diff,omitempty"`
+	// PackageMismatch is set when the package is not named after the directory.
+	PackageMismatch bool `json:"package_mismatch,omitempty"`
+}
+
+// validateConfig holds validate-specific configuration.
+type validateConfig struct {
+	LintReceivers bool
+	Gofmt         bool
 }
 
+var valCfg = &validateConfig{}
+
 // newValidateCmd creates the validate command.
 func newValidateCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "validate <path>",
 		Short: "Validate Go syntax of files",
-		Long:  `Validate that all Go files in the specified path have valid syntax.`,
-		Args:  cobra.ExactArgs(1),
-		RunE:  runValidate,
+		Long: `Validate that all Go files in the specified path have valid syntax.
+Syntax does not depend on the platform, so files that build constraints
+exclude from the current build context are checked too and only noted as
+such (--build-tags sets the tags of that context). If some files carry a
+build constraint and the others none, which is what a split that dropped
+the constraint from some of its files looks like, validate warns.
+
+With --gofmt, each file is also checked against gofmt without rewriting it;
+files that need formatting are reported with the diff gofmt would apply.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runValidate,
 	}
+
+	cmd.Flags().BoolVar(&valCfg.LintReceivers, "lint-receivers", false, "Report methods on the same type that use different receiver names")
+	cmd.Flags().BoolVar(&valCfg.Gofmt, "gofmt", false, "Report files that are not gofmt-clean, with their diffs")
+
+	return cmd
 }
 
 func runValidate(cmd *cobra.Command, args []string) error {
@@ -68,7 +117,7 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	result.FileCount = len(matches)
 
 	if len(matches) == 0 {
-		if format == "json" || format == "yaml" {
+		if format == "json" || format == "yaml" || format == "template" {
 			return PrintOutput(cmd.OutOrStdout(), result)
 		}
 		if format == "jsonl" {
@@ -82,22 +131,32 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		cmd.Println()
 	}
 
+	// JSONL: output each file as it's processed (streaming, in completion
+	// order); other formats report in file order once all are done.
 	jsonlEnc := json.NewEncoder(cmd.OutOrStdout())
-
-	for i, f := range matches {
-		vf := ValidatedFile{Name: filepath.Base(f), Valid: true}
-		_, err := analyzer.ParseGoFile(f)
-		if err != nil {
-			vf.Valid = false
-			vf.Error = err.Error()
-			result.Valid = false
+	var emit func(ValidatedFile)
+	if format == "jsonl" {
+		var mu sync.Mutex
+		emit = func(vf ValidatedFile) {
+			mu.Lock()
+			defer mu.Unlock()
+			_ = jsonlEnc.Encode(vf)
 		}
-		result.Files = append(result.Files, vf)
+	}
+	checked, err := validateFiles(matches, emit)
+	if err != nil {
+		return err
+	}
 
-		// JSONL: output each file as it's processed (streaming)
-		if format == "jsonl" {
-			_ = jsonlEnc.Encode(vf)
-			continue
+	var parsed []*analyzer.FileInfo
+	for i, c := range checked {
+		vf := c.file
+		result.Files = append(result.Files, vf)
+		if c.info != nil && !vf.OtherBuildContext {
+			parsed = append(parsed, c.info)
+		}
+		if !vf.Valid {
+			result.Valid = false
 		}
 
 		if IsStructuredOutput() {
@@ -105,17 +164,61 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		}
 
 		// Text mode
-		if !vf.Valid {
-			cmd.Printf("   [%d/%d] %s ✗\n        %v\n", i+1, len(matches), filepath.Base(f), err)
-		} else if cfg.Verbose {
-			cmd.Printf("   [%d/%d] %s ✓\n", i+1, len(matches), filepath.Base(f))
+		switch {
+		case !vf.Valid:
+			cmd.Printf("   [%d/%d] %s ✗\n        %v\n", i+1, len(matches), vf.Name, vf.Error)
+		case vf.Unformatted:
+			cmd.Printf("   [%d/%d] %s - needs gofmt\n", i+1, len(matches), vf.Name)
+			for _, line := range strings.Split(strings.TrimRight(vf.GofmtDiff, "\n"), "\n") {
+				cmd.Printf("        %s\n", line)
+			}
+		case cfg.Verbose && vf.OtherBuildContext:
+			cmd.Printf("   [%d/%d] %s ✓ (other build context)\n", i+1, len(matches), vf.Name)
+		case cfg.Verbose:
+			cmd.Printf("   [%d/%d] %s ✓\n", i+1, len(matches), vf.Name)
+		}
+		if vf.PackageMismatch {
+			abs, _ := filepath.Abs(dir)
+			ui.Warning(fmt.Sprintf("%s: package %s does not match directory %s", vf.Name, c.info.Package, filepath.Base(abs)))
+		}
+	}
+
+	if valCfg.LintReceivers {
+		result.ReceiverIssues = lintReceivers(parsed)
+	}
+	result.MismatchedConstraints = mismatchedConstraints(matches)
+	if !IsStructuredOutput() && result.MismatchedConstraints != nil {
+		var groups []string
+		for _, g := range result.MismatchedConstraints {
+			constraint := g.Constraint
+			if constraint == "" {
+				constraint = "no constraint"
+			}
+			groups = append(groups, fmt.Sprintf("%s (%s)", strings.Join(g.Files, ", "), constraint))
+		}
+		ui.Warning(fmt.Sprintf("Mismatched build constraints: %s", strings.Join(groups, "; ")))
+	}
+
+	unformatted := 0
+	for _, vf := range result.Files {
+		if vf.Unformatted {
+			unformatted++
 		}
 	}
 
 	if format == "jsonl" {
+		for _, issue := range result.ReceiverIssues {
+			_ = jsonlEnc.Encode(issue)
+		}
 		if !result.Valid {
 			return fmt.Errorf("validation failed")
 		}
+		if len(result.ReceiverIssues) > 0 {
+			return fmt.Errorf("inconsistent receiver names")
+		}
+		if unformatted > 0 {
+			return fmt.Errorf("%d files need gofmt", unformatted)
+		}
 		return nil
 	}
 
@@ -129,7 +232,153 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("validation failed")
 	}
 
+	if len(result.ReceiverIssues) > 0 {
+		cmd.Println()
+		for _, issue := range result.ReceiverIssues {
+			ui.Warning(fmt.Sprintf("%s methods use receivers %s (prefer %q)", issue.Type, strings.Join(issue.Names, ", "), issue.Preferred))
+			for _, m := range issue.Methods {
+				cmd.Printf("     • %s\n", m)
+			}
+		}
+		ui.Error("Inconsistent receiver names")
+		return fmt.Errorf("inconsistent receiver names")
+	}
+
+	if unformatted > 0 {
+		cmd.Println()
+		ui.Error(fmt.Sprintf("%d files need gofmt", unformatted))
+		return fmt.Errorf("%d files need gofmt", unformatted)
+	}
+
 	cmd.Println()
 	ui.Success(fmt.Sprintf("All %d files are valid Go syntax", len(matches)))
 	return nil
 }
+
+// checkedFile is the outcome of validating one file.
+type checkedFile struct {
+	file ValidatedFile
+	info *analyzer.FileInfo // nil unless the file parsed
+}
+
+// validateFiles parses files on a bounded pool of workers and returns the
+// results in the order of files. emit, if set, is called with each result
+// as soon as it is ready.
+func validateFiles(files []string, emit func(ValidatedFile)) ([]checkedFile, error) {
+	results := make([]checkedFile, len(files))
+	errs := make([]error, len(files))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = validateFile(files[i])
+				if emit != nil && errs[i] == nil {
+					emit(results[i].file)
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+// validateFile parses one file and, with --gofmt, checks its formatting.
+// Syntax errors are reported in the result; only failures to run the checks
+// are returned as errors.
+func validateFile(path string) (checkedFile, error) {
+	vf := ValidatedFile{Name: filepath.Base(path), Valid: true, OtherBuildContext: !matchesBuildContext(path)}
+
+	info, err := analyzer.ParseGoFile(path)
+	if err != nil {
+		vf.Valid = false
+		vf.Error = err.Error()
+		return checkedFile{file: vf}, nil
+	}
+	vf.PackageMismatch = packageMismatch(info.Package, filepath.Dir(path))
+	if valCfg.Gofmt {
+		if vf.GofmtDiff, err = gofmtDiff(path); err != nil {
+			return checkedFile{}, err
+		}
+		vf.Unformatted = vf.GofmtDiff != ""
+	}
+	return checkedFile{file: vf, info: info}, nil
+}
+
+// mismatchedConstraints groups files by build constraint when exactly one
+// constraint is shared by some of them and the others have none: split
+// siblings whose source was constrained should all keep it. Packages mixing
+// several constraints (unix and !unix) are left alone, as are files
+// constrained by a GOOS or GOARCH name suffix and files that do not parse.
+func mismatchedConstraints(files []string) []ConstraintGroup {
+	byConstraint := make(map[string][]string)
+	for _, path := range files {
+		if hasConstraintSuffix(filepath.Base(path)) {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		lines, err := analyzer.BuildConstraints(content)
+		if err != nil {
+			continue
+		}
+		// The //go:build line is authoritative; +build lines mirror it
+		key := strings.Join(lines, "\n")
+		for _, line := range lines {
+			if strings.HasPrefix(line, "//go:build") {
+				key = line
+			}
+		}
+		byConstraint[key] = append(byConstraint[key], filepath.Base(path))
+	}
+
+	unconstrained, ok := byConstraint[""]
+	if !ok || len(byConstraint) != 2 {
+		return nil
+	}
+	for constraint, names := range byConstraint {
+		if constraint != "" {
+			return []ConstraintGroup{{Constraint: constraint, Files: names}, {Files: unconstrained}}
+		}
+	}
+	return nil
+}
+
+// hasConstraintSuffix reports whether a file name carries an implicit build
+// constraint: a GOOS and/or GOARCH suffix, before any _test.
+func hasConstraintSuffix(name string) bool {
+	stem := strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	i := strings.LastIndex(stem, "_")
+	return i > 0 && (slices.Contains(knownOS, stem[i+1:]) || slices.Contains(knownArch, stem[i+1:]))
+}
+
+// gofmtDiff returns the diff gofmt would apply to path, or "" if the file is
+// already gofmt-clean. The file is never rewritten.
+func gofmtDiff(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format.Source(content)
+	if err != nil || bytes.Equal(formatted, content) {
+		// Syntax errors are reported by the parse step
+		return "", nil
+	}
+
+	// gofmt -d exits 1 when it prints a diff
+	out, err := exec.Command("gofmt", "-d", path).Output()
+	if err != nil && len(out) == 0 {
+		return "", fmt.Errorf("running gofmt -d %s: %w", filepath.Base(path), err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// Thresholds for the "already well-split" heuristic.
+const (
+	splitMinLines      = 300 // Below this a file is small enough to leave alone
+	splitMaxLines      = 800 // Above this a file should be split regardless
+	splitMaxTypeGroups = 3   // Types with their own methods that warrant separate files
+	refactorFuncLines  = 100 // A function this long needs refactoring, not a file split
+)
+
+// isEmptyFile reports whether info declares nothing: no functions, types,
+// variables or constants, just a package clause, imports and comments.
+func isEmptyFile(info *analyzer.FileInfo) bool {
+	return len(info.Functions) == 0 && len(info.Types) == 0 && len(info.Vars) == 0
+}
+
+// splitVerdict is the heuristic judgement on whether a file needs splitting.
+type splitVerdict struct {
+	Recommended bool
+	Reason      string
+}
+
+// assessSplit judges from size, largest function and type cohesion whether
+// info is worth splitting. It is deliberately conservative: only files that
+// are clearly fine are reported as not needing a split.
+func assessSplit(info *analyzer.FileInfo) splitVerdict {
+	methodTypes := make(map[string]bool)
+	var largest analyzer.FuncInfo
+	for _, fn := range info.Functions {
+		if fn.Receiver != "" {
+			methodTypes[fn.ReceiverType()] = true
+		}
+		if fn.EndLine-fn.Line > largest.EndLine-largest.Line {
+			largest = fn
+		}
+	}
+	largestLines := largest.EndLine - largest.Line + 1
+
+	switch {
+	case info.Lines > splitMaxLines:
+		return splitVerdict{true, fmt.Sprintf("%d lines exceeds %d", info.Lines, splitMaxLines)}
+	case info.Lines >= splitMinLines && len(methodTypes) >= splitMaxTypeGroups:
+		return splitVerdict{true, fmt.Sprintf("%d types with their own methods could live in separate files", len(methodTypes))}
+	case info.Lines >= splitMinLines && len(methodTypes) <= 1 && largestLines >= refactorFuncLines:
+		// One cohesive unit made long by a single function
+		return splitVerdict{false, fmt.Sprintf("%s is %d lines; refactor it rather than splitting the file", largest.Name, largestLines)}
+	case info.Lines < splitMinLines:
+		return splitVerdict{false, fmt.Sprintf("%d lines is small enough to keep in one file", info.Lines)}
+	}
+	return splitVerdict{true, fmt.Sprintf("%d lines across %d types and %d functions", info.Lines, len(info.Types), len(info.Functions))}
+}
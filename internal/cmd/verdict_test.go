@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+func TestAssessSplit(t *testing.T) {
+	fn := func(name, recv string, line, end int) analyzer.FuncInfo {
+		return analyzer.FuncInfo{Name: name, Receiver: recv, Line: line, EndLine: end}
+	}
+
+	tests := []struct {
+		name string
+		info analyzer.FileInfo
+		want bool
+	}{
+		{"small file", analyzer.FileInfo{Lines: 120, Functions: []analyzer.FuncInfo{fn("a", "", 1, 20)}}, false},
+		{"huge file", analyzer.FileInfo{Lines: 1200}, true},
+		{"many types with methods", analyzer.FileInfo{Lines: 400, Functions: []analyzer.FuncInfo{
+			fn("A", "*Client", 1, 10), fn("B", "Server", 11, 20), fn("C", "*Store", 21, 30),
+		}}, true},
+		{"one long function", analyzer.FileInfo{Lines: 400, Functions: []analyzer.FuncInfo{
+			fn("run", "", 10, 250), fn("helper", "", 260, 270),
+		}}, false},
+		{"mid-size mixed file", analyzer.FileInfo{Lines: 500, Functions: []analyzer.FuncInfo{
+			fn("A", "*Client", 1, 40), fn("B", "*Client", 41, 80), fn("c", "", 81, 120),
+		}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := assessSplit(&tt.info)
+			if got.Recommended != tt.want {
+				t.Errorf("assessSplit() = %+v, want Recommended=%v", got, tt.want)
+			}
+			if got.Reason == "" {
+				t.Error("assessSplit() gave no reason")
+			}
+		})
+	}
+}
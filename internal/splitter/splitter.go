@@ -0,0 +1,730 @@
+// Package splitter splits Go source files deterministically, without AI.
+package splitter
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aaronlippold/go-split/internal/analyzer"
+)
+
+// File is one output file of a split.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// importSpec is a single import of the source file.
+type importSpec struct {
+	Path  string // import path
+	Local string // name the file refers to it by
+	Text  string // spec as written, including any alias
+	Group int    // blank-line separated group in the original imports
+}
+
+// decl is a top-level declaration with its source text.
+type decl struct {
+	node    ast.Decl
+	text    string          // including its doc comment
+	lines   int             // lines spanned by text
+	imports map[string]bool // import paths used by the declaration
+}
+
+// source is a parsed input file ready to be distributed across outputs.
+type source struct {
+	base        string // file name without .go
+	header      []byte // everything up to and including the package clause
+	imports     []importSpec
+	sideEffects []string // blank and dot imports, kept with the first output
+	decls       []decl
+	comments    []*ast.CommentGroup
+}
+
+// parseSource parses src and splits it into header, imports and top-level
+// declarations.
+func parseSource(filename string, src []byte) (*source, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	offset := func(p token.Pos) int { return fset.Position(p).Offset }
+
+	s := &source{
+		base:    strings.TrimSuffix(filepath.Base(filename), ".go"),
+		header:  src[:offset(file.Name.End())],
+		imports: collectImports(fset, file),
+	}
+	s.comments = file.Comments
+	named := make(map[string]bool) // Paths imported under a name
+	for _, imp := range s.imports {
+		if imp.Local == "_" || imp.Local == "." {
+			s.sideEffects = append(s.sideEffects, imp.Path)
+			continue
+		}
+		named[imp.Path] = true
+	}
+
+	// Comments outside any declaration travel with a neighbour: trailing
+	// comments on a declaration's last line and comments after the last
+	// declaration with the one before, floating comments between
+	// declarations with the one after. Only comments around imports are
+	// dropped, as the import blocks are rebuilt per file.
+	comments := file.Comments
+	var prevEnd token.Pos = file.Name.End()
+	var last *decl
+	for _, d := range file.Decls {
+		end := trailingEnd(fset, d.End(), comments)
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			prevEnd = end
+			continue
+		}
+		start := d.Pos()
+		switch x := d.(type) {
+		case *ast.GenDecl:
+			if x.Doc != nil {
+				start = x.Doc.Pos()
+			}
+		case *ast.FuncDecl:
+			if x.Doc != nil {
+				start = x.Doc.Pos()
+			}
+		}
+		for _, c := range comments {
+			if c.Pos() >= prevEnd && c.Pos() < start {
+				start = c.Pos()
+				break
+			}
+		}
+		prevEnd = end
+
+		// Dot imports go with the side effects: names from the package's
+		// other files would make every declaration look like a user.
+		used := make(map[string]bool)
+		for _, p := range analyzer.DeclImports(file, d) {
+			if named[p] {
+				used[p] = true
+			}
+		}
+		s.decls = append(s.decls, decl{
+			node:    d,
+			text:    string(src[offset(start):offset(end)]),
+			lines:   fset.Position(end).Line - fset.Position(start).Line + 1,
+			imports: used,
+		})
+		last = &s.decls[len(s.decls)-1]
+	}
+
+	if last != nil && len(comments) > 0 {
+		if tail := comments[len(comments)-1]; tail.Pos() >= prevEnd {
+			last.text += string(src[offset(prevEnd):offset(tail.End())])
+			last.lines += fset.Position(tail.End()).Line - fset.Position(prevEnd).Line
+		}
+	}
+	return s, nil
+}
+
+// trailingEnd extends end past any comments that start on its line, so
+// "}  // end Foo" keeps its comment.
+func trailingEnd(fset *token.FileSet, end token.Pos, comments []*ast.CommentGroup) token.Pos {
+	line := fset.Position(end).Line
+	for _, c := range comments {
+		if c.Pos() >= end && fset.Position(c.Pos()).Line == line {
+			end = c.End()
+		}
+	}
+	return end
+}
+
+// build renders the output files: dest[i] names the file for s.decls[i] and
+// order lists the files to emit. order[0] is the source's own file and is
+// always emitted, a package clause alone if everything moved out, so that
+// writing the split replaces the original; other files left without
+// declarations are skipped.
+func (s *source) build(order, dest []string) ([]File, error) {
+	byFile := make(map[string][]int)
+	for i, name := range dest {
+		byFile[name] = append(byFile[name], i)
+	}
+
+	var files []File
+	for _, name := range order {
+		idx := byFile[name]
+		if len(idx) == 0 && len(files) > 0 {
+			continue
+		}
+		used := make(map[string]bool)
+		if len(files) == 0 {
+			for _, p := range s.sideEffects {
+				used[p] = true
+			}
+		}
+		texts := make([]string, 0, len(idx))
+		for _, i := range idx {
+			texts = append(texts, s.decls[i].text)
+			for p := range s.decls[i].imports {
+				used[p] = true
+			}
+		}
+		content, err := render(s.header, s.imports, used, texts)
+		if err != nil {
+			return nil, fmt.Errorf("formatting %s: %w", name, err)
+		}
+		files = append(files, File{Name: name, Content: content})
+	}
+	return files, nil
+}
+
+// ByTypeOptions adjusts how ByType routes declarations.
+type ByTypeOptions struct {
+	// HelpersFile, if set, receives every function without a receiver,
+	// constructors and init included, instead of <base>_helpers.go.
+	HelpersFile string
+	// FuncsFile, if set, names the file for the functions that are neither
+	// methods, constructors nor init, instead of <base>_helpers.go. It is
+	// ignored with HelpersFile or when it names the source file.
+	FuncsFile string
+	// Keep lists types too small for a file of their own; they stay in
+	// <base>.go with their methods and constructors.
+	Keep []string
+}
+
+// ByType splits the Go file filename (with content src) by type. Each type
+// declared on its own and not in opts.Keep, together with its methods and
+// New<Type>/new<Type> constructors, goes to <base>_<type>.go; the remaining functions go to
+// <base>_helpers.go; variables, constants, init functions and grouped type
+// blocks (with their methods) stay in <base>.go. Declarations keep their
+// source order and doc comments, every file repeats the package clause and
+// package doc, and imports are pruned to those each file uses.
+func ByType(filename string, src []byte, opts ByTypeOptions) ([]File, error) {
+	s, err := parseSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	primary := s.base + ".go"
+	helpers := s.base + "_helpers.go"
+	if opts.FuncsFile != "" && opts.FuncsFile != primary {
+		helpers = opts.FuncsFile
+	}
+	if opts.HelpersFile != "" {
+		if opts.HelpersFile == primary {
+			return nil, fmt.Errorf("helpers file %s is the source file itself", opts.HelpersFile)
+		}
+		helpers = opts.HelpersFile
+	}
+
+	keep := make(map[string]bool)
+	for _, name := range opts.Keep {
+		keep[name] = true
+	}
+
+	// Types declared on their own get a file; grouped blocks stay put
+	typeFiles := make(map[string]string)
+	for _, d := range s.decls {
+		gd, ok := d.node.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			name := spec.(*ast.TypeSpec).Name.Name
+			if len(gd.Specs) == 1 && !keep[name] {
+				typeFiles[name] = typeFileName(s.base, name)
+			} else {
+				typeFiles[name] = primary
+			}
+		}
+	}
+
+	// Primary first, then type files in source order, helpers last
+	order := []string{primary}
+	seen := map[string]bool{primary: true, helpers: true}
+	dest := make([]string, len(s.decls))
+	for i, d := range s.decls {
+		switch x := d.node.(type) {
+		case *ast.GenDecl:
+			dest[i] = primary
+			if x.Tok == token.TYPE && len(x.Specs) == 1 {
+				dest[i] = typeFiles[x.Specs[0].(*ast.TypeSpec).Name.Name]
+			}
+		case *ast.FuncDecl:
+			dest[i] = funcFile(x, s.base, primary, helpers, typeFiles)
+			if x.Recv == nil && opts.HelpersFile != "" {
+				dest[i] = helpers
+			}
+		}
+		if !seen[dest[i]] {
+			seen[dest[i]] = true
+			order = append(order, dest[i])
+		}
+	}
+	return s.build(append(order, helpers), dest)
+}
+
+// Even packs declarations, in source order, into files of at most maxLines
+// declaration lines each: the first stays in <base>.go, replacing the
+// source, and the rest go to <base>_part2.go, <base>_part3.go, ... A
+// declaration is never split; one longer than maxLines gets a file to
+// itself.
+func Even(filename string, src []byte, maxLines int) ([]File, error) {
+	if maxLines <= 0 {
+		return nil, fmt.Errorf("line budget must be positive, got %d", maxLines)
+	}
+	s, err := parseSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var order []string
+	dest := make([]string, len(s.decls))
+	used := 0
+	for i, d := range s.decls {
+		// Declarations are separated by a blank line
+		need := d.lines
+		if used > 0 {
+			need++
+		}
+		if len(order) == 0 || used+need > maxLines {
+			name := s.base + ".go"
+			if len(order) > 0 {
+				name = fmt.Sprintf("%s_part%d.go", s.base, len(order)+1)
+			}
+			order = append(order, name)
+			used, need = 0, d.lines
+		}
+		dest[i] = order[len(order)-1]
+		used += need
+	}
+	return s.build(order, dest)
+}
+
+// Exported moves the exported declarations of filename (with content src)
+// to apiFile, leaving everything unexported in the source file: exported
+// functions and types, exported methods of exported types, and var, const
+// and type blocks declaring any exported name (a block moves whole).
+// Declarations keep their source order and doc comments and imports are
+// pruned to those each file uses.
+func Exported(filename string, src []byte, apiFile string) ([]File, error) {
+	s, err := parseSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	primary := s.base + ".go"
+	if apiFile == primary {
+		return nil, fmt.Errorf("API file %s is the source file itself", apiFile)
+	}
+
+	dest := make([]string, len(s.decls))
+	exported := 0
+	for i, d := range s.decls {
+		dest[i] = primary
+		if exportedDecl(d.node) {
+			dest[i] = apiFile
+			exported++
+		}
+	}
+	switch exported {
+	case 0:
+		return nil, fmt.Errorf("%s has no exported declarations", filename)
+	case len(s.decls):
+		return nil, fmt.Errorf("every declaration in %s is exported; nothing would stay behind", filename)
+	}
+	return s.build([]string{primary, apiFile}, dest)
+}
+
+// DefaultSectionPattern matches common section divider comments such as
+// "// --- Handlers ---", "// ==== Handlers ====" and "// MARK: - Handlers".
+// The first non-empty capture group names the section.
+const DefaultSectionPattern = `^//\s*(?:MARK:\s*-?\s*(.+?)|[-=*#]{3,}\s*(.+?)\s*[-=*#]*)\s*$`
+
+// BySection splits the Go file filename (with content src) at top-level
+// comments matching divider, one file per section: <base>_<section>.go,
+// named after the first non-empty capture group of divider (or the comment
+// text if it has none). Declarations before the first divider stay in
+// <base>.go. The divider comment travels with the first declaration of its
+// section, and sections with the same name share a file.
+func BySection(filename string, src []byte, divider *regexp.Regexp) ([]File, error) {
+	s, err := parseSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	primary := s.base + ".go"
+
+	// Dividers inside a declaration (say, in a function body) don't count
+	type section struct {
+		pos  token.Pos
+		file string
+	}
+	var sections []section
+	for _, cg := range s.comments {
+		for _, c := range cg.List {
+			m := divider.FindStringSubmatch(c.Text)
+			if m == nil || insideDecl(c.Pos(), s.decls) {
+				continue
+			}
+			name := strings.Trim(strings.TrimPrefix(c.Text, "//"), " -=*#/")
+			for _, g := range m[1:] {
+				if g != "" {
+					name = g
+					break
+				}
+			}
+			file := fmt.Sprintf("%s_section%d.go", s.base, len(sections)+1)
+			if slug := sectionSlug(name); slug != "" {
+				file = s.base + "_" + slug + ".go"
+			}
+			sections = append(sections, section{c.Pos(), file})
+		}
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("%s has no section divider comments matching %s", filename, divider)
+	}
+
+	order := []string{primary}
+	seen := map[string]bool{primary: true}
+	dest := make([]string, len(s.decls))
+	for i, d := range s.decls {
+		dest[i] = primary
+		for _, sec := range sections {
+			if sec.pos < d.node.Pos() {
+				dest[i] = sec.file
+			}
+		}
+		if !seen[dest[i]] {
+			seen[dest[i]] = true
+			order = append(order, dest[i])
+		}
+	}
+	if len(order) == 1 || (len(order) == 2 && dest[0] != primary) {
+		return nil, fmt.Errorf("%s has a single section; nothing to split", filename)
+	}
+	return s.build(order, dest)
+}
+
+// ByOutline splits the Go file filename (with content src) as outline
+// says: it maps each output file name to the symbols that go there, named
+// as functions, types, variables and constants are declared and methods as
+// "Type.Method". A type brings along the methods the outline doesn't place
+// elsewhere, and a var, const or type block moves whole, so names from one
+// block must share a file. Declarations the outline leaves out stay in
+// <base>.go and are returned in unassigned. Fails if the outline names a
+// symbol the source does not declare, or one symbol twice.
+func ByOutline(filename string, src []byte, outline map[string][]string) (files []File, unassigned []string, err error) {
+	s, err := parseSource(filename, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	primary := s.base + ".go"
+
+	index := make(map[string][]int)
+	for i, d := range s.decls {
+		for _, name := range declNames(d.node) {
+			index[name] = append(index[name], i)
+		}
+	}
+
+	targets := make([]string, 0, len(outline))
+	for name := range outline {
+		targets = append(targets, name)
+	}
+	sort.Strings(targets)
+
+	dest := make([]string, len(s.decls))
+	placedBy := make(map[string]string) // symbol -> file
+	var unknown []string
+	for _, file := range targets {
+		for _, sym := range outline[file] {
+			idx, ok := index[sym]
+			if !ok {
+				unknown = append(unknown, sym)
+				continue
+			}
+			if other, ok := placedBy[sym]; ok {
+				return nil, nil, fmt.Errorf("outline places %s in both %s and %s", sym, other, file)
+			}
+			placedBy[sym] = file
+			for _, i := range idx {
+				if dest[i] != "" && dest[i] != file {
+					return nil, nil, fmt.Errorf("%s is declared in one block with symbols placed in %s; it cannot go to %s", sym, dest[i], file)
+				}
+				dest[i] = file
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("outline names symbols %s does not declare: %s", filename, strings.Join(unknown, ", "))
+	}
+
+	// Methods follow their type unless placed themselves
+	for i, d := range s.decls {
+		fn, ok := d.node.(*ast.FuncDecl)
+		if !ok || dest[i] != "" || fn.Recv == nil || len(fn.Recv.List) == 0 {
+			continue
+		}
+		if file, ok := placedBy[receiverType(fn.Recv.List[0].Type)]; ok {
+			dest[i] = file
+		}
+	}
+	for i, d := range s.decls {
+		if dest[i] == "" {
+			dest[i] = primary
+			unassigned = append(unassigned, declNames(d.node)...)
+		}
+	}
+
+	order := []string{primary}
+	for _, file := range targets {
+		if file != primary {
+			order = append(order, file)
+		}
+	}
+	files, err = s.build(order, dest)
+	return files, unassigned, err
+}
+
+// declNames returns the symbols d declares, with methods as "Type.Method".
+func declNames(d ast.Decl) []string {
+	var names []string
+	switch x := d.(type) {
+	case *ast.FuncDecl:
+		if x.Recv != nil && len(x.Recv.List) > 0 {
+			return []string{receiverType(x.Recv.List[0].Type) + "." + x.Name.Name}
+		}
+		return []string{x.Name.Name}
+	case *ast.GenDecl:
+		for _, spec := range x.Specs {
+			switch sp := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, sp.Name.Name)
+			case *ast.ValueSpec:
+				for _, n := range sp.Names {
+					if n.Name != "_" {
+						names = append(names, n.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// insideDecl reports whether pos falls within one of decls, excluding the
+// comments leading up to it.
+func insideDecl(pos token.Pos, decls []decl) bool {
+	for _, d := range decls {
+		if pos >= d.node.Pos() && pos < d.node.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// sectionSlug turns a section title into a file name part ("HTTP
+// Handlers" → "http_handlers").
+func sectionSlug(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// exportedDecl reports whether d belongs to the package's exported API.
+func exportedDecl(d ast.Decl) bool {
+	switch x := d.(type) {
+	case *ast.FuncDecl:
+		if x.Recv != nil && len(x.Recv.List) > 0 {
+			return x.Name.IsExported() && ast.IsExported(receiverType(x.Recv.List[0].Type))
+		}
+		return x.Name.IsExported()
+	case *ast.GenDecl:
+		for _, spec := range x.Specs {
+			switch sp := spec.(type) {
+			case *ast.TypeSpec:
+				if sp.Name.IsExported() {
+					return true
+				}
+			case *ast.ValueSpec:
+				for _, n := range sp.Names {
+					if n.IsExported() {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// funcFile returns the output file for a function: its receiver's type file
+// for methods, the type file for constructors, the primary file for init
+// and helpers otherwise.
+func funcFile(fn *ast.FuncDecl, base, primary, helpers string, typeFiles map[string]string) string {
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := receiverType(fn.Recv.List[0].Type)
+		if f, ok := typeFiles[recv]; ok {
+			return f
+		}
+		return typeFileName(base, recv)
+	}
+
+	name := fn.Name.Name
+	if name == "init" {
+		return primary
+	}
+	for _, prefix := range []string{"New", "new"} {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		for _, t := range []string{rest, lowerFirst(rest)} {
+			if f, ok := typeFiles[t]; ok {
+				return f
+			}
+		}
+	}
+	return helpers
+}
+
+// receiverType returns the base type name of a method receiver expression.
+func receiverType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(t.X)
+	case *ast.ParenExpr:
+		return receiverType(t.X)
+	case *ast.IndexExpr:
+		return receiverType(t.X)
+	case *ast.IndexListExpr:
+		return receiverType(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// typeFileName returns the output file for a type. A type named after the
+// source file itself shares the primary file.
+func typeFileName(base, typeName string) string {
+	snake := toSnake(typeName)
+	if snake == base {
+		return base + ".go"
+	}
+	return base + "_" + snake + ".go"
+}
+
+// collectImports returns the imports of file in source order, numbering
+// the groups they were written in: a blank line or a new import
+// declaration starts a group.
+func collectImports(fset *token.FileSet, file *ast.File) []importSpec {
+	var imports []importSpec
+	group, prevLine := -1, 0
+	for _, d := range file.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		for i, sp := range gd.Specs {
+			imp := sp.(*ast.ImportSpec)
+			line := fset.Position(imp.Pos()).Line
+			if i == 0 || line > prevLine+1 {
+				group++
+			}
+			prevLine = fset.Position(imp.End()).Line
+
+			p, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			spec := importSpec{Path: p, Local: analyzer.ImportName(p), Text: imp.Path.Value, Group: group}
+			if imp.Name != nil {
+				spec.Local = imp.Name.Name
+				spec.Text = imp.Name.Name + " " + imp.Path.Value
+			}
+			imports = append(imports, spec)
+		}
+	}
+	return imports
+}
+
+// render assembles and formats one output file from the declaration texts
+// and the imports in used. Imports keep the grouping of the original file
+// (typically stdlib, third-party, local), with groups left empty dropped.
+func render(header []byte, imports []importSpec, used map[string]bool, decls []string) ([]byte, error) {
+	var groups [][]string
+	last := -1
+	count := 0
+	for _, imp := range imports {
+		if !used[imp.Path] {
+			continue
+		}
+		if imp.Group != last {
+			groups = append(groups, nil)
+			last = imp.Group
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], imp.Text)
+		count++
+	}
+
+	var b bytes.Buffer
+	b.Write(header)
+	b.WriteString("\n\n")
+	switch {
+	case count == 1:
+		b.WriteString("import " + groups[0][0] + "\n\n")
+	case count > 1:
+		b.WriteString("import (\n")
+		for i, group := range groups {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			for _, s := range group {
+				b.WriteString("\t" + s + "\n")
+			}
+		}
+		b.WriteString(")\n\n")
+	}
+	b.WriteString(strings.Join(decls, "\n\n"))
+	b.WriteString("\n")
+
+	return format.Source(b.Bytes())
+}
+
+// toSnake converts a Go identifier to snake_case, keeping initialisms
+// together ("HTTPClient" → "http_client").
+func toSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
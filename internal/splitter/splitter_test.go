@@ -0,0 +1,633 @@
+package splitter_test
+
+import (
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aaronlippold/go-split/internal/splitter"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+const goldenDir = "../../testdata/golden"
+
+func TestByType_Golden(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join(goldenDir, "label_input.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := splitter.ByType("label.go", src, splitter.ByTypeOptions{})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	var names []string
+	var helpers []byte
+	for _, f := range files {
+		names = append(names, f.Name)
+		if f.Name == "label_helpers.go" {
+			helpers = f.Content
+		}
+	}
+	if got := strings.Join(names, ","); got != "label.go,label_helpers.go" {
+		t.Fatalf("files = %s, want label.go,label_helpers.go", got)
+	}
+
+	golden := filepath.Join(goldenDir, "label_output_helpers.go")
+	if *update {
+		if err := os.WriteFile(golden, helpers, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(helpers) != string(want) {
+		t.Errorf("label_helpers.go does not match %s (run with -update to regenerate)\ngot:\n%s\nwant:\n%s", golden, helpers, want)
+	}
+}
+
+func TestByType_Types(t *testing.T) {
+	src := `// Package store keeps things.
+package store
+
+import (
+	"fmt"
+	"strings"
+)
+
+const limit = 10
+
+// HTTPClient talks to the server.
+type HTTPClient struct{ base string }
+
+// NewHTTPClient returns a client for base.
+func NewHTTPClient(base string) *HTTPClient { return &HTTPClient{base: base} }
+
+func (c *HTTPClient) URL(p string) string { return fmt.Sprintf("%s/%s", c.base, p) }
+
+type (
+	ID   string
+	Name string
+)
+
+func (n Name) Upper() Name { return Name(strings.ToUpper(string(n))) }
+
+func clean(s string) string { return strings.TrimSpace(s) }
+`
+	files, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+		names = append(names, f.Name)
+	}
+	if want := "store.go,store_http_client.go,store_helpers.go"; strings.Join(names, ",") != want {
+		t.Fatalf("files = %v, want %s", names, want)
+	}
+
+	client := got["store_http_client.go"]
+	for _, want := range []string{"// Package store keeps things.\npackage store", "import \"fmt\"", "// NewHTTPClient returns", "func (c *HTTPClient) URL"} {
+		if !strings.Contains(client, want) {
+			t.Errorf("store_http_client.go missing %q:\n%s", want, client)
+		}
+	}
+	if strings.Contains(client, "strings") {
+		t.Errorf("store_http_client.go kept unused import:\n%s", client)
+	}
+	if primary := got["store.go"]; !strings.Contains(primary, "const limit") || !strings.Contains(primary, "func (n Name) Upper") {
+		t.Errorf("store.go missing constants or grouped type methods:\n%s", primary)
+	}
+	if helpers := got["store_helpers.go"]; !strings.Contains(helpers, "func clean") {
+		t.Errorf("store_helpers.go missing clean:\n%s", helpers)
+	}
+}
+
+func TestByType_Generics(t *testing.T) {
+	src := `package cache
+
+// Cache maps keys to values.
+type Cache[K comparable, V any] struct {
+	items map[K]V
+}
+
+// NewCache returns an empty cache.
+func NewCache[K comparable, V any]() *Cache[K, V] {
+	return &Cache[K, V]{items: map[K]V{}}
+}
+
+func (c *Cache[K, V]) Get(k K) V { return c.items[k] }
+
+func (c Cache[_, _]) Len() int { return len(c.items) }
+
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+func (p Pair[A, B]) Swap() Pair[B, A] { return Pair[B, A]{p.Second, p.First} }
+`
+	files, err := splitter.ByType("cache.go", []byte(src), splitter.ByTypeOptions{})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+	}
+	for name, wants := range map[string][]string{
+		"cache.go":      {"type Cache[K comparable, V any]", "func NewCache[K comparable, V any]()", "func (c *Cache[K, V]) Get", "func (c Cache[_, _]) Len"},
+		"cache_pair.go": {"type Pair[A, B any]", "func (p Pair[A, B]) Swap"},
+	} {
+		for _, want := range wants {
+			if !strings.Contains(got[name], want) {
+				t.Errorf("%s missing %q:\n%s", name, want, got[name])
+			}
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("files = %d, want cache.go and cache_pair.go", len(got))
+	}
+}
+
+func TestByType_HelpersFile(t *testing.T) {
+	src := `package store
+
+type Item struct{ name string }
+
+// NewItem returns an item.
+func TestByType_FuncsFile(t *testing.T) {
+	src := "package store\n\ntype Item struct{}\n\nfunc NewItem() Item { return Item{} }\n\nfunc init() {}\n\nfunc clean() {}\n"
+	files, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{FuncsFile: "helpers.go"})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+		names = append(names, f.Name)
+	}
+	// Only clean moves; the constructor and init are routed as usual
+	if want := "store.go,store_item.go,helpers.go"; strings.Join(names, ",") != want {
+		t.Fatalf("files = %v, want %s", names, want)
+	}
+	if !strings.Contains(got["helpers.go"], "func clean()") || !strings.Contains(got["store.go"], "func init()") || !strings.Contains(got["store_item.go"], "func NewItem()") {
+		t.Errorf("unexpected routing: %v", got)
+	}
+}
+
+func TestByType_HelpersFileIsSource(t *testing.T) {
+	src := "package store\n\ntype Item struct{}\n\nfunc clean() {}\n"
+	if _, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{HelpersFile: "store.go"}); err == nil {
+		t.Error("ByType() with the source as helpers file succeeded, want an error")
+	}
+}
+
+func NewItem(name string) *Item { return &Item{name: name} }
+
+func (i *Item) Name() string { return i.name }
+
+func init() {}
+
+func clean(s string) string { return s }
+`
+	files, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{HelpersFile: "helpers.go"})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+		names = append(names, f.Name)
+	}
+	if want := "store.go,store_item.go,helpers.go"; strings.Join(names, ",") != want {
+		t.Fatalf("files = %v, want %s", names, want)
+	}
+	// Everything moved out, but store.go is still rewritten
+	if want := "package store\n"; got["store.go"] != want {
+		t.Errorf("store.go = %q, want %q", got["store.go"], want)
+	}
+	for _, fn := range []string{"func NewItem(", "func init()", "func clean("} {
+		if !strings.Contains(got["helpers.go"], fn) {
+			t.Errorf("helpers.go missing %q:\n%s", fn, got["helpers.go"])
+		}
+	}
+	if item := got["store_item.go"]; !strings.Contains(item, "func (i *Item) Name()") || strings.Contains(item, "func NewItem(") {
+		t.Errorf("store_item.go should hold the type and methods only:\n%s", item)
+	}
+}
+
+func TestByType_Keep(t *testing.T) {
+	src := `package store
+
+type Item struct{ name string }
+
+func NewItem(name string) *Item { return &Item{name: name} }
+
+func (i *Item) Name() string { return i.name }
+
+type ID int
+
+func (id ID) Valid() bool { return id > 0 }
+`
+	files, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{Keep: []string{"ID"}})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+		names = append(names, f.Name)
+	}
+	if want := "store.go,store_item.go"; strings.Join(names, ",") != want {
+		t.Fatalf("files = %v, want %s", names, want)
+	}
+	if primary := got["store.go"]; !strings.Contains(primary, "type ID int") || !strings.Contains(primary, "func (id ID) Valid()") {
+		t.Errorf("store.go should keep ID and its method:\n%s", primary)
+	}
+}
+
+func TestByType_KeepsImportGroups(t *testing.T) {
+	src := `package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"example.com/store/internal/db"
+)
+
+type Item struct{}
+
+func (Item) Run(c *cobra.Command) string { return fmt.Sprint(db.Name, c.Use) }
+
+func clean(s string) string { return strings.TrimSpace(s) }
+`
+	files, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	want := map[string]string{
+		"store_item.go":    "import (\n\t\"fmt\"\n\n\t\"github.com/spf13/cobra\"\n\n\t\"example.com/store/internal/db\"\n)\n",
+		"store_helpers.go": "import \"strings\"\n",
+	}
+	for _, f := range files {
+		if w, ok := want[f.Name]; ok && !strings.Contains(string(f.Content), w) {
+			t.Errorf("%s imports not grouped as in the source:\n%s", f.Name, f.Content)
+		}
+	}
+}
+
+func TestEven(t *testing.T) {
+	src := `package calc
+
+import "strings"
+
+// Add adds.
+func Add(a, b int) int {
+	return a + b
+}
+
+func Sub(a, b int) int {
+	return a - b
+}
+
+func Upper(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.ToUpper(s)
+	return s
+}
+
+const Pi = 3.14
+`
+	files, err := splitter.Even("calc.go", []byte(src), 8)
+	if err != nil {
+		t.Fatalf("Even() error = %v", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	// Add (4 lines) + blank + Sub (3) fill calc.go; Upper (5) + blank + Pi (1) fill part2
+	if got := strings.Join(names, ","); got != "calc.go,calc_part2.go" {
+		t.Fatalf("files = %s, want calc.go,calc_part2.go", got)
+	}
+	if part1 := string(files[0].Content); strings.Contains(part1, "strings") || !strings.Contains(part1, "// Add adds.") {
+		t.Errorf("part1 imports or docs wrong:\n%s", part1)
+	}
+	if part2 := string(files[1].Content); !strings.Contains(part2, `import "strings"`) || !strings.Contains(part2, "const Pi") {
+		t.Errorf("part2 missing import or Pi:\n%s", part2)
+	}
+
+	if _, err := splitter.Even("calc.go", []byte(src), 0); err == nil {
+		t.Error("Even() with zero budget should fail")
+	}
+}
+
+// TestByType_PreservesComments checks that no comment is lost or moved
+// away from its declaration: every file must match its golden copy, and
+// every declaration-level comment of the input must appear in exactly one
+// output.
+func TestBySection(t *testing.T) {
+	src := `package app
+
+import (
+	"fmt"
+	"net/http"
+)
+
+var version = "1"
+
+// --- Handlers ---
+
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	// ---- not a divider ----
+	fmt.Fprint(w, version)
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {}
+
+// MARK: - Formatting
+
+func format(s string) string { return fmt.Sprintf("[%s]", s) }
+`
+	files, err := splitter.BySection("app.go", []byte(src), regexp.MustCompile(splitter.DefaultSectionPattern))
+	if err != nil {
+		t.Fatalf("BySection() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+		got[f.Name] = string(f.Content)
+	}
+	if strings.Join(names, ",") != "app.go,app_handlers.go,app_formatting.go" {
+		t.Fatalf("files = %v, want app.go, app_handlers.go and app_formatting.go", names)
+	}
+	if !strings.Contains(got["app.go"], "var version") || strings.Contains(got["app.go"], "import") {
+		t.Errorf("app.go should hold only version:\n%s", got["app.go"])
+	}
+	handlers := got["app_handlers.go"]
+	if !strings.Contains(handlers, "// --- Handlers ---") || !strings.Contains(handlers, "handleHealth") || !strings.Contains(handlers, `"net/http"`) {
+		t.Errorf("app_handlers.go missing divider, handlers or imports:\n%s", handlers)
+	}
+	if f := got["app_formatting.go"]; !strings.Contains(f, "func format") || strings.Contains(f, "net/http") {
+		t.Errorf("app_formatting.go wrong:\n%s", f)
+	}
+
+	if _, err := splitter.BySection("app.go", []byte("package app\n\nfunc A() {}\n"), regexp.MustCompile(splitter.DefaultSectionPattern)); err == nil {
+		t.Error("BySection() without dividers should fail")
+	}
+}
+
+func TestByType_KeepsDirectives(t *testing.T) {
+	src := `package store
+
+type Client struct{ base string }
+
+// Fetch gets p.
+//
+//nolint:gocyclo // one switch per status code
+func (c *Client) Fetch(p string) string { return c.base + p }
+
+//go:noinline
+func clean(s string) string { return s }
+`
+	files, err := splitter.ByType("store.go", []byte(src), splitter.ByTypeOptions{})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+	}
+	if client := got["store_client.go"]; !strings.Contains(client, "//nolint:gocyclo // one switch per status code\nfunc (c *Client) Fetch") {
+		t.Errorf("store_client.go lost the //nolint directive:\n%s", client)
+	}
+	if helpers := got["store_helpers.go"]; !strings.Contains(helpers, "//go:noinline\nfunc clean") {
+		t.Errorf("store_helpers.go lost the //go: directive:\n%s", helpers)
+	}
+}
+
+func TestByOutline(t *testing.T) {
+	src := `package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	A = 1
+	B = 2
+)
+
+type Store struct{}
+
+func (s *Store) Get() string { return fmt.Sprint(A) }
+
+func (s *Store) Dump() string { return strings.Repeat("x", B) }
+
+func Parse(s string) string { return strings.TrimSpace(s) }
+
+func helper() {}
+`
+	files, unassigned, err := splitter.ByOutline("app.go", []byte(src), map[string][]string{
+		"store.go": {"Store", "A"},
+		"dump.go":  {"Store.Dump", "Parse"},
+	})
+	if err != nil {
+		t.Fatalf("ByOutline() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+		names = append(names, f.Name)
+	}
+	if want := "app.go,dump.go,store.go"; strings.Join(names, ",") != want {
+		t.Fatalf("files = %v, want %s", names, want)
+	}
+	if store := got["store.go"]; !strings.Contains(store, "B = 2") || !strings.Contains(store, "func (s *Store) Get()") || strings.Contains(store, "Dump") {
+		t.Errorf("store.go should hold the const block, Store and Get:\n%s", store)
+	}
+	if dump := got["dump.go"]; !strings.Contains(dump, "func (s *Store) Dump()") || strings.Contains(dump, "fmt") {
+		t.Errorf("dump.go wrong:\n%s", dump)
+	}
+	if want := []string{"helper"}; !slices.Equal(unassigned, want) {
+		t.Errorf("unassigned = %v, want %v", unassigned, want)
+	}
+
+	for name, outline := range map[string]map[string][]string{
+		"unknown symbol": {"x.go": {"Nope"}},
+		"placed twice":   {"x.go": {"Parse"}, "y.go": {"Parse"}},
+		"split block":    {"x.go": {"A"}, "y.go": {"B"}},
+	} {
+		if _, _, err := splitter.ByOutline("app.go", []byte(src), outline); err == nil {
+			t.Errorf("%s: ByOutline() succeeded", name)
+		}
+	}
+}
+
+func TestByType_PreservesComments(t *testing.T) {
+	input := filepath.Join(goldenDir, "comments_input.go")
+	src, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := splitter.ByType("ledger.go", src, splitter.ByTypeOptions{})
+	if err != nil {
+		t.Fatalf("ByType() error = %v", err)
+	}
+
+	fset := token.NewFileSet()
+	got := make(map[string]int)
+	for _, f := range files {
+		golden := filepath.Join(goldenDir, "comments_output_"+f.Name)
+		if *update {
+			if err := os.WriteFile(golden, f.Content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%s: %v (run with -update to create)", f.Name, err)
+		}
+		if string(f.Content) != string(want) {
+			t.Errorf("%s does not match %s (run with -update to regenerate)\ngot:\n%s\nwant:\n%s", f.Name, golden, f.Content, want)
+		}
+		out, err := parser.ParseFile(fset, f.Name, f.Content, parser.ParseComments)
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		for _, group := range out.Comments {
+			for _, c := range group.List {
+				got[c.Text]++
+			}
+		}
+	}
+
+	file, err := parser.ParseFile(fset, input, src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			want := 1
+			switch c.Text {
+			case "// Package ledger records entries.":
+				want = len(files) // the package doc heads every file
+			case "// formatting for String":
+				want = 0 // import blocks are rebuilt without comments
+			}
+			if n := got[c.Text]; n != want {
+				t.Errorf("comment %q appears %d times in the output, want %d", c.Text, n, want)
+			}
+		}
+	}
+}
+
+func TestExported(t *testing.T) {
+	src := `package store
+
+import "strings"
+
+// Item is a stored item.
+type Item struct{ name string }
+
+type index map[string]*Item
+
+// Limit caps the store size.
+const Limit = 10
+
+var cache = index{}
+
+// NewItem returns an item.
+func NewItem(name string) *Item { return &Item{name: clean(name)} }
+
+// Name returns the item name.
+func (i *Item) Name() string { return i.name }
+
+func (i *Item) key() string { return strings.ToLower(i.name) }
+
+func (x index) Get(k string) *Item { return x[k] }
+
+func clean(s string) string { return strings.TrimSpace(s) }
+`
+	files, err := splitter.Exported("store.go", []byte(src), "api.go")
+	if err != nil {
+		t.Fatalf("Exported() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	var names []string
+	for _, f := range files {
+		got[f.Name] = string(f.Content)
+		names = append(names, f.Name)
+	}
+	if want := "store.go,api.go"; strings.Join(names, ",") != want {
+		t.Fatalf("files = %v, want %s", names, want)
+	}
+	for _, d := range []string{"type Item struct", "const Limit", "func NewItem(", "func (i *Item) Name()"} {
+		if !strings.Contains(got["api.go"], d) {
+			t.Errorf("api.go missing %q:\n%s", d, got["api.go"])
+		}
+	}
+	for _, d := range []string{"type index", "var cache", "func (i *Item) key()", "func (x index) Get(", "func clean("} {
+		if !strings.Contains(got["store.go"], d) {
+			t.Errorf("store.go missing %q:\n%s", d, got["store.go"])
+		}
+	}
+	if strings.Contains(got["api.go"], `"strings"`) {
+		t.Errorf("api.go should not import strings:\n%s", got["api.go"])
+	}
+
+	// The two files must still compile together
+	fset := token.NewFileSet()
+	var parsed []*ast.File
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, name, got[name], 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		parsed = append(parsed, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("store", fset, parsed, nil); err != nil {
+		t.Errorf("split does not type-check: %v", err)
+	}
+
+	if _, err := splitter.Exported("store.go", []byte("package store\n\nfunc clean() {}\n"), "api.go"); err == nil {
+		t.Error("Exported() with nothing exported should fail")
+	}
+}
@@ -0,0 +1,33 @@
+// Package ledger records entries.
+package ledger
+
+import (
+	"fmt" // formatting for String
+	"strings"
+)
+
+// maxEntries caps a ledger.
+const maxEntries = 100 // keep small for tests
+
+// ---- Entries ----
+
+// Entry is one line in the ledger.
+type Entry struct {
+	Amount int    // in cents
+	Memo   string // free text
+}
+
+// String renders the entry.
+func (e Entry) String() string {
+	// Cents are shown as a decimal
+	return fmt.Sprintf("%d.%02d %s", e.Amount/100, e.Amount%100, e.Memo)
+} // String
+
+// NOTE: parsing lives below so it can move to its own file later.
+
+// parseMemo normalizes a memo.
+func parseMemo(s string) string {
+	return strings.TrimSpace(s) /* trimmed */
+}
+
+// TODO: support currencies.
@@ -0,0 +1,5 @@
+// Package ledger records entries.
+package ledger
+
+// maxEntries caps a ledger.
+const maxEntries = 100 // keep small for tests
@@ -0,0 +1,18 @@
+// Package ledger records entries.
+package ledger
+
+import "fmt"
+
+// ---- Entries ----
+
+// Entry is one line in the ledger.
+type Entry struct {
+	Amount int    // in cents
+	Memo   string // free text
+}
+
+// String renders the entry.
+func (e Entry) String() string {
+	// Cents are shown as a decimal
+	return fmt.Sprintf("%d.%02d %s", e.Amount/100, e.Amount%100, e.Memo)
+} // String
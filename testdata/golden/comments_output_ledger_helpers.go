@@ -0,0 +1,13 @@
+// Package ledger records entries.
+package ledger
+
+import "strings"
+
+// NOTE: parsing lives below so it can move to its own file later.
+
+// parseMemo normalizes a memo.
+func parseMemo(s string) string {
+	return strings.TrimSpace(s) /* trimmed */
+}
+
+// TODO: support currencies.
@@ -30,4 +30,4 @@ func parseLabelArgs(args []string) (issueIDs []string, label string) {
 	label = args[len(args)-1]
 	issueIDs = args[:len(args)-1]
 	return
-}
\ No newline at end of file
+}